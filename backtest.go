@@ -0,0 +1,686 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/dzakyputra/binance/indicators"
+)
+
+// BacktestSettings are the knobs of one backtest run. Strategy produces the
+// entries and Trading carries the same tunables the live bot reads from its
+// strategy config. When set, From and To limit trading to bars closing in
+// [From, To); earlier candles still feed the screening windows.
+type BacktestSettings struct {
+	StartingBalance float64
+	FeeRate         float64
+	Trading         TradingConfig
+	Strategy        Strategy
+	From            time.Time
+	To              time.Time
+}
+
+type BacktestTrade struct {
+	Symbol     string
+	Signal     string
+	EntryTime  time.Time
+	ExitTime   time.Time
+	EntryPrice float64
+	ExitPrice  float64
+	Quantity   float64
+	Cost       float64
+	Proceeds   float64
+	Fees       float64
+	PnL        float64
+	ExitReason string
+
+	// TakeProfitPercent and Trailing are how the position exits: at a take
+	// profit or behind a trailing stop, whose High and Stop follow it. With
+	// a take-profit ladder every leg is a position of its own.
+	TakeProfitPercent float64
+	Trailing          bool
+	High              float64
+	Stop              float64
+}
+
+type EquityPoint struct {
+	Time      time.Time
+	Equity    float64
+	Positions int
+}
+
+type BacktestResult struct {
+	Settings     BacktestSettings
+	Trades       []BacktestTrade
+	Equity       []EquityPoint
+	FinalBalance float64
+}
+
+const (
+	EXIT_TAKE_PROFIT   = "take_profit"
+	EXIT_STOP_LOSS     = "stop_loss"
+	EXIT_TRAILING_STOP = "trailing_stop"
+	EXIT_FLATTEN       = "flatten"
+	EXIT_OPEN          = "open"
+)
+
+// runBacktest replays the klines bar by bar through the strategy's buy
+// signals. At every bar close it exits positions whose
+// take-profit or stop-loss the bar reached (stop first when both did), or
+// for trailing ones whose trailing stop it reached, then
+// buys the pairs that alerted on this bar and the previous one, with the
+// same minimum-alert, divider, per-trade cap and cooldown rules as
+// tradingLogic. Entries fill at the bar close and fees are charged in the
+// received asset.
+func runBacktest(klines map[string][]*binance.Kline, settings BacktestSettings) BacktestResult {
+	return replayBacktest(klines, screenKlines(klines, settings.Strategy, runtime.NumCPU()), settings)
+}
+
+// replayBacktest is runBacktest with the screening already done, so runs
+// that only differ in account settings or window can share it.
+func replayBacktest(klines map[string][]*binance.Kline, signals map[string]map[int64]Signal, settings BacktestSettings) BacktestResult {
+	trading := settings.Trading
+	result := BacktestResult{Settings: settings}
+
+	var symbols []string
+	times := make(map[int64]bool)
+	for symbol, candles := range klines {
+		symbols = append(symbols, symbol)
+		for _, k := range candles {
+			times[k.OpenTime] = true
+		}
+	}
+	sort.Strings(symbols)
+
+	var timeline []int64
+	for openTime := range times {
+		timeline = append(timeline, openTime)
+	}
+	sort.Slice(timeline, func(i, j int) bool { return timeline[i] < timeline[j] })
+
+	balance := settings.StartingBalance
+	positions := []*BacktestTrade{}
+	cooldowns := make(map[string][]time.Time)
+	lastAlertCoin := make(map[string]bool)
+	cursor := make(map[string]int)
+	lastClose := make(map[string]float64)
+	atr := make(map[string]*indicators.ATR)
+	sizingATR := make(map[string]*indicators.ATR)
+	returns := []float64{}
+
+	sizer, err := newSizer(trading)
+	if err != nil {
+		fmt.Println("[BACKTEST]", err)
+		return result
+	}
+
+	for _, openTime := range timeline {
+
+		// Advance every symbol to this bar
+		bars := make(map[string]*binance.Kline)
+		for _, symbol := range symbols {
+			i := cursor[symbol]
+			candles := klines[symbol]
+			if i < len(candles) && candles[i].OpenTime == openTime {
+				bars[symbol] = candles[i]
+				cursor[symbol] = i + 1
+			}
+		}
+
+		barTime := time.UnixMilli(openTime)
+		for _, symbol := range symbols {
+			if bar, exists := bars[symbol]; exists {
+				barTime = time.UnixMilli(bar.CloseTime)
+				break
+			}
+		}
+		if !settings.To.IsZero() && !barTime.Before(settings.To) {
+			break
+		}
+		if !settings.From.IsZero() && barTime.Before(settings.From) {
+			continue
+		}
+
+		for symbol, bar := range bars {
+			lastClose[symbol], _ = strconv.ParseFloat(bar.Close, 64)
+		}
+
+		// The trailing stops move, and the ATR mode sizes, with the ATR of
+		// the bars up to this one.
+		if trading.TrailingATRMultiple > 0 || trading.Sizing.Mode == SIZING_ATR {
+			for symbol, bar := range bars {
+				candle, err := candleFromKline(symbol, bar)
+				if err != nil {
+					continue
+				}
+				if trading.TrailingATRMultiple > 0 {
+					if atr[symbol] == nil {
+						atr[symbol] = indicators.NewATR(trading.TrailingATRPeriod)
+					}
+					atr[symbol].Update(candle.Bar())
+				}
+				if trading.Sizing.Mode == SIZING_ATR {
+					if sizingATR[symbol] == nil {
+						sizingATR[symbol] = indicators.NewATR(trading.Sizing.ATRPeriod)
+					}
+					sizingATR[symbol].Update(candle.Bar())
+				}
+			}
+		}
+
+		// Exits
+		remaining := positions[:0]
+		for _, position := range positions {
+			bar, exists := bars[position.Symbol]
+			if !exists {
+				remaining = append(remaining, position)
+				continue
+			}
+
+			open, _ := strconv.ParseFloat(bar.Open, 64)
+			high, _ := strconv.ParseFloat(bar.High, 64)
+			low, _ := strconv.ParseFloat(bar.Low, 64)
+			stopPrice := position.EntryPrice * (1 - trading.StopLossPercent/100)
+			takeProfitPrice := position.EntryPrice * (1 + position.TakeProfitPercent/100)
+
+			if position.Trailing {
+				// The stop standing before this bar decides the exit; only
+				// then does the bar's high move it up.
+				if low <= position.Stop {
+					exitPrice := math.Min(position.Stop, open)
+					balance += closeBacktestPosition(position, exitPrice, time.UnixMilli(bar.CloseTime), EXIT_TRAILING_STOP, settings.FeeRate)
+					result.Trades = append(result.Trades, *position)
+					continue
+				}
+				var symbolATR float64
+				if atr[position.Symbol] != nil {
+					symbolATR = atr[position.Symbol].Value()
+				}
+				position.High = math.Max(position.High, high)
+				position.Stop = raiseTrailingStop(trading, position.High, position.Stop, symbolATR)
+				remaining = append(remaining, position)
+				continue
+			}
+
+			switch {
+			case low <= stopPrice:
+				exitPrice := stopPrice
+				if open < stopPrice {
+					exitPrice = open
+				}
+				balance += closeBacktestPosition(position, exitPrice, time.UnixMilli(bar.CloseTime), EXIT_STOP_LOSS, settings.FeeRate)
+				result.Trades = append(result.Trades, *position)
+			case high >= takeProfitPrice:
+				exitPrice := takeProfitPrice
+				if open > takeProfitPrice {
+					exitPrice = open
+				}
+				balance += closeBacktestPosition(position, exitPrice, time.UnixMilli(bar.CloseTime), EXIT_TAKE_PROFIT, settings.FeeRate)
+				result.Trades = append(result.Trades, *position)
+			default:
+				remaining = append(remaining, position)
+			}
+		}
+		positions = remaining
+
+		// Screening
+		upperSignals := make(map[string]Signal)
+		for _, symbol := range symbols {
+			if _, exists := bars[symbol]; !exists {
+				continue
+			}
+			if signal, exists := signals[symbol][openTime]; exists {
+				upperSignals[symbol] = signal
+			}
+		}
+
+		// Entries
+		var alerted []string
+		for symbol := range upperSignals {
+			if lastAlertCoin[symbol] {
+				alerted = append(alerted, symbol)
+			}
+		}
+		sort.Strings(alerted)
+
+		if balance > trading.MinimumBalance && len(alerted) > trading.MinAlertCoins {
+			maxDivider := len(alerted)
+			if len(alerted) >= 4 {
+				maxDivider = 4
+			} else if len(alerted) == 1 {
+				maxDivider = 2
+			}
+
+			// The Kelly mode sizes from the trades closed so far
+			for len(returns) < len(result.Trades) {
+				closed := result.Trades[len(returns)]
+				returns = append(returns, closed.PnL/closed.Cost)
+			}
+			account := SizingAccount{Free: balance, SymbolExposure: make(map[string]float64), History: returns}
+			for _, position := range positions {
+				account.Exposure += position.Cost
+				account.SymbolExposure[position.Symbol] += position.Cost
+			}
+
+			var i int
+			for _, symbol := range alerted {
+				if countCooldowns(cooldowns[symbol], barTime, trading.CooldownMinutes) >= 2 {
+					continue
+				}
+
+				price := upperSignals[symbol].Parameters.CurrentPrice
+				entry := SizingEntry{Symbol: symbol, Price: price, Slots: maxDivider}
+				if sizingATR[symbol] != nil {
+					entry.ATR = sizingATR[symbol].Value()
+				}
+				quote, err := sizePosition(sizer, trading, account, entry)
+				if err != nil {
+					continue
+				}
+
+				i++
+
+				quantity := quote / price
+				fee := quantity * settings.FeeRate
+				balance -= quote
+				account.Add(symbol, quote)
+
+				for _, leg := range backtestLegs(trading) {
+					share := leg.Percent / 100
+					positions = append(positions, &BacktestTrade{
+						Symbol:            symbol,
+						Signal:            upperSignals[symbol].Reason,
+						EntryTime:         barTime,
+						EntryPrice:        price,
+						Quantity:          (quantity - fee) * share,
+						Cost:              quote * share,
+						Fees:              fee * price * share,
+						TakeProfitPercent: leg.TakeProfitPercent,
+						Trailing:          leg.Trailing,
+						High:              price,
+						Stop:              initialTrailingStop(trading, price),
+					})
+				}
+				cooldowns[symbol] = append(cooldowns[symbol], barTime)
+
+				if i >= maxDivider {
+					break
+				}
+			}
+		}
+
+		lastAlertCoin = make(map[string]bool)
+		for symbol := range upperSignals {
+			lastAlertCoin[symbol] = true
+		}
+
+		// Equity
+		equity := balance
+		for _, position := range positions {
+			equity += position.Quantity * lastClose[position.Symbol]
+		}
+		result.Equity = append(result.Equity, EquityPoint{Time: barTime, Equity: equity, Positions: len(positions)})
+	}
+
+	// Mark what is still open at the last close
+	for _, position := range positions {
+		position.ExitTime = result.Equity[len(result.Equity)-1].Time
+		position.ExitPrice = lastClose[position.Symbol]
+		position.Proceeds = position.Quantity * position.ExitPrice
+		position.PnL = position.Proceeds - position.Cost
+		position.ExitReason = EXIT_OPEN
+		result.Trades = append(result.Trades, *position)
+		balance += position.Proceeds
+	}
+	result.FinalBalance = balance
+
+	return result
+}
+
+// screenKlines evaluates the strategy over every 300-candle window of every
+// symbol, keeping the buy signals by the open time of the window's last
+// candle. Screening does not depend on the account, so the symbols are done
+// in parallel before the replay.
+func screenKlines(klines map[string][]*binance.Kline, strategy Strategy, workers int) map[string]map[int64]Signal {
+	var wg sync.WaitGroup
+	var m sync.Mutex
+	semaphore := make(chan struct{}, workers)
+	result := make(map[string]map[int64]Signal)
+
+	for symbol, candles := range klines {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(symbol string, candles []*binance.Kline) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+
+			signals := make(map[int64]Signal)
+			for end := SCREENING_WINDOW; end <= len(candles); end++ {
+				for _, signal := range strategy.Evaluate(candles[end-SCREENING_WINDOW:end], binance.Symbol{Symbol: symbol}) {
+					if signal.Side == binance.SideTypeBuy {
+						signals[candles[end-1].OpenTime] = signal
+					}
+				}
+			}
+
+			m.Lock()
+			defer m.Unlock()
+			result[symbol] = signals
+		}(symbol, candles)
+	}
+
+	wg.Wait()
+
+	return result
+}
+
+// closeBacktestPosition fills the exit and returns the quote received.
+func closeBacktestPosition(position *BacktestTrade, price float64, at time.Time, reason string, feeRate float64) float64 {
+	gross := position.Quantity * price
+	fee := gross * feeRate
+
+	position.ExitTime = at
+	position.ExitPrice = price
+	position.Proceeds = gross - fee
+	position.Fees += fee
+	position.PnL = position.Proceeds - position.Cost
+	position.ExitReason = reason
+
+	return position.Proceeds
+}
+
+// backtestLegs are the exits of one entry: the legs of the take-profit
+// ladder, or a single one of the exit mode.
+func backtestLegs(trading TradingConfig) []LadderLeg {
+	if len(trading.TakeProfitLadder) > 0 {
+		return trading.TakeProfitLadder
+	}
+	return []LadderLeg{{
+		Percent:           100,
+		TakeProfitPercent: trading.TakeProfitPercent,
+		Trailing:          trading.ExitMode == EXIT_MODE_TRAILING,
+	}}
+}
+
+func countCooldowns(entries []time.Time, at time.Time, cooldownMinutes int) (total int) {
+	for _, entry := range entries {
+		if at.Sub(entry).Minutes() < float64(cooldownMinutes) {
+			total++
+		}
+	}
+	return total
+}
+
+// readKlinesDir loads every *.csv under dir. The symbol is the file name up
+// to the first "-" or ".", so both BTCUSDT.csv and Binance's
+// BTCUSDT-15m-2024-01.csv work; files of the same symbol are merged.
+func readKlinesDir(dir string) (map[string][]*binance.Kline, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.csv"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .csv files in %s", dir)
+	}
+
+	result := make(map[string][]*binance.Kline)
+	for _, file := range files {
+		name := filepath.Base(file)
+		symbol := strings.ToUpper(strings.FieldsFunc(name, func(r rune) bool { return r == '-' || r == '.' })[0])
+
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		klines, err := readKlinesCSV(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+
+		result[symbol] = append(result[symbol], klines...)
+	}
+
+	for symbol, klines := range result {
+		result[symbol] = sortUniqueKlines(klines)
+	}
+	return result, nil
+}
+
+// readKlinesCSV parses Binance's kline dump columns: open time, open, high,
+// low, close, volume, close time, quote volume, trades, taker buy base
+// volume, taker buy quote volume. A header row is skipped and microsecond
+// timestamps (used by the dumps since 2025) are converted to milliseconds.
+func readKlinesCSV(r io.Reader) ([]*binance.Kline, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	var result []*binance.Kline
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 11 {
+			return nil, fmt.Errorf("line %d: expected at least 11 columns, got %d", line, len(record))
+		}
+
+		openTime, err := strconv.ParseInt(record[0], 10, 64)
+		if err != nil {
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: open time %q is not a number", line, record[0])
+		}
+		closeTime, _ := strconv.ParseInt(record[6], 10, 64)
+		tradeNum, _ := strconv.ParseInt(record[8], 10, 64)
+		if openTime > 1e14 {
+			openTime /= 1000
+			closeTime /= 1000
+		}
+
+		result = append(result, &binance.Kline{
+			OpenTime:                 openTime,
+			Open:                     record[1],
+			High:                     record[2],
+			Low:                      record[3],
+			Close:                    record[4],
+			Volume:                   record[5],
+			CloseTime:                closeTime,
+			QuoteAssetVolume:         record[7],
+			TradeNum:                 tradeNum,
+			TakerBuyBaseAssetVolume:  record[9],
+			TakerBuyQuoteAssetVolume: record[10],
+		})
+	}
+
+	return result, nil
+}
+
+func writeKlinesCSV(w io.Writer, klines []*binance.Kline) error {
+	writer := csv.NewWriter(w)
+	for _, k := range klines {
+		err := writer.Write([]string{
+			strconv.FormatInt(k.OpenTime, 10), k.Open, k.High, k.Low, k.Close, k.Volume,
+			strconv.FormatInt(k.CloseTime, 10), k.QuoteAssetVolume, strconv.FormatInt(k.TradeNum, 10),
+			k.TakerBuyBaseAssetVolume, k.TakerBuyQuoteAssetVolume, "0",
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func sortUniqueKlines(klines []*binance.Kline) []*binance.Kline {
+	sort.SliceStable(klines, func(i, j int) bool { return klines[i].OpenTime < klines[j].OpenTime })
+
+	result := klines[:0]
+	for _, k := range klines {
+		if len(result) > 0 && result[len(result)-1].OpenTime == k.OpenTime {
+			result[len(result)-1] = k
+			continue
+		}
+		result = append(result, k)
+	}
+	return result
+}
+
+// readKlinesStore loads every symbol's 15m candles from a candle store.
+func readKlinesStore(path string) (map[string][]*binance.Kline, error) {
+	store, err := openCandleStore(path)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	symbols, err := store.Symbols(KLINE_INTERVAL)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string][]*binance.Kline)
+	for _, symbol := range symbols {
+		klines, err := store.Range(symbol, KLINE_INTERVAL, 0, math.MaxInt64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", symbol, err)
+		}
+		result[symbol] = klines
+	}
+	return result, nil
+}
+
+func runBacktestCommand(args []string) error {
+	flags := flag.NewFlagSet("backtest", flag.ContinueOnError)
+	dataDir := flags.String("data", "data", "directory with 15m kline CSV files")
+	candlesPath := flags.String("candles", "", "read klines from this candle store instead of -data")
+	outDir := flags.String("out", "backtest", "directory for trades.csv, equity.csv and the report")
+	name := flags.String("name", "", "label of this run in the report (default the strategy name)")
+	balance := flags.Float64("balance", 100, "starting USDT balance")
+	feeRate := flags.Float64("fee", 0.001, "fee rate per fill")
+	minAlertCoins := flags.Int("min-alert-coins", -1, "only trade when more pairs alert (default the strategy's)")
+	strategyName := flags.String("strategy", "", "configured strategy to replay (default the first)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	strategies, err := loadStrategies()
+	if err != nil {
+		return err
+	}
+	strategy := strategies[0]
+	if *strategyName != "" {
+		strategy = nil
+		for _, s := range strategies {
+			if s.Name() == *strategyName {
+				strategy = s
+			}
+		}
+		if strategy == nil {
+			return fmt.Errorf("no strategy named %q in the config", *strategyName)
+		}
+	}
+
+	var klines map[string][]*binance.Kline
+	if *candlesPath != "" {
+		klines, err = readKlinesStore(*candlesPath)
+	} else {
+		klines, err = readKlinesDir(*dataDir)
+	}
+	if err != nil {
+		return err
+	}
+
+	settings := BacktestSettings{
+		StartingBalance: *balance,
+		FeeRate:         *feeRate,
+		Trading:         strategy.Settings().Trading,
+		Strategy:        strategy,
+	}
+	if *minAlertCoins >= 0 {
+		settings.Trading.MinAlertCoins = *minAlertCoins
+	}
+
+	result := runBacktest(klines, settings)
+	if len(result.Equity) == 0 {
+		return errors.New("no candles to replay")
+	}
+
+	if err := writeBacktestResult(*outDir, result); err != nil {
+		return err
+	}
+
+	if *name == "" {
+		*name = strategy.Name()
+	}
+	report := newBacktestReport(*name, result)
+	if err := writeBacktestReport(*outDir, report); err != nil {
+		return err
+	}
+
+	fmt.Printf("[BACKTEST] Symbols: %d | Trades: %d | Start: %.2f | End: %.2f | Return: %.2f%% | Max drawdown: %.2f%% | Sharpe: %.2f\n",
+		len(klines), len(result.Trades), settings.StartingBalance, result.FinalBalance, report.TotalReturn, report.MaxDrawdown, report.Sharpe)
+	return nil
+}
+
+func writeBacktestResult(dir string, result BacktestResult) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	trades := [][]string{{"symbol", "signal", "entry_time", "exit_time", "entry_price", "exit_price", "quantity", "cost", "proceeds", "fees", "pnl", "exit_reason"}}
+	for _, trade := range result.Trades {
+		trades = append(trades, []string{
+			trade.Symbol,
+			trade.Signal,
+			trade.EntryTime.UTC().Format("2006-01-02 15:04:05"),
+			trade.ExitTime.UTC().Format("2006-01-02 15:04:05"),
+			fmt.Sprint(trade.EntryPrice),
+			fmt.Sprint(trade.ExitPrice),
+			fmt.Sprint(trade.Quantity),
+			fmt.Sprint(trade.Cost),
+			fmt.Sprint(trade.Proceeds),
+			fmt.Sprint(trade.Fees),
+			fmt.Sprint(trade.PnL),
+			trade.ExitReason,
+		})
+	}
+	if err := writeCSVFile(filepath.Join(dir, "trades.csv"), trades); err != nil {
+		return err
+	}
+
+	equity := [][]string{{"time", "equity"}}
+	for _, point := range result.Equity {
+		equity = append(equity, []string{point.Time.UTC().Format("2006-01-02 15:04:05"), fmt.Sprint(point.Equity)})
+	}
+	return writeCSVFile(filepath.Join(dir, "equity.csv"), equity)
+}
+
+func writeCSVFile(path string, records [][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return csv.NewWriter(f).WriteAll(records)
+}
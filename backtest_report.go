@@ -0,0 +1,358 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BacktestReport summarises a BacktestResult. Returns and drawdown are
+// percentages; Sharpe and Sortino use per-bar equity returns annualised with
+// the bar interval and a zero risk-free rate.
+type BacktestReport struct {
+	Name                string              `json:"name,omitempty"`
+	Start               time.Time           `json:"start"`
+	End                 time.Time           `json:"end"`
+	StartingBalance     float64             `json:"starting_balance"`
+	FinalBalance        float64             `json:"final_balance"`
+	TotalReturn         float64             `json:"total_return_percent"`
+	AnnualizedReturn    float64             `json:"annualized_return_percent"`
+	Trades              int                 `json:"trades"`
+	Wins                int                 `json:"wins"`
+	Losses              int                 `json:"losses"`
+	WinRate             float64             `json:"win_rate_percent"`
+	AverageWin          float64             `json:"average_win"`
+	AverageLoss         float64             `json:"average_loss"`
+	ProfitFactor        ProfitFactor        `json:"profit_factor"`
+	MaxDrawdown         float64             `json:"max_drawdown_percent"`
+	MaxDrawdownDuration string              `json:"max_drawdown_duration"`
+	Sharpe              float64             `json:"sharpe"`
+	Sortino             float64             `json:"sortino"`
+	Exposure            float64             `json:"exposure_percent"`
+	FeesPaid            float64             `json:"fees_paid"`
+	BySymbol            []BacktestBreakdown `json:"by_symbol"`
+	BySignal            []BacktestBreakdown `json:"by_signal"`
+	Equity              []EquityPoint       `json:"-"`
+}
+
+// BacktestBreakdown is the trade statistics of one symbol or signal.
+type BacktestBreakdown struct {
+	Key          string       `json:"key"`
+	Trades       int          `json:"trades"`
+	Wins         int          `json:"wins"`
+	WinRate      float64      `json:"win_rate_percent"`
+	PnL          float64      `json:"pnl"`
+	Fees         float64      `json:"fees"`
+	ProfitFactor ProfitFactor `json:"profit_factor"`
+}
+
+// ProfitFactor is the gross profit over the gross loss: +Inf when trades
+// won and none lost, 0 when none won. JSON has no infinity, so +Inf is
+// written as the string "inf".
+type ProfitFactor float64
+
+func newProfitFactor(grossWin, grossLoss float64) ProfitFactor {
+	switch {
+	case grossLoss > 0:
+		return ProfitFactor(grossWin / grossLoss)
+	case grossWin > 0:
+		return ProfitFactor(math.Inf(1))
+	}
+	return 0
+}
+
+func (p ProfitFactor) String() string {
+	if math.IsInf(float64(p), 1) {
+		return "inf"
+	}
+	return fmt.Sprintf("%.2f", float64(p))
+}
+
+func (p ProfitFactor) MarshalJSON() ([]byte, error) {
+	if math.IsInf(float64(p), 1) {
+		return []byte(`"inf"`), nil
+	}
+	return json.Marshal(float64(p))
+}
+
+// newBacktestReport computes the report of result. Positions still open at
+// the end count as closed at the last price.
+func newBacktestReport(name string, result BacktestResult) BacktestReport {
+	report := BacktestReport{
+		Name:            name,
+		StartingBalance: result.Settings.StartingBalance,
+		FinalBalance:    result.FinalBalance,
+		Trades:          len(result.Trades),
+		Equity:          result.Equity,
+	}
+
+	if len(result.Equity) > 0 {
+		report.Start = result.Equity[0].Time
+		report.End = result.Equity[len(result.Equity)-1].Time
+	}
+
+	if report.StartingBalance > 0 {
+		growth := report.FinalBalance / report.StartingBalance
+		report.TotalReturn = (growth - 1) * 100
+
+		years := report.End.Sub(report.Start).Hours() / 24 / 365
+		if years > 0 && growth > 0 {
+			report.AnnualizedReturn = (math.Pow(growth, 1/years) - 1) * 100
+		}
+	}
+
+	// Trades
+	var grossWin, grossLoss float64
+	for _, trade := range result.Trades {
+		report.FeesPaid += trade.Fees
+		if trade.PnL > 0 {
+			report.Wins++
+			grossWin += trade.PnL
+		} else {
+			report.Losses++
+			grossLoss -= trade.PnL
+		}
+	}
+	if report.Trades > 0 {
+		report.WinRate = float64(report.Wins) / float64(report.Trades) * 100
+	}
+	if report.Wins > 0 {
+		report.AverageWin = grossWin / float64(report.Wins)
+	}
+	if report.Losses > 0 {
+		report.AverageLoss = -grossLoss / float64(report.Losses)
+	}
+	report.ProfitFactor = newProfitFactor(grossWin, grossLoss)
+
+	// Equity curve
+	var peak float64
+	var peakTime time.Time
+	var longestDrawdown time.Duration
+	var exposed int
+	var returns []float64
+	for i, point := range result.Equity {
+		if point.Positions > 0 {
+			exposed++
+		}
+		if i > 0 && result.Equity[i-1].Equity > 0 {
+			returns = append(returns, point.Equity/result.Equity[i-1].Equity-1)
+		}
+
+		if point.Equity >= peak {
+			peak = point.Equity
+			peakTime = point.Time
+			continue
+		}
+		if drawdown := (peak - point.Equity) / peak * 100; drawdown > report.MaxDrawdown {
+			report.MaxDrawdown = drawdown
+		}
+		if duration := point.Time.Sub(peakTime); duration > longestDrawdown {
+			longestDrawdown = duration
+		}
+	}
+	report.MaxDrawdownDuration = longestDrawdown.String()
+	if len(result.Equity) > 0 {
+		report.Exposure = float64(exposed) / float64(len(result.Equity)) * 100
+	}
+
+	barsPerYear := float64(365*24*time.Hour) / float64(intervalDurations[KLINE_INTERVAL])
+	report.Sharpe, report.Sortino = riskAdjustedReturns(returns, barsPerYear)
+
+	report.BySymbol = breakdownTrades(result.Trades, func(trade BacktestTrade) string { return trade.Symbol })
+	report.BySignal = breakdownTrades(result.Trades, func(trade BacktestTrade) string { return trade.Signal })
+
+	return report
+}
+
+// riskAdjustedReturns returns the annualised Sharpe and Sortino ratios of the
+// per-bar returns.
+func riskAdjustedReturns(returns []float64, periodsPerYear float64) (sharpe float64, sortino float64) {
+	if len(returns) < 2 {
+		return 0, 0
+	}
+
+	var sum float64
+	for _, r := range returns {
+		sum += r
+	}
+	mean := sum / float64(len(returns))
+
+	var variance, downside float64
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+		if r < 0 {
+			downside += r * r
+		}
+	}
+	deviation := math.Sqrt(variance / float64(len(returns)-1))
+	downsideDeviation := math.Sqrt(downside / float64(len(returns)))
+
+	if deviation > 0 {
+		sharpe = mean / deviation * math.Sqrt(periodsPerYear)
+	}
+	if downsideDeviation > 0 {
+		sortino = mean / downsideDeviation * math.Sqrt(periodsPerYear)
+	}
+	return sharpe, sortino
+}
+
+func breakdownTrades(trades []BacktestTrade, key func(BacktestTrade) string) []BacktestBreakdown {
+	rows := make(map[string]*BacktestBreakdown)
+	grossWin := make(map[string]float64)
+	grossLoss := make(map[string]float64)
+
+	for _, trade := range trades {
+		k := key(trade)
+		row, exists := rows[k]
+		if !exists {
+			row = &BacktestBreakdown{Key: k}
+			rows[k] = row
+		}
+
+		row.Trades++
+		row.PnL += trade.PnL
+		row.Fees += trade.Fees
+		if trade.PnL > 0 {
+			row.Wins++
+			grossWin[k] += trade.PnL
+		} else {
+			grossLoss[k] -= trade.PnL
+		}
+	}
+
+	result := []BacktestBreakdown{}
+	for k, row := range rows {
+		row.WinRate = float64(row.Wins) / float64(row.Trades) * 100
+		row.ProfitFactor = newProfitFactor(grossWin[k], grossLoss[k])
+		result = append(result, *row)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].PnL > result[j].PnL })
+
+	return result
+}
+
+// writeBacktestReport writes report.json and report.html to dir.
+func writeBacktestReport(dir string, report BacktestReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "report.json"), data, 0o644); err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(dir, "report.html"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return backtestReportTemplate.Execute(f, struct {
+		BacktestReport
+		Chart template.HTML
+	}{report, equityChartSVG(report.Equity, 900, 300)})
+}
+
+// equityChartSVG draws the equity curve as an inline SVG so the HTML report
+// needs no scripts or network access.
+func equityChartSVG(equity []EquityPoint, width, height float64) template.HTML {
+	if len(equity) < 2 {
+		return ""
+	}
+
+	low, high := equity[0].Equity, equity[0].Equity
+	for _, point := range equity {
+		low = math.Min(low, point.Equity)
+		high = math.Max(high, point.Equity)
+	}
+	if high == low {
+		high = low + 1
+	}
+
+	const padding = 40.0
+	start, end := equity[0].Time, equity[len(equity)-1].Time
+	span := end.Sub(start).Seconds()
+
+	var points strings.Builder
+	for i, point := range equity {
+		x := padding + float64(i)/float64(len(equity)-1)*(width-2*padding)
+		if span > 0 {
+			x = padding + point.Time.Sub(start).Seconds()/span*(width-2*padding)
+		}
+		y := height - padding - (point.Equity-low)/(high-low)*(height-2*padding)
+		fmt.Fprintf(&points, "%.1f,%.1f ", x, y)
+	}
+
+	return template.HTML(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%[1]g" height="%[2]g" viewBox="0 0 %[1]g %[2]g">
+<rect x="0" y="0" width="%[1]g" height="%[2]g" fill="#fff"/>
+<line x1="%[3]g" y1="%[4]g" x2="%[5]g" y2="%[4]g" stroke="#ccc"/>
+<line x1="%[3]g" y1="%[3]g" x2="%[3]g" y2="%[4]g" stroke="#ccc"/>
+<text x="%[3]g" y="%[6]g" font-size="11">%.2[7]f</text>
+<text x="%[3]g" y="%[8]g" font-size="11">%.2[9]f</text>
+<text x="%[3]g" y="%[10]g" font-size="11">%[11]s</text>
+<text x="%[5]g" y="%[10]g" font-size="11" text-anchor="end">%[12]s</text>
+<polyline fill="none" stroke="#2a6fdb" stroke-width="1.5" points="%[13]s"/>
+</svg>`,
+		width, height, padding, height-padding, width-padding, padding-6, high, height-padding-4, low, height-padding+16,
+		start.UTC().Format("2006-01-02"), end.UTC().Format("2006-01-02"), strings.TrimSpace(points.String())))
+}
+
+var backtestReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"money":   func(v float64) string { return fmt.Sprintf("%.2f", v) },
+	"percent": func(v float64) string { return fmt.Sprintf("%.2f%%", v) },
+	"ratio":   func(v float64) string { return fmt.Sprintf("%.2f", v) },
+	"date":    func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Backtest report{{if .Name}} - {{.Name}}{{end}}</title>
+<style>
+body { font-family: sans-serif; margin: 24px; color: #222; }
+table { border-collapse: collapse; margin-bottom: 24px; }
+th, td { border: 1px solid #ddd; padding: 4px 10px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+th { background: #f4f4f4; }
+</style>
+</head>
+<body>
+<h1>Backtest report{{if .Name}}: {{.Name}}{{end}}</h1>
+<p>{{date .Start}} to {{date .End}}</p>
+{{.Chart}}
+<h2>Summary</h2>
+<table>
+<tr><td>Starting balance</td><td>{{money .StartingBalance}}</td></tr>
+<tr><td>Final balance</td><td>{{money .FinalBalance}}</td></tr>
+<tr><td>Total return</td><td>{{percent .TotalReturn}}</td></tr>
+<tr><td>Annualized return</td><td>{{percent .AnnualizedReturn}}</td></tr>
+<tr><td>Trades</td><td>{{.Trades}}</td></tr>
+<tr><td>Win rate</td><td>{{percent .WinRate}} ({{.Wins}} / {{.Losses}})</td></tr>
+<tr><td>Average win</td><td>{{money .AverageWin}}</td></tr>
+<tr><td>Average loss</td><td>{{money .AverageLoss}}</td></tr>
+<tr><td>Profit factor</td><td>{{.ProfitFactor}}</td></tr>
+<tr><td>Max drawdown</td><td>{{percent .MaxDrawdown}}</td></tr>
+<tr><td>Max drawdown duration</td><td>{{.MaxDrawdownDuration}}</td></tr>
+<tr><td>Sharpe</td><td>{{ratio .Sharpe}}</td></tr>
+<tr><td>Sortino</td><td>{{ratio .Sortino}}</td></tr>
+<tr><td>Exposure</td><td>{{percent .Exposure}}</td></tr>
+<tr><td>Fees paid</td><td>{{money .FeesPaid}}</td></tr>
+</table>
+{{define "breakdown"}}
+<table>
+<tr><th></th><th>Trades</th><th>Win rate</th><th>PnL</th><th>Fees</th><th>Profit factor</th></tr>
+{{range .}}<tr><td>{{.Key}}</td><td>{{.Trades}}</td><td>{{percent .WinRate}}</td><td>{{money .PnL}}</td><td>{{money .Fees}}</td><td>{{.ProfitFactor}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>By signal</h2>
+{{template "breakdown" .BySignal}}
+<h2>By symbol</h2>
+{{template "breakdown" .BySymbol}}
+</body>
+</html>
+`))
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProfitFactor(t *testing.T) {
+	tests := []struct {
+		name   string
+		pnls   []float64
+		want   float64
+		json   string
+		report string
+	}{
+		{"no trades", nil, 0, "0", "0.00"},
+		{"only losses", []float64{-1, -2}, 0, "0", "0.00"},
+		{"wins and losses", []float64{3, -1, 1, -1}, 2, "2", "2.00"},
+		{"no losses", []float64{1, 2}, math.Inf(1), `"inf"`, "inf"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var result BacktestResult
+			for _, pnl := range test.pnls {
+				result.Trades = append(result.Trades, BacktestTrade{Symbol: "AAAUSDT", PnL: pnl})
+			}
+			report := newBacktestReport("", result)
+			if float64(report.ProfitFactor) != test.want {
+				t.Errorf("profit factor = %v, want %v", report.ProfitFactor, test.want)
+			}
+			if len(test.pnls) > 0 && report.BySymbol[0].ProfitFactor != report.ProfitFactor {
+				t.Errorf("AAAUSDT profit factor = %v, want %v", report.BySymbol[0].ProfitFactor, report.ProfitFactor)
+			}
+			if report.ProfitFactor.String() != test.report {
+				t.Errorf("shown as %s, want %s", report.ProfitFactor, test.report)
+			}
+
+			data, err := json.Marshal(report)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), `"profit_factor":`+test.json+`,`) {
+				t.Errorf("report.json = %s, want profit_factor %s", data, test.json)
+			}
+			if err := writeBacktestReport(t.TempDir(), report); err != nil {
+				t.Errorf("writeBacktestReport: %v", err)
+			}
+		})
+	}
+}
+
+func TestRankByProfitFactor(t *testing.T) {
+	results := []OptimizeResult{
+		{Screening: ScreeningConfig{MAPeriod: 10}, Test: OptimizeMetrics{ProfitFactor: 1.5}},
+		{Screening: ScreeningConfig{MAPeriod: 20}, Test: OptimizeMetrics{}},
+		{Screening: ScreeningConfig{MAPeriod: 30}, Test: OptimizeMetrics{ProfitFactor: math.Inf(1)}},
+		{Screening: ScreeningConfig{MAPeriod: 40}, Test: OptimizeMetrics{ProfitFactor: 3}},
+		{Screening: ScreeningConfig{MAPeriod: 50}, Test: OptimizeMetrics{ProfitFactor: math.Inf(1)}},
+	}
+	rankOptimizeResults(results, optimizeRankings["profit_factor"])
+
+	var got []int
+	for _, result := range results {
+		got = append(got, result.Screening.MAPeriod)
+	}
+	if want := []int{30, 50, 40, 10, 20}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ranked = %v, want %v", got, want)
+	}
+	if formatProfitFactor(results[0].Test.ProfitFactor) != "inf" || formatProfitFactor(results[2].Test.ProfitFactor) != "3.0000" {
+		t.Errorf("formatted as %s and %s", formatProfitFactor(results[0].Test.ProfitFactor), formatProfitFactor(results[2].Test.ProfitFactor))
+	}
+}
@@ -4,16 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strconv"
-	"strings"
 	"sync"
-	"time"
 
 	"github.com/adshao/go-binance/v2"
+	"github.com/dzakyputra/binance/patterns"
 )
 
-func getUserAsset(binanceClient *binance.Client, symbol string) (result binance.UserAssetRecord, err error) {
-	assets, err := binanceClient.NewGetUserAsset().Do(context.Background())
+func getUserAsset(exchange Exchange, symbol string) (result binance.UserAssetRecord, err error) {
+	assets, err := exchange.GetUserAssets(context.Background())
 	if err != nil {
 		return result, err
 	}
@@ -25,8 +23,8 @@ func getUserAsset(binanceClient *binance.Client, symbol string) (result binance.
 	return result, errors.New("asset not found")
 }
 
-func getActivePairs(binanceClient *binance.Client) (symbols []binance.Symbol, err error) {
-	res, err := binanceClient.NewExchangeInfoService().Do(context.Background())
+func getActivePairs(exchange Exchange) (symbols []binance.Symbol, err error) {
+	res, err := exchange.GetExchangeInfo(context.Background())
 	if err != nil {
 		fmt.Println(err)
 		return symbols, err
@@ -43,13 +41,26 @@ func getActivePairs(binanceClient *binance.Client) (symbols []binance.Symbol, er
 	return symbols, nil
 }
 
-func getParametersPerPairs(binanceClient *binance.Client, symbols []binance.Symbol) (map[string]Parameters, map[string]Parameters) {
+// strategyAlerts are one strategy's signals of a screening run by symbol:
+// Upper holds the BUY signals and Lower the SELL signals.
+type strategyAlerts struct {
+	Upper map[string]Signal
+	Lower map[string]Signal
+}
+
+// getParametersPerPairs fetches each symbol's screening window once and
+// evaluates every strategy on it. The result is keyed by strategy name.
+func getParametersPerPairs(exchange Exchange, symbols []binance.Symbol, strategies []Strategy) map[string]strategyAlerts {
 	var wg sync.WaitGroup
-	var m1 sync.Mutex
-	var m2 sync.Mutex
-	upperParameters := make(map[string]Parameters)
-	lowerParameters := make(map[string]Parameters)
-	maxWorkers := 20
+	var m sync.Mutex
+	alerts := make(map[string]strategyAlerts)
+	for _, strategy := range strategies {
+		alerts[strategy.Name()] = strategyAlerts{
+			Upper: make(map[string]Signal),
+			Lower: make(map[string]Signal),
+		}
+	}
+	maxWorkers := config.Trading.MaxWorkers
 	semaphore := make(chan struct{}, maxWorkers)
 
 	for _, symbol := range symbols {
@@ -60,34 +71,28 @@ func getParametersPerPairs(binanceClient *binance.Client, symbols []binance.Symb
 				<-semaphore
 				wg.Done()
 			}()
+			defer recoverPanic("screening " + symbol.Symbol)
 
-			klines, err := getKlines(binanceClient, symbol.Symbol, 300)
-			if err != nil {
+			if err := screeningTradeable(symbol, strategies); err != nil {
+				fmt.Println("[SKIP]", symbol.Symbol+":", err)
 				return
 			}
 
-			parameter, isValid := generateParameters(klines, symbol.Symbol, symbol.Filters)
-			if !isValid {
+			klines, err := getScreeningKlines(exchange, symbol.Symbol, SCREENING_WINDOW)
+			if err != nil {
 				return
 			}
 
-			// UPPER PARAMETERS
-			param1 := (parameter.IsGulfingCandles && (parameter.CurrentPrice >= (parameter.MovingAverage * 1.02)) && (parameter.IsUpperTrend))
-			param2 := (parameter.CurrentPrice >= (parameter.MovingAverage * 1.02)) && parameter.IsBreakResistance
-			parameter.Param1 = param1
-			parameter.Param2 = param2
-
-			if param1 || param2 {
-				m1.Lock()
-				defer m1.Unlock()
-				upperParameters[symbol.Symbol] = parameter
-			}
-
-			// LOWER PARAMETERS
-			if ((parameter.CurrentPrice <= (parameter.MovingAverage * 0.98)) && !parameter.IsUpperTrend) || parameter.IsBreakSupport {
-				m2.Lock()
-				defer m2.Unlock()
-				lowerParameters[symbol.Symbol] = parameter
+			for _, strategy := range strategies {
+				for _, signal := range strategy.Evaluate(klines, symbol) {
+					m.Lock()
+					if signal.Side == binance.SideTypeBuy {
+						alerts[strategy.Name()].Upper[symbol.Symbol] = signal
+					} else {
+						alerts[strategy.Name()].Lower[symbol.Symbol] = signal
+					}
+					m.Unlock()
+				}
 			}
 
 		}(symbol)
@@ -95,15 +100,38 @@ func getParametersPerPairs(binanceClient *binance.Client, symbols []binance.Symb
 
 	wg.Wait()
 
-	return upperParameters, lowerParameters
+	return alerts
+}
+
+// screeningTradeable rejects a symbol no strategy could trade, before its
+// klines are fetched. The notional check uses the largest per-trade amount
+// of the strategies; tradingLogic checks the strategy's own one.
+func screeningTradeable(symbol binance.Symbol, strategies []Strategy) error {
+	rules, err := newSymbolRules(symbol)
+	if err != nil {
+		return err
+	}
+	var maxQuote float64
+	for _, strategy := range strategies {
+		if quote := strategy.Settings().Trading.MaxQuotePerTrade; quote > maxQuote {
+			maxQuote = quote
+		}
+	}
+	return rules.Tradeable(symbol, maxQuote)
+}
+
+// signalParameters returns the parameters behind each signal, keyed like the
+// signals.
+func signalParameters(signals map[string]Signal) map[string]Parameters {
+	parameters := make(map[string]Parameters, len(signals))
+	for symbol, signal := range signals {
+		parameters[symbol] = signal.Parameters
+	}
+	return parameters
 }
 
-func getKlines(client *binance.Client, symbol string, limit int) ([]*binance.Kline, error) {
-	klines, err := client.NewKlinesService().
-		Symbol(symbol).
-		Interval("15m").
-		Limit(limit).
-		Do(context.Background())
+func getKlines(exchange Exchange, symbol string, limit int) ([]*binance.Kline, error) {
+	klines, err := exchange.GetKlines(context.Background(), symbol, KLINE_INTERVAL, limit)
 
 	if err != nil {
 		return klines, err
@@ -112,53 +140,36 @@ func getKlines(client *binance.Client, symbol string, limit int) ([]*binance.Kli
 	return klines, nil
 }
 
-func generateParameters(klines []*binance.Kline, symbol string, filters []map[string]interface{}) (parameters Parameters, isValid bool) {
+func generateParameters(klines []*binance.Kline, symbol binance.Symbol, rules ScreeningConfig) (parameters Parameters, isValid bool) {
 	var closePrices, volumes []float64
 	var maxPrice, minPrice float64
 	var startMA float64
 	var endMA float64
 
-	if len(klines) < 300 {
+	if len(klines) < SCREENING_WINDOW {
 		return parameters, false
 	}
 
-	var tickSize string
-	var tickSizeInt int
-	for _, filter := range filters {
-		if filter["filterType"] == "PRICE_FILTER" {
-			tickSize = filter["tickSize"].(string)
-
-			tickSizes := strings.Split(tickSize, ".")
-
-			if len(tickSizes) > 1 {
-
-				if tickSizes[0] == "1" {
-					tickSizeInt = 0
-					break
-				}
-
-				for _, v := range tickSizes[1] {
-					tickSizeInt += 1
-					if string(v) == "1" {
-						break
-					}
-				}
-			}
-		}
+	candles, err := candlesFromKlines(symbol.Symbol, klines)
+	if err != nil {
+		fmt.Println("[SCREENING]", err)
+		return parameters, false
 	}
+	bars := candleBars(candles)
+
+	// Symbols without usable filters are still screened, trading skips them
+	symbolRules, _ := newSymbolRules(symbol)
 
-	for i, k := range klines {
-		closePrice, _ := strconv.ParseFloat(k.Close, 64)
-		openPrice, _ := strconv.ParseFloat(k.Open, 64)
-		volume, _ := strconv.ParseFloat(k.QuoteAssetVolume, 64)
+	for i, bar := range bars {
+		closePrice, openPrice, volume := bar.Close, bar.Open, bar.Volume
 		closePrices = append(closePrices, closePrice)
 		volumes = append(volumes, volume)
 
-		if i >= 0 && i < 100 {
+		if i >= 0 && i < rules.TrendWindow {
 			startMA += closePrice
 		}
 
-		if i >= 200 && i < 300 {
+		if i >= len(klines)-rules.TrendWindow {
 			endMA += closePrice
 		}
 
@@ -179,20 +190,21 @@ func generateParameters(klines []*binance.Kline, symbol string, filters []map[st
 		}
 	}
 
-	currentPrice, _ := strconv.ParseFloat(klines[len(klines)-1].Close, 64)
+	currentPrice := closePrices[len(closePrices)-1]
 
 	return Parameters{
-		Symbol:                symbol,
-		DateTime:              time.UnixMilli(klines[len(klines)-1].CloseTime),
-		MovingAverage:         calculateMovingAverage(closePrices, 20),
-		RelativeStrengthIndex: calculateRelativeStrengthIndex(closePrices, 14),
-		IsGulfingCandles:      isGulfingCandles(klines),
+		Symbol:                symbol.Symbol,
+		DateTime:              candles[len(candles)-1].CloseTime,
+		MovingAverage:         calculateMovingAverage(closePrices, rules.MAPeriod),
+		RelativeStrengthIndex: calculateRelativeStrengthIndex(closePrices, rules.RSIPeriod),
+		IsGulfingCandles:      isGulfingCandles(bars),
 		Volume:                volumes[len(volumes)-1],
 		VolumeDiff:            calculateVolumdeDiff(volumes),
-		IsUpperTrend:          (startMA / float64(100)) < (endMA / float64(100)),
+		IsUpperTrend:          (startMA / float64(rules.TrendWindow)) < (endMA / float64(rules.TrendWindow)),
 		IsBreakResistance:     currentPrice >= maxPrice,
 		IsBreakSupport:        currentPrice <= minPrice,
 		CurrentPrice:          closePrices[len(closePrices)-1],
-		TickSize:              tickSizeInt,
+		Patterns:              patterns.Detect(bars),
+		Rules:                 symbolRules,
 	}, true
 }
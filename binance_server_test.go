@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/adshao/go-binance/v2/common"
+)
+
+// binanceStandIn serves the part of Binance's REST API the bot uses on top
+// of a fakeExchange. Signed endpoints check the API key, timestamp and HMAC
+// signature the same way Binance does, and responses carry the used-weight
+// headers so rate limit handling can be exercised too.
+type binanceStandIn struct {
+	exchange  *fakeExchange
+	apiKey    string
+	secretKey string
+
+	mu           sync.Mutex
+	weightMinute int64
+	weight       int
+	sapiWeight   int
+	orderCount   int
+}
+
+const (
+	standInWeightLimit     = 6000
+	standInSapiWeightLimit = 12000
+	standInRecvWindow      = 5000
+)
+
+// newBinanceStandInServer starts the stand-in on a local port. Point
+// binance.base_url (or Client.BaseURL) at the returned server's URL.
+func newBinanceStandInServer(exchange *fakeExchange, apiKey, secretKey string) *httptest.Server {
+	return httptest.NewServer(newBinanceStandIn(exchange, apiKey, secretKey))
+}
+
+func newBinanceStandIn(exchange *fakeExchange, apiKey, secretKey string) *binanceStandIn {
+	return &binanceStandIn{
+		exchange:  exchange,
+		apiKey:    apiKey,
+		secretKey: secretKey,
+	}
+}
+
+func (s *binanceStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/api/v3/klines" && r.Method == http.MethodGet:
+		s.handle(w, r, 2, false, false, s.klines)
+	case r.URL.Path == "/api/v3/exchangeInfo" && r.Method == http.MethodGet:
+		s.handle(w, r, 20, false, false, s.exchangeInfo)
+	case r.URL.Path == "/api/v3/order" && r.Method == http.MethodPost:
+		s.handle(w, r, 1, false, true, s.createOrder)
+	case r.URL.Path == "/api/v3/order" && r.Method == http.MethodGet:
+		s.handle(w, r, 4, false, true, s.getOrder)
+	case r.URL.Path == "/api/v3/order" && r.Method == http.MethodDelete:
+		s.handle(w, r, 1, false, true, s.cancelOrder)
+	case r.URL.Path == "/api/v3/order/oco" && r.Method == http.MethodPost:
+		s.handle(w, r, 1, false, true, s.createOCO)
+	case r.URL.Path == "/api/v3/orderList" && r.Method == http.MethodDelete:
+		s.handle(w, r, 1, false, true, s.cancelOCO)
+	case r.URL.Path == "/sapi/v3/asset/getUserAsset" && r.Method == http.MethodPost:
+		s.handle(w, r, 5, true, true, s.userAssets)
+	default:
+		writeStandInError(w, http.StatusNotFound, &common.APIError{Code: -1100, Message: "Illegal characters found in parameter 'path'; legal range is '/api/v3/'."})
+	}
+}
+
+// handle charges the request weight, verifies signed requests and writes the
+// handler's result as JSON or as a Binance error payload.
+func (s *binanceStandIn) handle(w http.ResponseWriter, r *http.Request, weight int, sapi bool, signed bool, handler func(params url.Values) (interface{}, error)) {
+	if !s.chargeWeight(w, weight, sapi) {
+		writeStandInError(w, http.StatusTooManyRequests, &common.APIError{Code: -1003, Message: "Too many requests; current limit is 6000 request weight per 1 MINUTE."})
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeStandInError(w, http.StatusBadRequest, &common.APIError{Code: -1000, Message: err.Error()})
+		return
+	}
+
+	params, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		writeStandInError(w, http.StatusBadRequest, &common.APIError{Code: -1100, Message: err.Error()})
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		writeStandInError(w, http.StatusBadRequest, &common.APIError{Code: -1100, Message: err.Error()})
+		return
+	}
+	for key, values := range form {
+		params[key] = append(params[key], values...)
+	}
+
+	if signed {
+		if apiErr := s.verifySignature(r, string(body), params); apiErr != nil {
+			status := http.StatusBadRequest
+			if apiErr.Code == -2014 || apiErr.Code == -2015 {
+				status = http.StatusUnauthorized
+			}
+			writeStandInError(w, status, apiErr)
+			return
+		}
+	}
+
+	if (r.URL.Path == "/api/v3/order" || r.URL.Path == "/api/v3/order/oco") && r.Method == http.MethodPost {
+		s.mu.Lock()
+		s.orderCount++
+		w.Header().Set("X-MBX-ORDER-COUNT-10S", strconv.Itoa(s.orderCount))
+		w.Header().Set("X-MBX-ORDER-COUNT-1D", strconv.Itoa(s.orderCount))
+		s.mu.Unlock()
+	}
+
+	result, err := handler(params)
+	if err != nil {
+		var apiErr *common.APIError
+		if !errors.As(err, &apiErr) {
+			apiErr = &common.APIError{Code: -1000, Message: err.Error()}
+		}
+		writeStandInError(w, http.StatusBadRequest, apiErr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func (s *binanceStandIn) chargeWeight(w http.ResponseWriter, weight int, sapi bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	minute := time.Now().Unix() / 60
+	if minute != s.weightMinute {
+		s.weightMinute = minute
+		s.weight = 0
+		s.sapiWeight = 0
+	}
+
+	if sapi {
+		s.sapiWeight += weight
+		w.Header().Set("X-SAPI-USED-IP-WEIGHT-1M", strconv.Itoa(s.sapiWeight))
+		return s.sapiWeight <= standInSapiWeightLimit
+	}
+
+	s.weight += weight
+	w.Header().Set("X-MBX-USED-WEIGHT-1M", strconv.Itoa(s.weight))
+	return s.weight <= standInWeightLimit
+}
+
+// verifySignature recomputes the HMAC-SHA256 of the query string (without
+// the signature itself) followed by the form body.
+func (s *binanceStandIn) verifySignature(r *http.Request, body string, params url.Values) *common.APIError {
+	if r.Header.Get("X-MBX-APIKEY") == "" {
+		return &common.APIError{Code: -2014, Message: "API-key format invalid."}
+	}
+	if r.Header.Get("X-MBX-APIKEY") != s.apiKey {
+		return &common.APIError{Code: -2015, Message: "Invalid API-key, IP, or permissions for action."}
+	}
+
+	signature := params.Get("signature")
+	if signature == "" {
+		return &common.APIError{Code: -1102, Message: "Mandatory parameter 'signature' was not sent, was empty/null, or malformed."}
+	}
+
+	query := r.URL.RawQuery
+	if i := strings.Index(query, "signature="); i >= 0 {
+		query = strings.TrimSuffix(query[:i], "&")
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.secretKey))
+	mac.Write([]byte(query + body))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return &common.APIError{Code: -1022, Message: "Signature for this request is not valid."}
+	}
+
+	timestamp, err := strconv.ParseInt(params.Get("timestamp"), 10, 64)
+	if err != nil {
+		return &common.APIError{Code: -1102, Message: "Mandatory parameter 'timestamp' was not sent, was empty/null, or malformed."}
+	}
+	recvWindow := int64(standInRecvWindow)
+	if params.Get("recvWindow") != "" {
+		recvWindow, _ = strconv.ParseInt(params.Get("recvWindow"), 10, 64)
+	}
+	now := time.Now().UnixMilli()
+	if timestamp > now+1000 || now-timestamp > recvWindow {
+		return &common.APIError{Code: -1021, Message: "Timestamp for this request is outside of the recvWindow."}
+	}
+
+	return nil
+}
+
+func (s *binanceStandIn) klines(params url.Values) (interface{}, error) {
+	symbol := params.Get("symbol")
+	if symbol == "" {
+		return nil, &common.APIError{Code: -1102, Message: "Mandatory parameter 'symbol' was not sent, was empty/null, or malformed."}
+	}
+	limit := 500
+	if params.Get("limit") != "" {
+		limit, _ = strconv.Atoi(params.Get("limit"))
+	}
+	if limit <= 0 || limit > 1000 {
+		return nil, &common.APIError{Code: -1130, Message: "Invalid data sent for a parameter."}
+	}
+
+	var klines []*binance.Kline
+	var err error
+	if params.Get("startTime") != "" {
+		startTime, _ := strconv.ParseInt(params.Get("startTime"), 10, 64)
+		klines, err = s.exchange.GetKlinesFrom(context.Background(), symbol, params.Get("interval"), startTime, limit)
+	} else {
+		klines, err = s.exchange.GetKlines(context.Background(), symbol, params.Get("interval"), limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows := [][]interface{}{}
+	for _, k := range klines {
+		rows = append(rows, []interface{}{
+			k.OpenTime, k.Open, k.High, k.Low, k.Close, k.Volume, k.CloseTime,
+			k.QuoteAssetVolume, k.TradeNum, k.TakerBuyBaseAssetVolume, k.TakerBuyQuoteAssetVolume, "0",
+		})
+	}
+	return rows, nil
+}
+
+func (s *binanceStandIn) exchangeInfo(params url.Values) (interface{}, error) {
+	info, err := s.exchange.GetExchangeInfo(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	info.Timezone = "UTC"
+	return info, nil
+}
+
+func (s *binanceStandIn) createOrder(params url.Values) (interface{}, error) {
+	for _, key := range []string{"symbol", "side", "type"} {
+		if params.Get(key) == "" {
+			return nil, &common.APIError{Code: -1102, Message: fmt.Sprintf("Mandatory parameter '%s' was not sent, was empty/null, or malformed.", key)}
+		}
+	}
+
+	return s.exchange.CreateOrder(context.Background(), OrderRequest{
+		Symbol:        params.Get("symbol"),
+		Side:          binance.SideType(params.Get("side")),
+		Type:          binance.OrderType(params.Get("type")),
+		TimeInForce:   binance.TimeInForceType(params.Get("timeInForce")),
+		Quantity:      params.Get("quantity"),
+		QuoteOrderQty: params.Get("quoteOrderQty"),
+		Price:         params.Get("price"),
+	})
+}
+
+func (s *binanceStandIn) getOrder(params url.Values) (interface{}, error) {
+	return s.exchange.GetOrder(context.Background(), params.Get("symbol"), params.Get("origClientOrderId"))
+}
+
+func (s *binanceStandIn) cancelOrder(params url.Values) (interface{}, error) {
+	return s.exchange.CancelOrder(context.Background(), params.Get("symbol"), params.Get("origClientOrderId"))
+}
+
+func (s *binanceStandIn) createOCO(params url.Values) (interface{}, error) {
+	for _, key := range []string{"symbol", "side", "quantity", "price", "stopPrice"} {
+		if params.Get(key) == "" {
+			return nil, &common.APIError{Code: -1102, Message: fmt.Sprintf("Mandatory parameter '%s' was not sent, was empty/null, or malformed.", key)}
+		}
+	}
+
+	return s.exchange.CreateOCO(context.Background(), OCORequest{
+		Symbol:               params.Get("symbol"),
+		Side:                 binance.SideType(params.Get("side")),
+		Quantity:             params.Get("quantity"),
+		Price:                params.Get("price"),
+		StopPrice:            params.Get("stopPrice"),
+		StopLimitPrice:       params.Get("stopLimitPrice"),
+		StopLimitTimeInForce: binance.TimeInForceType(params.Get("stopLimitTimeInForce")),
+	})
+}
+
+func (s *binanceStandIn) cancelOCO(params url.Values) (interface{}, error) {
+	orderListID, err := strconv.ParseInt(params.Get("orderListId"), 10, 64)
+	if err != nil {
+		return nil, &common.APIError{Code: -1102, Message: "Mandatory parameter 'orderListId' was not sent, was empty/null, or malformed."}
+	}
+	return s.exchange.CancelOCO(context.Background(), params.Get("symbol"), orderListID)
+}
+
+func (s *binanceStandIn) userAssets(params url.Values) (interface{}, error) {
+	assets, err := s.exchange.GetUserAssets(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	if asset := params.Get("asset"); asset != "" {
+		filtered := []binance.UserAssetRecord{}
+		for _, record := range assets {
+			if record.Asset == asset {
+				filtered = append(filtered, record)
+			}
+		}
+		return filtered, nil
+	}
+
+	return assets, nil
+}
+
+func writeStandInError(w http.ResponseWriter, status int, apiErr *common.APIError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiErr)
+}
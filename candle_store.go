@@ -0,0 +1,437 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+)
+
+var candleMigrations = []string{
+	`CREATE TABLE candles (
+		symbol            TEXT NOT NULL,
+		interval          TEXT NOT NULL,
+		open_time         INTEGER NOT NULL,
+		open              TEXT NOT NULL,
+		high              TEXT NOT NULL,
+		low               TEXT NOT NULL,
+		close             TEXT NOT NULL,
+		volume            TEXT NOT NULL,
+		close_time        INTEGER NOT NULL,
+		quote_volume      TEXT NOT NULL,
+		trade_num         INTEGER NOT NULL,
+		taker_base_volume TEXT NOT NULL,
+		taker_quote_volume TEXT NOT NULL,
+		PRIMARY KEY (symbol, interval, open_time)
+	) WITHOUT ROWID;`,
+}
+
+var intervalDurations = map[string]time.Duration{
+	"1m":  time.Minute,
+	"3m":  3 * time.Minute,
+	"5m":  5 * time.Minute,
+	"15m": 15 * time.Minute,
+	"30m": 30 * time.Minute,
+	"1h":  time.Hour,
+	"2h":  2 * time.Hour,
+	"4h":  4 * time.Hour,
+	"6h":  6 * time.Hour,
+	"8h":  8 * time.Hour,
+	"12h": 12 * time.Hour,
+	"1d":  24 * time.Hour,
+}
+
+// candleStore keeps klines by symbol and interval in their own SQLite file.
+// Prices stay the strings Binance sent so nothing is lost in the round trip.
+type candleStore struct {
+	db *sql.DB
+}
+
+type candleGap struct {
+	Start int64
+	End   int64
+}
+
+func openCandleStore(path string) (*candleStore, error) {
+	db, err := openSQLite(path, candleMigrations)
+	if err != nil {
+		return nil, err
+	}
+	return &candleStore{db: db}, nil
+}
+
+func (s *candleStore) Close() error {
+	return s.db.Close()
+}
+
+// Save inserts klines, replacing candles with the same open time so a
+// candle stored while still open gets its final values later.
+func (s *candleStore) Save(symbol, interval string, klines []*binance.Kline) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statement, err := tx.Prepare(`INSERT OR REPLACE INTO candles
+		(symbol, interval, open_time, open, high, low, close, volume, close_time, quote_volume, trade_num, taker_base_volume, taker_quote_volume)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer statement.Close()
+
+	for _, k := range klines {
+		_, err := statement.Exec(symbol, interval, k.OpenTime, k.Open, k.High, k.Low, k.Close, k.Volume,
+			k.CloseTime, k.QuoteAssetVolume, k.TradeNum, k.TakerBuyBaseAssetVolume, k.TakerBuyQuoteAssetVolume)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Range returns the candles opening in [start, end] (milliseconds), oldest
+// first.
+func (s *candleStore) Range(symbol, interval string, start, end int64) ([]*binance.Kline, error) {
+	return s.query(`WHERE symbol = ? AND interval = ? AND open_time >= ? AND open_time <= ? ORDER BY open_time`, symbol, interval, start, end)
+}
+
+// Latest returns the newest limit candles, oldest first, like GET /klines.
+func (s *candleStore) Latest(symbol, interval string, limit int) ([]*binance.Kline, error) {
+	klines, err := s.query(`WHERE symbol = ? AND interval = ? ORDER BY open_time DESC LIMIT ?`, symbol, interval, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(klines)-1; i < j; i, j = i+1, j-1 {
+		klines[i], klines[j] = klines[j], klines[i]
+	}
+	return klines, nil
+}
+
+func (s *candleStore) query(clause string, args ...interface{}) ([]*binance.Kline, error) {
+	rows, err := s.db.Query(`SELECT open_time, open, high, low, close, volume, close_time, quote_volume, trade_num, taker_base_volume, taker_quote_volume
+		FROM candles `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*binance.Kline{}
+	for rows.Next() {
+		k := &binance.Kline{}
+		err := rows.Scan(&k.OpenTime, &k.Open, &k.High, &k.Low, &k.Close, &k.Volume, &k.CloseTime,
+			&k.QuoteAssetVolume, &k.TradeNum, &k.TakerBuyBaseAssetVolume, &k.TakerBuyQuoteAssetVolume)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, k)
+	}
+	return result, rows.Err()
+}
+
+// Symbols lists the symbols that have candles for interval.
+func (s *candleStore) Symbols(interval string) ([]string, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT symbol FROM candles WHERE interval = ? ORDER BY symbol`, interval)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []string
+	for rows.Next() {
+		var symbol string
+		if err := rows.Scan(&symbol); err != nil {
+			return nil, err
+		}
+		result = append(result, symbol)
+	}
+	return result, rows.Err()
+}
+
+// Gaps returns the missing open-time ranges in [start, end], with both
+// bounds aligned to the interval.
+func (s *candleStore) Gaps(symbol, interval string, start, end int64) ([]candleGap, error) {
+	duration, exists := intervalDurations[interval]
+	if !exists {
+		return nil, fmt.Errorf("unknown interval %q", interval)
+	}
+	step := duration.Milliseconds()
+	start = (start + step - 1) / step * step
+	end = end / step * step
+
+	rows, err := s.db.Query(`SELECT open_time FROM candles WHERE symbol = ? AND interval = ? AND open_time >= ? AND open_time <= ? ORDER BY open_time`,
+		symbol, interval, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var gaps []candleGap
+	expected := start
+	for rows.Next() {
+		var openTime int64
+		if err := rows.Scan(&openTime); err != nil {
+			return nil, err
+		}
+		if openTime > expected {
+			gaps = append(gaps, candleGap{Start: expected, End: openTime - step})
+		}
+		expected = openTime + step
+	}
+	if expected <= end {
+		gaps = append(gaps, candleGap{Start: expected, End: end})
+	}
+	return gaps, rows.Err()
+}
+
+// backfillKlines downloads every missing candle of [start, end] through the
+// exchange, 1000 per request by startTime, and returns how many it saved.
+func backfillKlines(exchange Exchange, store *candleStore, symbol, interval string, start, end time.Time) (int, error) {
+	gaps, err := store.Gaps(symbol, interval, start.UnixMilli(), end.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+
+	step := intervalDurations[interval].Milliseconds()
+	var total int
+	for _, gap := range gaps {
+		from := gap.Start
+		for from <= gap.End {
+			limit := int((gap.End-from)/step + 1)
+			if limit > 1000 {
+				limit = 1000
+			}
+			klines, err := getKlinesFrom(exchange, symbol, interval, from, limit)
+			if err != nil {
+				return total, err
+			}
+			if len(klines) == 0 {
+				break
+			}
+
+			if err := store.Save(symbol, interval, klines); err != nil {
+				return total, err
+			}
+			total += len(klines)
+
+			next := klines[len(klines)-1].OpenTime + step
+			if next <= from {
+				break
+			}
+			from = next
+		}
+	}
+
+	return total, nil
+}
+
+// importKlinesZip loads one of Binance's public monthly dumps, e.g.
+// BTCUSDT-15m-2024-01.zip, taking the symbol and interval from the CSV name.
+func importKlinesZip(store *candleStore, path string) (int, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return 0, err
+	}
+	defer archive.Close()
+
+	var total int
+	for _, file := range archive.File {
+		if !strings.HasSuffix(file.Name, ".csv") {
+			continue
+		}
+
+		parts := strings.Split(strings.TrimSuffix(filepath.Base(file.Name), ".csv"), "-")
+		if len(parts) < 2 {
+			return total, fmt.Errorf("%s: expected SYMBOL-INTERVAL-... file name", file.Name)
+		}
+		symbol, interval := strings.ToUpper(parts[0]), parts[1]
+		if _, exists := intervalDurations[interval]; !exists {
+			return total, fmt.Errorf("%s: unknown interval %q", file.Name, interval)
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return total, err
+		}
+		klines, err := readKlinesCSV(reader)
+		reader.Close()
+		if err != nil {
+			return total, fmt.Errorf("%s: %v", file.Name, err)
+		}
+
+		if err := store.Save(symbol, interval, klines); err != nil {
+			return total, err
+		}
+		total += len(klines)
+	}
+
+	return total, nil
+}
+
+var (
+	candleStoreOnce   sync.Once
+	sharedCandleStore *candleStore
+)
+
+// initCandleStore returns the store configured in candles.path, or nil when
+// the screener should fetch every candle from the exchange.
+func initCandleStore() *candleStore {
+	if config.Candles.Path == "" {
+		return nil
+	}
+
+	candleStoreOnce.Do(func() {
+		store, err := openCandleStore(config.Candles.Path)
+		if err != nil {
+			log.Fatalf("Unable to open candle store: %v", err)
+		}
+		sharedCandleStore = store
+	})
+	return sharedCandleStore
+}
+
+// getScreeningKlines returns the latest limit candles of symbol. With a candle
+// store only the candles since the last stored one are fetched; the last
+// stored candle is fetched again because it may have been saved while open.
+func getScreeningKlines(exchange Exchange, symbol string, limit int) ([]*binance.Kline, error) {
+	store := initCandleStore()
+	if store == nil {
+		return getKlines(exchange, symbol, limit)
+	}
+
+	latest, err := store.Latest(symbol, KLINE_INTERVAL, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	var klines []*binance.Kline
+	if len(latest) > 0 {
+		klines, err = getKlinesFrom(exchange, symbol, KLINE_INTERVAL, latest[0].OpenTime, 1000)
+	}
+	// Nothing stored yet, or too far behind to catch up in one request.
+	if len(latest) == 0 || len(klines) >= 1000 {
+		klines, err = getKlines(exchange, symbol, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := store.Save(symbol, KLINE_INTERVAL, klines); err != nil {
+		return nil, err
+	}
+
+	return store.Latest(symbol, KLINE_INTERVAL, limit)
+}
+
+func runDownloadKlines(args []string) error {
+	flags := flag.NewFlagSet("download-klines", flag.ContinueOnError)
+	path := flags.String("path", candleStorePath(), "candle store to fill")
+	symbolsFlag := flags.String("symbols", "", "comma separated symbols, default every trading USDT pair")
+	interval := flags.String("interval", KLINE_INTERVAL, "kline interval")
+	from := flags.String("from", time.Now().AddDate(0, -1, 0).Format("2006-01-02"), "first day to download (YYYY-MM-DD)")
+	to := flags.String("to", "", "last day to download (YYYY-MM-DD), default now")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if _, exists := intervalDurations[*interval]; !exists {
+		return fmt.Errorf("unknown interval %q", *interval)
+	}
+	start, err := time.Parse("2006-01-02", *from)
+	if err != nil {
+		return fmt.Errorf("-from: %v", err)
+	}
+	end := time.Now()
+	if *to != "" {
+		end, err = time.Parse("2006-01-02", *to)
+		if err != nil {
+			return fmt.Errorf("-to: %v", err)
+		}
+		end = end.Add(24*time.Hour - time.Millisecond)
+	}
+
+	store, err := openCandleStore(*path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	exchange := initExchange()
+
+	var symbols []string
+	if *symbolsFlag != "" {
+		symbols = strings.Split(strings.ToUpper(*symbolsFlag), ",")
+	} else {
+		pairs, err := getActivePairs(exchange)
+		if err != nil {
+			return err
+		}
+		for _, pair := range pairs {
+			symbols = append(symbols, pair.Symbol)
+		}
+	}
+
+	var failed int
+	for _, symbol := range symbols {
+		total, err := backfillKlines(exchange, store, symbol, *interval, start, end)
+		if err != nil {
+			fmt.Println("[Download Klines]", symbol, err)
+			failed++
+			continue
+		}
+		fmt.Println("[Download Klines]", symbol, "saved", total, "candles")
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d symbols failed", failed, len(symbols))
+	}
+	return nil
+}
+
+func runImportKlines(args []string) error {
+	flags := flag.NewFlagSet("import-klines", flag.ContinueOnError)
+	path := flags.String("path", candleStorePath(), "candle store to fill")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errors.New("pass one or more Binance monthly kline .zip files")
+	}
+
+	store, err := openCandleStore(*path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	for _, file := range flags.Args() {
+		total, err := importKlinesZip(store, file)
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		fmt.Println("[Import Klines]", filepath.Base(file), "saved", total, "candles")
+	}
+	return nil
+}
+
+func candleStorePath() string {
+	if config.Candles.Path != "" {
+		return config.Candles.Path
+	}
+	return DEFAULT_CANDLES_PATH
+}
+
+func getKlinesFrom(exchange Exchange, symbol, interval string, startTime int64, limit int) ([]*binance.Kline, error) {
+	return exchange.GetKlinesFrom(context.Background(), symbol, interval, startTime, limit)
+}
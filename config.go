@@ -0,0 +1,968 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var config Config
+
+type Config struct {
+	Server       ServerConfig       `yaml:"server"`
+	Binance      BinanceConfig      `yaml:"binance"`
+	GoogleSheets GoogleSheetsConfig `yaml:"google_sheets"`
+	Telegram     TelegramConfig     `yaml:"telegram"`
+	Trading      TradingConfig      `yaml:"trading"`
+	Storage      StorageConfig      `yaml:"storage"`
+	Candles      CandlesConfig      `yaml:"candles"`
+	Screening    ScreeningConfig    `yaml:"screening"`
+	Paper        PaperConfig        `yaml:"paper"`
+	Risk         RiskConfig         `yaml:"risk"`
+	Scheduler    SchedulerConfig    `yaml:"scheduler"`
+	Strategies   []StrategyConfig   `yaml:"strategies"`
+}
+
+type ServerConfig struct {
+	Port string `yaml:"port"`
+
+	// ControlToken guards the kill switch endpoints, sent as
+	// "Authorization: Bearer <token>". They are off while it is empty.
+	ControlToken string `yaml:"control_token"`
+}
+
+type BinanceConfig struct {
+	APIKey    string `yaml:"api_key"`
+	SecretKey string `yaml:"secret_key"`
+
+	// BaseURL replaces the REST endpoint, e.g. to point the client at the
+	// local stand-in server. Empty means Binance production.
+	BaseURL string `yaml:"base_url"`
+}
+
+type GoogleSheetsConfig struct {
+	SpreadsheetID   string `yaml:"spreadsheet_id"`
+	CredentialsFile string `yaml:"credentials_file"`
+}
+
+type TelegramConfig struct {
+	BotToken       string `yaml:"bot_token"`
+	ReceiverUserID int64  `yaml:"receiver_user_id"`
+}
+
+// StorageConfig selects where trades, cooldowns and screening state live:
+// "sheets" (the spreadsheet tabs) or "sqlite" (an embedded database file).
+type StorageConfig struct {
+	Driver     string `yaml:"driver"`
+	SQLitePath string `yaml:"sqlite_path"`
+}
+
+// CandlesConfig points the screener at a local candle store so it only
+// fetches the candles it has not seen yet. Empty Path fetches every candle
+// from the exchange, as before.
+type CandlesConfig struct {
+	Path string `yaml:"path"`
+}
+
+// ScreeningConfig holds the thresholds of the entry rules. The defaults are
+// the values the screener has always used; the optimize command searches
+// them. TrendWindow is the number of candles averaged at each end of the
+// 300-candle window to decide the trend.
+type ScreeningConfig struct {
+	UpperMAFactor float64 `yaml:"upper_ma_factor"`
+	LowerMAFactor float64 `yaml:"lower_ma_factor"`
+	MAPeriod      int     `yaml:"ma_period"`
+	RSIPeriod     int     `yaml:"rsi_period"`
+	TrendWindow   int     `yaml:"trend_window"`
+}
+
+// StrategyConfig names one strategy to run. Its screening and trading
+// sections start from the top-level ones, so only the differences need to be
+// written. Name is stored with every trade of the strategy; cooldown_minutes
+// and max_workers always come from the top-level trading section. Buy and
+// Sell are the rules of a "rules" strategy, see rules.go.
+type StrategyConfig struct {
+	Name      string          `yaml:"name"`
+	Kind      string          `yaml:"kind"`
+	Buy       string          `yaml:"buy"`
+	Sell      string          `yaml:"sell"`
+	Screening ScreeningConfig `yaml:"-"`
+	Trading   TradingConfig   `yaml:"-"`
+
+	screening yaml.Node
+	trading   yaml.Node
+	// buyLine and sellLine are where the rules start in the config file, 0
+	// when they did not come from it.
+	buyLine  int
+	sellLine int
+}
+
+// UnmarshalYAML keeps the screening and trading sections aside until the
+// top-level sections they override are known.
+func (s *StrategyConfig) UnmarshalYAML(value *yaml.Node) error {
+	var raw struct {
+		Name      string    `yaml:"name"`
+		Kind      string    `yaml:"kind"`
+		Buy       yaml.Node `yaml:"buy"`
+		Sell      yaml.Node `yaml:"sell"`
+		Screening yaml.Node `yaml:"screening"`
+		Trading   yaml.Node `yaml:"trading"`
+	}
+	if err := checkKnownFields(value, reflect.TypeOf(raw)); err != nil {
+		return err
+	}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+
+	s.Name, s.Kind = raw.Name, raw.Kind
+	s.Buy, s.buyLine = ruleSource(raw.Buy)
+	s.Sell, s.sellLine = ruleSource(raw.Sell)
+	s.screening, s.trading = raw.Screening, raw.Trading
+	return nil
+}
+
+// checkKnownFields fails on a key of node that the struct it is decoded
+// into has no field for, at any depth. Node.Decode does not take the
+// decoder's KnownFields setting, so the sections a strategy keeps aside are
+// checked with this before they are decoded.
+func checkKnownFields(node *yaml.Node, target reflect.Type) error {
+	for target.Kind() == reflect.Ptr {
+		target = target.Elem()
+	}
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	switch {
+	case target == reflect.TypeOf(yaml.Node{}):
+		return nil
+	case target.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		fields := make(map[string]reflect.Type)
+		for i := 0; i < target.NumField(); i++ {
+			field := target.Field(i)
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if name == "-" || field.PkgPath != "" {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			fields[name] = field.Type
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			fieldType, exists := fields[key.Value]
+			if !exists {
+				return fmt.Errorf("line %d: field %s not found in type %s", key.Line, key.Value, target)
+			}
+			if err := checkKnownFields(node.Content[i+1], fieldType); err != nil {
+				return err
+			}
+		}
+	case target.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for _, item := range node.Content {
+			if err := checkKnownFields(item, target.Elem()); err != nil {
+				return err
+			}
+		}
+	case target.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			if err := checkKnownFields(node.Content[i], target.Elem()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ruleSource returns a rule's text and the config line its first line is on.
+// The text of a | or > block starts on the line after the indicator.
+func ruleSource(node yaml.Node) (string, int) {
+	if node.Kind == 0 {
+		return "", 0
+	}
+	if node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+		return node.Value, node.Line + 1
+	}
+	return node.Value, node.Line
+}
+
+// validateRules compiles the strategy's rules and reports where they fail.
+func (s StrategyConfig) validateRules(key string) (problems []string) {
+	check := func(source string, line int, name string) {
+		if _, err := compileRule(source); err != nil {
+			if line > 0 {
+				problems = append(problems, fmt.Sprintf("%s.%s (starting on config line %d): %v", key, name, line, err))
+			} else {
+				problems = append(problems, fmt.Sprintf("%s.%s: %v", key, name, err))
+			}
+		}
+	}
+
+	if s.Kind != STRATEGY_RULES {
+		if s.Buy != "" || s.Sell != "" {
+			problems = append(problems, fmt.Sprintf("%s: buy and sell are only used by kind %q", key, STRATEGY_RULES))
+		}
+		return problems
+	}
+
+	if s.Buy == "" {
+		problems = append(problems, fmt.Sprintf("%s.buy is required for kind %q", key, STRATEGY_RULES))
+	} else {
+		check(s.Buy, s.buyLine, "buy")
+	}
+	if s.Sell != "" {
+		check(s.Sell, s.sellLine, "sell")
+	}
+	return problems
+}
+
+// resolve lays the strategy's own sections over the top-level ones.
+func (s *StrategyConfig) resolve(screening ScreeningConfig, trading TradingConfig) error {
+	s.Screening, s.Trading = screening, trading.clone()
+	if s.screening.Kind != 0 {
+		if err := checkKnownFields(&s.screening, reflect.TypeOf(s.Screening)); err != nil {
+			return err
+		}
+		if err := s.screening.Decode(&s.Screening); err != nil {
+			return err
+		}
+	}
+	if s.trading.Kind != 0 {
+		if err := checkKnownFields(&s.trading, reflect.TypeOf(s.Trading)); err != nil {
+			return err
+		}
+		if err := s.trading.Decode(&s.Trading); err != nil {
+			return err
+		}
+	}
+	s.Trading.CooldownMinutes = trading.CooldownMinutes
+	s.Trading.MaxWorkers = trading.MaxWorkers
+	return nil
+}
+
+// clone copies the section's maps and slices. yaml decodes into a map it
+// is given, so without the copy a strategy's symbol_caps would end up in the
+// top-level section and in every strategy resolved after it.
+func (t TradingConfig) clone() TradingConfig {
+	t.TakeProfitLadder = append([]LadderLeg(nil), t.TakeProfitLadder...)
+	if t.Sizing.SymbolCaps != nil {
+		caps := make(map[string]float64, len(t.Sizing.SymbolCaps))
+		for symbol, cap := range t.Sizing.SymbolCaps {
+			caps[symbol] = cap
+		}
+		t.Sizing.SymbolCaps = caps
+	}
+	return t
+}
+
+// strategies returns the configured strategies, or the built-in
+// engulfing/breakout strategy on the top-level settings when none are.
+func (c Config) strategies() []StrategyConfig {
+	if len(c.Strategies) > 0 {
+		return c.Strategies
+	}
+	return []StrategyConfig{{
+		Name:      DEFAULT_STRATEGY_NAME,
+		Kind:      STRATEGY_ENGULFING_BREAKOUT,
+		Screening: c.Screening,
+		Trading:   c.Trading,
+	}}
+}
+
+// PaperConfig switches the bot to paper trading: market data still comes from
+// Binance but orders go to a simulated account whose balances and orders are
+// kept in StatePath. Trades are stored flagged as paper.
+type PaperConfig struct {
+	Enabled         bool    `yaml:"enabled"`
+	StartingBalance float64 `yaml:"starting_balance"`
+	FeeRate         float64 `yaml:"fee_rate"`
+	StatePath       string  `yaml:"state_path"`
+}
+
+// RiskConfig holds the portfolio limits checked before every buy, whatever
+// the strategy. A zero limit is off.
+//   - max_open_positions and max_exposure, the quote in open trades at cost,
+//     stop buying while they are reached
+//   - daily_loss_limit and weekly_loss_limit stop buying until the next day
+//     or Monday once the quote lost by trades closed since midnight or
+//     Monday reaches them
+//   - max_consecutive_losses stops buying for breaker_minutes after that
+//     many positions in a row closed at a loss
+//   - market_drop_percent stops buying for market_halt_minutes when
+//     market_symbol fell that far from its high of the last
+//     market_drop_minutes minutes
+type RiskConfig struct {
+	MaxOpenPositions     int     `yaml:"max_open_positions"`
+	MaxExposure          float64 `yaml:"max_exposure"`
+	DailyLossLimit       float64 `yaml:"daily_loss_limit"`
+	WeeklyLossLimit      float64 `yaml:"weekly_loss_limit"`
+	MaxConsecutiveLosses int     `yaml:"max_consecutive_losses"`
+	BreakerMinutes       int     `yaml:"breaker_minutes"`
+	MarketSymbol         string  `yaml:"market_symbol"`
+	MarketDropPercent    float64 `yaml:"market_drop_percent"`
+	MarketDropMinutes    int     `yaml:"market_drop_minutes"`
+	MarketHaltMinutes    int     `yaml:"market_halt_minutes"`
+}
+
+// SchedulerConfig runs the screening, order status and stop-loss checks in
+// the server process instead of waiting for their endpoints to be called.
+// The endpoints keep working as manual triggers and never run a job twice at
+// once.
+type SchedulerConfig struct {
+	Enabled     bool      `yaml:"enabled"`
+	Screening   JobConfig `yaml:"screening"`
+	OrderStatus JobConfig `yaml:"order_status"`
+	StopLoss    JobConfig `yaml:"stop_loss"`
+}
+
+// JobConfig schedules one job. Schedule is a cron expression, see
+// cronSchedule; "*/15 * * * *" fires at every 15m candle close. The run
+// starts delay_seconds after the scheduled minute, so the candle that closed
+// is final, plus up to jitter_seconds at random. A run that cannot start on
+// time, because the previous one is still going or the process was asleep,
+// is missed: "skip" waits for the next scheduled time and "run_once" runs
+// once right away for all of them. After timeout_seconds the run stops
+// making requests other than those that sell or protect what it bought. An
+// empty schedule only runs the job from its endpoint.
+type JobConfig struct {
+	Schedule       string `yaml:"schedule"`
+	DelaySeconds   int    `yaml:"delay_seconds"`
+	JitterSeconds  int    `yaml:"jitter_seconds"`
+	TimeoutSeconds int    `yaml:"timeout_seconds"`
+	Missed         string `yaml:"missed"`
+}
+
+type TradingConfig struct {
+	MinimumBalance    float64 `yaml:"minimum_balance"`
+	TakeProfitPercent float64 `yaml:"take_profit_percent"`
+	StopLossPercent   float64 `yaml:"stop_loss_percent"`
+	// StopLimitOffsetPercent puts the limit of the OCO's stop-loss leg this
+	// far below its trigger, so a fast fall still fills it.
+	StopLimitOffsetPercent float64 `yaml:"stop_limit_offset_percent"`
+	// ExitMode is "bracket", an OCO of take profit and stop loss, or
+	// "trailing", a stop kept by the price monitor that starts at
+	// stop_loss_percent and follows the highest price since entry, either
+	// trailing_atr_multiple ATRs below it when set or trailing_percent.
+	ExitMode            string  `yaml:"exit_mode"`
+	TrailingPercent     float64 `yaml:"trailing_percent"`
+	TrailingATRMultiple float64 `yaml:"trailing_atr_multiple"`
+	TrailingATRPeriod   int     `yaml:"trailing_atr_period"`
+	// TakeProfitLadder, when set, replaces the single exit of exit_mode:
+	// the position is sold in legs, see LadderLeg.
+	TakeProfitLadder []LadderLeg  `yaml:"take_profit_ladder"`
+	MaxQuotePerTrade float64      `yaml:"max_quote_per_trade"`
+	Sizing           SizingConfig `yaml:"sizing"`
+	MinAlertCoins    int          `yaml:"min_alert_coins"`
+	CooldownMinutes  int          `yaml:"cooldown_minutes"`
+	MaxWorkers       int          `yaml:"max_workers"`
+}
+
+// SizingConfig picks how much quote a buy spends. Mode is one of
+//   - "divider": the free balance above minimum_balance split over the
+//     alerted pairs, at most 4, buying max_quote_per_trade only when the
+//     split is above it, as the bot always has
+//   - "fixed": fixed_quote
+//   - "equity_percent": equity_percent of the equity
+//   - "risk": what loses risk_percent of the equity at the stop loss
+//   - "atr": what loses risk_percent of the equity atr_multiple ATRs of
+//     atr_period candles below the entry
+//   - "kelly": kelly_fraction of the Kelly fraction of the equity, from the
+//     win rate and payoff of the strategy's closed trades, and
+//     equity_percent until kelly_min_trades of them closed
+//
+// The equity is the free balance plus the open trades at cost. Every mode
+// is capped by max_quote_per_trade, the free balance above minimum_balance,
+// max_exposure_percent of the equity in open trades and, per pair,
+// max_symbol_percent of the equity or its symbol_caps quote. A zero cap is
+// off.
+type SizingConfig struct {
+	Mode               string             `yaml:"mode"`
+	FixedQuote         float64            `yaml:"fixed_quote"`
+	EquityPercent      float64            `yaml:"equity_percent"`
+	RiskPercent        float64            `yaml:"risk_percent"`
+	ATRMultiple        float64            `yaml:"atr_multiple"`
+	ATRPeriod          int                `yaml:"atr_period"`
+	KellyFraction      float64            `yaml:"kelly_fraction"`
+	KellyMinTrades     int                `yaml:"kelly_min_trades"`
+	MaxExposurePercent float64            `yaml:"max_exposure_percent"`
+	MaxSymbolPercent   float64            `yaml:"max_symbol_percent"`
+	SymbolCaps         map[string]float64 `yaml:"symbol_caps"`
+}
+
+// parseSymbolCapsEnv reads per-pair caps written as comma separated
+// SYMBOL:quote, e.g. "BTCUSDT:50,ETHUSDT:25".
+func parseSymbolCapsEnv(value string, target *map[string]float64) error {
+	caps := make(map[string]float64)
+	for _, part := range strings.Split(value, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ":")
+		if len(fields) != 2 || fields[0] == "" {
+			return fmt.Errorf("cap %q is not SYMBOL:quote", part)
+		}
+		var cap float64
+		if err := parseFloat64Env(fields[1], &cap); err != nil {
+			return err
+		}
+		caps[strings.ToUpper(fields[0])] = cap
+	}
+	*target = caps
+	return nil
+}
+
+// LadderLeg is one exit of a take-profit ladder: Percent of the bought
+// quantity is sold by an OCO of a take profit TakeProfitPercent above the
+// entry and the strategy's stop loss, or, when Trailing is set, by the
+// trailing stop of the trailing exit mode.
+type LadderLeg struct {
+	Percent           float64 `yaml:"percent"`
+	TakeProfitPercent float64 `yaml:"take_profit_percent"`
+	Trailing          bool    `yaml:"trailing"`
+}
+
+// parseLadderEnv reads a ladder written as comma separated legs of
+// percent:take_profit_percent, or percent:trailing, e.g.
+// "40:1.5,40:3,20:trailing".
+func parseLadderEnv(value string, target *[]LadderLeg) error {
+	var ladder []LadderLeg
+	for _, part := range strings.Split(value, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ":")
+		if len(fields) != 2 {
+			return fmt.Errorf("leg %q is not percent:take_profit_percent or percent:trailing", part)
+		}
+		var leg LadderLeg
+		if err := parseFloat64Env(fields[0], &leg.Percent); err != nil {
+			return err
+		}
+		if strings.EqualFold(fields[1], "trailing") {
+			leg.Trailing = true
+		} else if err := parseFloat64Env(fields[1], &leg.TakeProfitPercent); err != nil {
+			return err
+		}
+		ladder = append(ladder, leg)
+	}
+	*target = ladder
+	return nil
+}
+
+// envOverride maps an environment variable onto a config field. The names
+// match the constants that used to live in const.go so existing deploys keep
+// working.
+type envOverride struct {
+	name  string
+	apply func(c *Config, value string) error
+}
+
+var envOverrides = []envOverride{
+	{"PORT", func(c *Config, v string) error { c.Server.Port = v; return nil }},
+	{"CONTROL_TOKEN", func(c *Config, v string) error { c.Server.ControlToken = v; return nil }},
+	{"BINANCE_API_KEY", func(c *Config, v string) error { c.Binance.APIKey = v; return nil }},
+	{"BINANCE_SECRET_KEY", func(c *Config, v string) error { c.Binance.SecretKey = v; return nil }},
+	{"BINANCE_BASE_URL", func(c *Config, v string) error { c.Binance.BaseURL = v; return nil }},
+	{"SPREADSHEET_ID", func(c *Config, v string) error { c.GoogleSheets.SpreadsheetID = v; return nil }},
+	{"GOOGLE_CREDENTIALS_FILE", func(c *Config, v string) error { c.GoogleSheets.CredentialsFile = v; return nil }},
+	{"BOT_TOKEN", func(c *Config, v string) error { c.Telegram.BotToken = v; return nil }},
+	{"RECEIVER_USER_ID", func(c *Config, v string) error { return parseInt64Env(v, &c.Telegram.ReceiverUserID) }},
+	{"STORAGE_DRIVER", func(c *Config, v string) error { c.Storage.Driver = v; return nil }},
+	{"SQLITE_PATH", func(c *Config, v string) error { c.Storage.SQLitePath = v; return nil }},
+	{"CANDLES_PATH", func(c *Config, v string) error { c.Candles.Path = v; return nil }},
+	{"MINIMUM_BALANCE", func(c *Config, v string) error { return parseFloat64Env(v, &c.Trading.MinimumBalance) }},
+	{"TAKE_PROFIT_PERCENT", func(c *Config, v string) error { return parseFloat64Env(v, &c.Trading.TakeProfitPercent) }},
+	{"STOP_LOSS_PERCENT", func(c *Config, v string) error { return parseFloat64Env(v, &c.Trading.StopLossPercent) }},
+	{"STOP_LIMIT_OFFSET_PERCENT", func(c *Config, v string) error { return parseFloat64Env(v, &c.Trading.StopLimitOffsetPercent) }},
+	{"EXIT_MODE", func(c *Config, v string) error { c.Trading.ExitMode = v; return nil }},
+	{"TRAILING_PERCENT", func(c *Config, v string) error { return parseFloat64Env(v, &c.Trading.TrailingPercent) }},
+	{"TRAILING_ATR_MULTIPLE", func(c *Config, v string) error { return parseFloat64Env(v, &c.Trading.TrailingATRMultiple) }},
+	{"TRAILING_ATR_PERIOD", func(c *Config, v string) error { return parseIntEnv(v, &c.Trading.TrailingATRPeriod) }},
+	{"TAKE_PROFIT_LADDER", func(c *Config, v string) error { return parseLadderEnv(v, &c.Trading.TakeProfitLadder) }},
+	{"MAX_QUOTE_PER_TRADE", func(c *Config, v string) error { return parseFloat64Env(v, &c.Trading.MaxQuotePerTrade) }},
+	{"SIZING_MODE", func(c *Config, v string) error { c.Trading.Sizing.Mode = v; return nil }},
+	{"SIZING_FIXED_QUOTE", func(c *Config, v string) error { return parseFloat64Env(v, &c.Trading.Sizing.FixedQuote) }},
+	{"SIZING_EQUITY_PERCENT", func(c *Config, v string) error { return parseFloat64Env(v, &c.Trading.Sizing.EquityPercent) }},
+	{"SIZING_RISK_PERCENT", func(c *Config, v string) error { return parseFloat64Env(v, &c.Trading.Sizing.RiskPercent) }},
+	{"SIZING_ATR_MULTIPLE", func(c *Config, v string) error { return parseFloat64Env(v, &c.Trading.Sizing.ATRMultiple) }},
+	{"SIZING_ATR_PERIOD", func(c *Config, v string) error { return parseIntEnv(v, &c.Trading.Sizing.ATRPeriod) }},
+	{"SIZING_KELLY_FRACTION", func(c *Config, v string) error { return parseFloat64Env(v, &c.Trading.Sizing.KellyFraction) }},
+	{"SIZING_KELLY_MIN_TRADES", func(c *Config, v string) error { return parseIntEnv(v, &c.Trading.Sizing.KellyMinTrades) }},
+	{"MAX_EXPOSURE_PERCENT", func(c *Config, v string) error { return parseFloat64Env(v, &c.Trading.Sizing.MaxExposurePercent) }},
+	{"MAX_SYMBOL_PERCENT", func(c *Config, v string) error { return parseFloat64Env(v, &c.Trading.Sizing.MaxSymbolPercent) }},
+	{"SYMBOL_CAPS", func(c *Config, v string) error { return parseSymbolCapsEnv(v, &c.Trading.Sizing.SymbolCaps) }},
+	{"MIN_ALERT_COINS", func(c *Config, v string) error { return parseIntEnv(v, &c.Trading.MinAlertCoins) }},
+	{"COOLDOWN_MINUTES", func(c *Config, v string) error { return parseIntEnv(v, &c.Trading.CooldownMinutes) }},
+	{"MAX_WORKERS", func(c *Config, v string) error { return parseIntEnv(v, &c.Trading.MaxWorkers) }},
+	{"UPPER_MA_FACTOR", func(c *Config, v string) error { return parseFloat64Env(v, &c.Screening.UpperMAFactor) }},
+	{"LOWER_MA_FACTOR", func(c *Config, v string) error { return parseFloat64Env(v, &c.Screening.LowerMAFactor) }},
+	{"MA_PERIOD", func(c *Config, v string) error { return parseIntEnv(v, &c.Screening.MAPeriod) }},
+	{"RSI_PERIOD", func(c *Config, v string) error { return parseIntEnv(v, &c.Screening.RSIPeriod) }},
+	{"TREND_WINDOW", func(c *Config, v string) error { return parseIntEnv(v, &c.Screening.TrendWindow) }},
+	{"PAPER_TRADING", func(c *Config, v string) error { return parseBoolEnv(v, &c.Paper.Enabled) }},
+	{"PAPER_STARTING_BALANCE", func(c *Config, v string) error { return parseFloat64Env(v, &c.Paper.StartingBalance) }},
+	{"PAPER_FEE_RATE", func(c *Config, v string) error { return parseFloat64Env(v, &c.Paper.FeeRate) }},
+	{"PAPER_STATE_PATH", func(c *Config, v string) error { c.Paper.StatePath = v; return nil }},
+	{"MAX_OPEN_POSITIONS", func(c *Config, v string) error { return parseIntEnv(v, &c.Risk.MaxOpenPositions) }},
+	{"MAX_EXPOSURE", func(c *Config, v string) error { return parseFloat64Env(v, &c.Risk.MaxExposure) }},
+	{"DAILY_LOSS_LIMIT", func(c *Config, v string) error { return parseFloat64Env(v, &c.Risk.DailyLossLimit) }},
+	{"WEEKLY_LOSS_LIMIT", func(c *Config, v string) error { return parseFloat64Env(v, &c.Risk.WeeklyLossLimit) }},
+	{"MAX_CONSECUTIVE_LOSSES", func(c *Config, v string) error { return parseIntEnv(v, &c.Risk.MaxConsecutiveLosses) }},
+	{"BREAKER_MINUTES", func(c *Config, v string) error { return parseIntEnv(v, &c.Risk.BreakerMinutes) }},
+	{"MARKET_SYMBOL", func(c *Config, v string) error { c.Risk.MarketSymbol = v; return nil }},
+	{"MARKET_DROP_PERCENT", func(c *Config, v string) error { return parseFloat64Env(v, &c.Risk.MarketDropPercent) }},
+	{"MARKET_DROP_MINUTES", func(c *Config, v string) error { return parseIntEnv(v, &c.Risk.MarketDropMinutes) }},
+	{"MARKET_HALT_MINUTES", func(c *Config, v string) error { return parseIntEnv(v, &c.Risk.MarketHaltMinutes) }},
+	{"SCHEDULER_ENABLED", func(c *Config, v string) error { return parseBoolEnv(v, &c.Scheduler.Enabled) }},
+	{"SCREENING_SCHEDULE", func(c *Config, v string) error { c.Scheduler.Screening.Schedule = v; return nil }},
+	{"ORDER_STATUS_SCHEDULE", func(c *Config, v string) error { c.Scheduler.OrderStatus.Schedule = v; return nil }},
+	{"STOP_LOSS_SCHEDULE", func(c *Config, v string) error { c.Scheduler.StopLoss.Schedule = v; return nil }},
+}
+
+func defaultConfig() Config {
+	return Config{
+		Server: ServerConfig{
+			Port: DEFAULT_PORT,
+		},
+		GoogleSheets: GoogleSheetsConfig{
+			CredentialsFile: DEFAULT_CREDENTIALS_FILE,
+		},
+		Trading: TradingConfig{
+			MinimumBalance:         DEFAULT_MINIMUM_BALANCE,
+			TakeProfitPercent:      DEFAULT_TAKE_PROFIT_PERCENT,
+			StopLossPercent:        DEFAULT_STOP_LOSS_PERCENT,
+			StopLimitOffsetPercent: DEFAULT_STOP_LIMIT_OFFSET,
+			ExitMode:               EXIT_MODE_BRACKET,
+			TrailingPercent:        DEFAULT_TRAILING_PERCENT,
+			TrailingATRPeriod:      DEFAULT_TRAILING_ATR_PERIOD,
+			MaxQuotePerTrade:       DEFAULT_MAX_QUOTE_PER_TRADE,
+			MinAlertCoins:          DEFAULT_MIN_ALERT_COINS,
+			CooldownMinutes:        DEFAULT_COOLDOWN_MINUTES,
+			MaxWorkers:             DEFAULT_MAX_WORKERS,
+			Sizing: SizingConfig{
+				Mode:           SIZING_DIVIDER,
+				FixedQuote:     DEFAULT_MAX_QUOTE_PER_TRADE,
+				EquityPercent:  DEFAULT_SIZING_EQUITY_PERCENT,
+				RiskPercent:    DEFAULT_SIZING_RISK_PERCENT,
+				ATRMultiple:    DEFAULT_SIZING_ATR_MULTIPLE,
+				ATRPeriod:      DEFAULT_SIZING_ATR_PERIOD,
+				KellyFraction:  DEFAULT_SIZING_KELLY_FRACTION,
+				KellyMinTrades: DEFAULT_SIZING_KELLY_MIN_TRADES,
+			},
+		},
+		Storage: StorageConfig{
+			Driver:     STORAGE_SHEETS,
+			SQLitePath: DEFAULT_SQLITE_PATH,
+		},
+		Screening: defaultScreeningConfig(),
+		Paper: PaperConfig{
+			StartingBalance: DEFAULT_PAPER_STARTING_BALANCE,
+			FeeRate:         DEFAULT_PAPER_FEE_RATE,
+			StatePath:       DEFAULT_PAPER_STATE_PATH,
+		},
+		Risk: RiskConfig{
+			BreakerMinutes:    DEFAULT_BREAKER_MINUTES,
+			MarketSymbol:      DEFAULT_MARKET_SYMBOL,
+			MarketDropMinutes: DEFAULT_MARKET_DROP_MINUTES,
+			MarketHaltMinutes: DEFAULT_MARKET_HALT_MINUTES,
+		},
+		Scheduler: SchedulerConfig{
+			Screening: JobConfig{
+				Schedule:       DEFAULT_SCREENING_SCHEDULE,
+				DelaySeconds:   DEFAULT_SCREENING_DELAY_SECONDS,
+				JitterSeconds:  DEFAULT_SCHEDULER_JITTER_SECONDS,
+				TimeoutSeconds: DEFAULT_SCREENING_TIMEOUT,
+				Missed:         SCHEDULER_MISSED_SKIP,
+			},
+			OrderStatus: JobConfig{
+				Schedule:       DEFAULT_ORDER_STATUS_SCHEDULE,
+				JitterSeconds:  DEFAULT_SCHEDULER_JITTER_SECONDS,
+				TimeoutSeconds: DEFAULT_ORDER_STATUS_TIMEOUT,
+				Missed:         SCHEDULER_MISSED_RUN_ONCE,
+			},
+			StopLoss: JobConfig{
+				Schedule:       DEFAULT_STOP_LOSS_SCHEDULE,
+				DelaySeconds:   DEFAULT_STOP_LOSS_DELAY_SECONDS,
+				JitterSeconds:  DEFAULT_SCHEDULER_JITTER_SECONDS,
+				TimeoutSeconds: DEFAULT_STOP_LOSS_TIMEOUT,
+				Missed:         SCHEDULER_MISSED_RUN_ONCE,
+			},
+		},
+	}
+}
+
+func defaultScreeningConfig() ScreeningConfig {
+	return ScreeningConfig{
+		UpperMAFactor: DEFAULT_UPPER_MA_FACTOR,
+		LowerMAFactor: DEFAULT_LOWER_MA_FACTOR,
+		MAPeriod:      DEFAULT_MA_PERIOD,
+		RSIPeriod:     DEFAULT_RSI_PERIOD,
+		TrendWindow:   DEFAULT_TREND_WINDOW,
+	}
+}
+
+// loadConfig builds the configuration from the defaults, the YAML file named
+// by CONFIG_FILE (config.yaml when unset) and finally the environment. A
+// missing file is only an error when CONFIG_FILE was set explicitly. Offline
+// commands pass requireCredentials=false so they run without API keys.
+func loadConfig(requireCredentials bool) (Config, error) {
+	c := defaultConfig()
+
+	path, explicit := os.LookupEnv("CONFIG_FILE")
+	if !explicit {
+		path = DEFAULT_CONFIG_FILE
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if explicit || !errors.Is(err, os.ErrNotExist) {
+			return c, fmt.Errorf("unable to read config file %s: %v", path, err)
+		}
+	} else {
+		// A misspelled key is an error rather than a setting silently left
+		// at its default.
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+			return c, fmt.Errorf("unable to parse config file %s: %v", path, err)
+		}
+	}
+
+	var problems []string
+	for _, override := range envOverrides {
+		value, ok := os.LookupEnv(override.name)
+		if !ok {
+			continue
+		}
+		if err := override.apply(&c, value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", override.name, err))
+		}
+	}
+
+	for i := range c.Strategies {
+		if err := c.Strategies[i].resolve(c.Screening, c.Trading); err != nil {
+			problems = append(problems, fmt.Sprintf("strategies[%d]: %v", i, err))
+		}
+	}
+
+	problems = append(problems, c.validate(requireCredentials)...)
+	if len(problems) > 0 {
+		return c, fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+
+	return c, nil
+}
+
+func (c Config) validate(requireCredentials bool) (problems []string) {
+	required := func(value, key, env string) {
+		if value == "" {
+			problems = append(problems, fmt.Sprintf("%s is required (or set %s)", key, env))
+		}
+	}
+
+	if requireCredentials {
+		required(c.Server.Port, "server.port", "PORT")
+		// Paper trading only reads public market data.
+		if !c.Paper.Enabled {
+			required(c.Binance.APIKey, "binance.api_key", "BINANCE_API_KEY")
+			required(c.Binance.SecretKey, "binance.secret_key", "BINANCE_SECRET_KEY")
+		}
+		required(c.Telegram.BotToken, "telegram.bot_token", "BOT_TOKEN")
+
+		if c.Telegram.ReceiverUserID == 0 {
+			problems = append(problems, "telegram.receiver_user_id is required (or set RECEIVER_USER_ID)")
+		}
+	}
+
+	switch c.Storage.Driver {
+	case STORAGE_SHEETS:
+		if requireCredentials {
+			required(c.GoogleSheets.SpreadsheetID, "google_sheets.spreadsheet_id", "SPREADSHEET_ID")
+			required(c.GoogleSheets.CredentialsFile, "google_sheets.credentials_file", "GOOGLE_CREDENTIALS_FILE")
+		}
+	case STORAGE_SQLITE:
+		required(c.Storage.SQLitePath, "storage.sqlite_path", "SQLITE_PATH")
+	default:
+		problems = append(problems, fmt.Sprintf("storage.driver must be %q or %q, got %q", STORAGE_SHEETS, STORAGE_SQLITE, c.Storage.Driver))
+	}
+
+	problems = append(problems, c.Trading.validate("trading")...)
+	problems = append(problems, c.Screening.validate("screening")...)
+	problems = append(problems, c.Risk.validate("risk")...)
+	problems = append(problems, c.Scheduler.Screening.validate("scheduler.screening")...)
+	problems = append(problems, c.Scheduler.OrderStatus.validate("scheduler.order_status")...)
+	problems = append(problems, c.Scheduler.StopLoss.validate("scheduler.stop_loss")...)
+
+	names := make(map[string]bool)
+	for i, strategy := range c.Strategies {
+		key := fmt.Sprintf("strategies[%d]", i)
+		if strategy.Name == "" {
+			problems = append(problems, key+".name is required")
+		} else if names[strategy.Name] {
+			problems = append(problems, fmt.Sprintf("%s.name %q is used twice", key, strategy.Name))
+		}
+		names[strategy.Name] = true
+
+		if _, exists := strategyKinds[strategy.Kind]; !exists {
+			problems = append(problems, fmt.Sprintf("%s.kind %q is not a known strategy", key, strategy.Kind))
+		}
+		problems = append(problems, strategy.validateRules(key)...)
+		problems = append(problems, strategy.Trading.validate(key+".trading")...)
+		problems = append(problems, strategy.Screening.validate(key+".screening")...)
+	}
+
+	if c.Paper.Enabled {
+		if c.Paper.StartingBalance <= 0 {
+			problems = append(problems, fmt.Sprintf("paper.starting_balance must be > 0, got %v", c.Paper.StartingBalance))
+		}
+		if c.Paper.FeeRate < 0 || c.Paper.FeeRate >= 1 {
+			problems = append(problems, fmt.Sprintf("paper.fee_rate must be between 0 and 1, got %v", c.Paper.FeeRate))
+		}
+		required(c.Paper.StatePath, "paper.state_path", "PAPER_STATE_PATH")
+	}
+
+	return problems
+}
+
+func parseIntEnv(value string, target *int) error {
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("%q is not an integer", value)
+	}
+	*target = v
+	return nil
+}
+
+func parseInt64Env(value string, target *int64) error {
+	v, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%q is not an integer", value)
+	}
+	*target = v
+	return nil
+}
+
+func parseBoolEnv(value string, target *bool) error {
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("%q is not a boolean", value)
+	}
+	*target = v
+	return nil
+}
+
+func parseFloat64Env(value string, target *float64) error {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("%q is not a number", value)
+	}
+	*target = v
+	return nil
+}
+
+func (t TradingConfig) validate(key string) (problems []string) {
+	if t.MinimumBalance < 0 {
+		problems = append(problems, fmt.Sprintf("%s.minimum_balance must be >= 0, got %v", key, t.MinimumBalance))
+	}
+	if t.TakeProfitPercent <= 0 {
+		problems = append(problems, fmt.Sprintf("%s.take_profit_percent must be > 0, got %v", key, t.TakeProfitPercent))
+	}
+	if t.StopLossPercent <= 0 || t.StopLossPercent >= 100 {
+		problems = append(problems, fmt.Sprintf("%s.stop_loss_percent must be between 0 and 100, got %v", key, t.StopLossPercent))
+	}
+	if t.StopLimitOffsetPercent < 0 || t.StopLossPercent+t.StopLimitOffsetPercent >= 100 {
+		problems = append(problems, fmt.Sprintf("%s.stop_limit_offset_percent must be >= 0 and keep the stop limit above 0, got %v", key, t.StopLimitOffsetPercent))
+	}
+	switch t.ExitMode {
+	case EXIT_MODE_BRACKET, EXIT_MODE_TRAILING:
+	default:
+		problems = append(problems, fmt.Sprintf("%s.exit_mode must be %q or %q, got %q", key, EXIT_MODE_BRACKET, EXIT_MODE_TRAILING, t.ExitMode))
+	}
+	if t.TrailingPercent < 0 || t.TrailingPercent >= 100 {
+		problems = append(problems, fmt.Sprintf("%s.trailing_percent must be between 0 and 100, got %v", key, t.TrailingPercent))
+	}
+	if t.TrailingATRMultiple < 0 {
+		problems = append(problems, fmt.Sprintf("%s.trailing_atr_multiple must be >= 0, got %v", key, t.TrailingATRMultiple))
+	}
+	if t.ExitMode == EXIT_MODE_TRAILING && t.TrailingPercent == 0 && t.TrailingATRMultiple == 0 {
+		problems = append(problems, fmt.Sprintf("%s.exit_mode %q needs trailing_percent or trailing_atr_multiple > 0", key, EXIT_MODE_TRAILING))
+	}
+	if t.TrailingATRPeriod < 1 || t.TrailingATRPeriod >= SCREENING_WINDOW {
+		problems = append(problems, fmt.Sprintf("%s.trailing_atr_period must be between 1 and %d, got %v", key, SCREENING_WINDOW-1, t.TrailingATRPeriod))
+	}
+	problems = append(problems, validateLadder(key, t)...)
+	problems = append(problems, t.Sizing.validate(key+".sizing")...)
+	if t.MaxQuotePerTrade <= 0 {
+		problems = append(problems, fmt.Sprintf("%s.max_quote_per_trade must be > 0, got %v", key, t.MaxQuotePerTrade))
+	}
+	if t.MinAlertCoins < 0 {
+		problems = append(problems, fmt.Sprintf("%s.min_alert_coins must be >= 0, got %v", key, t.MinAlertCoins))
+	}
+	if t.CooldownMinutes < 0 {
+		problems = append(problems, fmt.Sprintf("%s.cooldown_minutes must be >= 0, got %v", key, t.CooldownMinutes))
+	}
+	if t.MaxWorkers <= 0 {
+		problems = append(problems, fmt.Sprintf("%s.max_workers must be > 0, got %v", key, t.MaxWorkers))
+	}
+	return problems
+}
+
+func (s SizingConfig) validate(key string) (problems []string) {
+	if _, exists := sizingModes[s.Mode]; !exists {
+		problems = append(problems, fmt.Sprintf("%s.mode must be one of %s, got %q", key, strings.Join(sizingModeNames(), ", "), s.Mode))
+	}
+	if s.Mode == SIZING_FIXED && s.FixedQuote <= 0 {
+		problems = append(problems, fmt.Sprintf("%s.fixed_quote must be > 0, got %v", key, s.FixedQuote))
+	}
+	if s.EquityPercent <= 0 || s.EquityPercent > 100 {
+		problems = append(problems, fmt.Sprintf("%s.equity_percent must be between 0 and 100, got %v", key, s.EquityPercent))
+	}
+	if s.RiskPercent <= 0 || s.RiskPercent > 100 {
+		problems = append(problems, fmt.Sprintf("%s.risk_percent must be between 0 and 100, got %v", key, s.RiskPercent))
+	}
+	if s.ATRMultiple <= 0 {
+		problems = append(problems, fmt.Sprintf("%s.atr_multiple must be > 0, got %v", key, s.ATRMultiple))
+	}
+	if s.ATRPeriod < 1 || s.ATRPeriod >= SCREENING_WINDOW {
+		problems = append(problems, fmt.Sprintf("%s.atr_period must be between 1 and %d, got %v", key, SCREENING_WINDOW-1, s.ATRPeriod))
+	}
+	if s.KellyFraction <= 0 || s.KellyFraction > 1 {
+		problems = append(problems, fmt.Sprintf("%s.kelly_fraction must be between 0 and 1, got %v", key, s.KellyFraction))
+	}
+	if s.KellyMinTrades < 1 {
+		problems = append(problems, fmt.Sprintf("%s.kelly_min_trades must be >= 1, got %v", key, s.KellyMinTrades))
+	}
+	if s.MaxExposurePercent < 0 {
+		problems = append(problems, fmt.Sprintf("%s.max_exposure_percent must be >= 0, got %v", key, s.MaxExposurePercent))
+	}
+	if s.MaxSymbolPercent < 0 {
+		problems = append(problems, fmt.Sprintf("%s.max_symbol_percent must be >= 0, got %v", key, s.MaxSymbolPercent))
+	}
+	for symbol, cap := range s.SymbolCaps {
+		if cap <= 0 {
+			problems = append(problems, fmt.Sprintf("%s.symbol_caps.%s must be > 0, got %v", key, symbol, cap))
+		}
+	}
+	return problems
+}
+
+func (r RiskConfig) validate(key string) (problems []string) {
+	if r.MaxOpenPositions < 0 {
+		problems = append(problems, fmt.Sprintf("%s.max_open_positions must be >= 0, got %v", key, r.MaxOpenPositions))
+	}
+	if r.MaxExposure < 0 {
+		problems = append(problems, fmt.Sprintf("%s.max_exposure must be >= 0, got %v", key, r.MaxExposure))
+	}
+	if r.DailyLossLimit < 0 {
+		problems = append(problems, fmt.Sprintf("%s.daily_loss_limit must be >= 0, got %v", key, r.DailyLossLimit))
+	}
+	if r.WeeklyLossLimit < 0 {
+		problems = append(problems, fmt.Sprintf("%s.weekly_loss_limit must be >= 0, got %v", key, r.WeeklyLossLimit))
+	}
+	if r.MaxConsecutiveLosses < 0 {
+		problems = append(problems, fmt.Sprintf("%s.max_consecutive_losses must be >= 0, got %v", key, r.MaxConsecutiveLosses))
+	}
+	if r.MaxConsecutiveLosses > 0 && r.BreakerMinutes <= 0 {
+		problems = append(problems, fmt.Sprintf("%s.breaker_minutes must be > 0, got %v", key, r.BreakerMinutes))
+	}
+	if r.MarketDropPercent < 0 || r.MarketDropPercent >= 100 {
+		problems = append(problems, fmt.Sprintf("%s.market_drop_percent must be between 0 and 100, got %v", key, r.MarketDropPercent))
+	}
+	if r.MarketDropPercent > 0 {
+		if r.MarketSymbol == "" {
+			problems = append(problems, fmt.Sprintf("%s.market_symbol is required (or set MARKET_SYMBOL)", key))
+		}
+		if r.MarketDropMinutes < 1 || r.MarketDropMinutes > MAX_MARKET_DROP_MINUTES {
+			problems = append(problems, fmt.Sprintf("%s.market_drop_minutes must be between 1 and %d, got %v", key, MAX_MARKET_DROP_MINUTES, r.MarketDropMinutes))
+		}
+		if r.MarketHaltMinutes <= 0 {
+			problems = append(problems, fmt.Sprintf("%s.market_halt_minutes must be > 0, got %v", key, r.MarketHaltMinutes))
+		}
+	}
+	return problems
+}
+
+func (j JobConfig) validate(key string) (problems []string) {
+	if j.Schedule != "" {
+		if schedule, err := parseCron(j.Schedule); err != nil {
+			problems = append(problems, fmt.Sprintf("%s.schedule: %v", key, err))
+		} else if schedule.Next(time.Now()).IsZero() {
+			problems = append(problems, fmt.Sprintf("%s.schedule %q never fires", key, j.Schedule))
+		}
+	}
+	if j.DelaySeconds < 0 {
+		problems = append(problems, fmt.Sprintf("%s.delay_seconds must be >= 0, got %v", key, j.DelaySeconds))
+	}
+	if j.JitterSeconds < 0 {
+		problems = append(problems, fmt.Sprintf("%s.jitter_seconds must be >= 0, got %v", key, j.JitterSeconds))
+	}
+	if j.TimeoutSeconds <= 0 {
+		problems = append(problems, fmt.Sprintf("%s.timeout_seconds must be > 0, got %v", key, j.TimeoutSeconds))
+	}
+	switch j.Missed {
+	case SCHEDULER_MISSED_SKIP, SCHEDULER_MISSED_RUN_ONCE:
+	default:
+		problems = append(problems, fmt.Sprintf("%s.missed must be %q or %q, got %q", key, SCHEDULER_MISSED_SKIP, SCHEDULER_MISSED_RUN_ONCE, j.Missed))
+	}
+	return problems
+}
+
+// validateLadder checks the take-profit ladder: legs above 0% adding up to
+// 100%, a take profit on every limit leg and at most one trailing leg, which
+// needs trailing_percent or trailing_atr_multiple.
+func validateLadder(key string, t TradingConfig) (problems []string) {
+	if len(t.TakeProfitLadder) == 0 {
+		return nil
+	}
+	var total float64
+	var trailing int
+	for i, leg := range t.TakeProfitLadder {
+		legKey := fmt.Sprintf("%s.take_profit_ladder[%d]", key, i)
+		if leg.Percent <= 0 {
+			problems = append(problems, fmt.Sprintf("%s.percent must be > 0, got %v", legKey, leg.Percent))
+		}
+		total += leg.Percent
+		if leg.Trailing {
+			trailing++
+			if leg.TakeProfitPercent != 0 {
+				problems = append(problems, fmt.Sprintf("%s is trailing and cannot have a take_profit_percent", legKey))
+			}
+		} else if leg.TakeProfitPercent <= 0 {
+			problems = append(problems, fmt.Sprintf("%s.take_profit_percent must be > 0, got %v", legKey, leg.TakeProfitPercent))
+		}
+	}
+	if math.Abs(total-100) > 1e-9 {
+		problems = append(problems, fmt.Sprintf("%s.take_profit_ladder percents must add up to 100, got %v", key, total))
+	}
+	if trailing > 1 {
+		problems = append(problems, fmt.Sprintf("%s.take_profit_ladder can have one trailing leg, got %d", key, trailing))
+	}
+	if trailing > 0 && t.TrailingPercent == 0 && t.TrailingATRMultiple == 0 {
+		problems = append(problems, fmt.Sprintf("%s.take_profit_ladder trailing leg needs trailing_percent or trailing_atr_multiple > 0", key))
+	}
+	return problems
+}
+
+func (s ScreeningConfig) validate(key string) (problems []string) {
+	if s.UpperMAFactor <= 0 {
+		problems = append(problems, fmt.Sprintf("%s.upper_ma_factor must be > 0, got %v", key, s.UpperMAFactor))
+	}
+	if s.LowerMAFactor <= 0 {
+		problems = append(problems, fmt.Sprintf("%s.lower_ma_factor must be > 0, got %v", key, s.LowerMAFactor))
+	}
+	if s.MAPeriod <= 0 || s.MAPeriod >= SCREENING_WINDOW {
+		problems = append(problems, fmt.Sprintf("%s.ma_period must be between 1 and %d, got %v", key, SCREENING_WINDOW-1, s.MAPeriod))
+	}
+	if s.RSIPeriod <= 0 || s.RSIPeriod >= SCREENING_WINDOW {
+		problems = append(problems, fmt.Sprintf("%s.rsi_period must be between 1 and %d, got %v", key, SCREENING_WINDOW-1, s.RSIPeriod))
+	}
+	if s.TrendWindow <= 0 || s.TrendWindow > SCREENING_WINDOW/2 {
+		problems = append(problems, fmt.Sprintf("%s.trend_window must be between 1 and %d, got %v", key, SCREENING_WINDOW/2, s.TrendWindow))
+	}
+	return problems
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadTestConfig loads content as the config file, with env as the only
+// environment overrides set.
+func loadTestConfig(t *testing.T, content string, env map[string]string, requireCredentials bool) (Config, error) {
+	t.Helper()
+
+	for _, override := range envOverrides {
+		if _, ok := os.LookupEnv(override.name); ok {
+			t.Setenv(override.name, "")
+			os.Unsetenv(override.name)
+		}
+	}
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+
+	return loadConfig(requireCredentials)
+}
+
+func TestLoadConfigExample(t *testing.T) {
+	content, err := os.ReadFile("config.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadTestConfig(t, string(content), nil, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadConfigUnknownKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "top level",
+			content: "tradng:\n  max_workers: 5\n",
+			want:    "line 1: field tradng not found",
+		},
+		{
+			name:    "trading",
+			content: "trading:\n  take_proft_percent: 3\n",
+			want:    "line 2: field take_proft_percent not found",
+		},
+		{
+			name:    "strategy",
+			content: "strategies:\n  - name: a\n    knd: rules\n",
+			want:    "line 3: field knd not found",
+		},
+		{
+			name:    "strategy trading",
+			content: "strategies:\n  - name: a\n    trading:\n      take_proft_percent: 3\n",
+			want:    "line 4: field take_proft_percent not found",
+		},
+		{
+			name:    "strategy screening",
+			content: "strategies:\n  - name: a\n    screening:\n      ma_perod: 10\n",
+			want:    "line 4: field ma_perod not found",
+		},
+		{
+			name:    "strategy sizing",
+			content: "strategies:\n  - name: a\n    trading:\n      sizing:\n        mod: fixed\n",
+			want:    "line 5: field mod not found",
+		},
+		{
+			name: "strategy ladder leg",
+			content: "strategies:\n  - name: a\n    trading:\n      take_profit_ladder:\n" +
+				"        - percent: 50\n          take_profit_percent: 1\n" +
+				"        - percent: 50\n          trailng: true\n",
+			want: "line 8: field trailng not found",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := loadTestConfig(t, test.content, nil, false)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("error = %v, want it to contain %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigListsEveryProblem(t *testing.T) {
+	content := `
+server:
+  port: ""
+trading:
+  take_profit_percent: 0
+  exit_mode: sideways
+storage:
+  driver: sheets
+risk:
+  max_consecutive_losses: 3
+  breaker_minutes: 0
+scheduler:
+  screening:
+    schedule: "61 * * * *"
+strategies:
+  - name: a
+    kind: rules
+  - name: a
+    kind: unknown
+    trading:
+      stop_loss_percent: 120
+`
+	_, err := loadTestConfig(t, content, map[string]string{"MAX_WORKERS": "abc"}, true)
+	if err == nil {
+		t.Fatal("loadConfig accepted an invalid configuration")
+	}
+
+	for _, want := range []string{
+		`MAX_WORKERS: "abc" is not an integer`,
+		"server.port is required (or set PORT)",
+		"binance.api_key is required (or set BINANCE_API_KEY)",
+		"binance.secret_key is required (or set BINANCE_SECRET_KEY)",
+		"telegram.bot_token is required (or set BOT_TOKEN)",
+		"telegram.receiver_user_id is required (or set RECEIVER_USER_ID)",
+		"google_sheets.spreadsheet_id is required (or set SPREADSHEET_ID)",
+		"trading.take_profit_percent must be > 0, got 0",
+		`trading.exit_mode must be "bracket" or "trailing", got "sideways"`,
+		"risk.breaker_minutes must be > 0, got 0",
+		"scheduler.screening.schedule:",
+		`strategies[0].buy is required for kind "rules"`,
+		`strategies[1].name "a" is used twice`,
+		`strategies[1].kind "unknown" is not a known strategy`,
+		"strategies[1].trading.stop_loss_percent must be between 0 and 100, got 120",
+	} {
+		if !strings.Contains(err.Error(), "\n  - "+want) {
+			t.Errorf("error does not list %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadConfigStrategyInherits(t *testing.T) {
+	content := `
+screening:
+  ma_period: 30
+trading:
+  take_profit_percent: 4
+  max_workers: 7
+  sizing:
+    symbol_caps:
+      BTCUSDT: 50
+strategies:
+  - name: a
+    kind: engulfing_breakout
+    screening:
+      rsi_period: 10
+    trading:
+      stop_loss_percent: 3
+      max_workers: 1
+      sizing:
+        symbol_caps:
+          ETHUSDT: 20
+  - name: b
+    kind: engulfing_breakout
+`
+	c, err := loadTestConfig(t, content, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, b := c.Strategies[0], c.Strategies[1]
+	if a.Screening.MAPeriod != 30 || a.Screening.RSIPeriod != 10 {
+		t.Errorf("strategy a screening = %+v, want ma_period 30 and rsi_period 10", a.Screening)
+	}
+	if a.Trading.TakeProfitPercent != 4 || a.Trading.StopLossPercent != 3 {
+		t.Errorf("strategy a take profit %v and stop loss %v, want 4 and 3", a.Trading.TakeProfitPercent, a.Trading.StopLossPercent)
+	}
+	if a.Trading.MaxWorkers != 7 {
+		t.Errorf("strategy a max_workers = %v, want the top-level 7", a.Trading.MaxWorkers)
+	}
+	if len(a.Trading.Sizing.SymbolCaps) != 2 {
+		t.Errorf("strategy a symbol_caps = %v, want BTCUSDT and ETHUSDT", a.Trading.Sizing.SymbolCaps)
+	}
+	if len(c.Trading.Sizing.SymbolCaps) != 1 || len(b.Trading.Sizing.SymbolCaps) != 1 {
+		t.Errorf("strategy a symbol_caps leaked: top level %v, strategy b %v", c.Trading.Sizing.SymbolCaps, b.Trading.Sizing.SymbolCaps)
+	}
+	if b.Trading.StopLossPercent != c.Trading.StopLossPercent || b.Screening.RSIPeriod != c.Screening.RSIPeriod {
+		t.Errorf("strategy b = %+v, want the top-level sections", b)
+	}
+}
@@ -1,15 +1,100 @@
 package main
 
 const (
+	DEFAULT_CONFIG_FILE = "config.yaml"
+
+	// SERVER
+	DEFAULT_PORT = "8080"
+
 	// BINANCE
-	BINANCE_API_KEY    = ""
-	BINANCE_SECRET_KEY = ""
-	MINIMUM_BALANCE    = 8
+	KLINE_INTERVAL              = "15m"
+	DEFAULT_MINIMUM_BALANCE     = 8
+	DEFAULT_TAKE_PROFIT_PERCENT = 2
+	DEFAULT_STOP_LOSS_PERCENT   = 2
+	DEFAULT_STOP_LIMIT_OFFSET   = 0.5
+	DEFAULT_TRAILING_PERCENT    = 2
+	DEFAULT_TRAILING_ATR_PERIOD = 14
+	DEFAULT_MAX_QUOTE_PER_TRADE = 10
+	DEFAULT_MIN_ALERT_COINS     = 30
+	DEFAULT_COOLDOWN_MINUTES    = 480
+	DEFAULT_MAX_WORKERS         = 20
+
+	// EXIT MODES
+	EXIT_MODE_BRACKET  = "bracket"
+	EXIT_MODE_TRAILING = "trailing"
+
+	// SIZING
+	SIZING_DIVIDER                  = "divider"
+	SIZING_FIXED                    = "fixed"
+	SIZING_EQUITY_PERCENT           = "equity_percent"
+	SIZING_RISK                     = "risk"
+	SIZING_ATR                      = "atr"
+	SIZING_KELLY                    = "kelly"
+	DEFAULT_SIZING_EQUITY_PERCENT   = 10
+	DEFAULT_SIZING_RISK_PERCENT     = 1
+	DEFAULT_SIZING_ATR_MULTIPLE     = 2
+	DEFAULT_SIZING_ATR_PERIOD       = 14
+	DEFAULT_SIZING_KELLY_FRACTION   = 0.25
+	DEFAULT_SIZING_KELLY_MIN_TRADES = 20
+
+	// RISK
+	RISK_MAX_OPEN_POSITIONS     = "max_open_positions"
+	RISK_MAX_EXPOSURE           = "max_exposure"
+	RISK_DAILY_LOSS_LIMIT       = "daily_loss_limit"
+	RISK_WEEKLY_LOSS_LIMIT      = "weekly_loss_limit"
+	RISK_CONSECUTIVE_LOSSES     = "max_consecutive_losses"
+	RISK_MARKET_DROP            = "market_drop"
+	DEFAULT_BREAKER_MINUTES     = 240
+	DEFAULT_MARKET_SYMBOL       = "BTCUSDT"
+	DEFAULT_MARKET_DROP_MINUTES = 60
+	DEFAULT_MARKET_HALT_MINUTES = 120
+	MARKET_DROP_INTERVAL        = "1m"
+	MAX_MARKET_DROP_MINUTES     = 999
+
+	// SCHEDULER
+	SCHEDULER_MISSED_SKIP            = "skip"
+	SCHEDULER_MISSED_RUN_ONCE        = "run_once"
+	SCHEDULER_GRACE_SECONDS          = 30
+	JOB_SCREENING                    = "screening"
+	JOB_ORDER_STATUS                 = "order_status"
+	JOB_STOP_LOSS                    = "stop_loss"
+	DEFAULT_SCREENING_SCHEDULE       = "*/15 * * * *"
+	DEFAULT_SCREENING_DELAY_SECONDS  = 5
+	DEFAULT_SCREENING_TIMEOUT        = 600
+	DEFAULT_ORDER_STATUS_SCHEDULE    = "*/5 * * * *"
+	DEFAULT_ORDER_STATUS_TIMEOUT     = 120
+	DEFAULT_STOP_LOSS_SCHEDULE       = "* * * * *"
+	DEFAULT_STOP_LOSS_DELAY_SECONDS  = 2
+	DEFAULT_STOP_LOSS_TIMEOUT        = 50
+	DEFAULT_SCHEDULER_JITTER_SECONDS = 10
 
 	// GOOGLE SHEETS
-	SPREADSHEET_ID = ""
+	DEFAULT_CREDENTIALS_FILE = "credentials.json"
+
+	// STORAGE
+	STORAGE_SHEETS      = "sheets"
+	STORAGE_SQLITE      = "sqlite"
+	DEFAULT_SQLITE_PATH = "bot.db"
+	STORE_WRITE_TIMEOUT = 30
+
+	// SCREENING
+	SCREENING_WINDOW        = 300
+	DEFAULT_UPPER_MA_FACTOR = 1.02
+	DEFAULT_LOWER_MA_FACTOR = 0.98
+	DEFAULT_MA_PERIOD       = 20
+	DEFAULT_RSI_PERIOD      = 14
+	DEFAULT_TREND_WINDOW    = 100
+
+	// STRATEGIES
+	DEFAULT_STRATEGY_NAME       = "default"
+	STRATEGY_ENGULFING_BREAKOUT = "engulfing_breakout"
+	STRATEGY_RULES              = "rules"
+
+	// PAPER TRADING
+	DEFAULT_PAPER_STARTING_BALANCE = 100
+	DEFAULT_PAPER_FEE_RATE         = 0.001
+	DEFAULT_PAPER_STATE_PATH       = "paper.json"
 
-	// TELEGRAM
-	BOT_TOKEN        = ""
-	RECEIVER_USER_ID = 216993313
+	// CANDLES
+	DEFAULT_CANDLES_PATH = "candles.db"
 )
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/shopspring/decimal"
+)
+
+// tradingEnabled reports whether the kill switch lets the bot trade. A switch
+// that cannot be read counts as off, so a failing read never resumes trading
+// an operator paused; a switch never saved, a spreadsheet without the
+// control tab included, is on.
+func tradingEnabled(store Store) bool {
+	trading, err := store.LoadTradingSwitch()
+	if err != nil {
+		fmt.Println("[ERROR] kill switch unreadable, not trading:", err)
+		return false
+	}
+	if !trading.Enabled {
+		fmt.Println("[PAUSED]", trading.Reason, "since", trading.Since)
+	}
+	return trading.Enabled
+}
+
+// setTradingEnabled turns the kill switch on or off and sends it to
+// Telegram.
+func setTradingEnabled(store Store, enabled bool, reason string) error {
+	if err := store.SaveTradingSwitch(TradingSwitch{Enabled: enabled, Reason: reason}); err != nil {
+		return err
+	}
+
+	message := "⏸ Trading paused: " + reason
+	if enabled {
+		message = "▶️ Trading resumed: " + reason
+	}
+	fmt.Println("[KILL SWITCH]", message)
+	sendTelegramNotice("KILL SWITCH", message)
+	return nil
+}
+
+// FlattenReport is what flatten did in one symbol: the orders it canceled,
+// what it sold and at which price, and what went wrong.
+type FlattenReport struct {
+	Symbol   string
+	Trades   int
+	Canceled []string
+	Sold     string
+	Price    string
+	Errors   []string
+}
+
+func (r FlattenReport) String() string {
+	line := fmt.Sprintf("%s: %d trades, canceled %d orders", r.Symbol, r.Trades, len(r.Canceled))
+	if len(r.Canceled) > 0 {
+		line += " (" + strings.Join(r.Canceled, ", ") + ")"
+	}
+	if r.Sold != "" {
+		line += ", sold " + r.Sold + " at " + r.Price
+	} else {
+		line += ", sold nothing"
+	}
+	for _, err := range r.Errors {
+		line += "\n  error: " + err
+	}
+	return line
+}
+
+// runFlatten pauses trading, then cancels the exit orders of every open
+// trade and market-sells what they still held, one sell per symbol. The sold
+// trades are closed as FILLED at the sell's price with the "flatten" exit.
+// A trade whose order cannot be canceled, most likely because it just
+// filled, is left for the order status check.
+func runFlatten(exchange Exchange, store Store) ([]FlattenReport, error) {
+	if err := setTradingEnabled(store, false, "flatten"); err != nil {
+		return nil, err
+	}
+
+	// A stop loss or order status run going through the same trades could
+	// sell them twice or overwrite their rows, and a screening run could
+	// store a buy after they are listed, so flatten waits for them and keeps
+	// the next ones from starting. The screening run sees the pause before
+	// its next buy.
+	for _, job := range []*schedulerJob{screeningJob, orderStatusJob, stopLossJob} {
+		job.running.Lock()
+		defer job.running.Unlock()
+	}
+
+	trades, err := store.ListOpenTrades()
+	if err != nil {
+		return nil, err
+	}
+
+	bySymbol := make(map[string][]TradingDetails)
+	for _, trade := range trades {
+		bySymbol[trade.Pair] = append(bySymbol[trade.Pair], trade)
+	}
+	symbols := make([]string, 0, len(bySymbol))
+	for symbol := range bySymbol {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	symbolRules := make(map[string]SymbolRules)
+	if len(symbols) > 0 {
+		exchangeInfo, err := exchange.GetExchangeInfo(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		for _, symbol := range exchangeInfo.Symbols {
+			if _, exists := bySymbol[symbol.Symbol]; !exists {
+				continue
+			}
+			if rules, err := newSymbolRules(symbol); err == nil {
+				symbolRules[symbol.Symbol] = rules
+			}
+		}
+	}
+
+	reports := []FlattenReport{}
+	for _, symbol := range symbols {
+		report := flattenSymbol(exchange, store, symbol, bySymbol[symbol], symbolRules)
+		fmt.Println("[FLATTEN]", report)
+		reports = append(reports, report)
+	}
+
+	lines := []string{fmt.Sprintf("Flattened %d symbols", len(reports))}
+	for _, report := range reports {
+		lines = append(lines, report.String())
+	}
+	sendTelegramNotice("FLATTEN", strings.Join(lines, "\n"))
+	return reports, nil
+}
+
+// flattenSymbol cancels the exit orders of the symbol's open trades and
+// sells what they held.
+func flattenSymbol(exchange Exchange, store Store, symbol string, trades []TradingDetails, symbolRules map[string]SymbolRules) FlattenReport {
+	report := FlattenReport{Symbol: symbol, Trades: len(trades)}
+
+	sold := []TradingDetails{}
+	total := decimal.Zero
+	for _, trade := range trades {
+		quantity, err := decimal.NewFromString(trade.Quantity)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("trade %d quantity %q is not a number", trade.ID, trade.Quantity))
+			continue
+		}
+
+		// executed is what a partially filled exit already sold, which is
+		// no longer ours to sell.
+		executed := decimal.Zero
+		switch {
+		case trade.OrderID == "error" || trade.TrailStop != "":
+			// Nothing rests on the exchange
+		case trade.StopOrderID != "":
+			response, err := exchange.CancelOCO(context.Background(), symbol, trade.OrderListID)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("cancel order list %d: %v", trade.OrderListID, err))
+				continue
+			}
+			for _, leg := range response.OrderReports {
+				filled, _ := decimal.NewFromString(leg.ExecutedQuantity)
+				executed = executed.Add(filled)
+			}
+			report.Canceled = append(report.Canceled, canceledExit(fmt.Sprint("list ", trade.OrderListID), executed))
+		default:
+			response, err := exchange.CancelOrder(context.Background(), symbol, trade.OrderID)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("cancel order %s: %v", trade.OrderID, err))
+				continue
+			}
+			executed, _ = decimal.NewFromString(response.ExecutedQuantity)
+			report.Canceled = append(report.Canceled, canceledExit(trade.OrderID, executed))
+		}
+
+		quantity = quantity.Sub(executed)
+		if !quantity.IsPositive() {
+			continue
+		}
+		sold = append(sold, trade)
+		total = total.Add(quantity)
+	}
+	if len(sold) == 0 {
+		return report
+	}
+
+	// From here on the exits are gone, so a failed sell leaves the coins
+	// unguarded and says so.
+	unguarded := func(err error) FlattenReport {
+		report.Errors = append(report.Errors, fmt.Sprintf("exits canceled but %s not sold: %v", total, err))
+		return report
+	}
+
+	quantity := total
+	if rules, exists := symbolRules[symbol]; exists {
+		klines, err := getKlines(exchange, symbol, 1)
+		if err != nil || len(klines) == 0 {
+			return unguarded(fmt.Errorf("no price: %v", err))
+		}
+		price, err := decimal.NewFromString(klines[len(klines)-1].Close)
+		if err != nil {
+			return unguarded(err)
+		}
+		if quantity, err = rules.AdjustMarketQuantity(total, price); err != nil {
+			return unguarded(err)
+		}
+		report.Sold = rules.FormatQuantity(quantity)
+	} else {
+		report.Sold = quantity.String()
+	}
+
+	response, err := exchange.CreateOrder(context.Background(), OrderRequest{
+		Symbol:   symbol,
+		Side:     binance.SideTypeSell,
+		Type:     binance.OrderTypeMarket,
+		Quantity: report.Sold,
+	})
+	if err != nil {
+		report.Sold = ""
+		return unguarded(err)
+	}
+	sellOrder, err := orderFromResponse(response)
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+		return report
+	}
+	report.Price = sellOrder.AveragePrice().String()
+
+	positions := make(map[string]bool)
+	for _, trade := range sold {
+		store.UpdateTradeSellPrice(trade, report.Price)
+		store.UpdateTradeExit(trade, EXIT_FLATTEN)
+		store.UpdateTradeStatus(trade, string(binance.OrderStatusTypeFilled))
+		positions[trade.PositionID] = true
+	}
+	for positionID := range positions {
+		reportClosedPosition(store, positionID)
+	}
+	return report
+}
+
+// canceledExit names a canceled exit order in the report, with what it had
+// sold when it was partially filled.
+func canceledExit(name string, executed decimal.Decimal) string {
+	if executed.IsPositive() {
+		return name + " (" + executed.String() + " filled)"
+	}
+	return name
+}
+
+// authorizeControl lets a kill switch request through when it is a POST
+// carrying the control token, and answers it otherwise.
+func authorizeControl(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return false
+	}
+	if config.Server.ControlToken == "" {
+		http.Error(w, "set server.control_token to use the control endpoints", http.StatusForbidden)
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(config.Server.ControlToken)) != 1 {
+		http.Error(w, "invalid control token", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func pauseTrading(w http.ResponseWriter, r *http.Request) {
+	if !authorizeControl(w, r) {
+		return
+	}
+	reason := r.URL.Query().Get("reason")
+	if reason == "" {
+		reason = "paused over HTTP"
+	}
+	if err := setTradingEnabled(initStore(), false, reason); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintln(w, "paused:", reason)
+}
+
+func resumeTrading(w http.ResponseWriter, r *http.Request) {
+	if !authorizeControl(w, r) {
+		return
+	}
+	if err := setTradingEnabled(initStore(), true, "resumed over HTTP"); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintln(w, "resumed")
+}
+
+func flattenPositions(w http.ResponseWriter, r *http.Request) {
+	if !authorizeControl(w, r) {
+		return
+	}
+	reports, err := runFlatten(initExchange(), initStore())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintln(w, "paused and flattened", len(reports), "symbols")
+	for _, report := range reports {
+		fmt.Fprintln(w, report)
+	}
+}
+
+// runPauseCommand turns trading off from the command line.
+func runPauseCommand(args []string) error {
+	flags := flag.NewFlagSet("pause", flag.ContinueOnError)
+	reason := flags.String("reason", "paused from the command line", "why trading is paused")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	return setTradingEnabled(initStore(), false, *reason)
+}
+
+func runResumeCommand(args []string) error {
+	flags := flag.NewFlagSet("resume", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	return setTradingEnabled(initStore(), true, "resumed from the command line")
+}
+
+func runFlattenCommand(args []string) error {
+	flags := flag.NewFlagSet("flatten", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	_, err := runFlatten(initExchange(), initStore())
+	return err
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// pausedAfterStore is a memoryStore whose kill switch reads on for the first
+// reads and off after them, as if the operator paused while a run was going.
+type pausedAfterStore struct {
+	*memoryStore
+	reads int
+}
+
+func (s *pausedAfterStore) LoadTradingSwitch() (TradingSwitch, error) {
+	if s.reads > 0 {
+		s.reads--
+		return TradingSwitch{Enabled: true}, nil
+	}
+	return TradingSwitch{Enabled: false, Reason: "paused mid-run"}, nil
+}
+
+func TestScreeningStopsBuyingWhenPausedMidRun(t *testing.T) {
+	useFlowConfig(t, EXIT_MODE_BRACKET)
+	exchange, _ := flowMarket()
+	store := newMemoryStore()
+
+	runScreening(exchange, store)
+
+	// The second run starts with trading on and is paused before its buy.
+	runScreening(exchange, &pausedAfterStore{memoryStore: store, reads: 1})
+
+	if trades, _ := store.ListTrades(); len(trades) != 0 {
+		t.Errorf("screening paused mid-run stored %d trades, want none", len(trades))
+	}
+	checkFlowBalance(t, exchange, "USDT", 100, 0)
+}
+
+func TestFlattenWaitsForScreening(t *testing.T) {
+	useFlowConfig(t, EXIT_MODE_BRACKET)
+	exchange, _ := flowMarket()
+	store := newMemoryStore()
+	trade := openFlowPosition(t, exchange, store)
+
+	screeningJob.running.Lock()
+	done := make(chan error)
+	go func() {
+		_, err := runFlatten(exchange, store)
+		done <- err
+	}()
+
+	select {
+	case <-done:
+		screeningJob.running.Unlock()
+		t.Fatal("flatten ran while screening was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if trading, _ := store.LoadTradingSwitch(); trading.Enabled {
+		t.Errorf("trading is still enabled while flatten waits for screening")
+	}
+
+	screeningJob.running.Unlock()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	got := store.trade(trade.ID)
+	if got.Status != "FILLED" || got.Exit != EXIT_FLATTEN || got.SellPrice != "10" {
+		t.Errorf("trade after flatten = %+v, want FILLED by flatten at 10", got)
+	}
+	checkFlowBalance(t, exchange, "AAA", 0, 0)
+	checkFlowBalance(t, exchange, "USDT", 90+0.999*10*(1-flowFeeRate), 0)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func cronBits(values ...int) uint64 {
+	var bits uint64
+	for _, value := range values {
+		bits |= 1 << uint(value)
+	}
+	return bits
+}
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field    string
+		min, max int
+		want     uint64
+	}{
+		{"*", 0, 5, cronBits(0, 1, 2, 3, 4, 5)},
+		{"7", 0, 59, cronBits(7)},
+		{"5/15", 0, 59, cronBits(5, 20, 35, 50)},
+		{"*/15", 0, 59, cronBits(0, 15, 30, 45)},
+		{"1-10/3", 0, 59, cronBits(1, 4, 7, 10)},
+		{"1,3,5-6", 0, 59, cronBits(1, 3, 5, 6)},
+		{"*/2", 1, 12, cronBits(1, 3, 5, 7, 9, 11)},
+	}
+	for _, test := range tests {
+		got, err := parseCronField(test.field, test.min, test.max)
+		if err != nil {
+			t.Errorf("parseCronField(%q): %v", test.field, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseCronField(%q) = %b, want %b", test.field, got, test.want)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"* * * *", "needs 5 fields"},
+		{"60 * * * *", `minute: "60" is not within 0-59`},
+		{"* 24 * * *", `hour: "24" is not within 0-23`},
+		{"* * 0 * *", `day of month: "0" is not within 1-31`},
+		{"* * * 13 *", `month: "13" is not within 1-12`},
+		{"* * * * 8", `day of week: "8" is not within 0-7`},
+		{"*/0 * * * *", `minute: step "0" is not a positive integer`},
+		{"5-1 * * * *", `minute: "5-1" is not within 0-59`},
+		{"a * * * *", `minute: "a" is not a number`},
+		{"1-b * * * *", `minute: "b" is not a number`},
+	}
+	for _, test := range tests {
+		_, err := parseCron(test.expr)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("parseCron(%q) error = %v, want %s", test.expr, err, test.want)
+		}
+	}
+}
+
+func TestParseCronSevenIsSunday(t *testing.T) {
+	seven, err := parseCron("0 0 * * 7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zero, err := parseCron("0 0 * * 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seven.dow&1 == 0 || zero.dow&1 == 0 {
+		t.Errorf("day of week bits = %b and %b, want Sunday in both", seven.dow, zero.dow)
+	}
+
+	// Saturday 6 January 2024.
+	saturday := time.Date(2024, 1, 6, 12, 0, 0, 0, time.UTC)
+	want := time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)
+	if got := seven.Next(saturday); !got.Equal(want) {
+		t.Errorf("Next = %s, want Sunday %s", got, want)
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	utc := func(year int, month time.Month, day, hour, minute, second int) time.Time {
+		return time.Date(year, month, day, hour, minute, second, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want []time.Time
+	}{
+		{
+			name: "strictly after the given minute",
+			expr: "*/15 * * * *",
+			from: utc(2024, 1, 1, 10, 15, 0),
+			want: []time.Time{utc(2024, 1, 1, 10, 30, 0), utc(2024, 1, 1, 10, 45, 0), utc(2024, 1, 1, 11, 0, 0)},
+		},
+		{
+			name: "seconds before the minute",
+			expr: "*/15 * * * *",
+			from: utc(2024, 1, 1, 10, 14, 59),
+			want: []time.Time{utc(2024, 1, 1, 10, 15, 0)},
+		},
+		{
+			name: "stepped from 5",
+			expr: "5/15 * * * *",
+			from: utc(2024, 1, 1, 10, 50, 0),
+			want: []time.Time{utc(2024, 1, 1, 11, 5, 0), utc(2024, 1, 1, 11, 20, 0)},
+		},
+		{
+			name: "across a month",
+			expr: "0 0 1 * *",
+			from: utc(2024, 1, 31, 12, 0, 0),
+			want: []time.Time{utc(2024, 2, 1, 0, 0, 0), utc(2024, 3, 1, 0, 0, 0)},
+		},
+		{
+			name: "across a year",
+			expr: "30 23 31 12 *",
+			from: utc(2024, 12, 31, 23, 30, 0),
+			want: []time.Time{utc(2025, 12, 31, 23, 30, 0)},
+		},
+		{
+			name: "new year",
+			expr: "0 0 1 1 *",
+			from: utc(2024, 6, 1, 0, 0, 0),
+			want: []time.Time{utc(2025, 1, 1, 0, 0, 0)},
+		},
+		{
+			name: "leap day",
+			expr: "0 12 29 2 *",
+			from: utc(2024, 3, 1, 0, 0, 0),
+			want: []time.Time{utc(2028, 2, 29, 12, 0, 0)},
+		},
+		{
+			// 1 January 2024 is a Monday: Fridays and the 13th both match.
+			name: "day of month or day of week",
+			expr: "0 0 13 * 5",
+			from: utc(2024, 1, 1, 0, 0, 0),
+			want: []time.Time{utc(2024, 1, 5, 0, 0, 0), utc(2024, 1, 12, 0, 0, 0), utc(2024, 1, 13, 0, 0, 0), utc(2024, 1, 19, 0, 0, 0)},
+		},
+		{
+			name: "day of month alone",
+			expr: "0 0 13 * *",
+			from: utc(2024, 1, 1, 0, 0, 0),
+			want: []time.Time{utc(2024, 1, 13, 0, 0, 0), utc(2024, 2, 13, 0, 0, 0)},
+		},
+		{
+			name: "day of week alone",
+			expr: "0 0 * * 5",
+			from: utc(2024, 1, 1, 0, 0, 0),
+			want: []time.Time{utc(2024, 1, 5, 0, 0, 0), utc(2024, 1, 12, 0, 0, 0)},
+		},
+		{
+			name: "weekdays within a month",
+			expr: "0 9 * 3 1-5",
+			from: utc(2024, 2, 28, 0, 0, 0),
+			want: []time.Time{utc(2024, 3, 1, 9, 0, 0), utc(2024, 3, 4, 9, 0, 0)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := parseCron(test.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			at := test.from
+			for _, want := range test.want {
+				at = schedule.Next(at)
+				if !at.Equal(want) {
+					t.Fatalf("Next = %s, want %s", at, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCronNextKeepsLocation(t *testing.T) {
+	schedule, err := parseCron("0 9 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jakarta := time.FixedZone("WIB", 7*60*60)
+	got := schedule.Next(time.Date(2024, 1, 1, 10, 0, 0, 0, jakarta))
+	if want := time.Date(2024, 1, 2, 9, 0, 0, 0, jakarta); !got.Equal(want) || got.Location() != jakarta {
+		t.Errorf("Next = %s, want %s", got, want)
+	}
+}
+
+func TestCronNextNever(t *testing.T) {
+	schedule, err := parseCron("0 0 31 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := schedule.Next(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Errorf("Next of 31 February = %s, want the zero time", got)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+
+	"github.com/adshao/go-binance/v2"
+)
+
+// Exchange is everything the screening and order flow needs from a venue.
+// The data types are go-binance's so the Binance adapter stays a thin
+// pass-through; other venues convert into them.
+type Exchange interface {
+	GetKlines(ctx context.Context, symbol string, interval string, limit int) ([]*binance.Kline, error)
+	// GetKlinesFrom returns up to limit candles opening at or after startTime
+	// (milliseconds), oldest first.
+	GetKlinesFrom(ctx context.Context, symbol string, interval string, startTime int64, limit int) ([]*binance.Kline, error)
+	GetExchangeInfo(ctx context.Context) (*binance.ExchangeInfo, error)
+	GetUserAssets(ctx context.Context) ([]binance.UserAssetRecord, error)
+	CreateOrder(ctx context.Context, order OrderRequest) (*binance.CreateOrderResponse, error)
+	CancelOrder(ctx context.Context, symbol string, clientOrderID string) (*binance.CancelOrderResponse, error)
+	GetOrder(ctx context.Context, symbol string, clientOrderID string) (*binance.Order, error)
+	// CreateOCO places a one-cancels-the-other pair: a LIMIT_MAKER order at
+	// Price and a STOP_LOSS_LIMIT order triggered at StopPrice. When one leg
+	// fills the other expires. Each leg can still be read with GetOrder.
+	CreateOCO(ctx context.Context, order OCORequest) (*binance.CreateOCOResponse, error)
+	// CancelOCO cancels both legs of an order list.
+	CancelOCO(ctx context.Context, symbol string, orderListID int64) (*binance.CancelOCOResponse, error)
+}
+
+// OrderRequest describes a new order. Empty fields are not sent.
+type OrderRequest struct {
+	Symbol        string
+	Side          binance.SideType
+	Type          binance.OrderType
+	TimeInForce   binance.TimeInForceType
+	Quantity      string
+	QuoteOrderQty string
+	Price         string
+}
+
+// OCORequest describes a new OCO order list.
+type OCORequest struct {
+	Symbol               string
+	Side                 binance.SideType
+	Quantity             string
+	Price                string
+	StopPrice            string
+	StopLimitPrice       string
+	StopLimitTimeInForce binance.TimeInForceType
+}
+
+type binanceExchange struct {
+	client *binance.Client
+}
+
+func newBinanceExchange(client *binance.Client) *binanceExchange {
+	return &binanceExchange{client: client}
+}
+
+func (e *binanceExchange) GetKlines(ctx context.Context, symbol string, interval string, limit int) ([]*binance.Kline, error) {
+	return e.client.NewKlinesService().
+		Symbol(symbol).
+		Interval(interval).
+		Limit(limit).
+		Do(ctx)
+}
+
+func (e *binanceExchange) GetKlinesFrom(ctx context.Context, symbol string, interval string, startTime int64, limit int) ([]*binance.Kline, error) {
+	return e.client.NewKlinesService().
+		Symbol(symbol).
+		Interval(interval).
+		StartTime(startTime).
+		Limit(limit).
+		Do(ctx)
+}
+
+func (e *binanceExchange) GetExchangeInfo(ctx context.Context) (*binance.ExchangeInfo, error) {
+	return e.client.NewExchangeInfoService().Do(ctx)
+}
+
+func (e *binanceExchange) GetUserAssets(ctx context.Context) ([]binance.UserAssetRecord, error) {
+	return e.client.NewGetUserAsset().Do(ctx)
+}
+
+func (e *binanceExchange) CreateOrder(ctx context.Context, order OrderRequest) (*binance.CreateOrderResponse, error) {
+	service := e.client.NewCreateOrderService().
+		Symbol(order.Symbol).
+		Side(order.Side).
+		Type(order.Type)
+
+	if order.TimeInForce != "" {
+		service = service.TimeInForce(order.TimeInForce)
+	}
+	if order.Quantity != "" {
+		service = service.Quantity(order.Quantity)
+	}
+	if order.QuoteOrderQty != "" {
+		service = service.QuoteOrderQty(order.QuoteOrderQty)
+	}
+	if order.Price != "" {
+		service = service.Price(order.Price)
+	}
+
+	return service.Do(ctx)
+}
+
+func (e *binanceExchange) CancelOrder(ctx context.Context, symbol string, clientOrderID string) (*binance.CancelOrderResponse, error) {
+	return e.client.NewCancelOrderService().Symbol(symbol).OrigClientOrderID(clientOrderID).Do(ctx)
+}
+
+func (e *binanceExchange) GetOrder(ctx context.Context, symbol string, clientOrderID string) (*binance.Order, error) {
+	return e.client.NewGetOrderService().Symbol(symbol).OrigClientOrderID(clientOrderID).Do(ctx)
+}
+
+func (e *binanceExchange) CreateOCO(ctx context.Context, order OCORequest) (*binance.CreateOCOResponse, error) {
+	return e.client.NewCreateOCOService().
+		Symbol(order.Symbol).
+		Side(order.Side).
+		Quantity(order.Quantity).
+		Price(order.Price).
+		StopPrice(order.StopPrice).
+		StopLimitPrice(order.StopLimitPrice).
+		StopLimitTimeInForce(order.StopLimitTimeInForce).
+		NewOrderRespType(binance.NewOrderRespTypeFULL).
+		Do(ctx)
+}
+
+func (e *binanceExchange) CancelOCO(ctx context.Context, symbol string, orderListID int64) (*binance.CancelOCOResponse, error) {
+	return e.client.NewCancelOCOService().Symbol(symbol).OrderListID(orderListID).Do(ctx)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/adshao/go-binance/v2/common"
+)
+
+// useStandIn points the config at a Binance stand-in over exchange and
+// returns the Binance adapter built by initBinanceClient, as the bot builds
+// it. The config is restored after the test.
+func useStandIn(t *testing.T, exchange *fakeExchange, secretKey string) *binanceExchange {
+	t.Helper()
+
+	server := newBinanceStandInServer(exchange, "test-key", "test-secret")
+	t.Cleanup(server.Close)
+
+	previous := config.Binance
+	t.Cleanup(func() { config.Binance = previous })
+	config.Binance = BinanceConfig{APIKey: "test-key", SecretKey: secretKey, BaseURL: server.URL}
+
+	return newBinanceExchange(initBinanceClient())
+}
+
+func TestBinanceExchangeThroughStandIn(t *testing.T) {
+	fake, _ := flowMarket()
+	exchange := useStandIn(t, fake, "test-secret")
+	ctx := context.Background()
+
+	info, err := exchange.GetExchangeInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Symbols) != 1 || info.Symbols[0].Symbol != flowSymbol {
+		t.Fatalf("exchange info symbols = %+v, want %s", info.Symbols, flowSymbol)
+	}
+	rules, err := newSymbolRules(info.Symbols[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules.TickSize.String() != "0.01" || rules.StepSize.String() != "0.001" || !rules.MinNotionalMarket {
+		t.Errorf("rules read through the stand-in = %+v", rules)
+	}
+
+	klines, err := exchange.GetKlines(ctx, flowSymbol, KLINE_INTERVAL, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(klines) != 5 || klines[4].Close != "10" {
+		t.Fatalf("klines = %+v, want the last 5 closing at 10", klines)
+	}
+
+	buy, err := exchange.CreateOrder(ctx, OrderRequest{Symbol: flowSymbol, Side: binance.SideTypeBuy, Type: binance.OrderTypeMarket, QuoteOrderQty: "10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	order, err := orderFromResponse(buy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.AveragePrice().String() != "10" || order.NetQuantity("AAA").String() != "0.999" {
+		t.Errorf("market buy filled %s at %s, want 0.999 at 10", order.NetQuantity("AAA"), order.AveragePrice())
+	}
+
+	asset, err := getUserAsset(exchange, "AAA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asset.Free != "0.99900000" {
+		t.Errorf("AAA free = %s, want 0.99900000", asset.Free)
+	}
+
+	oco, err := exchange.CreateOCO(ctx, OCORequest{
+		Symbol:               flowSymbol,
+		Side:                 binance.SideTypeSell,
+		Quantity:             "0.999",
+		Price:                "10.20",
+		StopPrice:            "9.80",
+		StopLimitPrice:       "9.75",
+		StopLimitTimeInForce: binance.TimeInForceTypeGTC,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(oco.OrderReports) != 2 {
+		t.Fatalf("OCO reports = %+v, want both legs", oco.OrderReports)
+	}
+	for _, leg := range oco.OrderReports {
+		got, err := exchange.GetOrder(ctx, flowSymbol, leg.ClientOrderID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != binance.OrderStatusTypeNew {
+			t.Errorf("%s leg status = %s, want NEW", got.Type, got.Status)
+		}
+	}
+	checkFlowBalance(t, fake, "AAA", 0, 0.999)
+
+	if _, err := exchange.CancelOCO(ctx, flowSymbol, oco.OrderListID); err != nil {
+		t.Fatal(err)
+	}
+	checkFlowBalance(t, fake, "AAA", 0.999, 0)
+}
+
+func TestBinanceExchangeErrorsThroughStandIn(t *testing.T) {
+	tests := []struct {
+		name      string
+		secretKey string
+		order     OrderRequest
+		code      int64
+	}{
+		{
+			name:      "insufficient balance",
+			secretKey: "test-secret",
+			order:     OrderRequest{Symbol: flowSymbol, Side: binance.SideTypeBuy, Type: binance.OrderTypeMarket, QuoteOrderQty: "1000"},
+			code:      -2010,
+		},
+		{
+			name:      "price off the tick",
+			secretKey: "test-secret",
+			order:     OrderRequest{Symbol: flowSymbol, Side: binance.SideTypeBuy, Type: binance.OrderTypeLimit, TimeInForce: binance.TimeInForceTypeGTC, Quantity: "1", Price: "9.995"},
+			code:      -1013,
+		},
+		{
+			name:      "below the minimum notional",
+			secretKey: "test-secret",
+			order:     OrderRequest{Symbol: flowSymbol, Side: binance.SideTypeBuy, Type: binance.OrderTypeMarket, QuoteOrderQty: "1"},
+			code:      -1013,
+		},
+		{
+			name:      "wrong secret key",
+			secretKey: "not-the-secret",
+			order:     OrderRequest{Symbol: flowSymbol, Side: binance.SideTypeBuy, Type: binance.OrderTypeMarket, QuoteOrderQty: "10"},
+			code:      -1022,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake, _ := flowMarket()
+			exchange := useStandIn(t, fake, test.secretKey)
+
+			_, err := exchange.CreateOrder(context.Background(), test.order)
+			var apiErr *common.APIError
+			if !errors.As(err, &apiErr) || apiErr.Code != test.code {
+				t.Fatalf("error = %v, want Binance error %d", err, test.code)
+			}
+			checkFlowBalance(t, fake, "USDT", 100, 0)
+		})
+	}
+}
+
+// TestFlowThroughStandIn buys and exits a position through the real
+// go-binance client, so the orders the bot builds are the ones Binance
+// would get.
+func TestFlowThroughStandIn(t *testing.T) {
+	useFlowConfig(t, EXIT_MODE_BRACKET)
+	fake, next := flowMarket()
+	exchange := useStandIn(t, fake, "test-secret")
+	store := newMemoryStore()
+
+	runScreening(exchange, store)
+	runScreening(exchange, store)
+
+	trades, _ := store.ListTrades()
+	if len(trades) != 1 || trades[0].SellPrice != "10.20" || trades[0].StopPrice != "9.80" || trades[0].Quantity != "0.999" {
+		t.Fatalf("stored trades = %+v, want one OCO exit of 0.999 at 10.20 and 9.80", trades)
+	}
+	checkFlowBalance(t, fake, "USDT", 90, 0)
+	checkFlowBalance(t, fake, "AAA", 0, 0.999)
+
+	fake.FeedCandle(flowSymbol, flowKline(next, 10.05, 10.3, 10.05, 10.25))
+	runOrderStatus(exchange, store)
+
+	got := store.trade(trades[0].ID)
+	if got.Status != "FILLED" || got.Exit != EXIT_TAKE_PROFIT {
+		t.Errorf("trade after the take profit = %+v, want FILLED by the take profit", got)
+	}
+	checkFlowBalance(t, fake, "USDT", 90+0.999*10.2*(1-flowFeeRate), 0)
+}
@@ -0,0 +1,736 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/adshao/go-binance/v2/common"
+)
+
+// fakeExchange is an in-memory Exchange. Market orders fill at the close of
+// the latest candle fed for the symbol, resting limit orders fill when a later
+// candle trades through their price, and every fill pays feeRate in the asset
+// received, the way Binance charges spot fees without BNB.
+type fakeExchange struct {
+	mu       sync.Mutex
+	feeRate  float64
+	balances map[string]float64
+	locked   map[string]float64
+	symbols  map[string]binance.Symbol
+	candles  map[string][]*binance.Kline
+	orders   map[string]*binance.Order
+	sequence []string
+	nextID   int64
+	now      time.Time
+
+	// clientIDPrefix starts every generated client order ID.
+	clientIDPrefix string
+}
+
+// fakeExchangeState is the account part of a fakeExchange: what has to
+// survive a restart when the fake backs paper trading.
+type fakeExchangeState struct {
+	Balances map[string]float64 `json:"balances"`
+	Locked   map[string]float64 `json:"locked"`
+	Orders   []binance.Order    `json:"orders"`
+	NextID   int64              `json:"next_id"`
+}
+
+func newFakeExchange(feeRate float64) *fakeExchange {
+	return &fakeExchange{
+		feeRate:  feeRate,
+		balances: make(map[string]float64),
+		locked:   make(map[string]float64),
+		symbols:  make(map[string]binance.Symbol),
+		candles:  make(map[string][]*binance.Kline),
+		orders:   make(map[string]*binance.Order),
+		now:      time.Now(),
+
+		clientIDPrefix: "fake",
+	}
+}
+
+// Snapshot returns a copy of the balances and orders.
+func (f *fakeExchange) Snapshot() fakeExchangeState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	state := fakeExchangeState{
+		Balances: make(map[string]float64),
+		Locked:   make(map[string]float64),
+		NextID:   f.nextID,
+	}
+	for asset, amount := range f.balances {
+		state.Balances[asset] = amount
+	}
+	for asset, amount := range f.locked {
+		state.Locked[asset] = amount
+	}
+	for _, id := range f.sequence {
+		state.Orders = append(state.Orders, *f.orders[id])
+	}
+	return state
+}
+
+// Restore replaces the balances and orders with a snapshot's.
+func (f *fakeExchange) Restore(state fakeExchangeState) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.balances = make(map[string]float64)
+	f.locked = make(map[string]float64)
+	f.orders = make(map[string]*binance.Order)
+	f.sequence = nil
+	f.nextID = state.NextID
+
+	for asset, amount := range state.Balances {
+		f.balances[asset] = amount
+	}
+	for asset, amount := range state.Locked {
+		f.locked[asset] = amount
+	}
+	for i := range state.Orders {
+		order := state.Orders[i]
+		f.orders[order.ClientOrderID] = &order
+		f.sequence = append(f.sequence, order.ClientOrderID)
+	}
+}
+
+// AddSymbol lists a symbol. Only BaseAsset and QuoteAsset are needed for
+// matching; Status defaults to TRADING.
+func (f *fakeExchange) AddSymbol(symbol binance.Symbol) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if symbol.Status == "" {
+		symbol.Status = "TRADING"
+	}
+	f.symbols[symbol.Symbol] = symbol
+}
+
+func (f *fakeExchange) SetBalance(asset string, free float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.balances[asset] = free
+}
+
+// Balance returns the free and locked amount of an asset.
+func (f *fakeExchange) Balance(asset string) (free float64, locked float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.balances[asset], f.locked[asset]
+}
+
+// FeedCandle appends a candle to the symbol's history, moves the clock to its
+// close time and fills resting orders whose price the candle reached.
+func (f *fakeExchange) FeedCandle(symbol string, kline *binance.Kline) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.candles[symbol] = append(f.candles[symbol], kline)
+	f.now = time.UnixMilli(kline.CloseTime)
+
+	high, _ := strconv.ParseFloat(kline.High, 64)
+	low, _ := strconv.ParseFloat(kline.Low, 64)
+
+	for _, id := range f.sequence {
+		order := f.orders[id]
+		if order.Symbol != symbol || !isOpenOrderStatus(order.Status) {
+			continue
+		}
+
+		price, _ := strconv.ParseFloat(order.Price, 64)
+		if order.Type == binance.OrderTypeStopLossLimit {
+			// An untriggered stop is not working. Once the candle reaches the
+			// stop it rests as a limit sell, filling at the stop or the gapped
+			// open, but not below its limit price.
+			stopPrice, _ := strconv.ParseFloat(order.StopPrice, 64)
+			if !order.IsWorking {
+				if low > stopPrice {
+					continue
+				}
+				order.IsWorking = true
+				open, _ := strconv.ParseFloat(kline.Open, 64)
+				if fill := math.Min(stopPrice, open); fill > price {
+					price = fill
+				}
+			}
+		}
+		if (order.Side == binance.SideTypeSell && high >= price) || (order.Side == binance.SideTypeBuy && low <= price) {
+			quantity, _ := strconv.ParseFloat(order.OrigQuantity, 64)
+			f.settle(f.symbols[symbol], order, quantity, price, true)
+			f.expireList(order)
+		}
+	}
+}
+
+// OpenOrders returns the resting orders in the order they were placed.
+func (f *fakeExchange) OpenOrders() []binance.Order {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var result []binance.Order
+	for _, id := range f.sequence {
+		if isOpenOrderStatus(f.orders[id].Status) {
+			result = append(result, *f.orders[id])
+		}
+	}
+	return result
+}
+
+func (f *fakeExchange) GetKlines(ctx context.Context, symbol string, interval string, limit int) ([]*binance.Kline, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, exists := f.symbols[symbol]; !exists {
+		return nil, &common.APIError{Code: -1121, Message: "Invalid symbol."}
+	}
+
+	candles := f.candles[symbol]
+	if limit > 0 && len(candles) > limit {
+		candles = candles[len(candles)-limit:]
+	}
+	return append([]*binance.Kline{}, candles...), nil
+}
+
+func (f *fakeExchange) GetKlinesFrom(ctx context.Context, symbol string, interval string, startTime int64, limit int) ([]*binance.Kline, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, exists := f.symbols[symbol]; !exists {
+		return nil, &common.APIError{Code: -1121, Message: "Invalid symbol."}
+	}
+
+	result := []*binance.Kline{}
+	for _, k := range f.candles[symbol] {
+		if k.OpenTime < startTime {
+			continue
+		}
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+		result = append(result, k)
+	}
+	return result, nil
+}
+
+func (f *fakeExchange) GetExchangeInfo(ctx context.Context) (*binance.ExchangeInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info := &binance.ExchangeInfo{ServerTime: f.now.UnixMilli()}
+	for _, symbol := range f.symbols {
+		info.Symbols = append(info.Symbols, symbol)
+	}
+	sort.Slice(info.Symbols, func(i, j int) bool {
+		return info.Symbols[i].Symbol < info.Symbols[j].Symbol
+	})
+	return info, nil
+}
+
+func (f *fakeExchange) GetUserAssets(ctx context.Context) ([]binance.UserAssetRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var assets []string
+	for asset := range f.balances {
+		assets = append(assets, asset)
+	}
+	for asset := range f.locked {
+		if _, exists := f.balances[asset]; !exists {
+			assets = append(assets, asset)
+		}
+	}
+	sort.Strings(assets)
+
+	var result []binance.UserAssetRecord
+	for _, asset := range assets {
+		if f.balances[asset] <= 0 && f.locked[asset] <= 0 {
+			continue
+		}
+		result = append(result, binance.UserAssetRecord{
+			Asset:  asset,
+			Free:   formatFakeAmount(f.balances[asset]),
+			Locked: formatFakeAmount(f.locked[asset]),
+		})
+	}
+	return result, nil
+}
+
+func (f *fakeExchange) CreateOrder(ctx context.Context, request OrderRequest) (*binance.CreateOrderResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	symbol, exists := f.symbols[request.Symbol]
+	if !exists {
+		return nil, &common.APIError{Code: -1121, Message: "Invalid symbol."}
+	}
+
+	quantity, _ := strconv.ParseFloat(request.Quantity, 64)
+	quoteQuantity, _ := strconv.ParseFloat(request.QuoteOrderQty, 64)
+	price, _ := strconv.ParseFloat(request.Price, 64)
+
+	f.nextID++
+	order := &binance.Order{
+		Symbol:        request.Symbol,
+		OrderID:       f.nextID,
+		OrderListId:   -1,
+		ClientOrderID: fmt.Sprintf("%s%016d", f.clientIDPrefix, f.nextID),
+		Status:        binance.OrderStatusTypeNew,
+		TimeInForce:   request.TimeInForce,
+		Type:          request.Type,
+		Side:          request.Side,
+		Time:          f.now.UnixMilli(),
+		UpdateTime:    f.now.UnixMilli(),
+		IsWorking:     true,
+	}
+
+	var fills []*binance.Fill
+	switch request.Type {
+	case binance.OrderTypeMarket:
+		marketPrice, err := f.lastPrice(request.Symbol)
+		if err != nil {
+			return nil, err
+		}
+		if quantity <= 0 && quoteQuantity > 0 {
+			quantity = floorToFakeStep(quoteQuantity/marketPrice, symbolFilterValue(symbol, "LOT_SIZE", "stepSize"))
+			order.OrigQuoteOrderQuantity = formatFakeAmount(quoteQuantity)
+		}
+		if quantity <= 0 {
+			return nil, &common.APIError{Code: -1013, Message: "Invalid quantity."}
+		}
+		if err := checkFakeFilters(symbol, quantity, marketPrice, false); err != nil {
+			return nil, err
+		}
+		if err := f.checkBalance(symbol, request.Side, quantity, marketPrice); err != nil {
+			return nil, err
+		}
+
+		order.Price = formatFakeAmount(0)
+		order.OrigQuantity = formatFakeAmount(quantity)
+		fills = append(fills, f.settle(symbol, order, quantity, marketPrice, false))
+
+	case binance.OrderTypeLimit:
+		if quantity <= 0 || price <= 0 {
+			return nil, &common.APIError{Code: -1013, Message: "Filter failure: PRICE_FILTER"}
+		}
+		if err := checkFakeFilters(symbol, quantity, price, true); err != nil {
+			return nil, err
+		}
+		if err := f.checkBalance(symbol, request.Side, quantity, price); err != nil {
+			return nil, err
+		}
+
+		order.Price = request.Price
+		order.OrigQuantity = formatFakeAmount(quantity)
+		order.ExecutedQuantity = formatFakeAmount(0)
+		order.CummulativeQuoteQuantity = formatFakeAmount(0)
+		if request.Side == binance.SideTypeSell {
+			f.balances[symbol.BaseAsset] -= quantity
+			f.locked[symbol.BaseAsset] += quantity
+		} else {
+			f.balances[symbol.QuoteAsset] -= quantity * price
+			f.locked[symbol.QuoteAsset] += quantity * price
+		}
+
+	default:
+		return nil, &common.APIError{Code: -1116, Message: "Invalid orderType."}
+	}
+
+	f.orders[order.ClientOrderID] = order
+	f.sequence = append(f.sequence, order.ClientOrderID)
+
+	return &binance.CreateOrderResponse{
+		Symbol:                   order.Symbol,
+		OrderID:                  order.OrderID,
+		ClientOrderID:            order.ClientOrderID,
+		TransactTime:             f.now.UnixMilli(),
+		Price:                    order.Price,
+		OrigQuantity:             order.OrigQuantity,
+		ExecutedQuantity:         order.ExecutedQuantity,
+		CummulativeQuoteQuantity: order.CummulativeQuoteQuantity,
+		Status:                   order.Status,
+		TimeInForce:              order.TimeInForce,
+		Type:                     order.Type,
+		Side:                     order.Side,
+		Fills:                    fills,
+	}, nil
+}
+
+// CreateOCO supports the sell lists the bot places: the stop-loss-limit leg
+// is listed first, as on Binance, so a candle reaching both legs fills the
+// stop. The quantity is locked once for the pair.
+func (f *fakeExchange) CreateOCO(ctx context.Context, request OCORequest) (*binance.CreateOCOResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	symbol, exists := f.symbols[request.Symbol]
+	if !exists {
+		return nil, &common.APIError{Code: -1121, Message: "Invalid symbol."}
+	}
+	if request.Side != binance.SideTypeSell {
+		return nil, &common.APIError{Code: -1106, Message: "Parameter 'side' only supports SELL on the fake exchange."}
+	}
+
+	quantity, _ := strconv.ParseFloat(request.Quantity, 64)
+	price, _ := strconv.ParseFloat(request.Price, 64)
+	stopPrice, _ := strconv.ParseFloat(request.StopPrice, 64)
+	stopLimitPrice, _ := strconv.ParseFloat(request.StopLimitPrice, 64)
+
+	marketPrice, err := f.lastPrice(request.Symbol)
+	if err != nil {
+		return nil, err
+	}
+	if quantity <= 0 || price <= 0 || stopPrice <= 0 || stopLimitPrice <= 0 {
+		return nil, &common.APIError{Code: -1013, Message: "Filter failure: PRICE_FILTER"}
+	}
+	if price <= marketPrice || stopPrice >= marketPrice {
+		return nil, &common.APIError{Code: -2010, Message: "The relationship of the prices for the orders is not correct."}
+	}
+	for _, legPrice := range []float64{price, stopLimitPrice} {
+		if err := checkFakeFilters(symbol, quantity, legPrice, true); err != nil {
+			return nil, err
+		}
+	}
+	if err := f.checkBalance(symbol, request.Side, quantity, price); err != nil {
+		return nil, err
+	}
+
+	f.nextID++
+	listID := f.nextID
+	newLeg := func(orderType binance.OrderType, legPrice, legStopPrice string, working bool) *binance.Order {
+		f.nextID++
+		order := &binance.Order{
+			Symbol:                   request.Symbol,
+			OrderID:                  f.nextID,
+			OrderListId:              listID,
+			ClientOrderID:            fmt.Sprintf("%s%016d", f.clientIDPrefix, f.nextID),
+			Price:                    legPrice,
+			OrigQuantity:             formatFakeAmount(quantity),
+			ExecutedQuantity:         formatFakeAmount(0),
+			CummulativeQuoteQuantity: formatFakeAmount(0),
+			Status:                   binance.OrderStatusTypeNew,
+			Type:                     orderType,
+			Side:                     request.Side,
+			StopPrice:                legStopPrice,
+			Time:                     f.now.UnixMilli(),
+			UpdateTime:               f.now.UnixMilli(),
+			IsWorking:                working,
+		}
+		if orderType == binance.OrderTypeStopLossLimit {
+			order.TimeInForce = request.StopLimitTimeInForce
+		}
+		f.orders[order.ClientOrderID] = order
+		f.sequence = append(f.sequence, order.ClientOrderID)
+		return order
+	}
+	legs := []*binance.Order{
+		newLeg(binance.OrderTypeStopLossLimit, request.StopLimitPrice, request.StopPrice, false),
+		newLeg(binance.OrderTypeLimitMaker, request.Price, "", true),
+	}
+
+	f.balances[symbol.BaseAsset] -= quantity
+	f.locked[symbol.BaseAsset] += quantity
+
+	response := &binance.CreateOCOResponse{
+		OrderListID:       listID,
+		ContingencyType:   "OCO",
+		ListStatusType:    "EXEC_STARTED",
+		ListOrderStatus:   "EXECUTING",
+		ListClientOrderID: fmt.Sprintf("%slist%016d", f.clientIDPrefix, listID),
+		TransactionTime:   f.now.UnixMilli(),
+		Symbol:            request.Symbol,
+	}
+	for _, leg := range legs {
+		response.Orders = append(response.Orders, &binance.OCOOrder{Symbol: leg.Symbol, OrderID: leg.OrderID, ClientOrderID: leg.ClientOrderID})
+		response.OrderReports = append(response.OrderReports, fakeOCOReport(leg))
+	}
+	return response, nil
+}
+
+// CancelOCO cancels the open legs of an order list and unlocks its quantity.
+func (f *fakeExchange) CancelOCO(ctx context.Context, symbol string, orderListID int64) (*binance.CancelOCOResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	legs := f.listLegs(symbol, orderListID)
+	if len(legs) == 0 || !isOpenOrderStatus(legs[0].Status) {
+		return nil, &common.APIError{Code: -2011, Message: "Unknown order list sent."}
+	}
+	f.cancelLegs(legs)
+
+	response := &binance.CancelOCOResponse{
+		OrderListID:     orderListID,
+		ContingencyType: "OCO",
+		ListStatusType:  "ALL_DONE",
+		ListOrderStatus: "ALL_DONE",
+		TransactionTime: f.now.UnixMilli(),
+		Symbol:          symbol,
+	}
+	for _, leg := range legs {
+		response.Orders = append(response.Orders, &binance.OCOOrder{Symbol: leg.Symbol, OrderID: leg.OrderID, ClientOrderID: leg.ClientOrderID})
+		response.OrderReports = append(response.OrderReports, fakeOCOReport(leg))
+	}
+	return response, nil
+}
+
+// listLegs returns the orders of an order list in the order they were placed.
+func (f *fakeExchange) listLegs(symbol string, orderListID int64) []*binance.Order {
+	var legs []*binance.Order
+	for _, id := range f.sequence {
+		if order := f.orders[id]; order.Symbol == symbol && order.OrderListId == orderListID {
+			legs = append(legs, order)
+		}
+	}
+	return legs
+}
+
+// cancelLegs cancels the open orders among legs, which share one locked
+// quantity, so it is released once.
+func (f *fakeExchange) cancelLegs(legs []*binance.Order) {
+	released := false
+	for _, order := range legs {
+		if !isOpenOrderStatus(order.Status) {
+			continue
+		}
+		if !released {
+			released = true
+			info := f.symbols[order.Symbol]
+			origQuantity, _ := strconv.ParseFloat(order.OrigQuantity, 64)
+			executedQuantity, _ := strconv.ParseFloat(order.ExecutedQuantity, 64)
+			price, _ := strconv.ParseFloat(order.Price, 64)
+			remaining := origQuantity - executedQuantity
+			if order.Side == binance.SideTypeSell {
+				f.locked[info.BaseAsset] -= remaining
+				f.balances[info.BaseAsset] += remaining
+			} else {
+				f.locked[info.QuoteAsset] -= remaining * price
+				f.balances[info.QuoteAsset] += remaining * price
+			}
+		}
+
+		order.Status = binance.OrderStatusTypeCanceled
+		order.IsWorking = false
+		order.UpdateTime = f.now.UnixMilli()
+	}
+}
+
+// expireList expires the other legs once one leg of a list filled. The
+// fill already released the shared locked quantity.
+func (f *fakeExchange) expireList(filled *binance.Order) {
+	if filled.OrderListId == -1 {
+		return
+	}
+	for _, order := range f.listLegs(filled.Symbol, filled.OrderListId) {
+		if order != filled && isOpenOrderStatus(order.Status) {
+			order.Status = binance.OrderStatusTypeExpired
+			order.IsWorking = false
+			order.UpdateTime = f.now.UnixMilli()
+		}
+	}
+}
+
+func fakeOCOReport(order *binance.Order) *binance.OCOOrderReport {
+	return &binance.OCOOrderReport{
+		Symbol:                   order.Symbol,
+		OrderID:                  order.OrderID,
+		OrderListID:              order.OrderListId,
+		ClientOrderID:            order.ClientOrderID,
+		TransactionTime:          order.UpdateTime,
+		Price:                    order.Price,
+		OrigQuantity:             order.OrigQuantity,
+		ExecutedQuantity:         order.ExecutedQuantity,
+		CummulativeQuoteQuantity: order.CummulativeQuoteQuantity,
+		Status:                   order.Status,
+		TimeInForce:              order.TimeInForce,
+		Type:                     order.Type,
+		Side:                     order.Side,
+		StopPrice:                order.StopPrice,
+	}
+}
+
+func (f *fakeExchange) CancelOrder(ctx context.Context, symbol string, clientOrderID string) (*binance.CancelOrderResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	order, exists := f.orders[clientOrderID]
+	if !exists || order.Symbol != symbol || !isOpenOrderStatus(order.Status) {
+		return nil, &common.APIError{Code: -2011, Message: "Unknown order sent."}
+	}
+
+	// Canceling one leg of a list cancels the whole list, as on Binance.
+	if order.OrderListId == -1 {
+		f.cancelLegs([]*binance.Order{order})
+	} else {
+		f.cancelLegs(f.listLegs(symbol, order.OrderListId))
+	}
+
+	return &binance.CancelOrderResponse{
+		Symbol:                   order.Symbol,
+		OrigClientOrderID:        order.ClientOrderID,
+		OrderID:                  order.OrderID,
+		OrderListID:              order.OrderListId,
+		ClientOrderID:            order.ClientOrderID,
+		TransactTime:             f.now.UnixMilli(),
+		Price:                    order.Price,
+		OrigQuantity:             order.OrigQuantity,
+		ExecutedQuantity:         order.ExecutedQuantity,
+		CummulativeQuoteQuantity: order.CummulativeQuoteQuantity,
+		Status:                   order.Status,
+		TimeInForce:              order.TimeInForce,
+		Type:                     order.Type,
+		Side:                     order.Side,
+	}, nil
+}
+
+func (f *fakeExchange) GetOrder(ctx context.Context, symbol string, clientOrderID string) (*binance.Order, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	order, exists := f.orders[clientOrderID]
+	if !exists || order.Symbol != symbol {
+		return nil, &common.APIError{Code: -2013, Message: "Order does not exist."}
+	}
+
+	result := *order
+	return &result, nil
+}
+
+func (f *fakeExchange) lastPrice(symbol string) (float64, error) {
+	candles := f.candles[symbol]
+	if len(candles) == 0 {
+		return 0, &common.APIError{Code: -1013, Message: "Market is closed."}
+	}
+	return strconv.ParseFloat(candles[len(candles)-1].Close, 64)
+}
+
+func (f *fakeExchange) checkBalance(symbol binance.Symbol, side binance.SideType, quantity, price float64) error {
+	if side == binance.SideTypeSell && f.balances[symbol.BaseAsset] < quantity {
+		return &common.APIError{Code: -2010, Message: "Account has insufficient balance for requested action."}
+	}
+	if side == binance.SideTypeBuy && f.balances[symbol.QuoteAsset] < quantity*price {
+		return &common.APIError{Code: -2010, Message: "Account has insufficient balance for requested action."}
+	}
+	return nil
+}
+
+// settle moves the balances for a full fill of order at price. Resting
+// orders pay out of the locked balance, market orders out of the free one.
+func (f *fakeExchange) settle(symbol binance.Symbol, order *binance.Order, quantity, price float64, resting bool) *binance.Fill {
+	quote := quantity * price
+
+	fill := &binance.Fill{
+		TradeID:  order.OrderID,
+		Price:    formatFakeAmount(price),
+		Quantity: formatFakeAmount(quantity),
+	}
+
+	if order.Side == binance.SideTypeBuy {
+		if resting {
+			f.locked[symbol.QuoteAsset] -= quote
+		} else {
+			f.balances[symbol.QuoteAsset] -= quote
+		}
+		fee := quantity * f.feeRate
+		f.balances[symbol.BaseAsset] += quantity - fee
+		fill.Commission = formatFakeAmount(fee)
+		fill.CommissionAsset = symbol.BaseAsset
+	} else {
+		if resting {
+			f.locked[symbol.BaseAsset] -= quantity
+		} else {
+			f.balances[symbol.BaseAsset] -= quantity
+		}
+		fee := quote * f.feeRate
+		f.balances[symbol.QuoteAsset] += quote - fee
+		fill.Commission = formatFakeAmount(fee)
+		fill.CommissionAsset = symbol.QuoteAsset
+	}
+
+	order.ExecutedQuantity = formatFakeAmount(quantity)
+	order.CummulativeQuoteQuantity = formatFakeAmount(quote)
+	order.Status = binance.OrderStatusTypeFilled
+	order.IsWorking = false
+	order.UpdateTime = f.now.UnixMilli()
+
+	return fill
+}
+
+// checkFakeFilters rejects orders the way Binance's PRICE_FILTER, LOT_SIZE
+// and NOTIONAL/MIN_NOTIONAL filters would. The price is only checked
+// against PRICE_FILTER for limit orders.
+func checkFakeFilters(symbol binance.Symbol, quantity, price float64, limit bool) error {
+	failure := func(filter string) error {
+		return &common.APIError{Code: -1013, Message: "Filter failure: " + filter}
+	}
+
+	if limit {
+		minPrice := symbolFilterValue(symbol, "PRICE_FILTER", "minPrice")
+		maxPrice := symbolFilterValue(symbol, "PRICE_FILTER", "maxPrice")
+		tickSize := symbolFilterValue(symbol, "PRICE_FILTER", "tickSize")
+		if (minPrice > 0 && price < minPrice) || (maxPrice > 0 && price > maxPrice) || !isFakeStepMultiple(price, minPrice, tickSize) {
+			return failure("PRICE_FILTER")
+		}
+	}
+
+	minQty := symbolFilterValue(symbol, "LOT_SIZE", "minQty")
+	maxQty := symbolFilterValue(symbol, "LOT_SIZE", "maxQty")
+	stepSize := symbolFilterValue(symbol, "LOT_SIZE", "stepSize")
+	if (minQty > 0 && quantity < minQty) || (maxQty > 0 && quantity > maxQty) || !isFakeStepMultiple(quantity, minQty, stepSize) {
+		return failure("LOT_SIZE")
+	}
+
+	for _, filter := range []string{"NOTIONAL", "MIN_NOTIONAL"} {
+		minNotional := symbolFilterValue(symbol, filter, "minNotional")
+		if minNotional > 0 && quantity*price < minNotional {
+			return failure(filter)
+		}
+	}
+
+	return nil
+}
+
+// symbolFilterValue returns a numeric field of one of the symbol's filters,
+// or 0 when the filter or field is missing.
+func symbolFilterValue(symbol binance.Symbol, filterType, key string) float64 {
+	for _, filter := range symbol.Filters {
+		if filter["filterType"] != filterType {
+			continue
+		}
+		value, _ := filter[key].(string)
+		result, _ := strconv.ParseFloat(value, 64)
+		return result
+	}
+	return 0
+}
+
+func isFakeStepMultiple(value, min, step float64) bool {
+	if step <= 0 {
+		return true
+	}
+	steps := (value - min) / step
+	return math.Abs(steps-math.Round(steps)) < 1e-6
+}
+
+func floorToFakeStep(value, step float64) float64 {
+	if step <= 0 {
+		return value
+	}
+	return math.Floor(value/step+1e-9) * step
+}
+
+func isOpenOrderStatus(status binance.OrderStatusType) bool {
+	return status == binance.OrderStatusTypeNew || status == binance.OrderStatusTypePartiallyFilled
+}
+
+func formatFakeAmount(value float64) string {
+	return strconv.FormatFloat(value, 'f', 8, 64)
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/adshao/go-binance/v2/common"
+)
+
+// The flow tests run screening, the order status check and the stop loss
+// check the way their endpoints do, minus the scheduler lock, against a
+// fakeExchange and a memoryStore. Every position is bought the same way: 10
+// USDT at 10 for 1 AAA, of which the 0.1% fee leaves 0.999.
+
+const (
+	flowSymbol   = "AAAUSDT"
+	flowStrategy = "flow"
+	flowFeeRate  = 0.001
+)
+
+var flowStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func flowSymbolInfo() binance.Symbol {
+	return binance.Symbol{
+		Symbol:               flowSymbol,
+		BaseAsset:            "AAA",
+		QuoteAsset:           "USDT",
+		IsSpotTradingAllowed: true,
+		Filters: []map[string]interface{}{
+			{"filterType": "PRICE_FILTER", "tickSize": "0.01", "minPrice": "0.01", "maxPrice": "10000"},
+			{"filterType": "LOT_SIZE", "stepSize": "0.001", "minQty": "0.001", "maxQty": "10000"},
+			{"filterType": "NOTIONAL", "minNotional": "5", "applyMinToMarket": true},
+		},
+	}
+}
+
+// flowKline is the i-th 15m candle of the test market.
+func flowKline(i int, open, high, low, close float64) *binance.Kline {
+	openTime := flowStart.Add(time.Duration(i) * 15 * time.Minute)
+	format := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return &binance.Kline{
+		OpenTime:         openTime.UnixMilli(),
+		CloseTime:        openTime.Add(15*time.Minute).UnixMilli() - 1,
+		Open:             format(open),
+		High:             format(high),
+		Low:              format(low),
+		Close:            format(close),
+		Volume:           "1000",
+		QuoteAssetVolume: format(1000 * close),
+	}
+}
+
+// flowMarket is a fakeExchange with 100 USDT and a screening window of AAA
+// trading flat at 10. It returns the index of the next candle.
+func flowMarket() (*fakeExchange, int) {
+	exchange := newFakeExchange(flowFeeRate)
+	exchange.AddSymbol(flowSymbolInfo())
+	exchange.SetBalance("USDT", 100)
+	for i := 0; i < SCREENING_WINDOW; i++ {
+		exchange.FeedCandle(flowSymbol, flowKline(i, 10, 10.05, 9.95, 10))
+	}
+	return exchange, SCREENING_WINDOW
+}
+
+// useFlowConfig runs the test on the default config with one rules strategy
+// that buys every symbol, and restores the config afterwards.
+func useFlowConfig(t *testing.T, exitMode string) {
+	t.Helper()
+
+	previous := config
+	t.Cleanup(func() { config = previous })
+
+	config = defaultConfig()
+	config.Trading.MinAlertCoins = 0
+	config.Trading.ExitMode = exitMode
+	config.Strategies = []StrategyConfig{{Name: flowStrategy, Kind: STRATEGY_RULES, Buy: "close > 0"}}
+	if err := config.Strategies[0].resolve(config.Screening, config.Trading); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// openFlowPosition screens twice, since a pair is only bought when it also
+// alerted the run before, and returns the trade the second run stored.
+func openFlowPosition(t *testing.T, exchange *fakeExchange, store *memoryStore) TradingDetails {
+	t.Helper()
+
+	runScreening(exchange, store)
+	if trades, _ := store.ListTrades(); len(trades) != 0 {
+		t.Fatalf("the first screening stored %d trades, want none", len(trades))
+	}
+	state, _ := store.LoadAlertState(flowStrategy)
+	if len(state.LastAlertCoin) != 1 || state.LastAlertCoin[0] != flowSymbol {
+		t.Fatalf("alert state after the first screening = %v, want [%s]", state.LastAlertCoin, flowSymbol)
+	}
+	checkFlowBalance(t, exchange, "USDT", 100, 0)
+
+	runScreening(exchange, store)
+	trades, _ := store.ListTrades()
+	if len(trades) != 1 {
+		t.Fatalf("the second screening stored %d trades, want 1", len(trades))
+	}
+	trade := trades[0]
+	if trade.Pair != flowSymbol || trade.Strategy != flowStrategy || trade.Status != "NEW" || trade.BuyPrice != 10 || trade.Quantity != "0.999" {
+		t.Fatalf("stored trade = %+v, want a NEW %s trade of 0.999 bought at 10 by %s", trade, flowSymbol, flowStrategy)
+	}
+	if trade.PositionID == "" {
+		t.Errorf("stored trade has no position ID")
+	}
+
+	cooldowns, _ := store.LoadCooldowns(flowStrategy)
+	if cooldowns[flowSymbol] != 1 {
+		t.Errorf("cooldowns = %v, want %s once", cooldowns, flowSymbol)
+	}
+	checkFlowBalance(t, exchange, "USDT", 90, 0)
+	return trade
+}
+
+func checkFlowBalance(t *testing.T, exchange *fakeExchange, asset string, wantFree, wantLocked float64) {
+	t.Helper()
+
+	free, locked := exchange.Balance(asset)
+	if math.Abs(free-wantFree) > 1e-9 || math.Abs(locked-wantLocked) > 1e-9 {
+		t.Errorf("%s balance = %v free, %v locked, want %v free, %v locked", asset, free, locked, wantFree, wantLocked)
+	}
+}
+
+func TestFlowOCOTakeProfit(t *testing.T) {
+	useFlowConfig(t, EXIT_MODE_BRACKET)
+	exchange, next := flowMarket()
+	store := newMemoryStore()
+
+	trade := openFlowPosition(t, exchange, store)
+	if trade.SellPrice != "10.20" || trade.StopPrice != "9.80" || trade.StopOrderID == "" || trade.OrderID == "" {
+		t.Fatalf("stored exit = %+v, want an OCO list at 10.20 and 9.80", trade)
+	}
+	checkFlowBalance(t, exchange, "AAA", 0, 0.999)
+
+	// The stop is on the exchange, the stop loss check leaves the trade alone.
+	exchange.FeedCandle(flowSymbol, flowKline(next, 10, 10.1, 9.9, 10.05))
+	runStopLoss(exchange, store)
+	runOrderStatus(exchange, store)
+	if got := store.trade(trade.ID); got.Status != "NEW" || got.Exit != "" {
+		t.Fatalf("trade before the take profit = %+v, want it still open", got)
+	}
+
+	exchange.FeedCandle(flowSymbol, flowKline(next+1, 10.05, 10.3, 10.05, 10.25))
+	runOrderStatus(exchange, store)
+
+	got := store.trade(trade.ID)
+	if got.Status != "FILLED" || got.Exit != EXIT_TAKE_PROFIT || got.SellPrice != "10.20" || got.ClosedAt == "" {
+		t.Errorf("trade after the take profit = %+v, want FILLED by the take profit at 10.20", got)
+	}
+	checkFlowBalance(t, exchange, "AAA", 0, 0)
+	checkFlowBalance(t, exchange, "USDT", 90+0.999*10.2*(1-flowFeeRate), 0)
+	if open := exchange.OpenOrders(); len(open) != 0 {
+		t.Errorf("open orders after the take profit = %v, want none", open)
+	}
+}
+
+func TestFlowOCOStopLoss(t *testing.T) {
+	useFlowConfig(t, EXIT_MODE_BRACKET)
+	exchange, next := flowMarket()
+	store := newMemoryStore()
+
+	trade := openFlowPosition(t, exchange, store)
+
+	// The candle opens above the 9.80 stop and trades through it, the stop
+	// fills at its trigger.
+	exchange.FeedCandle(flowSymbol, flowKline(next, 9.9, 9.95, 9.6, 9.7))
+	runStopLoss(exchange, store)
+	runOrderStatus(exchange, store)
+
+	got := store.trade(trade.ID)
+	if got.Status != "FILLED" || got.Exit != EXIT_STOP_LOSS || got.SellPrice != "9.8" || got.ClosedAt == "" {
+		t.Errorf("trade after the stop loss = %+v, want FILLED by the stop loss at 9.8", got)
+	}
+	checkFlowBalance(t, exchange, "AAA", 0, 0)
+	checkFlowBalance(t, exchange, "USDT", 90+0.999*9.8*(1-flowFeeRate), 0)
+}
+
+func TestFlowTrailingStop(t *testing.T) {
+	useFlowConfig(t, EXIT_MODE_TRAILING)
+	exchange, next := flowMarket()
+	store := newMemoryStore()
+
+	trade := openFlowPosition(t, exchange, store)
+	if trade.TrailStop != "9.80" || trade.HighPrice != "10.00" || trade.OrderID != trade.PositionID {
+		t.Fatalf("stored trailing stop = %+v, want a stop at 9.80 under a high of 10.00", trade)
+	}
+	checkFlowBalance(t, exchange, "AAA", 0.999, 0)
+
+	// A new high of 10.60 pulls the stop up to 2% below it.
+	exchange.FeedCandle(flowSymbol, flowKline(next, 10, 10.6, 9.98, 10.5))
+	runOrderStatus(exchange, store)
+	runStopLoss(exchange, store)
+	if got := store.trade(trade.ID); got.Status != "NEW" || got.HighPrice != "10.60" || got.TrailStop != "10.38" {
+		t.Fatalf("trade after the new high = %+v, want it open with the stop at 10.38", got)
+	}
+
+	exchange.FeedCandle(flowSymbol, flowKline(next+1, 10.5, 10.5, 10.1, 10.2))
+	runStopLoss(exchange, store)
+
+	got := store.trade(trade.ID)
+	if got.Status != "FILLED" || got.Exit != EXIT_TRAILING_STOP || got.SellPrice != "10.2" || got.ClosedAt == "" {
+		t.Errorf("trade after the trailing stop = %+v, want FILLED by the trailing stop at 10.2", got)
+	}
+	checkFlowBalance(t, exchange, "AAA", 0, 0)
+	checkFlowBalance(t, exchange, "USDT", 90+0.999*10.2*(1-flowFeeRate), 0)
+}
+
+func TestFlowPausedDoesNotTrade(t *testing.T) {
+	useFlowConfig(t, EXIT_MODE_BRACKET)
+	exchange, _ := flowMarket()
+	store := newMemoryStore()
+	store.SaveTradingSwitch(TradingSwitch{Enabled: false, Reason: "test"})
+
+	runScreening(exchange, store)
+	runScreening(exchange, store)
+
+	if trades, _ := store.ListTrades(); len(trades) != 0 {
+		t.Errorf("paused screening stored %d trades, want none", len(trades))
+	}
+	if state, _ := store.LoadAlertState(flowStrategy); len(state.LastAlertCoin) != 0 {
+		t.Errorf("paused screening saved alert state %v", state.LastAlertCoin)
+	}
+	checkFlowBalance(t, exchange, "USDT", 100, 0)
+}
+
+// noOCOExchange rejects every OCO list, as Binance does for a symbol that
+// stopped allowing them.
+type noOCOExchange struct {
+	*fakeExchange
+}
+
+func (e noOCOExchange) CreateOCO(ctx context.Context, order OCORequest) (*binance.CreateOCOResponse, error) {
+	return nil, &common.APIError{Code: -1013, Message: "OCO orders are not supported for this symbol."}
+}
+
+func TestFlowLimitExitPolledStopLoss(t *testing.T) {
+	useFlowConfig(t, EXIT_MODE_BRACKET)
+	fake, next := flowMarket()
+	exchange := noOCOExchange{fake}
+	store := newMemoryStore()
+
+	runScreening(exchange, store)
+	runScreening(exchange, store)
+	trades, _ := store.ListTrades()
+	if len(trades) != 1 || trades[0].StopOrderID != "" || trades[0].OrderID == "error" || trades[0].SellPrice != "10.20" {
+		t.Fatalf("stored trades = %+v, want one limit exit at 10.20", trades)
+	}
+	trade := trades[0]
+	checkFlowBalance(t, fake, "AAA", 0, 0.999)
+
+	// The close of 9.70 is below the 9.80 stop: the limit exit is canceled
+	// and the position sold at market.
+	fake.FeedCandle(flowSymbol, flowKline(next, 9.9, 9.9, 9.6, 9.7))
+	runStopLoss(exchange, store)
+	runOrderStatus(exchange, store)
+
+	got := store.trade(trade.ID)
+	if got.Status != "FILLED" || got.Exit != EXIT_STOP_LOSS || got.SellPrice != "9.7" || got.ClosedAt == "" {
+		t.Fatalf("trade after the stop loss = %+v, want FILLED by the stop loss at 9.7", got)
+	}
+	if pnl := legPnL(got); math.Abs(pnl-(9.7-10)*0.999) > 1e-9 {
+		t.Errorf("leg PnL = %v, want %v", pnl, (9.7-10)*0.999)
+	}
+	checkFlowBalance(t, fake, "AAA", 0, 0)
+	checkFlowBalance(t, fake, "USDT", 90+0.999*9.7*(1-flowFeeRate), 0)
+	if open := fake.OpenOrders(); len(open) != 0 {
+		t.Errorf("open orders after the stop loss = %v, want none", open)
+	}
+}
+
+// A stored quantity off the step size, as rows written before the symbol
+// rules existed can be, is sold rounded down to the step.
+func TestFlowStopLossSellsAdjustedQuantity(t *testing.T) {
+	tests := []struct {
+		name  string
+		trade TradingDetails
+		limit bool
+	}{
+		{
+			name:  "limit exit",
+			trade: TradingDetails{OrderListID: -1},
+			limit: true,
+		},
+		{
+			name:  "trailing stop",
+			trade: TradingDetails{OrderID: "buy", OrderListID: -1, HighPrice: "10.00", TrailStop: "9.80"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useFlowConfig(t, EXIT_MODE_BRACKET)
+			exchange, next := flowMarket()
+			exchange.SetBalance("USDT", 0)
+			exchange.SetBalance("AAA", 0.9999)
+			store := newMemoryStore()
+
+			trade := test.trade
+			if test.limit {
+				response, err := exchange.CreateOrder(context.Background(), OrderRequest{
+					Symbol: flowSymbol, Side: binance.SideTypeSell, Type: binance.OrderTypeLimit,
+					TimeInForce: binance.TimeInForceTypeGTC, Quantity: "0.999", Price: "10.20",
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				trade.OrderID, trade.SellPrice = response.ClientOrderID, "10.20"
+			}
+			trade.Pair, trade.Quantity, trade.BuyPrice, trade.Strategy = flowSymbol, "0.9999", 10, flowStrategy
+			store.AppendTrades([]TradingDetails{trade})
+
+			exchange.FeedCandle(flowSymbol, flowKline(next, 9.9, 9.9, 9.6, 9.7))
+			runStopLoss(exchange, store)
+
+			if got := store.trade(1); got.Status != "FILLED" || got.SellPrice != "9.7" {
+				t.Errorf("trade after the stop = %+v, want FILLED at 9.7", got)
+			}
+			checkFlowBalance(t, exchange, "AAA", 0.0009, 0)
+			checkFlowBalance(t, exchange, "USDT", 0.999*9.7*(1-flowFeeRate), 0)
+		})
+	}
+}
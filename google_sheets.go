@@ -10,11 +10,72 @@ import (
 	"google.golang.org/api/sheets/v4"
 )
 
-func getDataFromGoogleSheets(service *sheets.Service) (*sheets.ValueRange, error) {
-	ctx := context.Background()
+// alertStateTab is the tab holding a strategy's alert state: "data" for the
+// default strategy, so existing spreadsheets keep working, and "data_<name>"
+// for the others.
+func alertStateTab(strategy string) string {
+	if strategy == DEFAULT_STRATEGY_NAME {
+		return "data"
+	}
+	return "data_" + strategy
+}
+
+// riskTab is the tab holding the risk halt: "risk" live and "risk_paper"
+// in paper mode, so a paper halt never stops live trading.
+func riskTab() string {
+	if config.Paper.Enabled {
+		return "risk_paper"
+	}
+	return "risk"
+}
+
+// controlTab is the tab holding the kill switch: "control" live and
+// "control_paper" in paper mode.
+func controlTab() string {
+	if config.Paper.Enabled {
+		return "control_paper"
+	}
+	return "control"
+}
+
+// ensureSheetTab adds the tab to the spreadsheet when it does not have it
+// yet, so the tab of a new strategy needs no setup.
+func ensureSheetTab(ctx context.Context, service *sheets.Service, tab string) error {
+	exists, err := sheetTabExists(ctx, service, tab)
+	if err != nil || exists {
+		return err
+	}
+
+	request := &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: []*sheets.Request{
+			{AddSheet: &sheets.AddSheetRequest{Properties: &sheets.SheetProperties{Title: tab}}},
+		},
+	}
+	_, err = service.Spreadsheets.BatchUpdate(config.GoogleSheets.SpreadsheetID, request).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("unable to add the %s tab: %v", tab, err)
+	}
+
+	fmt.Println("[Google Sheets] Added the", tab, "tab")
+	return nil
+}
+
+func sheetTabExists(ctx context.Context, service *sheets.Service, tab string) (bool, error) {
+	spreadsheet, err := service.Spreadsheets.Get(config.GoogleSheets.SpreadsheetID).Fields("sheets.properties.title").Context(ctx).Do()
+	if err != nil {
+		return false, fmt.Errorf("unable to list the tabs: %v", err)
+	}
+	for _, sheet := range spreadsheet.Sheets {
+		if sheet.Properties != nil && sheet.Properties.Title == tab {
+			return true, nil
+		}
+	}
+	return false, nil
+}
 
-	writeRange := "data!A1:B4"
-	resp, err := service.Spreadsheets.Values.Get(SPREADSHEET_ID, writeRange).Context(ctx).Do()
+func getDataFromGoogleSheets(ctx context.Context, service *sheets.Service, tab string) (*sheets.ValueRange, error) {
+	writeRange := tab + "!A1:B4"
+	resp, err := service.Spreadsheets.Values.Get(config.GoogleSheets.SpreadsheetID, writeRange).Context(ctx).Do()
 	if err != nil {
 		fmt.Println("[Read Trading Information Data] Unable to retrieve data from sheet: ", err)
 		return resp, err
@@ -23,11 +84,9 @@ func getDataFromGoogleSheets(service *sheets.Service) (*sheets.ValueRange, error
 	return resp, err
 }
 
-func getTradingDetailsFromGoogleSheets(service *sheets.Service) (*sheets.ValueRange, error) {
-	ctx := context.Background()
-
+func getTradingDetailsFromGoogleSheets(ctx context.Context, service *sheets.Service) (*sheets.ValueRange, error) {
 	writeRange := "trading_details!A2:ZZ"
-	resp, err := service.Spreadsheets.Values.Get(SPREADSHEET_ID, writeRange).Context(ctx).Do()
+	resp, err := service.Spreadsheets.Values.Get(config.GoogleSheets.SpreadsheetID, writeRange).Context(ctx).Do()
 	if err != nil {
 		fmt.Println("[Read Trading Details] Unable to retrieve data from sheet: ", err)
 		return resp, err
@@ -36,11 +95,9 @@ func getTradingDetailsFromGoogleSheets(service *sheets.Service) (*sheets.ValueRa
 	return resp, err
 }
 
-func getAllTradingFromGoogleSheets(service *sheets.Service) (*sheets.ValueRange, error) {
-	ctx := context.Background()
-
+func getAllTradingFromGoogleSheets(ctx context.Context, service *sheets.Service) (*sheets.ValueRange, error) {
 	writeRange := "all_trading!A2:ZZ"
-	resp, err := service.Spreadsheets.Values.Get(SPREADSHEET_ID, writeRange).Context(ctx).Do()
+	resp, err := service.Spreadsheets.Values.Get(config.GoogleSheets.SpreadsheetID, writeRange).Context(ctx).Do()
 	if err != nil {
 		fmt.Println("[Read Trading Details] Unable to retrieve data from sheet: ", err)
 		return resp, err
@@ -49,13 +106,12 @@ func getAllTradingFromGoogleSheets(service *sheets.Service) (*sheets.ValueRange,
 	return resp, err
 }
 
-func writeAllTradingToGoogleSheets(service *sheets.Service, tradingDetails []TradingDetails) {
-	ctx := context.Background()
-
+func writeAllTradingToGoogleSheets(ctx context.Context, service *sheets.Service, tradingDetails []TradingDetails) error {
 	writeRange := "all_trading!A1"
-	resp, err := service.Spreadsheets.Values.Get(SPREADSHEET_ID, writeRange).Context(ctx).Do()
+	resp, err := service.Spreadsheets.Values.Get(config.GoogleSheets.SpreadsheetID, writeRange).Context(ctx).Do()
 	if err != nil {
 		fmt.Println("[Write All Trading] Unable to retrieve data from sheet: ", err)
+		return err
 	}
 
 	values := [][]interface{}{}
@@ -68,6 +124,16 @@ func writeAllTradingToGoogleSheets(service *sheets.Service, tradingDetails []Tra
 			detail.SellPrice,
 			detail.OrderID,
 			"NEW",
+			paperFlag(detail.Paper),
+			strategyFlag(detail.Strategy),
+			orderListFlag(detail),
+			detail.StopOrderID,
+			detail.StopPrice,
+			detail.Exit,
+			detail.HighPrice,
+			detail.TrailStop,
+			detail.PositionID,
+			detail.ClosedAt,
 		})
 	}
 
@@ -77,30 +143,33 @@ func writeAllTradingToGoogleSheets(service *sheets.Service, tradingDetails []Tra
 
 	appendRange := fmt.Sprintf("all_trading!A%d", len(resp.Values)+1)
 
-	_, err = service.Spreadsheets.Values.Append(SPREADSHEET_ID, appendRange, valueRange).
+	_, err = service.Spreadsheets.Values.Append(config.GoogleSheets.SpreadsheetID, appendRange, valueRange).
 		ValueInputOption("RAW").
 		InsertDataOption("INSERT_ROWS").
 		Context(ctx).
 		Do()
 	if err != nil {
-		fmt.Println("[Write All Trading] Unable to append data: %v")
+		fmt.Println("[Write All Trading] Unable to append data: ", err)
+		return err
 	}
 
 	fmt.Println("[Write All Trading] Data appended successfully...")
+	return nil
 }
 
-func writeDummyTradeDataToGoogleSheets(service *sheets.Service, parameters map[string]Parameters) {
+func writeDummyTradeDataToGoogleSheets(service *sheets.Service, signals map[string]Signal) {
 	ctx := context.Background()
 
 	writeRange := "dummy_trade!A1"
-	resp, err := service.Spreadsheets.Values.Get(SPREADSHEET_ID, writeRange).Context(ctx).Do()
+	resp, err := service.Spreadsheets.Values.Get(config.GoogleSheets.SpreadsheetID, writeRange).Context(ctx).Do()
 	if err != nil {
 		fmt.Println("[Write Dummy Trade] Unable to retrieve data from sheet: ", err)
 	}
 
 	values := [][]interface{}{}
 
-	for _, param := range parameters {
+	for _, signal := range signals {
+		param := signal.Parameters
 		values = append(values, []interface{}{
 			param.Symbol,
 			param.DateTime,
@@ -110,8 +179,9 @@ func writeDummyTradeDataToGoogleSheets(service *sheets.Service, parameters map[s
 			param.Volume,
 			param.VolumeDiff,
 			param.CurrentPrice,
-			param.Param1,
-			param.Param2,
+			signal.Reason,
+			signal.Strength,
+			formatPatterns(param.Patterns),
 		})
 	}
 
@@ -121,19 +191,19 @@ func writeDummyTradeDataToGoogleSheets(service *sheets.Service, parameters map[s
 
 	appendRange := fmt.Sprintf("dummy_trade!A%d", len(resp.Values)+1)
 
-	_, err = service.Spreadsheets.Values.Append(SPREADSHEET_ID, appendRange, valueRange).
+	_, err = service.Spreadsheets.Values.Append(config.GoogleSheets.SpreadsheetID, appendRange, valueRange).
 		ValueInputOption("RAW").
 		InsertDataOption("INSERT_ROWS").
 		Context(ctx).
 		Do()
 	if err != nil {
-		fmt.Println("[Write Dummy Trade] Unable to append data: %v")
+		fmt.Println("[Write Dummy Trade] Unable to append data: ", err)
 	}
 
 	fmt.Println("[Write Dummy Trade] Data appended successfully...")
 }
 
-func overwriteTradingDetailsToGoogleSheets(service *sheets.Service, tradingDetails []TradingDetails) {
+func overwriteTradingDetailsToGoogleSheets(ctx context.Context, service *sheets.Service, tradingDetails []TradingDetails) error {
 	writeRange := "trading_details!A2:ZZ"
 	values := [][]interface{}{}
 	for _, param := range tradingDetails {
@@ -142,6 +212,8 @@ func overwriteTradingDetailsToGoogleSheets(service *sheets.Service, tradingDetai
 			param.Pair,
 			param.BuyPrice,
 			param.SellPrice,
+			paperFlag(param.Paper),
+			strategyFlag(param.Strategy),
 		})
 	}
 
@@ -150,17 +222,20 @@ func overwriteTradingDetailsToGoogleSheets(service *sheets.Service, tradingDetai
 	}
 
 	clearReq := sheets.ClearValuesRequest{}
-	_, err := service.Spreadsheets.Values.Clear(SPREADSHEET_ID, writeRange, &clearReq).Do()
+	_, err := service.Spreadsheets.Values.Clear(config.GoogleSheets.SpreadsheetID, writeRange, &clearReq).Context(ctx).Do()
 	if err != nil {
 		fmt.Printf("[Overwrite Trading Details] Unable to clear values in range %s: %v", writeRange, err)
+		return err
 	}
 
-	_, err = service.Spreadsheets.Values.Update(SPREADSHEET_ID, writeRange, valueRange).ValueInputOption("RAW").Do()
+	_, err = service.Spreadsheets.Values.Update(config.GoogleSheets.SpreadsheetID, writeRange, valueRange).ValueInputOption("RAW").Context(ctx).Do()
 	if err != nil {
 		fmt.Printf("[Overwrite Trading Details] Unable to update data in sheet: %v", err)
+		return err
 	}
 
 	fmt.Printf("[Overwrite Trading Details] Updated cell %s with value %v\n", writeRange, valueRange.Values)
+	return nil
 }
 
 func overwriteAllTradingGoogleSheets(service *sheets.Service, tradingDetails []TradingDetails) {
@@ -183,12 +258,12 @@ func overwriteAllTradingGoogleSheets(service *sheets.Service, tradingDetails []T
 	}
 
 	clearReq := sheets.ClearValuesRequest{}
-	_, err := service.Spreadsheets.Values.Clear(SPREADSHEET_ID, writeRange, &clearReq).Do()
+	_, err := service.Spreadsheets.Values.Clear(config.GoogleSheets.SpreadsheetID, writeRange, &clearReq).Do()
 	if err != nil {
 		fmt.Printf("[Overwrite All Trading] Unable to clear values in range %s: %v", writeRange, err)
 	}
 
-	_, err = service.Spreadsheets.Values.Update(SPREADSHEET_ID, writeRange, valueRange).ValueInputOption("RAW").Do()
+	_, err = service.Spreadsheets.Values.Update(config.GoogleSheets.SpreadsheetID, writeRange, valueRange).ValueInputOption("RAW").Do()
 	if err != nil {
 		fmt.Printf("[Overwrite All Trading] Unable to update data in sheet: %v", err)
 	}
@@ -196,40 +271,87 @@ func overwriteAllTradingGoogleSheets(service *sheets.Service, tradingDetails []T
 	fmt.Printf("[Overwrite All Trading] Updated cell %s with value %v\n", writeRange, valueRange.Values)
 }
 
-func writeTradingInformationDataToGoogleSheets(service *sheets.Service, parameters map[string]Parameters, tradingIndormationData TradingIndormationData) {
-	writeRange := "data!B2:B4"
-	var values string
-	var total int
-	for key, _ := range parameters {
-		total++
-		if values == "" {
-			values += key
-			continue
-		}
-		values += "," + key
+// writeTradingInformationDataToGoogleSheets writes the state with its keys
+// in column A, which getTradingInformation looks up, adding the tab first
+// when it is a new strategy's.
+func writeTradingInformationDataToGoogleSheets(ctx context.Context, service *sheets.Service, tab string, state TradingIndormationData) error {
+	if err := ensureSheetTab(ctx, service, tab); err != nil {
+		fmt.Printf("[Write Trading Information Data] %v\n", err)
+		return err
 	}
 
+	writeRange := tab + "!A2:B4"
+	values := strings.Join(state.LastAlertCoin, ",")
 	if values == "" {
 		values = "a"
 	}
 
 	valueRange := &sheets.ValueRange{
 		Values: [][]interface{}{
-			{values},
-			{total},
-			{tradingIndormationData.CurrentTotalAlertCoin},
+			{"lastAlertCoin", values},
+			{"currentTotalAlertCoin", len(state.LastAlertCoin)},
+			{"previousTotalAlertCoin", state.PreviousTotalAlertCoin},
 		},
 	}
 
-	_, err := service.Spreadsheets.Values.Update(SPREADSHEET_ID, writeRange, valueRange).ValueInputOption("RAW").Do()
+	_, err := service.Spreadsheets.Values.Update(config.GoogleSheets.SpreadsheetID, writeRange, valueRange).ValueInputOption("RAW").Context(ctx).Do()
 	if err != nil {
 		fmt.Printf("[Write Trading Information Data] Unable to update data in sheet: %v", err)
+		return err
 	}
 
 	fmt.Printf("[Write Trading Information Data] Updated cell %s with value %v\n", writeRange, valueRange.Values)
+	return nil
 }
 
-func editAllTradingDataToGoogleSheets(service *sheets.Service, column string, index int, value string) {
+// writeRiskHaltToGoogleSheets writes the halt as the rule, reason, since and
+// until rows of the tab, keys in column A and values in column B.
+func writeRiskHaltToGoogleSheets(ctx context.Context, service *sheets.Service, tab string, halt RiskHalt) error {
+	writeRange := tab + "!A1:B4"
+
+	valueRange := &sheets.ValueRange{
+		Values: [][]interface{}{
+			{"rule", halt.Rule},
+			{"reason", halt.Reason},
+			{"since", halt.Since},
+			{"until", halt.Until},
+		},
+	}
+
+	_, err := service.Spreadsheets.Values.Update(config.GoogleSheets.SpreadsheetID, writeRange, valueRange).ValueInputOption("RAW").Context(ctx).Do()
+	if err != nil {
+		fmt.Printf("[Write Risk Halt] Unable to update data in sheet: %v", err)
+		return err
+	}
+
+	fmt.Printf("[Write Risk Halt] Updated cell %s with value %v\n", writeRange, valueRange.Values)
+	return nil
+}
+
+// writeTradingSwitchToGoogleSheets writes the switch as the enabled, reason
+// and since rows of the tab, keys in column A and values in column B.
+func writeTradingSwitchToGoogleSheets(ctx context.Context, service *sheets.Service, tab string, trading TradingSwitch) error {
+	writeRange := tab + "!A1:B3"
+
+	valueRange := &sheets.ValueRange{
+		Values: [][]interface{}{
+			{"enabled", strconv.FormatBool(trading.Enabled)},
+			{"reason", trading.Reason},
+			{"since", trading.Since},
+		},
+	}
+
+	_, err := service.Spreadsheets.Values.Update(config.GoogleSheets.SpreadsheetID, writeRange, valueRange).ValueInputOption("RAW").Context(ctx).Do()
+	if err != nil {
+		fmt.Printf("[Write Trading Switch] Unable to update data in sheet: %v", err)
+		return err
+	}
+
+	fmt.Printf("[Write Trading Switch] Updated cell %s with value %v\n", writeRange, valueRange.Values)
+	return nil
+}
+
+func editAllTradingDataToGoogleSheets(ctx context.Context, service *sheets.Service, column string, index int, value string) error {
 	writeRange := fmt.Sprintf("all_trading!%v%d", column, index)
 
 	valueRange := &sheets.ValueRange{
@@ -238,51 +360,94 @@ func editAllTradingDataToGoogleSheets(service *sheets.Service, column string, in
 		},
 	}
 
-	_, err := service.Spreadsheets.Values.Update(SPREADSHEET_ID, writeRange, valueRange).ValueInputOption("RAW").Do()
+	_, err := service.Spreadsheets.Values.Update(config.GoogleSheets.SpreadsheetID, writeRange, valueRange).ValueInputOption("RAW").Context(ctx).Do()
 	if err != nil {
 		fmt.Printf("[Edit All Trading Data] Unable to update data in sheet: %v", err)
+		return err
 	}
 
 	fmt.Printf("[Edit All Trading Data] Updated cell %s with value %v\n", writeRange, valueRange.Values)
+	return nil
 }
 
 func getTradingInformation(data *sheets.ValueRange) TradingIndormationData {
 	tradingIndormationData := TradingIndormationData{}
 	for _, v := range data.Values {
-		if v[0].(string) == "lastAlertCoin" {
-			tradingIndormationData.LastAlertCoin = strings.Split(v[1].(string), ",")
-		} else if v[0].(string) == "currentTotalAlertCoin" {
-			tradingIndormationData.CurrentTotalAlertCoin = v[1].(string)
-		} else if v[0].(string) == "previousTotalAlertCoin" {
-			tradingIndormationData.PreviousTotalAlertCoin = v[1].(string)
+		if len(v) < 2 {
+			continue
+		}
+		key, value := cellString(v, 0), cellString(v, 1)
+		if key == "lastAlertCoin" {
+			if value != "a" && value != "" {
+				tradingIndormationData.LastAlertCoin = strings.Split(value, ",")
+			}
+		} else if key == "currentTotalAlertCoin" {
+			tradingIndormationData.CurrentTotalAlertCoin = value
+		} else if key == "previousTotalAlertCoin" {
+			tradingIndormationData.PreviousTotalAlertCoin = value
 		}
 	}
 	return tradingIndormationData
 }
 
-func getTradingDetails(data *sheets.ValueRange) (map[string]int, []TradingDetails) {
+func getRiskHalt(data *sheets.ValueRange) RiskHalt {
+	halt := RiskHalt{}
+	for _, v := range data.Values {
+		switch cellString(v, 0) {
+		case "rule":
+			halt.Rule = cellString(v, 1)
+		case "reason":
+			halt.Reason = cellString(v, 1)
+		case "since":
+			halt.Since = cellString(v, 1)
+		case "until":
+			halt.Until = cellString(v, 1)
+		}
+	}
+	return halt
+}
+
+// getTradingSwitch reads the control tab. Anything but a false enabled
+// cell, an empty tab included, leaves trading enabled.
+func getTradingSwitch(data *sheets.ValueRange) TradingSwitch {
+	trading := TradingSwitch{Enabled: true}
+	for _, v := range data.Values {
+		switch cellString(v, 0) {
+		case "enabled":
+			if enabled, err := strconv.ParseBool(strings.TrimSpace(cellString(v, 1))); err == nil {
+				trading.Enabled = enabled
+			}
+		case "reason":
+			trading.Reason = cellString(v, 1)
+		case "since":
+			trading.Since = cellString(v, 1)
+		}
+	}
+	return trading
+}
+
+// getTradingDetails returns the trading_details rows still inside the
+// cooldown window and how many of them each pair has.
+func getTradingDetails(data *sheets.ValueRange, strategy string) (map[string]int, []TradingDetails) {
 	blacklistAssets := make(map[string]int)
 	result := []TradingDetails{}
 	for _, d := range data.Values {
 		if len(d) >= 4 {
-
-			tradingTime, err := time.Parse("2006-01-02 15:04:05", d[0].(string))
-			if err != nil {
-				continue
-			}
-
-			duration := time.Now().Sub(tradingTime).Minutes()
-
-			if duration < 480 {
-				blacklistAssets[d[1].(string)] += 1
-
-				buyPrice := d[2].(string)
-				buyPriceFloat, _ := strconv.ParseFloat(buyPrice, 64)
+			if isInCooldown(cellString(d, 0)) {
+				paper := isPaperFlag(cellString(d, 4))
+				tradeStrategy := parseStrategyFlag(cellString(d, 5))
+				if paper == config.Paper.Enabled && tradeStrategy == strategy {
+					blacklistAssets[cellString(d, 1)] += 1
+				}
+
+				buyPriceFloat, _ := strconv.ParseFloat(cellString(d, 2), 64)
 				result = append(result, TradingDetails{
-					Timestamp: d[0].(string),
-					Pair:      d[1].(string),
+					Timestamp: cellString(d, 0),
+					Pair:      cellString(d, 1),
 					BuyPrice:  buyPriceFloat,
-					SellPrice: d[3].(string),
+					SellPrice: cellString(d, 3),
+					Paper:     paper,
+					Strategy:  tradeStrategy,
 				})
 			}
 		}
@@ -290,3 +455,286 @@ func getTradingDetails(data *sheets.ValueRange) (map[string]int, []TradingDetail
 
 	return blacklistAssets, result
 }
+
+// getAllTrading parses the all_trading rows that have every column filled.
+// ID is the sheet row number so updates land on the same row.
+func getAllTrading(data *sheets.ValueRange) []TradingDetails {
+	result := []TradingDetails{}
+	for i, d := range data.Values {
+		if len(d) < 7 {
+			continue
+		}
+
+		buyPriceFloat, _ := strconv.ParseFloat(cellString(d, 3), 64)
+		result = append(result, TradingDetails{
+			ID:        int64(i + 2),
+			Timestamp: cellString(d, 0),
+			Pair:      cellString(d, 1),
+			Quantity:  cellString(d, 2),
+			BuyPrice:  buyPriceFloat,
+			SellPrice: cellString(d, 4),
+			OrderID:   cellString(d, 5),
+			Status:    cellString(d, 6),
+			Paper:     isPaperFlag(cellString(d, 7)),
+			Strategy:  parseStrategyFlag(cellString(d, 8)),
+
+			OrderListID: parseOrderListFlag(cellString(d, 9)),
+			StopOrderID: cellString(d, 10),
+			StopPrice:   cellString(d, 11),
+			Exit:        cellString(d, 12),
+			HighPrice:   cellString(d, 13),
+			TrailStop:   cellString(d, 14),
+			PositionID:  cellString(d, 15),
+			ClosedAt:    cellString(d, 16),
+		})
+	}
+	return result
+}
+
+// paperFlag is what the sheets store writes in the paper column; live rows
+// leave it empty so existing sheets need no new column.
+func paperFlag(paper bool) string {
+	if paper {
+		return "PAPER"
+	}
+	return ""
+}
+
+func isPaperFlag(value string) bool {
+	return strings.EqualFold(strings.TrimSpace(value), "PAPER")
+}
+
+// strategyFlag is what the sheets store writes in the strategy column; trades
+// of the default strategy leave it empty like the rows written before it.
+func strategyFlag(strategy string) string {
+	if strategy == DEFAULT_STRATEGY_NAME {
+		return ""
+	}
+	return strategy
+}
+
+func parseStrategyFlag(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return DEFAULT_STRATEGY_NAME
+	}
+	return value
+}
+
+// orderListFlag is what the sheets store writes in the OCO list column;
+// trades without an OCO exit leave it empty.
+func orderListFlag(trade TradingDetails) string {
+	if trade.StopOrderID == "" {
+		return ""
+	}
+	return strconv.FormatInt(trade.OrderListID, 10)
+}
+
+func parseOrderListFlag(value string) int64 {
+	orderListID, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return orderListID
+}
+
+// cellString reads a cell as text. The API returns formatted values, so
+// anything else only shows up when a row is shorter than expected.
+func cellString(row []interface{}, index int) string {
+	if index >= len(row) {
+		return ""
+	}
+	return fmt.Sprint(row[index])
+}
+
+// sheetsStore is the Store backed by the data, trading_details and
+// all_trading tabs of the spreadsheet. Strategies other than the default one
+// keep their alert state in their own data_<name> tab.
+type sheetsStore struct {
+	service *sheets.Service
+	// ctx bounds the reads, see Store.WithContext.
+	ctx context.Context
+}
+
+func newSheetsStore(service *sheets.Service) *sheetsStore {
+	return &sheetsStore{service: service, ctx: context.Background()}
+}
+
+func (s *sheetsStore) WithContext(ctx context.Context) Store {
+	return &sheetsStore{service: s.service, ctx: ctx}
+}
+
+func (s *sheetsStore) LoadAlertState(strategy string) (TradingIndormationData, error) {
+	data, err := getDataFromGoogleSheets(s.ctx, s.service, alertStateTab(strategy))
+	if err != nil {
+		return TradingIndormationData{}, err
+	}
+	return getTradingInformation(data), nil
+}
+
+func (s *sheetsStore) SaveAlertState(strategy string, state TradingIndormationData) error {
+	ctx, cancel := storeWriteContext()
+	defer cancel()
+
+	return writeTradingInformationDataToGoogleSheets(ctx, s.service, alertStateTab(strategy), state)
+}
+
+func (s *sheetsStore) ListOpenTrades() ([]TradingDetails, error) {
+	data, err := getAllTradingFromGoogleSheets(s.ctx, s.service)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []TradingDetails{}
+	for _, trade := range getAllTrading(data) {
+		if trade.Paper != config.Paper.Enabled {
+			continue
+		}
+		if trade.Status == "NEW" || trade.Status == "PARTIALLY_FILLED" {
+			result = append(result, trade)
+		}
+	}
+	return result, nil
+}
+
+func (s *sheetsStore) ListTrades() ([]TradingDetails, error) {
+	data, err := getAllTradingFromGoogleSheets(s.ctx, s.service)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []TradingDetails{}
+	for _, trade := range getAllTrading(data) {
+		if trade.Paper == config.Paper.Enabled {
+			result = append(result, trade)
+		}
+	}
+	return result, nil
+}
+
+func (s *sheetsStore) ListPositionTrades(positionID string) ([]TradingDetails, error) {
+	data, err := getAllTradingFromGoogleSheets(s.ctx, s.service)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []TradingDetails{}
+	for _, trade := range getAllTrading(data) {
+		if trade.PositionID == positionID {
+			result = append(result, trade)
+		}
+	}
+	return result, nil
+}
+
+func (s *sheetsStore) AppendTrades(trades []TradingDetails) error {
+	if len(trades) == 0 {
+		return nil
+	}
+	ctx, cancel := storeWriteContext()
+	defer cancel()
+
+	return writeAllTradingToGoogleSheets(ctx, s.service, trades)
+}
+
+// UpdateTradeStatus also stamps the closed at column the first time the
+// status closes the trade.
+func (s *sheetsStore) UpdateTradeStatus(trade TradingDetails, status string) error {
+	ctx, cancel := storeWriteContext()
+	defer cancel()
+
+	if err := editAllTradingDataToGoogleSheets(ctx, s.service, "G", int(trade.ID), status); err != nil {
+		return err
+	}
+	if isClosedStatus(status) && trade.ClosedAt == "" {
+		return editAllTradingDataToGoogleSheets(ctx, s.service, "Q", int(trade.ID), time.Now().Format("2006-01-02 15:04:05"))
+	}
+	return nil
+}
+
+func (s *sheetsStore) UpdateTradeSellPrice(trade TradingDetails, sellPrice string) error {
+	ctx, cancel := storeWriteContext()
+	defer cancel()
+
+	return editAllTradingDataToGoogleSheets(ctx, s.service, "E", int(trade.ID), sellPrice)
+}
+
+func (s *sheetsStore) UpdateTradeExit(trade TradingDetails, exit string) error {
+	ctx, cancel := storeWriteContext()
+	defer cancel()
+
+	return editAllTradingDataToGoogleSheets(ctx, s.service, "M", int(trade.ID), exit)
+}
+
+func (s *sheetsStore) UpdateTradeTrail(trade TradingDetails, highPrice string, trailStop string) error {
+	ctx, cancel := storeWriteContext()
+	defer cancel()
+
+	if err := editAllTradingDataToGoogleSheets(ctx, s.service, "N", int(trade.ID), highPrice); err != nil {
+		return err
+	}
+	return editAllTradingDataToGoogleSheets(ctx, s.service, "O", int(trade.ID), trailStop)
+}
+
+func (s *sheetsStore) LoadRiskHalt() (RiskHalt, error) {
+	data, err := getDataFromGoogleSheets(s.ctx, s.service, riskTab())
+	if err != nil {
+		return RiskHalt{}, err
+	}
+	return getRiskHalt(data), nil
+}
+
+func (s *sheetsStore) SaveRiskHalt(halt RiskHalt) error {
+	ctx, cancel := storeWriteContext()
+	defer cancel()
+
+	if err := ensureSheetTab(ctx, s.service, riskTab()); err != nil {
+		return err
+	}
+	return writeRiskHaltToGoogleSheets(ctx, s.service, riskTab(), halt)
+}
+
+// LoadTradingSwitch reads the control tab. A spreadsheet without it never
+// saved the switch, which is on; any other failed read is an error.
+func (s *sheetsStore) LoadTradingSwitch() (TradingSwitch, error) {
+	data, err := getDataFromGoogleSheets(s.ctx, s.service, controlTab())
+	if err != nil {
+		if exists, tabErr := sheetTabExists(s.ctx, s.service, controlTab()); tabErr == nil && !exists {
+			return TradingSwitch{Enabled: true}, nil
+		}
+		return TradingSwitch{}, err
+	}
+	return getTradingSwitch(data), nil
+}
+
+func (s *sheetsStore) SaveTradingSwitch(trading TradingSwitch) error {
+	ctx, cancel := storeWriteContext()
+	defer cancel()
+
+	if err := ensureSheetTab(ctx, s.service, controlTab()); err != nil {
+		return err
+	}
+	trading.Since = time.Now().Format("2006-01-02 15:04:05")
+	return writeTradingSwitchToGoogleSheets(ctx, s.service, controlTab(), trading)
+}
+
+func (s *sheetsStore) LoadCooldowns(strategy string) (map[string]int, error) {
+	data, err := getTradingDetailsFromGoogleSheets(s.ctx, s.service)
+	if err != nil {
+		return map[string]int{}, err
+	}
+	blacklistAssets, _ := getTradingDetails(data, strategy)
+	return blacklistAssets, nil
+}
+
+func (s *sheetsStore) RecordCooldown(trades []TradingDetails) error {
+	ctx, cancel := storeWriteContext()
+	defer cancel()
+
+	data, err := getTradingDetailsFromGoogleSheets(ctx, s.service)
+	if err != nil {
+		return err
+	}
+	_, tradingDetails := getTradingDetails(data, DEFAULT_STRATEGY_NAME)
+	return overwriteTradingDetailsToGoogleSheets(ctx, s.service, append(tradingDetails, trades...))
+}
@@ -0,0 +1,104 @@
+// Package indicators computes technical indicators over candles.
+//
+// Every indicator has a streaming form, a type whose Update takes the next
+// value or bar in O(1) and returns the indicator's current value, and a batch
+// form, a *Series function that runs the streaming form over a whole slice.
+// Until an indicator has seen enough input Ready is false, and the batch
+// forms put NaN in those positions. Constructors panic on periods below 1,
+// like make does on a negative length.
+package indicators
+
+import (
+	"fmt"
+	"math"
+)
+
+// Bar is one candle.
+type Bar struct {
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume float64
+}
+
+func checkPeriod(name string, period int) {
+	if period < 1 {
+		panic(fmt.Sprintf("indicators: %s period must be >= 1, got %d", name, period))
+	}
+}
+
+// window keeps the last size values and their sum.
+type window struct {
+	values []float64
+	next   int
+	full   bool
+	sum    float64
+}
+
+func newWindow(size int) *window {
+	return &window{values: make([]float64, size)}
+}
+
+// push adds value and returns the one it pushed out, 0 until the window is
+// full.
+func (w *window) push(value float64) (dropped float64) {
+	dropped = w.values[w.next]
+	w.values[w.next] = value
+	w.sum += value - dropped
+	w.next++
+	if w.next == len(w.values) {
+		w.next = 0
+		w.full = true
+	}
+	return dropped
+}
+
+func (w *window) count() int {
+	if w.full {
+		return len(w.values)
+	}
+	return w.next
+}
+
+// extreme tracks the highest or lowest of the last size values with a
+// monotonic queue, amortised O(1) per update.
+type extreme struct {
+	size    int
+	highest bool
+	index   int
+	queue   []extremeEntry
+}
+
+type extremeEntry struct {
+	index int
+	value float64
+}
+
+func newExtreme(size int, highest bool) *extreme {
+	return &extreme{size: size, highest: highest}
+}
+
+func (e *extreme) push(value float64) float64 {
+	for len(e.queue) > 0 {
+		last := e.queue[len(e.queue)-1].value
+		if (e.highest && last > value) || (!e.highest && last < value) {
+			break
+		}
+		e.queue = e.queue[:len(e.queue)-1]
+	}
+	e.queue = append(e.queue, extremeEntry{index: e.index, value: value})
+	if e.queue[0].index <= e.index-e.size {
+		e.queue = e.queue[1:]
+	}
+	e.index++
+	return e.queue[0].value
+}
+
+func nanSeries(length int) []float64 {
+	series := make([]float64, length)
+	for i := range series {
+		series[i] = math.NaN()
+	}
+	return series
+}
@@ -0,0 +1,233 @@
+package indicators
+
+import (
+	"math"
+	"testing"
+)
+
+// The closes are the worked examples on StockCharts' EMA and RSI pages. The
+// expected values are the textbook formulas evaluated exactly and rounded to
+// four decimals; StockCharts' own tables round every intermediate step and
+// drift from these in the second decimal.
+var (
+	emaCloses = []float64{
+		22.27, 22.19, 22.08, 22.17, 22.18, 22.13, 22.23, 22.43, 22.24, 22.29,
+		22.15, 22.39, 22.38, 22.61, 23.36, 24.05, 23.75, 23.83, 23.95, 23.63,
+		23.82, 23.87, 23.65, 23.19, 23.10, 23.33, 22.68, 23.10, 22.40, 22.17,
+	}
+	rsiCloses = []float64{
+		44.34, 44.09, 44.15, 43.61, 44.33, 44.83, 45.10, 45.42, 45.84, 46.08,
+		45.89, 46.03, 45.61, 46.28, 46.28, 46.00, 46.03, 46.41, 46.22, 45.64,
+		46.21, 46.25, 45.71, 46.45, 45.78, 45.35, 44.03, 44.18, 44.22, 44.57,
+		43.42, 42.66, 43.13,
+	}
+)
+
+// referenceBars are rsiCloses with each open at the previous close and the
+// wicks stretched by a fixed pattern, so that the true range and the
+// directional movement differ from bar to bar.
+var referenceBars = []Bar{
+	{Open: 44.29, High: 44.39, Low: 44.24, Close: 44.34},
+	{Open: 44.34, High: 44.49, Low: 43.89, Close: 44.09},
+	{Open: 44.09, High: 44.40, Low: 43.94, Close: 44.15},
+	{Open: 44.15, High: 44.25, Low: 43.51, Close: 43.61},
+	{Open: 43.61, High: 44.53, Low: 43.56, Close: 44.33},
+	{Open: 44.33, High: 44.88, Low: 44.13, Close: 44.83},
+	{Open: 44.83, High: 45.25, Low: 44.68, Close: 45.10},
+	{Open: 45.10, High: 45.67, Low: 45.00, Close: 45.42},
+	{Open: 45.42, High: 45.94, Low: 45.37, Close: 45.84},
+	{Open: 45.84, High: 46.28, Low: 45.64, Close: 46.08},
+	{Open: 46.08, High: 46.13, Low: 45.74, Close: 45.89},
+	{Open: 45.89, High: 46.18, Low: 45.79, Close: 46.03},
+	{Open: 46.03, High: 46.28, Low: 45.56, Close: 45.61},
+	{Open: 45.61, High: 46.38, Low: 45.41, Close: 46.28},
+	{Open: 46.28, High: 46.48, Low: 46.13, Close: 46.28},
+	{Open: 46.28, High: 46.33, Low: 45.90, Close: 46.00},
+	{Open: 46.00, High: 46.18, Low: 45.95, Close: 46.03},
+	{Open: 46.03, High: 46.66, Low: 45.83, Close: 46.41},
+	{Open: 46.41, High: 46.51, Low: 46.07, Close: 46.22},
+	{Open: 46.22, High: 46.42, Low: 45.54, Close: 45.64},
+	{Open: 45.64, High: 46.26, Low: 45.59, Close: 46.21},
+	{Open: 46.21, High: 46.40, Low: 46.01, Close: 46.25},
+	{Open: 46.25, High: 46.50, Low: 45.56, Close: 45.71},
+	{Open: 45.71, High: 46.55, Low: 45.61, Close: 46.45},
+	{Open: 46.45, High: 46.65, Low: 45.73, Close: 45.78},
+	{Open: 45.78, High: 45.83, Low: 45.15, Close: 45.35},
+	{Open: 45.35, High: 45.50, Low: 43.88, Close: 44.03},
+	{Open: 44.03, High: 44.43, Low: 43.93, Close: 44.18},
+	{Open: 44.18, High: 44.32, Low: 44.13, Close: 44.22},
+	{Open: 44.22, High: 44.77, Low: 44.02, Close: 44.57},
+	{Open: 44.57, High: 44.62, Low: 43.27, Close: 43.42},
+	{Open: 43.42, High: 43.57, Low: 42.56, Close: 42.66},
+	{Open: 42.66, High: 43.38, Low: 42.61, Close: 43.13},
+}
+
+const tolerance = 1e-4
+
+// checkSeries fails unless got is NaN before first and matches want from
+// first on.
+func checkSeries(t *testing.T, got []float64, first int, want []float64) {
+	t.Helper()
+	if len(got) != first+len(want) {
+		t.Fatalf("got %d values, want %d", len(got), first+len(want))
+	}
+	for i, value := range got {
+		if i < first {
+			if !math.IsNaN(value) {
+				t.Errorf("[%d] = %.4f, want NaN", i, value)
+			}
+			continue
+		}
+		if math.Abs(value-want[i-first]) > tolerance {
+			t.Errorf("[%d] = %.4f, want %.4f", i, value, want[i-first])
+		}
+	}
+}
+
+func macdField(series []MACDValue, field func(MACDValue) float64) []float64 {
+	values := make([]float64, len(series))
+	for i, value := range series {
+		values[i] = field(value)
+	}
+	return values
+}
+
+func dmiField(series []DMIValue, field func(DMIValue) float64) []float64 {
+	values := make([]float64, len(series))
+	for i, value := range series {
+		values[i] = field(value)
+	}
+	return values
+}
+
+func TestSeriesAgainstReference(t *testing.T) {
+	macd := MACDSeries(rsiCloses, 5, 10, 4)
+	adx := ADXSeries(referenceBars, 14)
+
+	tests := []struct {
+		name  string
+		got   []float64
+		first int
+		want  []float64
+	}{
+		{
+			name:  "EMA(10)",
+			got:   EMASeries(emaCloses, 10),
+			first: 9,
+			want: []float64{
+				22.2210, 22.2081, 22.2412, 22.2664, 22.3289, 22.5164, 22.7952,
+				22.9688, 23.1254, 23.2753, 23.3398, 23.4271, 23.5076, 23.5335,
+				23.4711, 23.4036, 23.3902, 23.2611, 23.2318, 23.0806, 22.9150,
+			},
+		},
+		{
+			name:  "MACD(5,10,4) line",
+			got:   macdField(macd, func(v MACDValue) float64 { return v.MACD }),
+			first: 12,
+			want: []float64{
+				0.4577, 0.4610, 0.4348, 0.3518, 0.2897, 0.2959, 0.2525,
+				0.1257, 0.1353, 0.1383, 0.0498, 0.1106, 0.0356, -0.0727,
+				-0.3273, -0.4236, -0.4444, -0.3758, -0.4899, -0.6375, -0.6082,
+			},
+		},
+		{
+			name:  "MACD(5,10,4) signal",
+			got:   macdField(macd, func(v MACDValue) float64 { return v.Signal }),
+			first: 12,
+			want: []float64{
+				0.5993, 0.5440, 0.5003, 0.4409, 0.3804, 0.3466, 0.3090,
+				0.2357, 0.1955, 0.1726, 0.1235, 0.1184, 0.0852, 0.0221,
+				-0.1177, -0.2401, -0.3218, -0.3434, -0.4020, -0.4962, -0.5410,
+			},
+		},
+		{
+			name:  "MACD(5,10,4) histogram",
+			got:   macdField(macd, func(v MACDValue) float64 { return v.Histogram }),
+			first: 12,
+			want: []float64{
+				-0.1416, -0.0830, -0.0655, -0.0891, -0.0907, -0.0507, -0.0565,
+				-0.1100, -0.0602, -0.0343, -0.0737, -0.0077, -0.0497, -0.0947,
+				-0.2096, -0.1836, -0.1226, -0.0324, -0.0879, -0.1413, -0.0672,
+			},
+		},
+		{
+			name:  "ATR(14)",
+			got:   ATRSeries(referenceBars, 14),
+			first: 13,
+			want: []float64{
+				0.6136, 0.5947, 0.5830, 0.5578, 0.5772, 0.5674, 0.5897,
+				0.5955, 0.5808, 0.6065, 0.6303, 0.6510, 0.6530, 0.7221,
+				0.7062, 0.6694, 0.6751, 0.7233, 0.7438, 0.7457,
+			},
+		},
+		{
+			name:  "ADX(14) +DI",
+			got:   dmiField(adx, func(v DMIValue) float64 { return v.PlusDI }),
+			first: 14,
+			want: []float64{
+				24.8009, 23.5597, 22.8996, 26.3299, 24.9321, 22.3739, 20.6376,
+				21.3455, 19.0515, 17.6270, 16.9610, 15.7272, 13.2536, 12.5952,
+				12.3442, 16.0656, 13.9534, 12.6170, 11.6971,
+			},
+		},
+		{
+			name:  "ADX(14) -DI",
+			got:   dmiField(adx, func(v DMIValue) float64 { return v.MinusDI }),
+			first: 14,
+			want: []float64{
+				13.1968, 15.2132, 14.7870, 13.3349, 12.6270, 17.5111, 16.1522,
+				15.4029, 18.8924, 16.9327, 15.2638, 20.3582, 29.4862, 28.0213,
+				27.4630, 25.3184, 29.2938, 33.2211, 30.7991,
+			},
+		},
+		{
+			name:  "ADX(14)",
+			got:   dmiField(adx, func(v DMIValue) float64 { return v.ADX }),
+			first: 27,
+			want:  []float64{19.7257, 21.0296, 21.1245, 22.1493, 23.7779, 25.2902},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkSeries(t, test.got, test.first, test.want)
+		})
+	}
+}
+
+func TestStreamingMatchesSeries(t *testing.T) {
+	ema := NewEMA(10)
+	for i, value := range EMASeries(emaCloses, 10) {
+		got := ema.Update(emaCloses[i])
+		if ema.Ready() && got != value {
+			t.Errorf("EMA [%d]: Update = %v, series = %v", i, got, value)
+		}
+	}
+
+	atr := NewATR(14)
+	for i, value := range ATRSeries(referenceBars, 14) {
+		got := atr.Update(referenceBars[i])
+		if atr.Ready() && got != value {
+			t.Errorf("ATR [%d]: Update = %v, series = %v", i, got, value)
+		}
+	}
+}
+
+func TestConstructorsPanicOnBadPeriod(t *testing.T) {
+	constructors := map[string]func(){
+		"EMA":  func() { NewEMA(0) },
+		"MACD": func() { NewMACD(12, 0, 9) },
+		"ATR":  func() { NewATR(-1) },
+		"ADX":  func() { NewADX(0) },
+	}
+	for name, construct := range constructors {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("New%s did not panic", name)
+				}
+			}()
+			construct()
+		})
+	}
+}
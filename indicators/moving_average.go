@@ -0,0 +1,145 @@
+package indicators
+
+// SMA is the simple moving average of the last Period values.
+type SMA struct {
+	window *window
+	value  float64
+}
+
+func NewSMA(period int) *SMA {
+	checkPeriod("SMA", period)
+	return &SMA{window: newWindow(period)}
+}
+
+func (s *SMA) Update(value float64) float64 {
+	s.window.push(value)
+	s.value = s.window.sum / float64(s.window.count())
+	return s.Value()
+}
+
+func (s *SMA) Value() float64 {
+	if !s.Ready() {
+		return 0
+	}
+	return s.value
+}
+
+func (s *SMA) Ready() bool {
+	return s.window.full
+}
+
+// SMASeries returns the SMA at every value.
+func SMASeries(values []float64, period int) []float64 {
+	return runSeries(values, NewSMA(period))
+}
+
+// EMA is the exponential moving average with smoothing 2 / (period + 1). It
+// starts from the SMA of the first period values.
+type EMA struct {
+	period int
+	alpha  float64
+	count  int
+	sum    float64
+	value  float64
+}
+
+func NewEMA(period int) *EMA {
+	checkPeriod("EMA", period)
+	return &EMA{period: period, alpha: 2 / float64(period+1)}
+}
+
+func (e *EMA) Update(value float64) float64 {
+	e.count++
+	switch {
+	case e.count < e.period:
+		e.sum += value
+	case e.count == e.period:
+		e.value = (e.sum + value) / float64(e.period)
+	default:
+		e.value += e.alpha * (value - e.value)
+	}
+	return e.Value()
+}
+
+func (e *EMA) Value() float64 {
+	if !e.Ready() {
+		return 0
+	}
+	return e.value
+}
+
+func (e *EMA) Ready() bool {
+	return e.count >= e.period
+}
+
+// EMASeries returns the EMA at every value.
+func EMASeries(values []float64, period int) []float64 {
+	return runSeries(values, NewEMA(period))
+}
+
+// WMA is the linearly weighted moving average of the last Period values, the
+// newest weighing Period and the oldest 1.
+type WMA struct {
+	window      *window
+	numerator   float64
+	denominator float64
+}
+
+func NewWMA(period int) *WMA {
+	checkPeriod("WMA", period)
+	return &WMA{window: newWindow(period), denominator: float64(period*(period+1)) / 2}
+}
+
+func (w *WMA) Update(value float64) float64 {
+	period := len(w.window.values)
+	if w.window.full {
+		// Every value loses one weight and the new one enters with
+		// weight period.
+		previousSum := w.window.sum
+		w.window.push(value)
+		w.numerator += float64(period)*value - previousSum
+		return w.Value()
+	}
+
+	w.window.push(value)
+	if w.window.full {
+		w.numerator = 0
+		for i := 0; i < period; i++ {
+			// The window wrapped to 0, so values are oldest first.
+			w.numerator += float64(i+1) * w.window.values[i]
+		}
+	}
+	return w.Value()
+}
+
+func (w *WMA) Value() float64 {
+	if !w.Ready() {
+		return 0
+	}
+	return w.numerator / w.denominator
+}
+
+func (w *WMA) Ready() bool {
+	return w.window.full
+}
+
+// WMASeries returns the WMA at every value.
+func WMASeries(values []float64, period int) []float64 {
+	return runSeries(values, NewWMA(period))
+}
+
+type valueIndicator interface {
+	Update(value float64) float64
+	Ready() bool
+}
+
+func runSeries(values []float64, indicator valueIndicator) []float64 {
+	series := nanSeries(len(values))
+	for i, value := range values {
+		result := indicator.Update(value)
+		if indicator.Ready() {
+			series[i] = result
+		}
+	}
+	return series
+}
@@ -0,0 +1,136 @@
+package indicators
+
+import "math"
+
+// MACDValue is the MACD line, its signal line and their difference.
+type MACDValue struct {
+	MACD      float64
+	Signal    float64
+	Histogram float64
+}
+
+// MACD is the difference of a fast and a slow EMA of the closes, with an EMA
+// of that difference as the signal line. The usual periods are 12, 26, 9.
+type MACD struct {
+	fast   *EMA
+	slow   *EMA
+	signal *EMA
+	value  MACDValue
+}
+
+func NewMACD(fast, slow, signal int) *MACD {
+	return &MACD{fast: NewEMA(fast), slow: NewEMA(slow), signal: NewEMA(signal)}
+}
+
+func (m *MACD) Update(value float64) MACDValue {
+	m.fast.Update(value)
+	m.slow.Update(value)
+	if !m.fast.Ready() || !m.slow.Ready() {
+		return m.Value()
+	}
+
+	m.value.MACD = m.fast.Value() - m.slow.Value()
+	m.value.Signal = m.signal.Update(m.value.MACD)
+	m.value.Histogram = m.value.MACD - m.value.Signal
+	return m.Value()
+}
+
+func (m *MACD) Value() MACDValue {
+	if !m.Ready() {
+		return MACDValue{}
+	}
+	return m.value
+}
+
+func (m *MACD) Ready() bool {
+	return m.signal.Ready()
+}
+
+// MACDSeries returns the MACD at every close; values before it is ready are
+// NaN.
+func MACDSeries(values []float64, fast, slow, signal int) []MACDValue {
+	indicator := NewMACD(fast, slow, signal)
+	series := make([]MACDValue, len(values))
+	for i, value := range values {
+		series[i] = indicator.Update(value)
+		if !indicator.Ready() {
+			series[i] = MACDValue{MACD: math.NaN(), Signal: math.NaN(), Histogram: math.NaN()}
+		}
+	}
+	return series
+}
+
+// StochasticValue is the %K and %D lines, between 0 and 100.
+type StochasticValue struct {
+	K float64
+	D float64
+}
+
+// Stochastic places the close within the high-low range of the last
+// kPeriod bars. %K is that position smoothed over smoothK bars (1 for the
+// fast stochastic) and %D is the SMA of %K over dPeriod bars. A flat range
+// counts as the middle, 50.
+type Stochastic struct {
+	highest *extreme
+	lowest  *extreme
+	seen    int
+	kPeriod int
+	smoothK *SMA
+	d       *SMA
+	value   StochasticValue
+}
+
+func NewStochastic(kPeriod, smoothK, dPeriod int) *Stochastic {
+	checkPeriod("Stochastic %K", kPeriod)
+	return &Stochastic{
+		highest: newExtreme(kPeriod, true),
+		lowest:  newExtreme(kPeriod, false),
+		kPeriod: kPeriod,
+		smoothK: NewSMA(smoothK),
+		d:       NewSMA(dPeriod),
+	}
+}
+
+func (s *Stochastic) Update(bar Bar) StochasticValue {
+	highest := s.highest.push(bar.High)
+	lowest := s.lowest.push(bar.Low)
+	s.seen++
+	if s.seen < s.kPeriod {
+		return s.Value()
+	}
+
+	raw := 50.0
+	if highest > lowest {
+		raw = (bar.Close - lowest) / (highest - lowest) * 100
+	}
+	s.value.K = s.smoothK.Update(raw)
+	if s.smoothK.Ready() {
+		s.value.D = s.d.Update(s.value.K)
+	}
+	return s.Value()
+}
+
+func (s *Stochastic) Value() StochasticValue {
+	if !s.Ready() {
+		return StochasticValue{}
+	}
+	return s.value
+}
+
+func (s *Stochastic) Ready() bool {
+	return s.d.Ready()
+}
+
+// StochasticSeries returns the stochastic at every bar; values before it is
+// ready are NaN.
+func StochasticSeries(bars []Bar, kPeriod, smoothK, dPeriod int) []StochasticValue {
+	indicator := NewStochastic(kPeriod, smoothK, dPeriod)
+	series := make([]StochasticValue, len(bars))
+	for i, bar := range bars {
+		series[i] = indicator.Update(bar)
+		if !indicator.Ready() {
+			series[i] = StochasticValue{K: math.NaN(), D: math.NaN()}
+		}
+	}
+	return series
+}
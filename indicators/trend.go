@@ -0,0 +1,131 @@
+package indicators
+
+import "math"
+
+// DMIValue is Wilder's directional movement: the +DI and -DI lines and the
+// ADX, all between 0 and 100.
+type DMIValue struct {
+	PlusDI  float64
+	MinusDI float64
+	ADX     float64
+}
+
+// ADX is Wilder's directional movement system. The directional movements and
+// true ranges are summed over the first Period moves and then smoothed with
+// sum = sum - sum/period + value; the ADX is the mean of the first Period DX
+// values and then smoothed like the ATR. +DI and -DI are ready after
+// Period + 1 bars, the ADX after 2 * Period.
+type ADX struct {
+	period   int
+	tr       trueRange
+	previous Bar
+	started  bool
+	moves    int
+
+	trSum    float64
+	plusSum  float64
+	minusSum float64
+
+	dxCount int
+	adx     float64
+	value   DMIValue
+}
+
+func NewADX(period int) *ADX {
+	checkPeriod("ADX", period)
+	return &ADX{period: period}
+}
+
+func (a *ADX) Update(bar Bar) DMIValue {
+	tr := a.tr.update(bar)
+	if !a.started {
+		a.previous, a.started = bar, true
+		return a.Value()
+	}
+
+	up := bar.High - a.previous.High
+	down := a.previous.Low - bar.Low
+	a.previous = bar
+	var plusDM, minusDM float64
+	if up > down && up > 0 {
+		plusDM = up
+	}
+	if down > up && down > 0 {
+		minusDM = down
+	}
+
+	a.moves++
+	n := float64(a.period)
+	if a.moves <= a.period {
+		a.trSum += tr
+		a.plusSum += plusDM
+		a.minusSum += minusDM
+	} else {
+		a.trSum += tr - a.trSum/n
+		a.plusSum += plusDM - a.plusSum/n
+		a.minusSum += minusDM - a.minusSum/n
+	}
+	if a.moves < a.period {
+		return a.Value()
+	}
+
+	if a.trSum > 0 {
+		a.value.PlusDI = 100 * a.plusSum / a.trSum
+		a.value.MinusDI = 100 * a.minusSum / a.trSum
+	} else {
+		a.value.PlusDI, a.value.MinusDI = 0, 0
+	}
+	var dx float64
+	if total := a.value.PlusDI + a.value.MinusDI; total > 0 {
+		dx = 100 * math.Abs(a.value.PlusDI-a.value.MinusDI) / total
+	}
+
+	a.dxCount++
+	switch {
+	case a.dxCount < a.period:
+		a.adx += dx
+	case a.dxCount == a.period:
+		a.adx = (a.adx + dx) / n
+	default:
+		a.adx = (a.adx*(n-1) + dx) / n
+	}
+	if a.Ready() {
+		a.value.ADX = a.adx
+	}
+	return a.Value()
+}
+
+// Value returns the latest reading; ADX is 0 until Ready.
+func (a *ADX) Value() DMIValue {
+	if !a.DIReady() {
+		return DMIValue{}
+	}
+	return a.value
+}
+
+// DIReady reports whether +DI and -DI are available.
+func (a *ADX) DIReady() bool {
+	return a.moves >= a.period
+}
+
+// Ready reports whether the ADX is available.
+func (a *ADX) Ready() bool {
+	return a.dxCount >= a.period
+}
+
+// ADXSeries returns the directional movement at every bar; values not yet
+// available are NaN.
+func ADXSeries(bars []Bar, period int) []DMIValue {
+	indicator := NewADX(period)
+	series := make([]DMIValue, len(bars))
+	for i, bar := range bars {
+		series[i] = indicator.Update(bar)
+		if !indicator.DIReady() {
+			series[i].PlusDI, series[i].MinusDI = math.NaN(), math.NaN()
+		}
+		if !indicator.Ready() {
+			series[i].ADX = math.NaN()
+		}
+	}
+	return series
+}
@@ -0,0 +1,139 @@
+package indicators
+
+import "math"
+
+// BollingerValue is the middle band and the bands Multiplier standard
+// deviations above and below it.
+type BollingerValue struct {
+	Middle float64
+	Upper  float64
+	Lower  float64
+}
+
+// Bollinger is the SMA of the last Period closes with bands at a multiple
+// of their population standard deviation. The usual settings are 20 and 2.
+type Bollinger struct {
+	window     *window
+	sumSquares float64
+	multiplier float64
+	value      BollingerValue
+}
+
+func NewBollinger(period int, multiplier float64) *Bollinger {
+	checkPeriod("Bollinger", period)
+	return &Bollinger{window: newWindow(period), multiplier: multiplier}
+}
+
+func (b *Bollinger) Update(value float64) BollingerValue {
+	dropped := b.window.push(value)
+	b.sumSquares += value*value - dropped*dropped
+	if !b.window.full {
+		return b.Value()
+	}
+
+	n := float64(len(b.window.values))
+	mean := b.window.sum / n
+	// Rounding can push the running variance a hair below zero on flat
+	// input.
+	deviation := math.Sqrt(math.Max(b.sumSquares/n-mean*mean, 0))
+	b.value = BollingerValue{
+		Middle: mean,
+		Upper:  mean + b.multiplier*deviation,
+		Lower:  mean - b.multiplier*deviation,
+	}
+	return b.Value()
+}
+
+func (b *Bollinger) Value() BollingerValue {
+	if !b.Ready() {
+		return BollingerValue{}
+	}
+	return b.value
+}
+
+func (b *Bollinger) Ready() bool {
+	return b.window.full
+}
+
+// BollingerSeries returns the bands at every close; values before they are
+// ready are NaN.
+func BollingerSeries(values []float64, period int, multiplier float64) []BollingerValue {
+	indicator := NewBollinger(period, multiplier)
+	series := make([]BollingerValue, len(values))
+	for i, value := range values {
+		series[i] = indicator.Update(value)
+		if !indicator.Ready() {
+			series[i] = BollingerValue{Middle: math.NaN(), Upper: math.NaN(), Lower: math.NaN()}
+		}
+	}
+	return series
+}
+
+// trueRange is the bar's range extended to the previous close. The first
+// bar, without a previous close, uses its high-low range.
+type trueRange struct {
+	previousClose float64
+	started       bool
+}
+
+func (t *trueRange) update(bar Bar) float64 {
+	result := bar.High - bar.Low
+	if t.started {
+		result = math.Max(result, math.Max(math.Abs(bar.High-t.previousClose), math.Abs(bar.Low-t.previousClose)))
+	}
+	t.previousClose = bar.Close
+	t.started = true
+	return result
+}
+
+// ATR is Wilder's average true range: the mean of the first Period true
+// ranges, then atr = (atr * (period - 1) + tr) / period.
+type ATR struct {
+	period int
+	tr     trueRange
+	count  int
+	value  float64
+}
+
+func NewATR(period int) *ATR {
+	checkPeriod("ATR", period)
+	return &ATR{period: period}
+}
+
+func (a *ATR) Update(bar Bar) float64 {
+	tr := a.tr.update(bar)
+	a.count++
+	switch {
+	case a.count < a.period:
+		a.value += tr
+	case a.count == a.period:
+		a.value = (a.value + tr) / float64(a.period)
+	default:
+		a.value = (a.value*float64(a.period-1) + tr) / float64(a.period)
+	}
+	return a.Value()
+}
+
+func (a *ATR) Value() float64 {
+	if !a.Ready() {
+		return 0
+	}
+	return a.value
+}
+
+func (a *ATR) Ready() bool {
+	return a.count >= a.period
+}
+
+// ATRSeries returns the ATR at every bar.
+func ATRSeries(bars []Bar, period int) []float64 {
+	indicator := NewATR(period)
+	series := nanSeries(len(bars))
+	for i, bar := range bars {
+		result := indicator.Update(bar)
+		if indicator.Ready() {
+			series[i] = result
+		}
+	}
+	return series
+}
@@ -0,0 +1,93 @@
+package indicators
+
+// OBV is on-balance volume: the running total of volume, added on bars that
+// close higher than the previous one and subtracted on bars that close lower.
+// It starts at 0 on the first bar.
+type OBV struct {
+	previousClose float64
+	started       bool
+	value         float64
+}
+
+func NewOBV() *OBV {
+	return &OBV{}
+}
+
+func (o *OBV) Update(bar Bar) float64 {
+	if o.started {
+		switch {
+		case bar.Close > o.previousClose:
+			o.value += bar.Volume
+		case bar.Close < o.previousClose:
+			o.value -= bar.Volume
+		}
+	}
+	o.previousClose = bar.Close
+	o.started = true
+	return o.value
+}
+
+func (o *OBV) Value() float64 {
+	return o.value
+}
+
+func (o *OBV) Ready() bool {
+	return o.started
+}
+
+// OBVSeries returns the OBV at every bar.
+func OBVSeries(bars []Bar) []float64 {
+	indicator := NewOBV()
+	series := make([]float64, len(bars))
+	for i, bar := range bars {
+		series[i] = indicator.Update(bar)
+	}
+	return series
+}
+
+// VWAP is the volume-weighted average of the typical price (high + low +
+// close) / 3 since the last Reset. Call Reset at the start of each session
+// for a session VWAP.
+type VWAP struct {
+	priceVolume float64
+	volume      float64
+}
+
+func NewVWAP() *VWAP {
+	return &VWAP{}
+}
+
+func (v *VWAP) Update(bar Bar) float64 {
+	v.priceVolume += (bar.High + bar.Low + bar.Close) / 3 * bar.Volume
+	v.volume += bar.Volume
+	return v.Value()
+}
+
+func (v *VWAP) Value() float64 {
+	if !v.Ready() {
+		return 0
+	}
+	return v.priceVolume / v.volume
+}
+
+// Ready reports whether any volume has traded since the last Reset.
+func (v *VWAP) Ready() bool {
+	return v.volume > 0
+}
+
+func (v *VWAP) Reset() {
+	v.priceVolume, v.volume = 0, 0
+}
+
+// VWAPSeries returns the VWAP anchored at the first bar at every bar.
+func VWAPSeries(bars []Bar) []float64 {
+	indicator := NewVWAP()
+	series := nanSeries(len(bars))
+	for i, bar := range bars {
+		result := indicator.Update(bar)
+		if indicator.Ready() {
+			series[i] = result
+		}
+	}
+	return series
+}
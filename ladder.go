@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/shopspring/decimal"
+)
+
+// exitOrders is how many orders the exit of one buy keeps open on the
+// exchange: two per OCO list, none for a trailing stop.
+func exitOrders(trading TradingConfig) int {
+	if len(trading.TakeProfitLadder) > 0 {
+		var orders int
+		for _, leg := range trading.TakeProfitLadder {
+			if !leg.Trailing {
+				orders += 2
+			}
+		}
+		return orders
+	}
+	if trading.ExitMode == EXIT_MODE_TRAILING {
+		return 0
+	}
+	return 2
+}
+
+// placeLadderExit sells what the buy order got in the legs of the
+// strategy's take-profit ladder, returning one trade per leg. The legs are
+// split along LOT_SIZE so that each one can still be sold at the stop
+// limit; a leg too small for that is added to the next one. A buy too small
+// to split gets the single exit of placeOCOExit at take_profit_percent.
+func placeLadderExit(exchange Exchange, symbolRules SymbolRules, trading TradingConfig, buyOrder Order) []TradingDetails {
+	averageBuyPrice := buyOrder.AveragePrice()
+	netQuantity := buyOrder.NetQuantity(symbolRules.BaseAsset)
+
+	percents := make([]float64, len(trading.TakeProfitLadder))
+	for i, leg := range trading.TakeProfitLadder {
+		percents[i] = leg.Percent
+	}
+	stopLimitPrice := averageBuyPrice.Mul(decimal.NewFromFloat((1 - trading.StopLossPercent/100) * (1 - trading.StopLimitOffsetPercent/100)))
+	parts, err := symbolRules.SplitQuantity(netQuantity, percents, stopLimitPrice)
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return []TradingDetails{placeOCOExit(exchange, symbolRules, trading, averageBuyPrice, netQuantity, trading.TakeProfitPercent)}
+	}
+
+	trades := []TradingDetails{}
+	for i, leg := range trading.TakeProfitLadder {
+		if !parts[i].IsPositive() {
+			continue
+		}
+		if leg.Trailing {
+			trades = append(trades, startTrailingStop(symbolRules, trading, buyOrder, parts[i]))
+		} else {
+			trades = append(trades, placeOCOExit(exchange, symbolRules, trading, averageBuyPrice, parts[i], leg.TakeProfitPercent))
+		}
+	}
+	return trades
+}
+
+// positionEntries keeps the first trade of every position, so a ladder
+// counts once toward its pair's cooldown.
+func positionEntries(trades []TradingDetails) []TradingDetails {
+	seen := make(map[string]bool)
+	entries := []TradingDetails{}
+	for _, trade := range trades {
+		if trade.PositionID != "" {
+			if seen[trade.PositionID] {
+				continue
+			}
+			seen[trade.PositionID] = true
+		}
+		entries = append(entries, trade)
+	}
+	return entries
+}
+
+// isClosedLeg reports whether the trade's exit is done: filled, or canceled,
+// expired or rejected with nothing left for it to sell.
+func isClosedLeg(trade TradingDetails) bool {
+	return isClosedStatus(trade.Status)
+}
+
+func isClosedStatus(status string) bool {
+	switch binance.OrderStatusType(status) {
+	case binance.OrderStatusTypeFilled, binance.OrderStatusTypeCanceled, binance.OrderStatusTypeExpired, binance.OrderStatusTypeRejected:
+		return true
+	}
+	return false
+}
+
+// legPnL is the profit a closed leg realized in the quote asset: its
+// quantity sold at the sell price instead of the buy price. A leg that
+// closed without a fill realized nothing.
+func legPnL(trade TradingDetails) float64 {
+	if trade.Status != string(binance.OrderStatusTypeFilled) {
+		return 0
+	}
+	quantity, err := strconv.ParseFloat(trade.Quantity, 64)
+	if err != nil {
+		return 0
+	}
+	sellPrice, err := strconv.ParseFloat(trade.SellPrice, 64)
+	if err != nil {
+		return 0
+	}
+	return (sellPrice - trade.BuyPrice) * quantity
+}
+
+// positionPnL adds up the realized profit of a position's legs and reports
+// whether every leg is closed.
+func positionPnL(legs []TradingDetails) (pnl float64, closed bool) {
+	closed = len(legs) > 0
+	for _, leg := range legs {
+		if !isClosedLeg(leg) {
+			closed = false
+		}
+		pnl += legPnL(leg)
+	}
+	return pnl, closed
+}
+
+// reportClosedPosition prints a position's realized profit per leg and in
+// total once all of its legs are closed, and nothing before.
+func reportClosedPosition(store Store, positionID string) {
+	if positionID == "" {
+		return
+	}
+	legs, err := store.ListPositionTrades(positionID)
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return
+	}
+	pnl, closed := positionPnL(legs)
+	if !closed {
+		return
+	}
+	for _, leg := range legs {
+		fmt.Println("[LEG]", leg.Pair, leg.Quantity, leg.Status, leg.Exit, "buy", leg.BuyPrice, "sell", leg.SellPrice, "PnL", strconv.FormatFloat(legPnL(leg), 'f', 8, 64))
+	}
+	fmt.Println("[POSITION CLOSED]", legs[0].Pair, positionID, "legs", len(legs), "PnL", strconv.FormatFloat(pnl, 'f', 8, 64))
+}
@@ -6,36 +6,112 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/adshao/go-binance/v2"
+	"github.com/shopspring/decimal"
 
 	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
 )
 
+// offlineCommands only use local data or public market data and run without
+// credentials.
+var offlineCommands = map[string]bool{
+	"backtest":        true,
+	"download-klines": true,
+	"import-klines":   true,
+	"optimize":        true,
+}
+
 func main() {
 
-	port := os.Getenv("PORT")
-	// port := "8081"
+	var command string
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+
+	var err error
+	config, err = loadConfig(!offlineCommands[command])
+	if err != nil {
+		log.Fatalf("Unable to load config: %v", err)
+	}
+
+	if command != "" {
+		runCommand(command, os.Args[2:])
+		return
+	}
+
+	// Run the schema migrations before serving anything.
+	if config.Storage.Driver == STORAGE_SQLITE {
+		initStore()
+	}
+
+	if config.Scheduler.Enabled {
+		startScheduler(nil)
+	}
 
 	http.HandleFunc("/", welcome)
 	http.HandleFunc("/automate-screening", automateScreening)
 	http.HandleFunc("/check-order-status", checkOrderStatus)
 	http.HandleFunc("/check-stop-loss", checkStopLoss)
+	http.HandleFunc("/pause", pauseTrading)
+	http.HandleFunc("/resume", resumeTrading)
+	http.HandleFunc("/flatten", flattenPositions)
 	http.HandleFunc("/test", test)
-	http.ListenAndServe(":"+port, nil)
+	http.ListenAndServe(":"+config.Server.Port, nil)
+}
+
+// runCommand runs one of the maintenance commands instead of the server.
+func runCommand(name string, args []string) {
+	var err error
+	switch name {
+	case "migrate-sheets":
+		err = runMigrateSheets(args)
+	case "backtest":
+		err = runBacktestCommand(args)
+	case "optimize":
+		err = runOptimizeCommand(args)
+	case "download-klines":
+		err = runDownloadKlines(args)
+	case "import-klines":
+		err = runImportKlines(args)
+	case "pause":
+		err = runPauseCommand(args)
+	case "resume":
+		err = runResumeCommand(args)
+	case "flatten":
+		err = runFlattenCommand(args)
+	default:
+		err = fmt.Errorf("unknown command %q", name)
+	}
+
+	if err != nil {
+		log.Fatalf("[%s] %v", name, err)
+	}
 }
 
 func initBinanceClient() *binance.Client {
-	return binance.NewClient(BINANCE_API_KEY, BINANCE_SECRET_KEY)
+	client := binance.NewClient(config.Binance.APIKey, config.Binance.SecretKey)
+	if config.Binance.BaseURL != "" {
+		client.BaseURL = config.Binance.BaseURL
+	}
+	return client
+}
+
+// initExchange returns the paper account in paper mode and Binance otherwise.
+func initExchange() Exchange {
+	if config.Paper.Enabled {
+		return initPaperExchange()
+	}
+	return newBinanceExchange(initBinanceClient())
 }
 
 func initGoogleSheetClient() *sheets.Service {
 	ctx := context.Background()
-	creds := "credentials.json"
+	creds := config.GoogleSheets.CredentialsFile
 
 	service, err := sheets.NewService(ctx, option.WithCredentialsFile(creds))
 	if err != nil {
@@ -54,40 +130,57 @@ func test(w http.ResponseWriter, r *http.Request) {
 }
 
 func checkStopLoss(w http.ResponseWriter, r *http.Request) {
+	if !stopLossJob.tryRun("endpoint") {
+		http.Error(w, "stop loss is already running", http.StatusConflict)
+		return
+	}
 
-	// Initialization
-	var wgInit sync.WaitGroup
-	var binanceClient *binance.Client
-	var sheetsClient *sheets.Service
-
-	wgInit.Add(1)
-	go func() {
-		defer wgInit.Done()
-
-		binanceClient = initBinanceClient()
-	}()
+	fmt.Fprintf(w, "hai!")
+}
 
-	wgInit.Add(1)
-	go func() {
-		defer wgInit.Done()
+// runStopLoss market-sells the trades whose price fell below their stop and
+// moves the stops of trailing stop trades up. Trades exited with an OCO list
+// carry their stop on the exchange and are left alone. Nothing is sold while
+// the kill switch is off.
+func runStopLoss(exchange Exchange, store Store) {
 
-		sheetsClient = initGoogleSheetClient()
-	}()
-	wgInit.Wait()
+	if !tradingEnabled(store) {
+		return
+	}
 
 	// Get All Trading Data
-	data, _ := getAllTradingFromGoogleSheets(sheetsClient)
+	trades, err := store.ListOpenTrades()
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return
+	}
 
 	// Get All Symbols
 	symbols := make(map[string]bool)
-	for _, pairs := range data.Values {
-		if len(pairs) >= 7 {
-			orgClientOrderID := pairs[5].(string)
-			status := pairs[6].(string)
-			symbol := pairs[1].(string)
-
-			if status == "NEW" && orgClientOrderID != "error" {
-				symbols[symbol] = true
+	limits := make(map[string]int)
+	for _, trade := range trades {
+		if isPolledStopLoss(trade) {
+			symbols[trade.Pair] = true
+			if limit := monitorKlines(trade); limit > limits[trade.Pair] {
+				limits[trade.Pair] = limit
+			}
+		}
+	}
+
+	// Get The Symbol Rules
+	symbolRules := make(map[string]SymbolRules)
+	if len(symbols) > 0 {
+		exchangeInfo, err := exchange.GetExchangeInfo(context.Background())
+		if err != nil {
+			fmt.Println("[ERROR]", err)
+			return
+		}
+		for _, symbol := range exchangeInfo.Symbols {
+			if !symbols[symbol.Symbol] {
+				continue
+			}
+			if rules, err := newSymbolRules(symbol); err == nil {
+				symbolRules[symbol.Symbol] = rules
 			}
 		}
 	}
@@ -95,9 +188,9 @@ func checkStopLoss(w http.ResponseWriter, r *http.Request) {
 	// Get The Latest Price
 	var wg sync.WaitGroup
 	var m sync.Mutex
-	maxWorkers := 20
+	maxWorkers := config.Trading.MaxWorkers
 	semaphore := make(chan struct{}, maxWorkers)
-	prices := make(map[string]float64)
+	quotes := make(map[string]monitorQuote)
 
 	for symbol, _ := range symbols {
 		wg.Add(1)
@@ -107,20 +200,28 @@ func checkStopLoss(w http.ResponseWriter, r *http.Request) {
 				<-semaphore
 				wg.Done()
 			}()
+			defer recoverPanic("stop loss " + symbol)
 
-			klines, err := getKlines(binanceClient, symbol, 1)
-			if err != nil {
+			klines, err := getKlines(exchange, symbol, limits[symbol])
+			if err != nil || len(klines) == 0 {
 				return
 			}
 
-			currentPrice, err := strconv.ParseFloat(klines[0].Close, 64)
+			candles, err := candlesFromKlines(symbol, klines)
 			if err != nil {
+				fmt.Println("[ERROR]", err)
 				return
 			}
 
+			latest := candles[len(candles)-1]
+
 			m.Lock()
 			defer m.Unlock()
-			prices[symbol] = currentPrice
+			quotes[symbol] = monitorQuote{
+				Price:  latest.Close.InexactFloat64(),
+				High:   latest.High.InexactFloat64(),
+				Closed: candles[:len(candles)-1],
+			}
 
 		}(symbol)
 	}
@@ -128,146 +229,260 @@ func checkStopLoss(w http.ResponseWriter, r *http.Request) {
 	wg.Wait()
 
 	// Stop Loss and Sell Order
-	for i, pairs := range data.Values {
-		if len(pairs) >= 7 {
-			orgClientOrderID := pairs[5].(string)
-			status := pairs[6].(string)
-			symbol := pairs[1].(string)
-			buyPrice := pairs[3].(string)
-			quantity := pairs[2].(string)
-			buyPriceFloat64, _ := strconv.ParseFloat(buyPrice, 64)
+	for _, trade := range trades {
+		if isPolledStopLoss(trade) {
+			quote, exists := quotes[trade.Pair]
+			if !exists {
+				continue
+			}
+			price := quote.Price
 
-			if status == "NEW" && orgClientOrderID != "error" {
-				if prices[symbol] < 0.98*buyPriceFloat64 {
+			if trade.TrailStop != "" {
+				rules, hasRules := symbolRules[trade.Pair]
+				checkTrailingStop(exchange, store, trade, quote, rules, hasRules)
+				continue
+			}
 
-					fmt.Println("SELL", symbol, buyPriceFloat64, 0.98*buyPriceFloat64, prices[symbol])
+			stopLossPrice := (1 - strategyTrading(trade.Strategy).StopLossPercent/100) * trade.BuyPrice
+			if price < stopLossPrice {
 
-					if quantity == "a" {
-						continue
-					}
+				fmt.Println("SELL", trade.Pair, trade.BuyPrice, stopLossPrice, price)
 
-					_, err := binanceClient.NewCancelOrderService().Symbol(symbol).OrigClientOrderID(orgClientOrderID).Do(context.Background())
+				if trade.Quantity == "a" {
+					continue
+				}
+
+				// Check the market sell before the take-profit order is gone.
+				sellQuantity := trade.Quantity
+				if rules, exists := symbolRules[trade.Pair]; exists {
+					quantity, err := decimal.NewFromString(trade.Quantity)
 					if err != nil {
-						fmt.Println("ERROR CANCEL ORDER", err)
+						fmt.Println("[ERROR]", trade.Pair, "quantity", trade.Quantity, "is not a number")
 						continue
 					}
-
-					sellMarketResponse, err := binanceClient.NewCreateOrderService().Symbol(symbol).
-						Side(binance.SideTypeSell).
-						Type(binance.OrderTypeMarket).
-						Quantity(quantity).
-						Do(context.Background())
+					quantity, err = rules.AdjustMarketQuantity(quantity, decimal.NewFromFloat(price))
 					if err != nil {
-						fmt.Println(err)
+						fmt.Println("[ERROR] cannot stop loss", err)
 						continue
 					}
+					sellQuantity = rules.FormatQuantity(quantity)
+				}
 
-					var totalPrices float64
-					for _, fill := range sellMarketResponse.Fills {
-						price, _ := strconv.ParseFloat(fill.Price, 64)
-						totalPrices += price
-					}
-					averageSellMarketPrice := totalPrices / float64(len(sellMarketResponse.Fills))
+				_, err := exchange.CancelOrder(context.Background(), trade.Pair, trade.OrderID)
+				if err != nil {
+					fmt.Println("ERROR CANCEL ORDER", err)
+					continue
+				}
 
-					editAllTradingDataToGoogleSheets(sheetsClient, "E", i+2, fmt.Sprint(averageSellMarketPrice))
+				sellMarketResponse, err := exchange.CreateOrder(context.Background(), OrderRequest{
+					Symbol:   trade.Pair,
+					Side:     binance.SideTypeSell,
+					Type:     binance.OrderTypeMarket,
+					Quantity: sellQuantity,
+				})
+				if err != nil {
+					fmt.Println(err)
+					continue
+				}
 
+				sellOrder, err := orderFromResponse(sellMarketResponse)
+				if err != nil {
+					fmt.Println("[ERROR]", err)
+					continue
 				}
+
+				// The canceled limit exit is not polled again, the trade closes
+				// here with the price the sell got.
+				store.UpdateTradeSellPrice(trade, sellOrder.AveragePrice().String())
+				store.UpdateTradeExit(trade, EXIT_STOP_LOSS)
+				store.UpdateTradeStatus(trade, string(binance.OrderStatusTypeFilled))
+				reportClosedPosition(store, trade.PositionID)
+
 			}
 		}
 	}
 
 	fmt.Println("REFRESHED!!")
+}
 
-	fmt.Fprintf(w, "hai!")
+// isPolledStopLoss reports whether runStopLoss guards the trade: an open
+// trade whose exit is a plain limit sell or a trailing stop.
+func isPolledStopLoss(trade TradingDetails) bool {
+	return trade.Status == "NEW" && trade.OrderID != "error" && trade.StopOrderID == ""
 }
 
 func checkOrderStatus(w http.ResponseWriter, r *http.Request) {
+	if !orderStatusJob.tryRun("endpoint") {
+		http.Error(w, "order status is already running", http.StatusConflict)
+		return
+	}
 
-	// Initialization
-	var wgInit sync.WaitGroup
-	var binanceClient *binance.Client
-	var sheetsClient *sheets.Service
-
-	wgInit.Add(1)
-	go func() {
-		defer wgInit.Done()
-
-		binanceClient = initBinanceClient()
-	}()
-
-	wgInit.Add(1)
-	go func() {
-		defer wgInit.Done()
+	fmt.Fprintf(w, "hai!")
+}
 
-		sheetsClient = initGoogleSheetClient()
-	}()
-	wgInit.Wait()
+func runOrderStatus(exchange Exchange, store Store) {
 
 	// Get All Trading Data
-	data, _ := getAllTradingFromGoogleSheets(sheetsClient)
+	trades, err := store.ListOpenTrades()
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return
+	}
 
 	// Check the Order Status
-	for i, pairs := range data.Values {
-		if len(pairs) >= 7 {
-			orgClientOrderID := pairs[5].(string)
-			symbol := pairs[1].(string)
-			status := pairs[6].(string)
-
-			if (status == "NEW" || status == "PARTIALLY_FILLED") && orgClientOrderID != "error" {
-				result, err := binanceClient.NewGetOrderService().Symbol(symbol).OrigClientOrderID(orgClientOrderID).Do(context.Background())
-				if err != nil {
-					fmt.Println("[ERROR]", err)
-					status = "NEW"
-				} else {
-					status = string(result.Status)
-				}
+	closedPositions := make(map[string]bool)
+	for _, trade := range trades {
+		if trade.OrderID == "error" {
+			continue
+		}
 
-				editAllTradingDataToGoogleSheets(sheetsClient, "G", i+2, status)
+		// Trailing stop trades have no exit order; runStopLoss closes them.
+		if trade.TrailStop != "" {
+			continue
+		}
+
+		if trade.StopOrderID != "" {
+			trade.Status = updateOCOTrade(exchange, store, trade)
+		} else {
+			status := trade.Status
+			result, err := exchange.GetOrder(context.Background(), trade.Pair, trade.OrderID)
+			if err != nil {
+				fmt.Println("[ERROR]", err)
+				status = "NEW"
+			} else {
+				status = string(result.Status)
 			}
+
+			store.UpdateTradeStatus(trade, status)
+			trade.Status = status
+		}
+
+		if isClosedLeg(trade) {
+			closedPositions[trade.PositionID] = true
 		}
 	}
 
+	// A position is closed once its last leg is, report the ones that closed
+	// in this run
+	for positionID := range closedPositions {
+		reportClosedPosition(store, positionID)
+	}
+
 	fmt.Println("REFRESHED!!")
+}
 
-	fmt.Fprintf(w, "hai!")
+// updateOCOTrade reads both legs of a trade's OCO exit, stores the list's
+// status and returns it, or the stored one when a leg cannot be read. Once
+// a leg filled, the trade records it as its exit and a stop-loss fill also
+// replaces the sell price with the price it got.
+func updateOCOTrade(exchange Exchange, store Store, trade TradingDetails) string {
+	takeProfit, err := exchange.GetOrder(context.Background(), trade.Pair, trade.OrderID)
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return trade.Status
+	}
+	stopLoss, err := exchange.GetOrder(context.Background(), trade.Pair, trade.StopOrderID)
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return trade.Status
+	}
+
+	status, exit := ocoStatus(takeProfit, stopLoss)
+	if status == string(binance.OrderStatusTypeFilled) && exit != trade.Exit {
+		if exit == EXIT_STOP_LOSS {
+			price, err := executedPrice(stopLoss)
+			if err != nil {
+				fmt.Println("[ERROR]", err)
+			} else {
+				store.UpdateTradeSellPrice(trade, price.String())
+			}
+		}
+		store.UpdateTradeExit(trade, exit)
+		fmt.Println("[EXIT]", trade.Pair, exit)
+	}
+
+	store.UpdateTradeStatus(trade, status)
+	return status
+}
+
+// ocoStatus folds the legs of an OCO list into one trade status and the leg
+// that fills it. A stop-loss fill wins, as it does on the exchange when both
+// prices are reached. A list canceled as a whole takes the take-profit leg's
+// status.
+func ocoStatus(takeProfit, stopLoss *binance.Order) (status string, exit string) {
+	switch {
+	case stopLoss.Status == binance.OrderStatusTypeFilled:
+		return string(binance.OrderStatusTypeFilled), EXIT_STOP_LOSS
+	case takeProfit.Status == binance.OrderStatusTypeFilled:
+		return string(binance.OrderStatusTypeFilled), EXIT_TAKE_PROFIT
+	case stopLoss.Status == binance.OrderStatusTypePartiallyFilled:
+		return string(binance.OrderStatusTypePartiallyFilled), EXIT_STOP_LOSS
+	case takeProfit.Status == binance.OrderStatusTypePartiallyFilled:
+		return string(binance.OrderStatusTypePartiallyFilled), EXIT_TAKE_PROFIT
+	case isOpenOrderStatus(takeProfit.Status) || isOpenOrderStatus(stopLoss.Status):
+		return string(binance.OrderStatusTypeNew), ""
+	default:
+		return string(takeProfit.Status), ""
+	}
 }
 
 func automateScreening(w http.ResponseWriter, r *http.Request) {
+	if !screeningJob.tryRun("endpoint") {
+		http.Error(w, "screening is already running", http.StatusConflict)
+		return
+	}
 
-	// Initialization
-	var wgInit sync.WaitGroup
-	var binanceClient *binance.Client
-	var sheetsClient *sheets.Service
+	fmt.Fprintf(w, "hai!")
+}
 
-	wgInit.Add(1)
-	go func() {
-		defer wgInit.Done()
+func runScreening(exchange Exchange, store Store) {
 
-		binanceClient = initBinanceClient()
-	}()
+	if !tradingEnabled(store) {
+		return
+	}
 
-	wgInit.Add(1)
-	go func() {
-		defer wgInit.Done()
+	strategies, err := loadStrategies()
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return
+	}
 
-		sheetsClient = initGoogleSheetClient()
-	}()
-	wgInit.Wait()
+	symbols, err := getActivePairs(exchange)
+	if err != nil || len(symbols) <= 0 {
+		fmt.Println(err, len(symbols))
+	}
+
+	// Every strategy sees the same candles
+	alerts := getParametersPerPairs(exchange, symbols, strategies)
+
+	// The risk limits are the portfolio's, shared by every strategy
+	risk := newRiskManager(exchange, store)
+
+	// Strategies share the USDT balance, so they trade one after another
+	for _, strategy := range strategies {
+		runStrategy(exchange, store, risk, strategy.Settings(), alerts[strategy.Name()])
+	}
+}
+
+// runStrategy trades one strategy's alerts and records the result under the
+// strategy's name.
+func runStrategy(exchange Exchange, store Store, risk *RiskManager, strategy StrategyConfig, alerts strategyAlerts) {
 
 	// Get initial data
-	var err error
 	var wgGetData sync.WaitGroup
 	var asset binance.UserAssetRecord
-	var symbols []binance.Symbol
 	var tradingIndormationData TradingIndormationData
-	var tradingDetails []TradingDetails
 	var blacklistAssets map[string]int
+	var account SizingAccount
+	openOrders := make(map[string]int)
 
 	wgGetData.Add(1)
 	go func() {
 		defer wgGetData.Done()
+		defer recoverPanic("strategy " + strategy.Name)
 
-		asset, err = getUserAsset(binanceClient, "USDT")
+		var err error
+		asset, err = getUserAsset(exchange, "USDT")
 		if err != nil {
 			fmt.Println(err)
 		}
@@ -276,92 +491,127 @@ func automateScreening(w http.ResponseWriter, r *http.Request) {
 	wgGetData.Add(1)
 	go func() {
 		defer wgGetData.Done()
+		defer recoverPanic("strategy " + strategy.Name)
 
-		symbols, err = getActivePairs(binanceClient)
-		if err != nil || len(symbols) <= 0 {
-			fmt.Println(err, len(symbols))
+		var err error
+		tradingIndormationData, err = store.LoadAlertState(strategy.Name)
+		if err != nil {
+			fmt.Println(err)
 		}
 	}()
 
 	wgGetData.Add(1)
 	go func() {
 		defer wgGetData.Done()
+		defer recoverPanic("strategy " + strategy.Name)
 
-		data, err := getDataFromGoogleSheets(sheetsClient)
+		var err error
+		blacklistAssets, err = store.LoadCooldowns(strategy.Name)
 		if err != nil {
 			fmt.Println(err)
 		}
-		tradingIndormationData = getTradingInformation(data)
 	}()
 
 	wgGetData.Add(1)
 	go func() {
 		defer wgGetData.Done()
+		defer recoverPanic("strategy " + strategy.Name)
 
-		data, err := getTradingDetailsFromGoogleSheets(sheetsClient)
+		trades, err := store.ListOpenTrades()
 		if err != nil {
 			fmt.Println(err)
 		}
-		blacklistAssets, tradingDetails = getTradingDetails(data)
+		account = newSizingAccount(trades)
+		for _, trade := range trades {
+			if trade.Status != "NEW" || trade.OrderID == "error" || trade.TrailStop != "" {
+				continue
+			}
+			openOrders[trade.Pair]++
+			if trade.StopOrderID != "" {
+				openOrders[trade.Pair]++
+			}
+		}
 	}()
 
+	// The Kelly mode sizes from the strategy's closed trades
+	var history []float64
+	if strategy.Trading.Sizing.Mode == SIZING_KELLY {
+		wgGetData.Add(1)
+		go func() {
+			defer wgGetData.Done()
+			defer recoverPanic("strategy " + strategy.Name)
+
+			trades, err := store.ListTrades()
+			if err != nil {
+				fmt.Println(err)
+			}
+			history = tradeReturns(trades, strategy.Name)
+		}()
+	}
+
 	wgGetData.Wait()
+	account.History = history
 
 	// Trading Logic
-	upperParameters, lowerParameters := getParametersPerPairs(binanceClient, symbols)
-	_, _, resultTrading := tradingLogic(binanceClient, asset, tradingIndormationData, blacklistAssets, upperParameters)
+	upperParameters := signalParameters(alerts.Upper)
+	lowerParameters := signalParameters(alerts.Lower)
+	_, _, resultTrading := tradingLogic(exchange, store, risk, strategy, asset, tradingIndormationData, blacklistAssets, openOrders, account, upperParameters)
 
-	// Write data to the Google Sheets
+	// Write data to the storage
 	var wgWriteData sync.WaitGroup
 
 	wgWriteData.Add(1)
 	go func() {
 		defer wgWriteData.Done()
+		defer recoverPanic("strategy " + strategy.Name)
 
-		writeTradingInformationDataToGoogleSheets(sheetsClient, upperParameters, tradingIndormationData)
+		store.SaveAlertState(strategy.Name, newAlertState(upperParameters, tradingIndormationData))
 	}()
 
 	wgWriteData.Add(1)
 	go func() {
 		defer wgWriteData.Done()
+		defer recoverPanic("strategy " + strategy.Name)
 
-		overwriteTradingDetailsToGoogleSheets(sheetsClient, append(tradingDetails, resultTrading...))
+		store.RecordCooldown(positionEntries(resultTrading))
 	}()
 
 	wgWriteData.Add(1)
 	go func() {
 		defer wgWriteData.Done()
+		defer recoverPanic("strategy " + strategy.Name)
 
-		writeAllTradingToGoogleSheets(sheetsClient, resultTrading)
+		store.AppendTrades(resultTrading)
 	}()
 
-	// wgWriteData.Add(1)
-	// go func() {
-	// 	defer wgWriteData.Done()
-
-	// 	if isEligibleToTrade {
-	// 		sendTelegramMessage("TRADE DATA", newParameters)
-	// 		writeDummyTradeDataToGoogleSheets(sheetsClient, newParameters)
-	// 	}
-	// }()
-
 	wgWriteData.Add(1)
 	go func() {
 		defer wgWriteData.Done()
+		defer recoverPanic("strategy " + strategy.Name)
 
-		sendTelegramMessage("PARAMETER DATA", upperParameters, lowerParameters)
+		title := "PARAMETER DATA"
+		if strategy.Name != DEFAULT_STRATEGY_NAME {
+			title += " " + strings.ToUpper(strategy.Name)
+		}
+		sendTelegramMessage(title, upperParameters, lowerParameters)
 	}()
 
 	wgWriteData.Wait()
 }
 
-func tradingLogic(client *binance.Client, asset binance.UserAssetRecord, tradingInformationData TradingIndormationData, blacklistAssets map[string]int, parameters map[string]Parameters) (bool, map[string]Parameters, []TradingDetails) {
+func tradingLogic(exchange Exchange, store Store, risk *RiskManager, strategy StrategyConfig, asset binance.UserAssetRecord, tradingInformationData TradingIndormationData, blacklistAssets map[string]int, openOrders map[string]int, account SizingAccount, parameters map[string]Parameters) (bool, map[string]Parameters, []TradingDetails) {
 
+	trading := strategy.Trading
 	result := make(map[string]Parameters)
 	resultTrading := []TradingDetails{}
 
-	balance, _ := strconv.ParseFloat(asset.Free, 64)
-	if balance <= MINIMUM_BALANCE {
+	free, err := decimal.NewFromString(asset.Free)
+	if err != nil {
+		fmt.Println("[ERROR] USDT balance", asset.Free, "is not a number")
+		return false, result, resultTrading
+	}
+	balance := free.InexactFloat64()
+	if balance <= trading.MinimumBalance {
 		return false, result, resultTrading
 	}
 
@@ -371,7 +621,7 @@ func tradingLogic(client *binance.Client, asset binance.UserAssetRecord, trading
 		}
 	}
 
-	if len(result) <= 30 {
+	if len(result) <= trading.MinAlertCoins {
 		return false, result, resultTrading
 	}
 
@@ -384,18 +634,14 @@ func tradingLogic(client *binance.Client, asset binance.UserAssetRecord, trading
 		maxDivider = len(result)
 	}
 
-	balanceToTrade := balance - MINIMUM_BALANCE
-	balancePerTrade := balanceToTrade / float64(maxDivider)
-
-	if balancePerTrade <= 10 {
+	sizer, err := newSizer(trading)
+	if err != nil {
+		fmt.Println("[ERROR]", err)
 		return false, result, resultTrading
 	}
+	account.Free = balance
 
-	if balancePerTrade > 10 {
-		balancePerTrade = 10
-	}
-
-	fmt.Println("[TRADE] Length:", len(result), " | Divider:", maxDivider, " | Balance Per Trade:", balancePerTrade)
+	fmt.Println("[TRADE] Length:", len(result), " | Divider:", maxDivider, " | Sizing:", trading.Sizing.Mode, " | Equity:", account.Equity())
 	fmt.Println(mapKeyToString(result))
 
 	var i int
@@ -405,92 +651,186 @@ func tradingLogic(client *binance.Client, asset binance.UserAssetRecord, trading
 			continue
 		}
 
-		if parameters[pair].TickSize <= 0 {
-			continue
+		// A pause or flatten during the run stops the buys it has left.
+		if !tradingEnabled(store) {
+			break
 		}
 
-		i++
+		if err := risk.Allow(account); err != nil {
+			fmt.Println("[RISK] no more buys:", err)
+			break
+		}
 
-		fmt.Println("\n", pair)
+		symbolRules := parameters[pair].Rules
+		if symbolRules.TickSize.IsZero() {
+			fmt.Println("[SKIP]", pair, "has no PRICE_FILTER/LOT_SIZE rules")
+			continue
+		}
 
-		orderResponse, err := client.NewCreateOrderService().Symbol(pair).
-			Side(binance.SideTypeBuy).
-			Type(binance.OrderTypeMarket).
-			QuoteOrderQty(fmt.Sprintf("%f", balancePerTrade)).
-			Do(context.Background())
+		entry := SizingEntry{Symbol: pair, Price: parameters[pair].CurrentPrice, Slots: maxDivider}
+		if trading.Sizing.Mode == SIZING_ATR {
+			entry.ATR = latestATR(exchange, pair, trading.Sizing.ATRPeriod)
+		}
+		quoteSize, err := sizePosition(sizer, trading, account, entry)
 		if err != nil {
-			fmt.Println(err)
+			fmt.Println("[SKIP]", pair+":", err)
 			continue
 		}
 
-		var totalPrices float64
-		for _, fill := range orderResponse.Fills {
-			price, _ := strconv.ParseFloat(fill.Price, 64)
-			totalPrices += price
+		// The buy has to leave room for the legs of its OCO exits and they
+		// must pass the filters, otherwise the coin would be bought without one.
+		quote := decimal.NewFromFloat(quoteSize).Truncate(8)
+		if err := symbolRules.CheckOpenOrders(openOrders[pair], exitOrders(trading)); err != nil {
+			fmt.Println("[SKIP]", err)
+			continue
 		}
-		averageBuyPrice := totalPrices / float64(len(orderResponse.Fills))
-		sellPrice := averageBuyPrice * 1.02
-
-		fmt.Println("[BUY] ", pair, averageBuyPrice, parameters[pair].TickSize)
-
-		var sellPriceStr string
-		switch parameters[pair].TickSize {
-		case 1:
-			sellPriceStr = fmt.Sprintf("%.1f", sellPrice)
-		case 2:
-			sellPriceStr = fmt.Sprintf("%.2f", sellPrice)
-		case 3:
-			sellPriceStr = fmt.Sprintf("%.3f", sellPrice)
-		case 4:
-			sellPriceStr = fmt.Sprintf("%.4f", sellPrice)
-		case 5:
-			sellPriceStr = fmt.Sprintf("%.5f", sellPrice)
-		case 6:
-			sellPriceStr = fmt.Sprintf("%.6f", sellPrice)
-		case 7:
-			sellPriceStr = fmt.Sprintf("%.7f", sellPrice)
-		case 8:
-			sellPriceStr = fmt.Sprintf("%.8f", sellPrice)
-		default:
-			sellPriceStr = fmt.Sprintf("%.9f", sellPrice)
+		if err := symbolRules.CheckQuoteOrder(quote, decimal.NewFromFloat(parameters[pair].CurrentPrice)); err != nil {
+			fmt.Println("[SKIP]", err)
+			continue
 		}
 
-		fmt.Println("[TRY TO SELL] ", pair, " SELL PRICE: ", sellPrice, sellPriceStr, orderResponse.ExecutedQuantity)
+		i++
 
-		sellResponse, err := client.NewCreateOrderService().Symbol(pair).
-			Side(binance.SideTypeSell).
-			Type(binance.OrderTypeLimit).
-			TimeInForce(binance.TimeInForceTypeGTC).
-			Quantity(orderResponse.ExecutedQuantity).
-			Price(sellPriceStr).
-			Do(context.Background())
+		fmt.Println("\n", pair)
+
+		orderResponse, err := exchange.CreateOrder(context.Background(), OrderRequest{
+			Symbol:        pair,
+			Side:          binance.SideTypeBuy,
+			Type:          binance.OrderTypeMarket,
+			QuoteOrderQty: quote.String(),
+		})
 		if err != nil {
 			fmt.Println(err)
+			continue
 		}
 
-		clientOID := "error"
-		if err == nil {
-			clientOID = sellResponse.ClientOrderID
+		buyOrder, err := orderFromResponse(orderResponse)
+		if err != nil {
+			fmt.Println("[ERROR]", err)
+			continue
 		}
 
-		resultTrading = append(resultTrading, TradingDetails{
-			OrderID:   clientOID,
-			Timestamp: time.Now().Format("2006-01-02 15:04:05"),
-			Pair:      pair,
-			Quantity:  orderResponse.ExecutedQuantity,
-			BuyPrice:  averageBuyPrice,
-			SellPrice: sellPriceStr,
-		})
-
-		fmt.Println("[SUCCESS] ", pair, " SELL PRICE: ", sellPrice, sellPriceStr)
+		averageBuyPrice := buyOrder.AveragePrice()
+		fmt.Println("[BUY] ", pair, averageBuyPrice, symbolRules.TickSize)
+		account.Add(pair, buyOrder.QuoteQuantity.InexactFloat64())
+
+		netQuantity := buyOrder.NetQuantity(symbolRules.BaseAsset)
+		var trades []TradingDetails
+		switch {
+		case len(trading.TakeProfitLadder) > 0:
+			trades = placeLadderExit(exchange, symbolRules, trading, buyOrder)
+		case trading.ExitMode == EXIT_MODE_TRAILING:
+			trades = []TradingDetails{startTrailingStop(symbolRules, trading, buyOrder, netQuantity)}
+		default:
+			trades = []TradingDetails{placeOCOExit(exchange, symbolRules, trading, averageBuyPrice, netQuantity, trading.TakeProfitPercent)}
+		}
+		timestamp := time.Now().Format("2006-01-02 15:04:05")
+		for _, trade := range trades {
+			trade.Timestamp = timestamp
+			trade.Pair = pair
+			trade.BuyPrice = averageBuyPrice.InexactFloat64()
+			trade.Paper = config.Paper.Enabled
+			trade.Strategy = strategy.Name
+			trade.PositionID = buyOrder.ClientOrderID
+			resultTrading = append(resultTrading, trade)
+
+			fmt.Println("[SUCCESS] ", pair, " SELL PRICE: ", trade.SellPrice, trade.Quantity)
+		}
 
 		if i >= maxDivider {
 			break
 		}
 	}
 
-	fmt.Println("\n")
+	fmt.Println()
 
 	return true, result, resultTrading
 
 }
+
+// placeOCOExit sells quantity of what was bought at averageBuyPrice as one
+// OCO list of a take profit takeProfitPercent above it and the stop loss,
+// placed at once so the stop does not wait for a poll. The quantity is the
+// buy's net of commission taken in the coin itself, which is not ours to
+// sell, or a ladder leg's share of it. A list that cannot be placed falls
+// back to placeLimitExit.
+func placeOCOExit(exchange Exchange, symbolRules SymbolRules, trading TradingConfig, averageBuyPrice, quantity decimal.Decimal, takeProfitPercent float64) TradingDetails {
+	stopPrice := averageBuyPrice.Mul(decimal.NewFromFloat(1 - trading.StopLossPercent/100))
+	oco, err := symbolRules.AdjustOCOSell(
+		averageBuyPrice.Mul(decimal.NewFromFloat(1+takeProfitPercent/100)),
+		stopPrice,
+		stopPrice.Mul(decimal.NewFromFloat(1-trading.StopLimitOffsetPercent/100)),
+		quantity,
+		averageBuyPrice,
+	)
+
+	fmt.Println("[TRY TO SELL] ", symbolRules.Symbol, " SELL PRICE: ", oco.Price, " STOP: ", oco.StopPrice, oco.Quantity)
+
+	var ocoResponse *binance.CreateOCOResponse
+	if err == nil {
+		ocoResponse, err = exchange.CreateOCO(context.Background(), oco)
+	}
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return placeLimitExit(exchange, symbolRules, averageBuyPrice, quantity, takeProfitPercent, err)
+	}
+
+	trade := TradingDetails{
+		Quantity:    oco.Quantity,
+		SellPrice:   oco.Price,
+		OrderListID: ocoResponse.OrderListID,
+		StopPrice:   oco.StopPrice,
+	}
+	for _, leg := range ocoResponse.OrderReports {
+		if leg.Type == binance.OrderTypeStopLossLimit {
+			trade.StopOrderID = leg.ClientOrderID
+		} else {
+			trade.OrderID = leg.ClientOrderID
+		}
+	}
+	return trade
+}
+
+// placeLimitExit is the exit of a buy whose OCO list failed: a plain limit
+// take profit, with the stop loss polled by runStopLoss as it was before OCO
+// exits. When that cannot be placed either, the trade keeps the "error"
+// order ID and the unguarded position is sent to Telegram to be sold by
+// hand. ocoErr is why the list failed.
+func placeLimitExit(exchange Exchange, symbolRules SymbolRules, averageBuyPrice, quantity decimal.Decimal, takeProfitPercent float64, ocoErr error) TradingDetails {
+	price, quantity, err := symbolRules.AdjustLimitOrder(
+		binance.SideTypeSell,
+		averageBuyPrice.Mul(decimal.NewFromFloat(1+takeProfitPercent/100)),
+		quantity,
+		averageBuyPrice,
+	)
+
+	trade := TradingDetails{
+		OrderID:     "error",
+		Quantity:    symbolRules.FormatQuantity(quantity),
+		SellPrice:   symbolRules.FormatPrice(price),
+		OrderListID: -1,
+	}
+
+	var sellResponse *binance.CreateOrderResponse
+	if err == nil {
+		sellResponse, err = exchange.CreateOrder(context.Background(), OrderRequest{
+			Symbol:      symbolRules.Symbol,
+			Side:        binance.SideTypeSell,
+			Type:        binance.OrderTypeLimit,
+			TimeInForce: binance.TimeInForceTypeGTC,
+			Quantity:    trade.Quantity,
+			Price:       trade.SellPrice,
+		})
+	}
+	if err != nil {
+		message := fmt.Sprintf("%s: bought %s at %s but no exit could be placed, sell it by hand\nOCO: %v\nLimit: %v",
+			symbolRules.Symbol, trade.Quantity, symbolRules.FormatPrice(averageBuyPrice), ocoErr, err)
+		fmt.Println("[ERROR]", message)
+		sendTelegramNotice("NO EXIT", message)
+		return trade
+	}
+
+	fmt.Println("[LIMIT EXIT] ", symbolRules.Symbol, " SELL PRICE: ", trade.SellPrice, trade.Quantity, "stop loss polled")
+	trade.OrderID = sellResponse.ClientOrderID
+	return trade
+}
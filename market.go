@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/dzakyputra/binance/indicators"
+	"github.com/shopspring/decimal"
+)
+
+// Candle is a kline with its prices and volumes parsed into exact decimals.
+// Volume is in the base asset and QuoteVolume in the quote asset.
+type Candle struct {
+	Symbol      string
+	OpenTime    time.Time
+	CloseTime   time.Time
+	Open        decimal.Decimal
+	High        decimal.Decimal
+	Low         decimal.Decimal
+	Close       decimal.Decimal
+	Volume      decimal.Decimal
+	QuoteVolume decimal.Decimal
+	Trades      int64
+}
+
+// candleFromKline is the one place a go-binance kline is parsed. A field that
+// is not a number fails the whole candle instead of reading as 0.
+func candleFromKline(symbol string, k *binance.Kline) (Candle, error) {
+	candle := Candle{
+		Symbol:    symbol,
+		OpenTime:  time.UnixMilli(k.OpenTime),
+		CloseTime: time.UnixMilli(k.CloseTime),
+		Trades:    k.TradeNum,
+	}
+
+	fields := []struct {
+		name   string
+		value  string
+		target *decimal.Decimal
+	}{
+		{"open", k.Open, &candle.Open},
+		{"high", k.High, &candle.High},
+		{"low", k.Low, &candle.Low},
+		{"close", k.Close, &candle.Close},
+		{"volume", k.Volume, &candle.Volume},
+		{"quote volume", k.QuoteAssetVolume, &candle.QuoteVolume},
+	}
+	for _, field := range fields {
+		value, err := decimal.NewFromString(field.value)
+		if err != nil {
+			return candle, fmt.Errorf("%s kline at %s: %s %q is not a number", symbol, candle.OpenTime.UTC().Format(time.RFC3339), field.name, field.value)
+		}
+		*field.target = value
+	}
+	return candle, nil
+}
+
+func candlesFromKlines(symbol string, klines []*binance.Kline) ([]Candle, error) {
+	candles := make([]Candle, len(klines))
+	for i, k := range klines {
+		candle, err := candleFromKline(symbol, k)
+		if err != nil {
+			return nil, err
+		}
+		candles[i] = candle
+	}
+	return candles, nil
+}
+
+// Bar converts the candle for the indicators and patterns packages. Volume
+// is the quote asset volume, as everywhere else in screening.
+func (c Candle) Bar() indicators.Bar {
+	return indicators.Bar{
+		Open:   c.Open.InexactFloat64(),
+		High:   c.High.InexactFloat64(),
+		Low:    c.Low.InexactFloat64(),
+		Close:  c.Close.InexactFloat64(),
+		Volume: c.QuoteVolume.InexactFloat64(),
+	}
+}
+
+func candleBars(candles []Candle) []indicators.Bar {
+	bars := make([]indicators.Bar, len(candles))
+	for i, candle := range candles {
+		bars[i] = candle.Bar()
+	}
+	return bars
+}
+
+// candlesATR is the ATR of the candles at the last one, 0 when there are
+// not enough.
+func candlesATR(candles []Candle, period int) float64 {
+	if len(candles) < period {
+		return 0
+	}
+	atr := indicators.ATRSeries(candleBars(candles), period)
+	return atr[len(atr)-1]
+}
+
+// Order is an order response with its amounts parsed into exact decimals.
+type Order struct {
+	Symbol           string
+	ClientOrderID    string
+	Side             binance.SideType
+	Type             binance.OrderType
+	Status           binance.OrderStatusType
+	Price            decimal.Decimal
+	Quantity         decimal.Decimal
+	ExecutedQuantity decimal.Decimal
+	QuoteQuantity    decimal.Decimal
+	Fills            []Fill
+}
+
+// Fill is one trade that filled part of an order.
+type Fill struct {
+	Price           decimal.Decimal
+	Quantity        decimal.Decimal
+	Commission      decimal.Decimal
+	CommissionAsset string
+}
+
+// orderFromResponse parses a new order response. Like candleFromKline it
+// fails on any amount that is not a number.
+func orderFromResponse(response *binance.CreateOrderResponse) (Order, error) {
+	order := Order{
+		Symbol:        response.Symbol,
+		ClientOrderID: response.ClientOrderID,
+		Side:          response.Side,
+		Type:          response.Type,
+		Status:        response.Status,
+	}
+
+	parse := func(name, text string) (decimal.Decimal, error) {
+		if text == "" {
+			return decimal.Zero, nil
+		}
+		value, err := decimal.NewFromString(text)
+		if err != nil {
+			return value, fmt.Errorf("%s order %s: %s %q is not a number", response.Symbol, response.ClientOrderID, name, text)
+		}
+		return value, nil
+	}
+
+	var err error
+	if order.Price, err = parse("price", response.Price); err != nil {
+		return order, err
+	}
+	if order.Quantity, err = parse("quantity", response.OrigQuantity); err != nil {
+		return order, err
+	}
+	if order.ExecutedQuantity, err = parse("executed quantity", response.ExecutedQuantity); err != nil {
+		return order, err
+	}
+	if order.QuoteQuantity, err = parse("quote quantity", response.CummulativeQuoteQuantity); err != nil {
+		return order, err
+	}
+
+	for _, f := range response.Fills {
+		var fill Fill
+		if fill.Price, err = parse("fill price", f.Price); err != nil {
+			return order, err
+		}
+		if fill.Quantity, err = parse("fill quantity", f.Quantity); err != nil {
+			return order, err
+		}
+		if fill.Commission, err = parse("fill commission", f.Commission); err != nil {
+			return order, err
+		}
+		fill.CommissionAsset = f.CommissionAsset
+		order.Fills = append(order.Fills, fill)
+	}
+	return order, nil
+}
+
+// AveragePrice is the quantity-weighted price of the fills, 0 without any.
+func (o Order) AveragePrice() decimal.Decimal {
+	var value, quantity decimal.Decimal
+	for _, fill := range o.Fills {
+		value = value.Add(fill.Price.Mul(fill.Quantity))
+		quantity = quantity.Add(fill.Quantity)
+	}
+	if quantity.IsZero() {
+		return decimal.Zero
+	}
+	return value.Div(quantity)
+}
+
+// NetQuantity is the executed quantity less the commission paid in the
+// order's base asset, which is what a buy actually adds to the balance.
+func (o Order) NetQuantity(baseAsset string) decimal.Decimal {
+	quantity := o.ExecutedQuantity
+	for _, fill := range o.Fills {
+		if fill.CommissionAsset == baseAsset {
+			quantity = quantity.Sub(fill.Commission)
+		}
+	}
+	return quantity
+}
+
+// executedPrice is the average price an order queried from the exchange
+// filled at, its cumulative quote over its executed quantity.
+func executedPrice(order *binance.Order) (decimal.Decimal, error) {
+	quote, err := decimal.NewFromString(order.CummulativeQuoteQuantity)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("%s order %s: quote quantity %q is not a number", order.Symbol, order.ClientOrderID, order.CummulativeQuoteQuantity)
+	}
+	quantity, err := decimal.NewFromString(order.ExecutedQuantity)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("%s order %s: executed quantity %q is not a number", order.Symbol, order.ClientOrderID, order.ExecutedQuantity)
+	}
+	if quantity.IsZero() {
+		return decimal.Zero, fmt.Errorf("%s order %s has not filled", order.Symbol, order.ClientOrderID)
+	}
+	return quote.Div(quantity), nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/adshao/go-binance/v2"
+)
+
+func testKline() *binance.Kline {
+	return &binance.Kline{
+		OpenTime:         1704067200000,
+		CloseTime:        1704068099999,
+		Open:             "10.01000000",
+		High:             "10.50000000",
+		Low:              "9.90000000",
+		Close:            "10.20000000",
+		Volume:           "1234.50000000",
+		QuoteAssetVolume: "12500.12345678",
+		TradeNum:         42,
+	}
+}
+
+func TestCandleFromKline(t *testing.T) {
+	candle, err := candleFromKline("AAAUSDT", testKline())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if candle.Symbol != "AAAUSDT" || candle.Trades != 42 {
+		t.Errorf("candle = %+v", candle)
+	}
+	if got := candle.OpenTime.UTC().Format("2006-01-02 15:04:05.000"); got != "2024-01-01 00:00:00.000" {
+		t.Errorf("open time = %s", got)
+	}
+	if got := candle.CloseTime.UTC().Format("2006-01-02 15:04:05.000"); got != "2024-01-01 00:14:59.999" {
+		t.Errorf("close time = %s", got)
+	}
+	for _, field := range []struct{ name, got, want string }{
+		{"open", candle.Open.String(), "10.01"},
+		{"high", candle.High.String(), "10.5"},
+		{"low", candle.Low.String(), "9.9"},
+		{"close", candle.Close.String(), "10.2"},
+		{"volume", candle.Volume.String(), "1234.5"},
+		{"quote volume", candle.QuoteVolume.String(), "12500.12345678"},
+	} {
+		if field.got != field.want {
+			t.Errorf("%s = %s, want %s", field.name, field.got, field.want)
+		}
+	}
+
+	// The indicators read the quote volume.
+	if bar := candle.Bar(); bar.Close != 10.2 || bar.Volume != 12500.12345678 {
+		t.Errorf("bar = %+v, want close 10.2 and the quote volume", bar)
+	}
+}
+
+func TestCandleFromKlineRejectsNonNumbers(t *testing.T) {
+	fields := map[string]func(k *binance.Kline){
+		"open":         func(k *binance.Kline) { k.Open = "" },
+		"high":         func(k *binance.Kline) { k.High = "n/a" },
+		"low":          func(k *binance.Kline) { k.Low = "9,9" },
+		"close":        func(k *binance.Kline) { k.Close = "NaN?" },
+		"volume":       func(k *binance.Kline) { k.Volume = "1e" },
+		"quote volume": func(k *binance.Kline) { k.QuoteAssetVolume = "x" },
+	}
+	for name, spoil := range fields {
+		t.Run(name, func(t *testing.T) {
+			k := testKline()
+			spoil(k)
+			_, err := candleFromKline("AAAUSDT", k)
+			if err == nil || !strings.HasPrefix(err.Error(), "AAAUSDT kline at 2024-01-01T00:00:00Z: "+name+" ") {
+				t.Errorf("error = %v, want the %s of the candle named", err, name)
+			}
+		})
+	}
+
+	klines := []*binance.Kline{testKline(), testKline()}
+	klines[1].Close = "bad"
+	if candles, err := candlesFromKlines("AAAUSDT", klines); err == nil || candles != nil {
+		t.Errorf("candlesFromKlines = %v, %v, want no candles and an error", candles, err)
+	}
+}
+
+func testOrderResponse() *binance.CreateOrderResponse {
+	return &binance.CreateOrderResponse{
+		Symbol:                   "AAAUSDT",
+		ClientOrderID:            "buy1",
+		Side:                     binance.SideTypeBuy,
+		Type:                     binance.OrderTypeMarket,
+		Status:                   binance.OrderStatusTypeFilled,
+		Price:                    "0.00000000",
+		OrigQuantity:             "3.00000000",
+		ExecutedQuantity:         "3.00000000",
+		CummulativeQuoteQuantity: "30.50000000",
+		Fills: []*binance.Fill{
+			{Price: "10.00000000", Quantity: "1.00000000", Commission: "0.00100000", CommissionAsset: "AAA"},
+			{Price: "10.25000000", Quantity: "2.00000000", Commission: "0.00200000", CommissionAsset: "AAA"},
+		},
+	}
+}
+
+func TestOrderFromResponse(t *testing.T) {
+	order, err := orderFromResponse(testOrderResponse())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if order.Symbol != "AAAUSDT" || order.ClientOrderID != "buy1" || order.Side != binance.SideTypeBuy || order.Status != binance.OrderStatusTypeFilled {
+		t.Errorf("order = %+v", order)
+	}
+	if !order.Quantity.Equal(dec("3")) || !order.ExecutedQuantity.Equal(dec("3")) || !order.QuoteQuantity.Equal(dec("30.5")) || !order.Price.IsZero() {
+		t.Errorf("order amounts = %s %s %s %s", order.Price, order.Quantity, order.ExecutedQuantity, order.QuoteQuantity)
+	}
+	if len(order.Fills) != 2 || !order.Fills[1].Commission.Equal(dec("0.002")) || order.Fills[1].CommissionAsset != "AAA" {
+		t.Errorf("fills = %+v", order.Fills)
+	}
+	if got := order.AveragePrice(); !got.Equal(dec("10.1666666666666667")) {
+		t.Errorf("average price = %s, want 30.5 / 3", got)
+	}
+}
+
+func TestOrderFromResponseRejectsNonNumbers(t *testing.T) {
+	fields := map[string]func(r *binance.CreateOrderResponse){
+		"price":             func(r *binance.CreateOrderResponse) { r.Price = "p" },
+		"quantity":          func(r *binance.CreateOrderResponse) { r.OrigQuantity = "q" },
+		"executed quantity": func(r *binance.CreateOrderResponse) { r.ExecutedQuantity = "3.0.0" },
+		"quote quantity":    func(r *binance.CreateOrderResponse) { r.CummulativeQuoteQuantity = "-" },
+		"fill price":        func(r *binance.CreateOrderResponse) { r.Fills[1].Price = "ten" },
+		"fill quantity":     func(r *binance.CreateOrderResponse) { r.Fills[0].Quantity = "one" },
+		"fill commission":   func(r *binance.CreateOrderResponse) { r.Fills[0].Commission = "fee" },
+	}
+	for name, spoil := range fields {
+		t.Run(name, func(t *testing.T) {
+			response := testOrderResponse()
+			spoil(response)
+			_, err := orderFromResponse(response)
+			if err == nil || !strings.HasPrefix(err.Error(), "AAAUSDT order buy1: "+name+" ") {
+				t.Errorf("error = %v, want the %s of the order named", err, name)
+			}
+		})
+	}
+}
+
+func TestOrderWithoutFills(t *testing.T) {
+	response := testOrderResponse()
+	response.Fills = nil
+	response.Price, response.CummulativeQuoteQuantity = "", ""
+
+	order, err := orderFromResponse(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !order.AveragePrice().IsZero() || !order.QuoteQuantity.IsZero() || !order.Price.IsZero() {
+		t.Errorf("order without fills = %+v, want zero prices", order)
+	}
+	if !order.NetQuantity("AAA").Equal(dec("3")) {
+		t.Errorf("net quantity = %s, want the executed 3", order.NetQuantity("AAA"))
+	}
+}
+
+func TestNetQuantity(t *testing.T) {
+	tests := []struct {
+		name   string
+		assets []string
+		want   string
+	}{
+		{"fee in the base asset", []string{"AAA", "AAA"}, "2.997"},
+		{"fee in BNB", []string{"BNB", "BNB"}, "3"},
+		{"fee in the quote asset", []string{"USDT", "USDT"}, "3"},
+		{"mixed fees", []string{"AAA", "BNB"}, "2.999"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := testOrderResponse()
+			for i, asset := range test.assets {
+				response.Fills[i].CommissionAsset = asset
+			}
+			order, err := orderFromResponse(response)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := order.NetQuantity("AAA"); !got.Equal(dec(test.want)) {
+				t.Errorf("net quantity = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExecutedPrice(t *testing.T) {
+	tests := []struct {
+		name            string
+		quote, executed string
+		want, err       string
+	}{
+		{"filled", "30.50000000", "3.00000000", "10.1666666666666667", ""},
+		{"partly filled", "10.20000000", "1.00000000", "10.2", ""},
+		{"not filled", "0.00000000", "0.00000000", "", "AAAUSDT order sell1 has not filled"},
+		{"quote not a number", "", "1.00000000", "", `AAAUSDT order sell1: quote quantity "" is not a number`},
+		{"executed not a number", "10", "one", "", `AAAUSDT order sell1: executed quantity "one" is not a number`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			order := &binance.Order{Symbol: "AAAUSDT", ClientOrderID: "sell1", CummulativeQuoteQuantity: test.quote, ExecutedQuantity: test.executed}
+			price, err := executedPrice(order)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("error = %v, want %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !price.Equal(dec(test.want)) {
+				t.Errorf("executed price = %s, want %s", price, test.want)
+			}
+		})
+	}
+}
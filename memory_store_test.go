@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// memoryStore is a Store in memory with the semantics of sqliteStore: trades
+// get increasing IDs, the running mode filters trades, halts and the kill
+// switch, and closing a trade stamps ClosedAt.
+type memoryStore struct {
+	mu          sync.Mutex
+	trades      []TradingDetails
+	alertStates map[string]TradingIndormationData
+	cooldowns   []TradingDetails
+	halts       map[bool]RiskHalt
+	switches    map[bool]TradingSwitch
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		alertStates: make(map[string]TradingIndormationData),
+		halts:       make(map[bool]RiskHalt),
+		switches:    make(map[bool]TradingSwitch),
+	}
+}
+
+func (s *memoryStore) WithContext(ctx context.Context) Store {
+	return s
+}
+
+func (s *memoryStore) LoadAlertState(strategy string) (TradingIndormationData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.alertStates[strategy], nil
+}
+
+func (s *memoryStore) SaveAlertState(strategy string, state TradingIndormationData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.alertStates[strategy] = state
+	return nil
+}
+
+func (s *memoryStore) ListOpenTrades() ([]TradingDetails, error) {
+	return s.filterTrades(func(trade TradingDetails) bool {
+		return (trade.Status == "NEW" || trade.Status == "PARTIALLY_FILLED") && trade.Paper == config.Paper.Enabled
+	}), nil
+}
+
+func (s *memoryStore) ListTrades() ([]TradingDetails, error) {
+	return s.filterTrades(func(trade TradingDetails) bool {
+		return trade.Paper == config.Paper.Enabled
+	}), nil
+}
+
+func (s *memoryStore) ListPositionTrades(positionID string) ([]TradingDetails, error) {
+	return s.filterTrades(func(trade TradingDetails) bool {
+		return trade.PositionID == positionID
+	}), nil
+}
+
+func (s *memoryStore) filterTrades(keep func(trade TradingDetails) bool) []TradingDetails {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := []TradingDetails{}
+	for _, trade := range s.trades {
+		if keep(trade) {
+			result = append(result, trade)
+		}
+	}
+	return result
+}
+
+func (s *memoryStore) AppendTrades(trades []TradingDetails) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, trade := range trades {
+		trade.ID = int64(len(s.trades) + 1)
+		if trade.Status == "" {
+			trade.Status = "NEW"
+		}
+		trade.Strategy = tradeStrategy(trade)
+		trade.OrderListID = tradeOrderListID(trade)
+		s.trades = append(s.trades, trade)
+	}
+	return nil
+}
+
+func (s *memoryStore) UpdateTradeStatus(trade TradingDetails, status string) error {
+	return s.updateTrade(trade.ID, func(stored *TradingDetails) {
+		if isClosedStatus(status) && stored.ClosedAt == "" {
+			stored.ClosedAt = time.Now().Format("2006-01-02 15:04:05")
+		}
+		stored.Status = status
+	})
+}
+
+func (s *memoryStore) UpdateTradeSellPrice(trade TradingDetails, sellPrice string) error {
+	return s.updateTrade(trade.ID, func(stored *TradingDetails) {
+		stored.SellPrice = sellPrice
+	})
+}
+
+func (s *memoryStore) UpdateTradeExit(trade TradingDetails, exit string) error {
+	return s.updateTrade(trade.ID, func(stored *TradingDetails) {
+		stored.Exit = exit
+	})
+}
+
+func (s *memoryStore) UpdateTradeTrail(trade TradingDetails, highPrice string, trailStop string) error {
+	return s.updateTrade(trade.ID, func(stored *TradingDetails) {
+		stored.HighPrice, stored.TrailStop = highPrice, trailStop
+	})
+}
+
+func (s *memoryStore) updateTrade(id int64, change func(stored *TradingDetails)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id < 1 || id > int64(len(s.trades)) {
+		return fmt.Errorf("trade %d not found", id)
+	}
+	change(&s.trades[id-1])
+	return nil
+}
+
+func (s *memoryStore) LoadRiskHalt() (RiskHalt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.halts[config.Paper.Enabled], nil
+}
+
+func (s *memoryStore) SaveRiskHalt(halt RiskHalt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.halts[config.Paper.Enabled] = halt
+	return nil
+}
+
+func (s *memoryStore) LoadTradingSwitch() (TradingSwitch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	trading, exists := s.switches[config.Paper.Enabled]
+	if !exists {
+		return TradingSwitch{Enabled: true}, nil
+	}
+	return trading, nil
+}
+
+func (s *memoryStore) SaveTradingSwitch(trading TradingSwitch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	trading.Since = time.Now().Format("2006-01-02 15:04:05")
+	s.switches[config.Paper.Enabled] = trading
+	return nil
+}
+
+func (s *memoryStore) LoadCooldowns(strategy string) (map[string]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	blacklistAssets := make(map[string]int)
+	for _, cooldown := range s.cooldowns {
+		if isInCooldown(cooldown.Timestamp) && cooldown.Paper == config.Paper.Enabled && cooldown.Strategy == strategy {
+			blacklistAssets[cooldown.Pair] += 1
+		}
+	}
+	return blacklistAssets, nil
+}
+
+func (s *memoryStore) RecordCooldown(trades []TradingDetails) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := []TradingDetails{}
+	for _, cooldown := range s.cooldowns {
+		if isInCooldown(cooldown.Timestamp) {
+			kept = append(kept, cooldown)
+		}
+	}
+	for _, trade := range trades {
+		trade.Strategy = tradeStrategy(trade)
+		kept = append(kept, trade)
+	}
+	s.cooldowns = kept
+	return nil
+}
+
+// trade returns the stored trade with the given ID.
+func (s *memoryStore) trade(id int64) TradingDetails {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.trades[id-1]
+}
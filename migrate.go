@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+var validOrderStatuses = map[string]bool{
+	"NEW":              true,
+	"PARTIALLY_FILLED": true,
+	"FILLED":           true,
+	"CANCELED":         true,
+	"PENDING_CANCEL":   true,
+	"REJECTED":         true,
+	"EXPIRED":          true,
+}
+
+type migrationReport struct {
+	Tab      string
+	Imported int
+	Existing int
+	Rejected []string
+}
+
+// runMigrateSheets copies the all_trading and trading_details tabs into the
+// SQLite database. Rows already present are skipped, so it can be rerun.
+func runMigrateSheets(args []string) error {
+	flags := flag.NewFlagSet("migrate-sheets", flag.ContinueOnError)
+	path := flags.String("sqlite", config.Storage.SQLitePath, "SQLite database to import into")
+	dryRun := flags.Bool("dry-run", false, "only validate the rows and report rejects")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if config.GoogleSheets.SpreadsheetID == "" {
+		return errors.New("google_sheets.spreadsheet_id is required (or set SPREADSHEET_ID)")
+	}
+
+	sheetsClient := initGoogleSheetClient()
+
+	allTrading, err := getAllTradingFromGoogleSheets(context.Background(), sheetsClient)
+	if err != nil {
+		return err
+	}
+	tradingDetails, err := getTradingDetailsFromGoogleSheets(context.Background(), sheetsClient)
+	if err != nil {
+		return err
+	}
+
+	var store *sqliteStore
+	if !*dryRun {
+		store, err = openSQLiteStore(*path)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+	}
+
+	reports := []migrationReport{
+		importRows(store, "all_trading", allTrading, parseAllTradingRow, func(s *sqliteStore, trade TradingDetails) (bool, error) {
+			return s.importTrade(trade)
+		}),
+		importRows(store, "trading_details", tradingDetails, parseTradingDetailsRow, func(s *sqliteStore, trade TradingDetails) (bool, error) {
+			return s.importCooldown(trade)
+		}),
+	}
+
+	failed := false
+	for _, report := range reports {
+		fmt.Printf("[Migrate %s] imported: %d | already present: %d | rejected: %d\n", report.Tab, report.Imported, report.Existing, len(report.Rejected))
+		for _, reject := range report.Rejected {
+			fmt.Printf("[Migrate %s] %s\n", report.Tab, reject)
+		}
+		if len(report.Rejected) > 0 {
+			failed = true
+		}
+	}
+
+	if failed {
+		return errors.New("some rows were rejected, fix them in the sheet and rerun")
+	}
+	return nil
+}
+
+// importRows validates every row of a tab and hands the valid ones to
+// insert. A nil store only validates. Rows start at 2 to match the sheet.
+func importRows(store *sqliteStore, tab string, data *sheets.ValueRange, parse func([]interface{}) (TradingDetails, error), insert func(*sqliteStore, TradingDetails) (bool, error)) migrationReport {
+	report := migrationReport{Tab: tab}
+
+	for i, row := range data.Values {
+		rowNumber := i + 2
+		if len(row) == 0 {
+			continue
+		}
+
+		trade, err := parse(row)
+		if err != nil {
+			report.Rejected = append(report.Rejected, fmt.Sprintf("row %d: %v", rowNumber, err))
+			continue
+		}
+
+		if store == nil {
+			report.Imported++
+			continue
+		}
+
+		inserted, err := insert(store, trade)
+		if err != nil {
+			report.Rejected = append(report.Rejected, fmt.Sprintf("row %d: %v", rowNumber, err))
+			continue
+		}
+		if inserted {
+			report.Imported++
+		} else {
+			report.Existing++
+		}
+	}
+
+	return report
+}
+
+// parseAllTradingRow validates an all_trading row: timestamp, pair, quantity,
+// buy price, sell price, sell order ID and status. The quantity may be the
+// "a" sentinel that keeps a row away from the stop-loss, and the order ID may
+// be "error" when the sell order was never placed.
+func parseAllTradingRow(row []interface{}) (TradingDetails, error) {
+	if len(row) < 7 {
+		return TradingDetails{}, fmt.Errorf("expected 7 columns, got %d", len(row))
+	}
+
+	var problems []string
+
+	timestamp := strings.TrimSpace(cellString(row, 0))
+	if _, err := time.Parse("2006-01-02 15:04:05", timestamp); err != nil {
+		problems = append(problems, fmt.Sprintf("timestamp %q is not YYYY-MM-DD HH:MM:SS", timestamp))
+	}
+
+	pair := strings.TrimSpace(cellString(row, 1))
+	if pair == "" {
+		problems = append(problems, "pair is empty")
+	}
+
+	quantity := strings.TrimSpace(cellString(row, 2))
+	if quantity != "a" {
+		if value, err := strconv.ParseFloat(quantity, 64); err != nil || value <= 0 {
+			problems = append(problems, fmt.Sprintf("quantity %q is not a positive number or \"a\"", quantity))
+		}
+	}
+
+	buyPrice, err := strconv.ParseFloat(strings.TrimSpace(cellString(row, 3)), 64)
+	if err != nil || buyPrice <= 0 {
+		problems = append(problems, fmt.Sprintf("buy price %q is not a positive number", cellString(row, 3)))
+	}
+
+	sellPrice := strings.TrimSpace(cellString(row, 4))
+	if _, err := strconv.ParseFloat(sellPrice, 64); err != nil {
+		problems = append(problems, fmt.Sprintf("sell price %q is not a number", sellPrice))
+	}
+
+	orderID := strings.TrimSpace(cellString(row, 5))
+	if orderID == "" {
+		problems = append(problems, "order ID is empty (use \"error\" for failed sell orders)")
+	}
+
+	status := strings.TrimSpace(cellString(row, 6))
+	if !validOrderStatuses[status] {
+		problems = append(problems, fmt.Sprintf("status %q is not a Binance order status", status))
+	}
+
+	if len(problems) > 0 {
+		return TradingDetails{}, errors.New(strings.Join(problems, "; "))
+	}
+
+	return TradingDetails{
+		Timestamp: timestamp,
+		Pair:      pair,
+		Quantity:  quantity,
+		BuyPrice:  buyPrice,
+		SellPrice: sellPrice,
+		OrderID:   orderID,
+		Status:    status,
+		Paper:     isPaperFlag(cellString(row, 7)),
+		Strategy:  parseStrategyFlag(cellString(row, 8)),
+
+		OrderListID: parseOrderListFlag(cellString(row, 9)),
+		StopOrderID: strings.TrimSpace(cellString(row, 10)),
+		StopPrice:   strings.TrimSpace(cellString(row, 11)),
+		Exit:        strings.TrimSpace(cellString(row, 12)),
+		HighPrice:   strings.TrimSpace(cellString(row, 13)),
+		TrailStop:   strings.TrimSpace(cellString(row, 14)),
+		PositionID:  strings.TrimSpace(cellString(row, 15)),
+		ClosedAt:    strings.TrimSpace(cellString(row, 16)),
+	}, nil
+}
+
+// parseTradingDetailsRow validates a trading_details row: timestamp, pair,
+// buy price and sell price.
+func parseTradingDetailsRow(row []interface{}) (TradingDetails, error) {
+	if len(row) < 4 {
+		return TradingDetails{}, fmt.Errorf("expected 4 columns, got %d", len(row))
+	}
+
+	var problems []string
+
+	timestamp := strings.TrimSpace(cellString(row, 0))
+	if _, err := time.Parse("2006-01-02 15:04:05", timestamp); err != nil {
+		problems = append(problems, fmt.Sprintf("timestamp %q is not YYYY-MM-DD HH:MM:SS", timestamp))
+	}
+
+	pair := strings.TrimSpace(cellString(row, 1))
+	if pair == "" {
+		problems = append(problems, "pair is empty")
+	}
+
+	buyPrice, err := strconv.ParseFloat(strings.TrimSpace(cellString(row, 2)), 64)
+	if err != nil || buyPrice <= 0 {
+		problems = append(problems, fmt.Sprintf("buy price %q is not a positive number", cellString(row, 2)))
+	}
+
+	sellPrice := strings.TrimSpace(cellString(row, 3))
+	if _, err := strconv.ParseFloat(sellPrice, 64); err != nil {
+		problems = append(problems, fmt.Sprintf("sell price %q is not a number", sellPrice))
+	}
+
+	if len(problems) > 0 {
+		return TradingDetails{}, errors.New(strings.Join(problems, "; "))
+	}
+
+	return TradingDetails{
+		Timestamp: timestamp,
+		Pair:      pair,
+		BuyPrice:  buyPrice,
+		SellPrice: sellPrice,
+		Paper:     isPaperFlag(cellString(row, 4)),
+		Strategy:  parseStrategyFlag(cellString(row, 5)),
+	}, nil
+}
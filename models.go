@@ -1,6 +1,10 @@
 package main
 
-import "time"
+import (
+	"time"
+
+	"github.com/dzakyputra/binance/patterns"
+)
 
 type Parameters struct {
 	Symbol                string
@@ -14,13 +18,13 @@ type Parameters struct {
 	IsBreakResistance     bool
 	IsBreakSupport        bool
 	CurrentPrice          float64
-
-	// Combination 1 or more parameters
-	Param1 bool
-	Param2 bool
+	// Patterns are the candlestick patterns at the latest candle.
+	Patterns []patterns.Match
 
 	// Others
-	TickSize int
+	// Rules round the symbol's order prices and quantities. They are zero
+	// when the exchange info had no usable PRICE_FILTER or LOT_SIZE.
+	Rules SymbolRules
 }
 
 type TradingIndormationData struct {
@@ -30,6 +34,7 @@ type TradingIndormationData struct {
 }
 
 type TradingDetails struct {
+	ID        int64
 	OrderID   string
 	Timestamp string
 	Pair      string
@@ -37,4 +42,54 @@ type TradingDetails struct {
 	BuyPrice  float64
 	SellPrice string
 	Status    string
+
+	// Paper marks trades made against the simulated paper-trading account.
+	Paper bool
+	// Strategy is the name of the strategy that opened the trade.
+	Strategy string
+
+	// Exits placed as an OCO list keep its ID and the stop-loss leg here;
+	// OrderID and SellPrice are the take-profit leg. StopOrderID is empty
+	// for trades exited with a plain limit sell, whose OrderListID is -1.
+	OrderListID int64
+	StopOrderID string
+	StopPrice   string
+	// Exit is how the trade closed, EXIT_TAKE_PROFIT, EXIT_STOP_LOSS,
+	// EXIT_TRAILING_STOP or EXIT_FLATTEN, once it is known.
+	Exit string
+
+	// Trades in the trailing exit mode have no exit order on the exchange.
+	// HighPrice is the highest price seen since entry and TrailStop the
+	// stop the price monitor sells at; TrailStop is empty for other trades.
+	HighPrice string
+	TrailStop string
+
+	// PositionID is the client order ID of the buy that opened the trade.
+	// A take-profit ladder stores one trade per leg under the same
+	// PositionID; trades recorded before ladders existed leave it empty.
+	PositionID string
+
+	// ClosedAt is when the store saw the trade's exit close, empty while it
+	// is open and for trades closed before it was recorded.
+	ClosedAt string
+}
+
+// TradingSwitch is the kill switch. While Enabled is false the bot neither
+// screens for buys nor polls its stop losses; Reason and Since say who
+// turned it off, and when.
+type TradingSwitch struct {
+	Enabled bool
+	Reason  string
+	Since   string
+}
+
+// RiskHalt is a risk limit that stopped new entries. Rule names the limit,
+// e.g. "daily_loss_limit", and Reason says what tripped it. Since and Until
+// are timestamps; the halt lifts at Until, when the limits are checked
+// again. A zero RiskHalt is no halt.
+type RiskHalt struct {
+	Rule   string
+	Reason string
+	Since  string
+	Until  string
 }
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+)
+
+// OptimizeSpace lists the values the optimizer tries for each screening
+// threshold. The lower MA factor only affects downtrend alerts, which are
+// never traded, and the entry rules do not read the RSI, so both stay at
+// the configured value.
+type OptimizeSpace struct {
+	UpperMAFactors []float64
+	MAPeriods      []int
+	TrendWindows   []int
+}
+
+// grid returns every combination of the space on top of base, skipping the
+// ones that do not validate.
+func (s OptimizeSpace) grid(base ScreeningConfig) []ScreeningConfig {
+	var result []ScreeningConfig
+	for _, factor := range s.UpperMAFactors {
+		for _, maPeriod := range s.MAPeriods {
+			for _, trendWindow := range s.TrendWindows {
+				rules := base
+				rules.UpperMAFactor = factor
+				rules.MAPeriod = maPeriod
+				rules.TrendWindow = trendWindow
+				if len(rules.validate("screening")) == 0 {
+					result = append(result, rules)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// sample picks n distinct combinations of the grid at random.
+func (s OptimizeSpace) sample(base ScreeningConfig, n int, rng *rand.Rand) []ScreeningConfig {
+	grid := s.grid(base)
+	rng.Shuffle(len(grid), func(i, j int) { grid[i], grid[j] = grid[j], grid[i] })
+	if n < len(grid) {
+		grid = grid[:n]
+	}
+	return grid
+}
+
+type walkForwardFold struct {
+	TrainFrom time.Time
+	TrainTo   time.Time
+	TestTo    time.Time
+}
+
+// walkForwardFolds rolls a train window followed by a test window over
+// [start, end), moving by one test window each time so the test windows
+// cover the period without overlapping.
+func walkForwardFolds(start, end time.Time, train, test time.Duration) []walkForwardFold {
+	var folds []walkForwardFold
+	for from := start; !from.Add(train + test).After(end); from = from.Add(test) {
+		folds = append(folds, walkForwardFold{
+			TrainFrom: from,
+			TrainTo:   from.Add(train),
+			TestTo:    from.Add(train + test),
+		})
+	}
+	return folds
+}
+
+// OptimizeMetrics pools the per-fold reports of one window kind. Return and
+// Sharpe are fold averages, MaxDrawdown the worst fold and the trade
+// statistics cover the trades of every fold. A profit factor of +Inf, trades
+// without a loss, ranks first.
+type OptimizeMetrics struct {
+	Return       float64
+	Sharpe       float64
+	MaxDrawdown  float64
+	Trades       int
+	WinRate      float64
+	ProfitFactor float64
+}
+
+type OptimizeResult struct {
+	Screening ScreeningConfig
+	Train     OptimizeMetrics
+	Test      OptimizeMetrics
+	// Folds holds the train and test report of every fold, in fold order.
+	Folds [][2]BacktestReport
+}
+
+// optimizeScreening backtests every candidate on the train and test window of
+// every fold, spreading the candidates over workers goroutines.
+func optimizeScreening(klines map[string][]*binance.Kline, candidates []ScreeningConfig, folds []walkForwardFold, settings BacktestSettings, workers int) []OptimizeResult {
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, workers)
+	results := make([]OptimizeResult, len(candidates))
+
+	for i, rules := range candidates {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, rules ScreeningConfig) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+
+			strategy := newEngulfingBreakoutStrategy(StrategyConfig{
+				Name:      "optimize",
+				Kind:      STRATEGY_ENGULFING_BREAKOUT,
+				Screening: rules,
+				Trading:   settings.Trading,
+			})
+			signals := screenKlines(klines, strategy, 1)
+			result := OptimizeResult{Screening: rules}
+
+			var train, test []BacktestReport
+			var trainTrades, testTrades []BacktestTrade
+			for _, fold := range folds {
+				run := settings
+				run.Strategy = strategy
+
+				run.From, run.To = fold.TrainFrom, fold.TrainTo
+				trainResult := replayBacktest(klines, signals, run)
+				run.From, run.To = fold.TrainTo, fold.TestTo
+				testResult := replayBacktest(klines, signals, run)
+
+				trainReport := newBacktestReport("", trainResult)
+				testReport := newBacktestReport("", testResult)
+				result.Folds = append(result.Folds, [2]BacktestReport{trainReport, testReport})
+
+				train = append(train, trainReport)
+				test = append(test, testReport)
+				trainTrades = append(trainTrades, trainResult.Trades...)
+				testTrades = append(testTrades, testResult.Trades...)
+			}
+
+			result.Train = poolOptimizeMetrics(train, trainTrades)
+			result.Test = poolOptimizeMetrics(test, testTrades)
+			results[i] = result
+		}(i, rules)
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+func poolOptimizeMetrics(reports []BacktestReport, trades []BacktestTrade) OptimizeMetrics {
+	var metrics OptimizeMetrics
+	if len(reports) == 0 {
+		return metrics
+	}
+
+	for _, report := range reports {
+		metrics.Return += report.TotalReturn / float64(len(reports))
+		metrics.Sharpe += report.Sharpe / float64(len(reports))
+		if report.MaxDrawdown > metrics.MaxDrawdown {
+			metrics.MaxDrawdown = report.MaxDrawdown
+		}
+	}
+
+	pooled := newBacktestReport("", BacktestResult{Trades: trades})
+	metrics.Trades = pooled.Trades
+	metrics.WinRate = pooled.WinRate
+	metrics.ProfitFactor = float64(pooled.ProfitFactor)
+
+	return metrics
+}
+
+var optimizeRankings = map[string]func(OptimizeMetrics) float64{
+	"sharpe":        func(m OptimizeMetrics) float64 { return m.Sharpe },
+	"return":        func(m OptimizeMetrics) float64 { return m.Return },
+	"profit_factor": func(m OptimizeMetrics) float64 { return m.ProfitFactor },
+}
+
+// rankOptimizeResults sorts the results best first by their test metrics,
+// keeping the grid order between equals.
+func rankOptimizeResults(results []OptimizeResult, rankBy func(OptimizeMetrics) float64) {
+	sort.SliceStable(results, func(i, j int) bool { return rankBy(results[i].Test) > rankBy(results[j].Test) })
+}
+
+func runOptimizeCommand(args []string) error {
+	flags := flag.NewFlagSet("optimize", flag.ContinueOnError)
+	dataDir := flags.String("data", "data", "directory with 15m kline CSV files")
+	candlesPath := flags.String("candles", "", "read klines from this candle store instead of -data")
+	outDir := flags.String("out", "optimize", "directory for optimize.csv and walkforward.csv")
+	mode := flags.String("mode", "grid", "grid or random")
+	samples := flags.Int("samples", 50, "parameter sets to try in random mode")
+	seed := flags.Int64("seed", 1, "random mode seed")
+	upper := flags.String("upper", "1.01,1.015,1.02,1.025,1.03", "upper MA factors")
+	maPeriods := flags.String("ma", "10,20,30,50", "moving average periods")
+	trendWindows := flags.String("trend", "50,75,100,150", "trend window lengths in candles")
+	trainDays := flags.Int("train-days", 60, "walk-forward train window in days")
+	testDays := flags.Int("test-days", 15, "walk-forward test window in days")
+	rank := flags.String("rank", "sharpe", "out-of-sample metric to rank by: sharpe, return or profit_factor")
+	balance := flags.Float64("balance", 100, "starting USDT balance of every window")
+	feeRate := flags.Float64("fee", 0.001, "fee rate per fill")
+	minAlertCoins := flags.Int("min-alert-coins", config.Trading.MinAlertCoins, "only trade when more pairs alert")
+	workers := flags.Int("workers", runtime.NumCPU(), "parameter sets backtested in parallel")
+	top := flags.Int("top", 10, "rows to print")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	rankBy, exists := optimizeRankings[*rank]
+	if !exists {
+		return fmt.Errorf("unknown -rank %q", *rank)
+	}
+	if *trainDays <= 0 || *testDays <= 0 {
+		return errors.New("-train-days and -test-days must be > 0")
+	}
+
+	var space OptimizeSpace
+	var err error
+	if space.UpperMAFactors, err = parseFloatList(*upper); err != nil {
+		return fmt.Errorf("-upper: %v", err)
+	}
+	if space.MAPeriods, err = parseIntList(*maPeriods); err != nil {
+		return fmt.Errorf("-ma: %v", err)
+	}
+	if space.TrendWindows, err = parseIntList(*trendWindows); err != nil {
+		return fmt.Errorf("-trend: %v", err)
+	}
+
+	var candidates []ScreeningConfig
+	switch *mode {
+	case "grid":
+		candidates = space.grid(config.Screening)
+	case "random":
+		candidates = space.sample(config.Screening, *samples, rand.New(rand.NewSource(*seed)))
+	default:
+		return fmt.Errorf("unknown -mode %q", *mode)
+	}
+	if len(candidates) == 0 {
+		return errors.New("no valid parameter sets in the search space")
+	}
+
+	var klines map[string][]*binance.Kline
+	if *candlesPath != "" {
+		klines, err = readKlinesStore(*candlesPath)
+	} else {
+		klines, err = readKlinesDir(*dataDir)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The first screening window needs SCREENING_WINDOW candles of history.
+	var start, end time.Time
+	for _, candles := range klines {
+		if len(candles) < SCREENING_WINDOW {
+			continue
+		}
+		first := time.UnixMilli(candles[SCREENING_WINDOW-1].CloseTime)
+		last := time.UnixMilli(candles[len(candles)-1].CloseTime)
+		if start.IsZero() || first.Before(start) {
+			start = first
+		}
+		if last.After(end) {
+			end = last
+		}
+	}
+	folds := walkForwardFolds(start, end, time.Duration(*trainDays)*24*time.Hour, time.Duration(*testDays)*24*time.Hour)
+	if len(folds) == 0 {
+		return fmt.Errorf("%s to %s is too short for a %d day train and %d day test window", start.UTC().Format("2006-01-02"), end.UTC().Format("2006-01-02"), *trainDays, *testDays)
+	}
+
+	settings := BacktestSettings{
+		StartingBalance: *balance,
+		FeeRate:         *feeRate,
+		Trading:         config.Trading,
+	}
+	settings.Trading.MinAlertCoins = *minAlertCoins
+
+	fmt.Printf("[OPTIMIZE] Parameter sets: %d | Folds: %d | Workers: %d\n", len(candidates), len(folds), *workers)
+	results := optimizeScreening(klines, candidates, folds, settings, *workers)
+	rankOptimizeResults(results, rankBy)
+
+	if err := writeOptimizeResults(*outDir, results, folds, rankBy); err != nil {
+		return err
+	}
+
+	for i, result := range results {
+		if i >= *top {
+			break
+		}
+		fmt.Printf("[OPTIMIZE] #%d %s | Train return: %.2f%% Sharpe: %.2f | Test return: %.2f%% Sharpe: %.2f Max drawdown: %.2f%% Trades: %d\n",
+			i+1, formatScreening(result.Screening), result.Train.Return, result.Train.Sharpe,
+			result.Test.Return, result.Test.Sharpe, result.Test.MaxDrawdown, result.Test.Trades)
+	}
+	return nil
+}
+
+// writeOptimizeResults writes the ranked parameter sets to optimize.csv and,
+// to walkforward.csv, the set each fold would have picked on its train window
+// together with how that set did on the following test window.
+func writeOptimizeResults(dir string, results []OptimizeResult, folds []walkForwardFold, rankBy func(OptimizeMetrics) float64) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	ranked := [][]string{{"rank", "upper_ma_factor", "ma_period", "trend_window",
+		"train_return", "train_sharpe", "train_trades",
+		"test_return", "test_sharpe", "test_max_drawdown", "test_trades", "test_win_rate", "test_profit_factor"}}
+	for i, result := range results {
+		ranked = append(ranked, []string{
+			strconv.Itoa(i + 1),
+			fmt.Sprint(result.Screening.UpperMAFactor),
+			strconv.Itoa(result.Screening.MAPeriod),
+			strconv.Itoa(result.Screening.TrendWindow),
+			fmt.Sprintf("%.4f", result.Train.Return),
+			fmt.Sprintf("%.4f", result.Train.Sharpe),
+			strconv.Itoa(result.Train.Trades),
+			fmt.Sprintf("%.4f", result.Test.Return),
+			fmt.Sprintf("%.4f", result.Test.Sharpe),
+			fmt.Sprintf("%.4f", result.Test.MaxDrawdown),
+			strconv.Itoa(result.Test.Trades),
+			fmt.Sprintf("%.4f", result.Test.WinRate),
+			formatProfitFactor(result.Test.ProfitFactor),
+		})
+	}
+	if err := writeCSVFile(filepath.Join(dir, "optimize.csv"), ranked); err != nil {
+		return err
+	}
+
+	walkForward := [][]string{{"fold", "train_from", "test_from", "test_to", "upper_ma_factor", "ma_period", "trend_window",
+		"train_return", "train_sharpe", "test_return", "test_sharpe", "test_max_drawdown", "test_trades"}}
+	for f, fold := range folds {
+		best := 0
+		for i, result := range results {
+			if rankBy(foldMetrics(result.Folds[f][0])) > rankBy(foldMetrics(results[best].Folds[f][0])) {
+				best = i
+			}
+		}
+
+		chosen := results[best]
+		train, test := chosen.Folds[f][0], chosen.Folds[f][1]
+		walkForward = append(walkForward, []string{
+			strconv.Itoa(f + 1),
+			fold.TrainFrom.UTC().Format("2006-01-02 15:04"),
+			fold.TrainTo.UTC().Format("2006-01-02 15:04"),
+			fold.TestTo.UTC().Format("2006-01-02 15:04"),
+			fmt.Sprint(chosen.Screening.UpperMAFactor),
+			strconv.Itoa(chosen.Screening.MAPeriod),
+			strconv.Itoa(chosen.Screening.TrendWindow),
+			fmt.Sprintf("%.4f", train.TotalReturn),
+			fmt.Sprintf("%.4f", train.Sharpe),
+			fmt.Sprintf("%.4f", test.TotalReturn),
+			fmt.Sprintf("%.4f", test.Sharpe),
+			fmt.Sprintf("%.4f", test.MaxDrawdown),
+			strconv.Itoa(test.Trades),
+		})
+	}
+	return writeCSVFile(filepath.Join(dir, "walkforward.csv"), walkForward)
+}
+
+func foldMetrics(report BacktestReport) OptimizeMetrics {
+	return OptimizeMetrics{
+		Return:       report.TotalReturn,
+		Sharpe:       report.Sharpe,
+		MaxDrawdown:  report.MaxDrawdown,
+		Trades:       report.Trades,
+		WinRate:      report.WinRate,
+		ProfitFactor: float64(report.ProfitFactor),
+	}
+}
+
+// formatProfitFactor writes +Inf as "inf", like the backtest report.
+func formatProfitFactor(value float64) string {
+	if math.IsInf(value, 1) {
+		return "inf"
+	}
+	return fmt.Sprintf("%.4f", value)
+}
+
+func formatScreening(rules ScreeningConfig) string {
+	return fmt.Sprintf("upper=%v ma=%d trend=%d", rules.UpperMAFactor, rules.MAPeriod, rules.TrendWindow)
+}
+
+func parseFloatList(value string) ([]float64, error) {
+	var result []float64
+	for _, field := range strings.Split(value, ",") {
+		number, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, number)
+	}
+	return result, nil
+}
+
+func parseIntList(value string) ([]int, error) {
+	var result []int
+	for _, field := range strings.Split(value, ",") {
+		number, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, number)
+	}
+	return result, nil
+}
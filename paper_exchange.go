@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/adshao/go-binance/v2/common"
+)
+
+// paperExchange trades a simulated account against live market data. Klines
+// and exchange info come from the live exchange; orders, balances and fills
+// come from a fakeExchange. Before each order call the symbol's candles since
+// the last call are fed to the simulation, so a resting limit sell fills once
+// a later kline trades through its price and a market order fills at the
+// latest price. The account is saved to a JSON file after every call.
+type paperExchange struct {
+	live      Exchange
+	sim       *fakeExchange
+	statePath string
+
+	mu      sync.Mutex
+	symbols map[string]binance.Symbol
+	// synced is the open time of the last candle fed per symbol. That candle
+	// is fed again on the next sync because it may have been open.
+	synced map[string]int64
+}
+
+type paperState struct {
+	Account fakeExchangeState `json:"account"`
+	Synced  map[string]int64  `json:"synced"`
+}
+
+// openPaperExchange loads the paper account from statePath, or opens a new
+// one holding startingBalance USDT when the file does not exist yet.
+func openPaperExchange(live Exchange, statePath string, startingBalance, feeRate float64) (*paperExchange, error) {
+	sim := newFakeExchange(feeRate)
+	sim.clientIDPrefix = "paper"
+
+	p := &paperExchange{
+		live:      live,
+		sim:       sim,
+		statePath: statePath,
+		synced:    make(map[string]int64),
+	}
+
+	content, err := os.ReadFile(statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		sim.SetBalance("USDT", startingBalance)
+		fmt.Println("[Paper] Opened a new account with", startingBalance, "USDT")
+		return p, p.save()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state paperState
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, fmt.Errorf("%s: %v", statePath, err)
+	}
+	sim.Restore(state.Account)
+	for symbol, openTime := range state.Synced {
+		p.synced[symbol] = openTime
+	}
+	return p, nil
+}
+
+func (p *paperExchange) GetKlines(ctx context.Context, symbol string, interval string, limit int) ([]*binance.Kline, error) {
+	return p.live.GetKlines(ctx, symbol, interval, limit)
+}
+
+func (p *paperExchange) GetKlinesFrom(ctx context.Context, symbol string, interval string, startTime int64, limit int) ([]*binance.Kline, error) {
+	return p.live.GetKlinesFrom(ctx, symbol, interval, startTime, limit)
+}
+
+func (p *paperExchange) GetExchangeInfo(ctx context.Context) (*binance.ExchangeInfo, error) {
+	return p.live.GetExchangeInfo(ctx)
+}
+
+func (p *paperExchange) GetUserAssets(ctx context.Context) ([]binance.UserAssetRecord, error) {
+	return p.sim.GetUserAssets(ctx)
+}
+
+func (p *paperExchange) CreateOrder(ctx context.Context, order OrderRequest) (*binance.CreateOrderResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.prepare(ctx, order.Symbol); err != nil {
+		return nil, err
+	}
+	response, err := p.sim.CreateOrder(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+	return response, p.save()
+}
+
+func (p *paperExchange) CancelOrder(ctx context.Context, symbol string, clientOrderID string) (*binance.CancelOrderResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.prepare(ctx, symbol); err != nil {
+		return nil, err
+	}
+	response, err := p.sim.CancelOrder(ctx, symbol, clientOrderID)
+	if err != nil {
+		return nil, err
+	}
+	return response, p.save()
+}
+
+func (p *paperExchange) GetOrder(ctx context.Context, symbol string, clientOrderID string) (*binance.Order, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.prepare(ctx, symbol); err != nil {
+		return nil, err
+	}
+	order, err := p.sim.GetOrder(ctx, symbol, clientOrderID)
+	if err != nil {
+		return nil, err
+	}
+	return order, p.save()
+}
+
+func (p *paperExchange) CreateOCO(ctx context.Context, order OCORequest) (*binance.CreateOCOResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.prepare(ctx, order.Symbol); err != nil {
+		return nil, err
+	}
+	response, err := p.sim.CreateOCO(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+	return response, p.save()
+}
+
+func (p *paperExchange) CancelOCO(ctx context.Context, symbol string, orderListID int64) (*binance.CancelOCOResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.prepare(ctx, symbol); err != nil {
+		return nil, err
+	}
+	response, err := p.sim.CancelOCO(ctx, symbol, orderListID)
+	if err != nil {
+		return nil, err
+	}
+	return response, p.save()
+}
+
+// prepare lists symbol on the simulation with its live filters and feeds it
+// the candles since the last sync. A symbol seen for the first time only gets
+// the current candle; after a long pause at most 1000 candles are replayed.
+func (p *paperExchange) prepare(ctx context.Context, symbol string) error {
+	if p.symbols == nil {
+		info, err := p.live.GetExchangeInfo(ctx)
+		if err != nil {
+			return err
+		}
+		p.symbols = make(map[string]binance.Symbol)
+		for _, s := range info.Symbols {
+			p.symbols[s.Symbol] = s
+		}
+	}
+
+	info, exists := p.symbols[symbol]
+	if !exists {
+		return &common.APIError{Code: -1121, Message: "Invalid symbol."}
+	}
+	p.sim.AddSymbol(info)
+
+	var klines []*binance.Kline
+	var err error
+	if openTime, exists := p.synced[symbol]; exists {
+		klines, err = p.live.GetKlinesFrom(ctx, symbol, KLINE_INTERVAL, openTime, 1000)
+	} else {
+		klines, err = p.live.GetKlines(ctx, symbol, KLINE_INTERVAL, 1)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, k := range klines {
+		p.sim.FeedCandle(symbol, k)
+	}
+	if len(klines) > 0 {
+		p.synced[symbol] = klines[len(klines)-1].OpenTime
+	}
+	return nil
+}
+
+// save writes the account next to the state file first and renames it over
+// so a crash never leaves a half-written file.
+func (p *paperExchange) save() error {
+	content, err := json.MarshalIndent(paperState{Account: p.sim.Snapshot(), Synced: p.synced}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	temporary := p.statePath + ".tmp"
+	if err := os.WriteFile(temporary, content, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(temporary, p.statePath)
+}
+
+var (
+	paperExchangeOnce   sync.Once
+	sharedPaperExchange *paperExchange
+)
+
+// initPaperExchange returns the process-wide paper account, so every handler
+// trades against the same balances.
+func initPaperExchange() *paperExchange {
+	paperExchangeOnce.Do(func() {
+		exchange, err := openPaperExchange(newBinanceExchange(initBinanceClient()), config.Paper.StatePath, config.Paper.StartingBalance, config.Paper.FeeRate)
+		if err != nil {
+			log.Fatalf("Unable to open paper account: %v", err)
+		}
+		sharedPaperExchange = exchange
+	})
+	return sharedPaperExchange
+}
@@ -0,0 +1,181 @@
+package patterns
+
+// BullishEngulfing is a bullish candle whose body covers the body of the
+// bearish candle before it.
+func BullishEngulfing(bars []Bar) float64 {
+	window, ok := last(bars, 2)
+	if !ok {
+		return 0
+	}
+	previous, current := window[0], window[1]
+	if isBullish(previous) || !isBullish(current) {
+		return 0
+	}
+	if current.Open >= previous.Close || current.Close <= previous.Open {
+		return 0
+	}
+	return reversal(engulfingShape(previous, current), bars, 2, -1)
+}
+
+// BearishEngulfing is a bearish candle whose body covers the body of the
+// bullish candle before it.
+func BearishEngulfing(bars []Bar) float64 {
+	window, ok := last(bars, 2)
+	if !ok {
+		return 0
+	}
+	previous, current := window[0], window[1]
+	if isBearish(previous) || !isBearish(current) {
+		return 0
+	}
+	if current.Open <= previous.Close || current.Close >= previous.Open {
+		return 0
+	}
+	return reversal(engulfingShape(previous, current), bars, 2, 1)
+}
+
+// engulfingShape grows from 0.5 for bodies of about the same size to 1 when
+// the engulfing body is three times the engulfed one.
+func engulfingShape(previous, current Bar) float64 {
+	if body(previous) == 0 {
+		return 1
+	}
+	return clamp(0.5 + 0.25*(body(current)/body(previous)-1))
+}
+
+// BullishHarami is a small bullish body inside the body of a long bearish
+// candle.
+func BullishHarami(bars []Bar) float64 {
+	window, ok := last(bars, 2)
+	if !ok {
+		return 0
+	}
+	previous, current := window[0], window[1]
+	if !isBearish(previous) || !isBullish(current) {
+		return 0
+	}
+	return reversal(haramiShape(bars, previous, current), bars, 2, -1)
+}
+
+// BearishHarami is a small bearish body inside the body of a long bullish
+// candle.
+func BearishHarami(bars []Bar) float64 {
+	window, ok := last(bars, 2)
+	if !ok {
+		return 0
+	}
+	previous, current := window[0], window[1]
+	if !isBullish(previous) || !isBearish(current) {
+		return 0
+	}
+	return reversal(haramiShape(bars, previous, current), bars, 2, 1)
+}
+
+func haramiShape(bars []Bar, previous, current Bar) float64 {
+	if bodyTop(current) >= bodyTop(previous) || bodyBottom(current) <= bodyBottom(previous) {
+		return 0
+	}
+	if average := averageBody(bars, 2); average > 0 && body(previous) < average {
+		return 0
+	}
+	return clamp(1 - body(current)/body(previous))
+}
+
+// MorningStar is a long bearish candle, a small-bodied one below its
+// midpoint and a bullish candle closing above that midpoint.
+func MorningStar(bars []Bar) float64 {
+	window, ok := last(bars, 3)
+	if !ok {
+		return 0
+	}
+	first, star, third := window[0], window[1], window[2]
+	if !isBearish(first) || !isBullish(third) {
+		return 0
+	}
+	if bodyTop(star) > midpoint(first) || third.Close <= midpoint(first) {
+		return 0
+	}
+	return reversal(starShape(first, star, third), bars, 3, -1)
+}
+
+// EveningStar is a long bullish candle, a small-bodied one above its
+// midpoint and a bearish candle closing below that midpoint.
+func EveningStar(bars []Bar) float64 {
+	window, ok := last(bars, 3)
+	if !ok {
+		return 0
+	}
+	first, star, third := window[0], window[1], window[2]
+	if !isBullish(first) || !isBearish(third) {
+		return 0
+	}
+	if bodyBottom(star) < midpoint(first) || third.Close >= midpoint(first) {
+		return 0
+	}
+	return reversal(starShape(first, star, third), bars, 3, 1)
+}
+
+// starShape scores how small the star is and how far the third candle
+// reaches back into the first one's body.
+func starShape(first, star, third Bar) float64 {
+	if body(first) == 0 || body(star) > body(first)/2 {
+		return 0
+	}
+	return clamp(0.5*(1-2*body(star)/body(first)) + 0.5*body(third)/body(first))
+}
+
+// ThreeWhiteSoldiers is three bullish candles, each opening within the body
+// before it and closing higher, near its high.
+func ThreeWhiteSoldiers(bars []Bar) float64 {
+	window, ok := last(bars, 3)
+	if !ok {
+		return 0
+	}
+	for i, b := range window {
+		if !isBullish(b) {
+			return 0
+		}
+		if i > 0 {
+			previous := window[i-1]
+			if b.Close <= previous.Close || b.Open < previous.Open || b.Open > previous.Close {
+				return 0
+			}
+		}
+	}
+	return soldiersShape(window, upperShadow)
+}
+
+// ThreeBlackCrows is three bearish candles, each opening within the body
+// before it and closing lower, near its low.
+func ThreeBlackCrows(bars []Bar) float64 {
+	window, ok := last(bars, 3)
+	if !ok {
+		return 0
+	}
+	for i, b := range window {
+		if !isBearish(b) {
+			return 0
+		}
+		if i > 0 {
+			previous := window[i-1]
+			if b.Close >= previous.Close || b.Open > previous.Open || b.Open < previous.Close {
+				return 0
+			}
+		}
+	}
+	return soldiersShape(window, lowerShadow)
+}
+
+// soldiersShape is high when the closing-side shadows are short next to the
+// bodies. Shadows longer than the body fail the pattern.
+func soldiersShape(window []Bar, shadow func(Bar) float64) float64 {
+	score := 1.0
+	for _, b := range window {
+		ratio := shadow(b) / body(b)
+		if ratio > 1 {
+			return 0
+		}
+		score = score * (1 - ratio/2)
+	}
+	return clamp(score)
+}
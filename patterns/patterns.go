@@ -0,0 +1,182 @@
+// Package patterns recognises candlestick patterns on numeric OHLC bars.
+//
+// Each pattern is a function over bars, oldest first, that looks at the
+// latest one to three bars and returns a confidence between 0 and 1, 0
+// meaning the pattern is not there. The confidence grows with how clearly
+// the candle shapes match and, for reversal patterns, with how well the bars
+// before agree with the trend being reversed.
+package patterns
+
+import (
+	"math"
+
+	"github.com/dzakyputra/binance/indicators"
+)
+
+// Bar is one candle.
+type Bar = indicators.Bar
+
+// Direction is the move a pattern points to.
+type Direction int
+
+const (
+	Neutral Direction = iota
+	Bullish
+	Bearish
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Bullish:
+		return "bullish"
+	case Bearish:
+		return "bearish"
+	default:
+		return "neutral"
+	}
+}
+
+// Pattern is a recognisable candle formation.
+type Pattern struct {
+	Name      string
+	Direction Direction
+	Detect    func(bars []Bar) float64
+}
+
+// Match is a pattern found at the latest bar.
+type Match struct {
+	Name       string
+	Direction  Direction
+	Confidence float64
+}
+
+// All are the patterns Detect looks for.
+var All = []Pattern{
+	{"bullish_engulfing", Bullish, BullishEngulfing},
+	{"bearish_engulfing", Bearish, BearishEngulfing},
+	{"hammer", Bullish, Hammer},
+	{"inverted_hammer", Bullish, InvertedHammer},
+	{"shooting_star", Bearish, ShootingStar},
+	{"doji", Neutral, Doji},
+	{"dragonfly_doji", Bullish, DragonflyDoji},
+	{"gravestone_doji", Bearish, GravestoneDoji},
+	{"long_legged_doji", Neutral, LongLeggedDoji},
+	{"morning_star", Bullish, MorningStar},
+	{"evening_star", Bearish, EveningStar},
+	{"three_white_soldiers", Bullish, ThreeWhiteSoldiers},
+	{"three_black_crows", Bearish, ThreeBlackCrows},
+	{"bullish_harami", Bullish, BullishHarami},
+	{"bearish_harami", Bearish, BearishHarami},
+}
+
+// Detect returns every pattern found at the latest bar, in the order of All.
+func Detect(bars []Bar) []Match {
+	var matches []Match
+	for _, pattern := range All {
+		if confidence := pattern.Detect(bars); confidence > 0 {
+			matches = append(matches, Match{Name: pattern.Name, Direction: pattern.Direction, Confidence: confidence})
+		}
+	}
+	return matches
+}
+
+// trendBars is how many bars before a pattern set the trend it reverses.
+const trendBars = 5
+
+func body(b Bar) float64 {
+	return math.Abs(b.Close - b.Open)
+}
+
+func span(b Bar) float64 {
+	return b.High - b.Low
+}
+
+func upperShadow(b Bar) float64 {
+	return b.High - math.Max(b.Open, b.Close)
+}
+
+func lowerShadow(b Bar) float64 {
+	return math.Min(b.Open, b.Close) - b.Low
+}
+
+func bodyTop(b Bar) float64 {
+	return math.Max(b.Open, b.Close)
+}
+
+func bodyBottom(b Bar) float64 {
+	return math.Min(b.Open, b.Close)
+}
+
+func midpoint(b Bar) float64 {
+	return (b.Open + b.Close) / 2
+}
+
+func isBullish(b Bar) bool {
+	return b.Close > b.Open
+}
+
+func isBearish(b Bar) bool {
+	return b.Close < b.Open
+}
+
+func clamp(value float64) float64 {
+	return math.Max(0, math.Min(1, value))
+}
+
+// averageBody is the mean body of the trendBars bars before the last skip
+// bars, the yardstick for a long or small body. It is 0 without history.
+func averageBody(bars []Bar, skip int) float64 {
+	end := len(bars) - skip
+	start := end - trendBars
+	if start < 0 {
+		start = 0
+	}
+	if end <= start {
+		return 0
+	}
+	var total float64
+	for _, b := range bars[start:end] {
+		total += body(b)
+	}
+	return total / float64(end-start)
+}
+
+// priorTrend is the move of the trendBars closes before the last skip bars,
+// scaled to -1 (falling) .. 1 (rising) by their average range. It is 0
+// without history.
+func priorTrend(bars []Bar, skip int) float64 {
+	end := len(bars) - skip
+	start := end - trendBars
+	if start < 0 {
+		start = 0
+	}
+	if end-start < 2 {
+		return 0
+	}
+	var ranges float64
+	for _, b := range bars[start:end] {
+		ranges += span(b)
+	}
+	if ranges == 0 {
+		return 0
+	}
+	move := bars[end-1].Close - bars[start].Close
+	return math.Max(-1, math.Min(1, move/(ranges/float64(end-start))/2))
+}
+
+// reversal weights a shape score with the trend before it: half the
+// confidence is the shape, half how much the bars before moved the other
+// way. want is -1 when the pattern reverses a fall and 1 a rise.
+func reversal(shape float64, bars []Bar, skip int, want float64) float64 {
+	if shape <= 0 {
+		return 0
+	}
+	return clamp(0.5*shape + 0.5*math.Max(0, priorTrend(bars, skip)*want))
+}
+
+func last(bars []Bar, n int) ([]Bar, bool) {
+	if len(bars) < n {
+		return nil, false
+	}
+	return bars[len(bars)-n:], true
+}
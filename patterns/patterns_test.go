@@ -0,0 +1,162 @@
+package patterns
+
+import (
+	"math"
+	"testing"
+)
+
+// falling is trendBars bearish candles closing from 16 down to 12.
+func falling() []Bar {
+	var bars []Bar
+	for i := 0; i < trendBars; i++ {
+		open, close := 17-float64(i), 16-float64(i)
+		bars = append(bars, Bar{Open: open, High: open + 0.2, Low: close - 0.2, Close: close, Volume: 100})
+	}
+	return bars
+}
+
+// rising is trendBars bullish candles closing from 9 up to 13.
+func rising() []Bar {
+	var bars []Bar
+	for i := 0; i < trendBars; i++ {
+		open, close := 8+float64(i), 9+float64(i)
+		bars = append(bars, Bar{Open: open, High: close + 0.2, Low: open - 0.2, Close: close, Volume: 100})
+	}
+	return bars
+}
+
+func after(trend []Bar, bars ...Bar) []Bar {
+	return append(trend, bars...)
+}
+
+func bar(open, high, low, close float64) Bar {
+	return Bar{Open: open, High: high, Low: low, Close: close, Volume: 100}
+}
+
+var (
+	hammerBar         = bar(11.8, 12.05, 11, 12)
+	invertedHammerBar = bar(11, 12, 10.95, 11.2)
+	dojiBar           = bar(12, 12.5, 11.5, 12.01)
+	dragonflyBar      = bar(12, 12.02, 11, 12.01)
+	gravestoneBar     = bar(13, 14, 12.99, 13.01)
+)
+
+func TestDetectors(t *testing.T) {
+	tests := []struct {
+		name   string
+		detect func([]Bar) float64
+		bars   []Bar
+		found  bool
+	}{
+		{"bullish engulfing", BullishEngulfing, after(falling(), bar(12, 12.1, 10.9, 11), bar(10.8, 12.6, 10.7, 12.5)), true},
+		{"bullish engulfing not covering the open", BullishEngulfing, after(falling(), bar(12, 12.1, 10.9, 11), bar(10.8, 12, 10.7, 11.9)), false},
+		{"bullish engulfing after two bullish candles", BullishEngulfing, after(falling(), bar(11, 12.1, 10.9, 12), bar(10.8, 12.6, 10.7, 12.5)), false},
+		// The strings "10.1" and "9.5" compare the other way round from the
+		// numbers, which made the old string check miss this one...
+		{"bullish engulfing across 10", BullishEngulfing, after(falling(), bar(9.5, 9.6, 8.9, 9), bar(8.9, 10.2, 8.8, 10.1)), true},
+		// ...and report this one, where 9.5 is below the open of 10.1.
+		{"bullish engulfing 9.5 below 10.1", BullishEngulfing, after(falling(), bar(10.1, 10.2, 9.5, 9.6), bar(9.4, 9.6, 9.3, 9.5)), false},
+		{"bearish engulfing", BearishEngulfing, after(rising(), bar(13, 14.1, 12.9, 14), bar(14.2, 14.3, 12.4, 12.5)), true},
+		{"bearish engulfing not covering the open", BearishEngulfing, after(rising(), bar(13, 14.1, 12.9, 14), bar(14.2, 14.3, 13, 13.1)), false},
+
+		{"hammer", Hammer, after(falling(), hammerBar), true},
+		{"hammer after a rise", Hammer, after(rising(), hammerBar), false},
+		{"hammer with a long upper shadow", Hammer, after(falling(), invertedHammerBar), false},
+		{"inverted hammer", InvertedHammer, after(falling(), invertedHammerBar), true},
+		{"inverted hammer after a rise", InvertedHammer, after(rising(), invertedHammerBar), false},
+		{"shooting star", ShootingStar, after(rising(), invertedHammerBar), true},
+		{"shooting star after a fall", ShootingStar, after(falling(), invertedHammerBar), false},
+		{"shooting star with a long lower shadow", ShootingStar, after(rising(), hammerBar), false},
+
+		{"doji", Doji, []Bar{dojiBar}, true},
+		{"doji with a body", Doji, []Bar{bar(12, 12.5, 11.5, 12.3)}, false},
+		{"doji without a range", Doji, []Bar{bar(12, 12, 12, 12)}, false},
+		{"dragonfly doji", DragonflyDoji, after(falling(), dragonflyBar), true},
+		{"dragonfly doji with an upper shadow", DragonflyDoji, after(falling(), dojiBar), false},
+		{"gravestone doji", GravestoneDoji, after(rising(), gravestoneBar), true},
+		{"gravestone doji with a lower shadow", GravestoneDoji, after(rising(), dojiBar), false},
+		{"long-legged doji", LongLeggedDoji, []Bar{dojiBar}, true},
+		{"long-legged doji with one shadow", LongLeggedDoji, []Bar{dragonflyBar}, false},
+
+		{"morning star", MorningStar, after(falling(), bar(12, 12.1, 10.4, 10.5), bar(10.3, 10.4, 10.1, 10.35), bar(10.5, 11.9, 10.4, 11.8)), true},
+		{"morning star closing below the midpoint", MorningStar, after(falling(), bar(12, 12.1, 10.4, 10.5), bar(10.3, 10.4, 10.1, 10.35), bar(10.5, 11.1, 10.4, 11)), false},
+		{"morning star with a long star", MorningStar, after(falling(), bar(12, 12.1, 10.4, 10.5), bar(9.2, 10.4, 9.1, 10.3), bar(10.5, 11.9, 10.4, 11.8)), false},
+		{"evening star", EveningStar, after(rising(), bar(13, 14.6, 12.9, 14.5), bar(14.7, 14.8, 14.6, 14.65), bar(14.5, 14.6, 13.1, 13.2)), true},
+		{"evening star closing above the midpoint", EveningStar, after(rising(), bar(13, 14.6, 12.9, 14.5), bar(14.7, 14.8, 14.6, 14.65), bar(14.5, 14.6, 13.9, 14)), false},
+
+		{"three white soldiers", ThreeWhiteSoldiers, []Bar{bar(10, 10.85, 9.95, 10.8), bar(10.5, 11.55, 10.45, 11.5), bar(11.2, 12.35, 11.15, 12.3)}, true},
+		{"three white soldiers opening below the body", ThreeWhiteSoldiers, []Bar{bar(10, 10.85, 9.95, 10.8), bar(9.9, 11.55, 9.85, 11.5), bar(11.2, 12.35, 11.15, 12.3)}, false},
+		{"three white soldiers with long upper shadows", ThreeWhiteSoldiers, []Bar{bar(10, 12, 9.95, 10.8), bar(10.5, 11.55, 10.45, 11.5), bar(11.2, 12.35, 11.15, 12.3)}, false},
+		{"three black crows", ThreeBlackCrows, []Bar{bar(12.3, 12.35, 11.45, 11.5), bar(11.8, 11.85, 10.85, 10.9), bar(11.2, 11.25, 10.15, 10.2)}, true},
+		{"three black crows closing higher", ThreeBlackCrows, []Bar{bar(12.3, 12.35, 11.45, 11.5), bar(11.8, 11.85, 10.85, 10.9), bar(10.9, 11.25, 10.85, 11)}, false},
+
+		{"bullish harami", BullishHarami, after(falling(), bar(12, 12.1, 10.4, 10.5), bar(11, 11.4, 10.9, 11.3)), true},
+		{"bullish harami outside the body", BullishHarami, after(falling(), bar(12, 12.1, 10.4, 10.5), bar(10.4, 11.4, 10.3, 11.3)), false},
+		{"bearish harami", BearishHarami, after(rising(), bar(13, 14.6, 12.9, 14.5), bar(14, 14.1, 13.5, 13.6)), true},
+		{"bearish harami inside a short body", BearishHarami, after(rising(), bar(13, 13.3, 12.9, 13.2), bar(13.15, 13.2, 13, 13.05)), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			confidence := test.detect(test.bars)
+			if math.IsNaN(confidence) || confidence < 0 || confidence > 1 {
+				t.Fatalf("confidence = %v, want it within 0..1", confidence)
+			}
+			if found := confidence > 0; found != test.found {
+				t.Errorf("confidence = %v, want found %v", confidence, test.found)
+			}
+
+			// Every pattern, not only the one under test, stays within 0..1.
+			for _, pattern := range All {
+				if c := pattern.Detect(test.bars); math.IsNaN(c) || c < 0 || c > 1 {
+					t.Errorf("%s confidence = %v, want it within 0..1", pattern.Name, c)
+				}
+			}
+		})
+	}
+}
+
+func TestDetectorsWithoutEnoughBars(t *testing.T) {
+	for _, bars := range [][]Bar{nil, {dojiBar}, {bar(12, 12, 12, 12), bar(12, 12, 12, 12), bar(12, 12, 12, 12)}} {
+		for _, pattern := range All {
+			if c := pattern.Detect(bars); math.IsNaN(c) || c < 0 || c > 1 {
+				t.Errorf("%s over %d bars = %v, want it within 0..1", pattern.Name, len(bars), c)
+			}
+		}
+	}
+	for _, pattern := range All {
+		if c := pattern.Detect(nil); c != 0 {
+			t.Errorf("%s without bars = %v, want 0", pattern.Name, c)
+		}
+	}
+}
+
+func TestReversalGrowsWithTheTrend(t *testing.T) {
+	engulfing := []Bar{bar(12, 12.1, 10.9, 11), bar(10.8, 12.6, 10.7, 12.5)}
+	alone := BullishEngulfing(engulfing)
+	afterFall := BullishEngulfing(after(falling(), engulfing...))
+	afterRise := BullishEngulfing(after(rising(), engulfing...))
+
+	if alone <= 0 || afterFall <= alone {
+		t.Errorf("bullish engulfing alone %v and after a fall %v, want more after the fall", alone, afterFall)
+	}
+	if afterRise != alone {
+		t.Errorf("bullish engulfing after a rise %v, want the shape alone %v", afterRise, alone)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	matches := Detect(after(falling(), hammerBar))
+
+	found := make(map[string]Match)
+	for _, match := range matches {
+		found[match.Name] = match
+	}
+	hammer, ok := found["hammer"]
+	if !ok || hammer.Direction != Bullish || hammer.Confidence != Hammer(after(falling(), hammerBar)) {
+		t.Errorf("Detect = %+v, want a bullish hammer", matches)
+	}
+	if _, ok := found["shooting_star"]; ok {
+		t.Errorf("Detect = %+v, found a shooting star after a fall", matches)
+	}
+}
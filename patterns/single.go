@@ -0,0 +1,121 @@
+package patterns
+
+// dojiBody is the largest body, as a share of the range, that still counts as
+// a doji.
+const dojiBody = 0.1
+
+// Doji is a candle that opened and closed at about the same price.
+func Doji(bars []Bar) float64 {
+	window, ok := last(bars, 1)
+	if !ok {
+		return 0
+	}
+	b := window[0]
+	if span(b) == 0 {
+		return 0
+	}
+	ratio := body(b) / span(b)
+	if ratio > dojiBody {
+		return 0
+	}
+	return clamp(1 - ratio/dojiBody)
+}
+
+// DragonflyDoji is a doji at the top of its range with a long lower shadow,
+// buyers pushing back a sell-off.
+func DragonflyDoji(bars []Bar) float64 {
+	doji := Doji(bars)
+	if doji == 0 {
+		return 0
+	}
+	b := bars[len(bars)-1]
+	if upperShadow(b) > dojiBody*span(b) {
+		return 0
+	}
+	return reversal(0.5*doji+0.5*lowerShadow(b)/span(b), bars, 1, -1)
+}
+
+// GravestoneDoji is a doji at the bottom of its range with a long upper
+// shadow, sellers pushing back a rally.
+func GravestoneDoji(bars []Bar) float64 {
+	doji := Doji(bars)
+	if doji == 0 {
+		return 0
+	}
+	b := bars[len(bars)-1]
+	if lowerShadow(b) > dojiBody*span(b) {
+		return 0
+	}
+	return reversal(0.5*doji+0.5*upperShadow(b)/span(b), bars, 1, 1)
+}
+
+// LongLeggedDoji is a doji with long shadows on both sides, indecision
+// after a wide swing.
+func LongLeggedDoji(bars []Bar) float64 {
+	doji := Doji(bars)
+	if doji == 0 {
+		return 0
+	}
+	b := bars[len(bars)-1]
+	upper, lower := upperShadow(b)/span(b), lowerShadow(b)/span(b)
+	if upper < 0.3 || lower < 0.3 {
+		return 0
+	}
+	// Balanced shadows make the clearest long-legged doji.
+	balance := 1 - (upper-lower)*(upper-lower)/((upper+lower)*(upper+lower))
+	return clamp(0.5*doji + 0.5*balance)
+}
+
+// hammerShape scores a small body at one end of the range with a shadow of
+// at least twice the body on the other end. long is the long shadow and
+// short the other one.
+func hammerShape(b Bar, long, short float64) float64 {
+	if span(b) == 0 || body(b) == 0 {
+		return 0
+	}
+	if long < 2*body(b) || short > body(b) || body(b) > span(b)/3 {
+		return 0
+	}
+	return clamp(0.5*(long/body(b)-2)/2 + 0.5*(1-short/body(b)))
+}
+
+// Hammer is a small body at the top of the range with a long lower shadow,
+// after a fall.
+func Hammer(bars []Bar) float64 {
+	window, ok := last(bars, 1)
+	if !ok {
+		return 0
+	}
+	b := window[0]
+	if priorTrend(bars, 1) >= 0 {
+		return 0
+	}
+	return reversal(hammerShape(b, lowerShadow(b), upperShadow(b)), bars, 1, -1)
+}
+
+// InvertedHammer is a small body at the bottom of the range with a long
+// upper shadow, after a fall.
+func InvertedHammer(bars []Bar) float64 {
+	window, ok := last(bars, 1)
+	if !ok {
+		return 0
+	}
+	b := window[0]
+	if priorTrend(bars, 1) >= 0 {
+		return 0
+	}
+	return reversal(hammerShape(b, upperShadow(b), lowerShadow(b)), bars, 1, -1)
+}
+
+// ShootingStar is the inverted hammer's shape after a rise.
+func ShootingStar(bars []Bar) float64 {
+	window, ok := last(bars, 1)
+	if !ok {
+		return 0
+	}
+	b := window[0]
+	if priorTrend(bars, 1) <= 0 {
+		return 0
+	}
+	return reversal(hammerShape(b, upperShadow(b), lowerShadow(b)), bars, 1, 1)
+}
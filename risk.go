@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RiskManager is consulted before every buy of a screening run. The loss
+// limits and the market drop are checked once, when the run starts, and the
+// halt they trip is saved so that it holds until it lifts. max_open_positions
+// and max_exposure are checked against the account before each buy.
+type RiskManager struct {
+	risk  RiskConfig
+	store Store
+	// saved is the halt in the store and halt the one in force.
+	saved RiskHalt
+	halt  RiskHalt
+}
+
+// newRiskManager loads the saved halt and, when there is none in force,
+// checks the limits on the stored trades and the market.
+func newRiskManager(exchange Exchange, store Store) *RiskManager {
+	m := &RiskManager{risk: config.Risk, store: store}
+	if !m.risk.enabled() {
+		return m
+	}
+
+	saved, err := store.LoadRiskHalt()
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+	}
+	m.saved = saved
+
+	now := time.Now()
+	if saved.Rule != "" && saved.Until != "" && now.Before(parseStoreTime(saved.Until)) {
+		m.halt = saved
+		fmt.Println("[RISK]", saved.Rule+":", saved.Reason, "until", saved.Until)
+		return m
+	}
+
+	halt := m.checkTrades(now)
+	if halt.Rule == "" {
+		halt = m.checkMarket(exchange, now)
+	}
+	if halt.Rule == "" && (m.risk.MaxOpenPositions > 0 || m.risk.MaxExposure > 0) {
+		trades, err := store.ListOpenTrades()
+		if err != nil {
+			fmt.Println("[ERROR]", err)
+		} else {
+			halt = accountHalt(m.risk, newSizingAccount(trades), now)
+		}
+	}
+	m.record(halt)
+	return m
+}
+
+// enabled reports whether any limit is set.
+func (r RiskConfig) enabled() bool {
+	return r.MaxOpenPositions > 0 || r.MaxExposure > 0 || r.DailyLossLimit > 0 || r.WeeklyLossLimit > 0 ||
+		r.MaxConsecutiveLosses > 0 || r.MarketDropPercent > 0
+}
+
+// Allow returns why no more buys can be made, nil when the next one can.
+func (m *RiskManager) Allow(account SizingAccount) error {
+	if m.halt.Rule == "" && m.risk.enabled() {
+		if halt := accountHalt(m.risk, account, time.Now()); halt.Rule != "" {
+			m.record(halt)
+		}
+	}
+	if m.halt.Rule != "" {
+		return errors.New(m.halt.Reason)
+	}
+	return nil
+}
+
+// record puts the halt in force and saves it when it changed. A rule that
+// trips, or a halt that lifts, is sent to Telegram; the same rule tripping
+// run after run keeps the time it first did and is not sent again.
+func (m *RiskManager) record(halt RiskHalt) {
+	if halt.Rule != "" && halt.Rule == m.saved.Rule {
+		halt.Since = m.saved.Since
+	}
+	m.halt = halt
+	if halt == m.saved {
+		return
+	}
+
+	if err := m.store.SaveRiskHalt(halt); err != nil {
+		fmt.Println("[ERROR]", err)
+	}
+
+	switch {
+	case halt.Rule != "" && halt.Rule != m.saved.Rule:
+		message := "⛔ New entries halted by " + halt.Rule + ": " + halt.Reason
+		if halt.Until != "" {
+			message += "\nUntil " + halt.Until
+		}
+		fmt.Println("[RISK]", message)
+		sendTelegramNotice("RISK", message)
+	case halt.Rule == "":
+		message := "✅ New entries resumed, " + m.saved.Rule + " lifted"
+		fmt.Println("[RISK]", message)
+		sendTelegramNotice("RISK", message)
+	}
+	m.saved = halt
+}
+
+// checkTrades checks the loss limits on the stored trades.
+func (m *RiskManager) checkTrades(now time.Time) RiskHalt {
+	if m.risk.DailyLossLimit == 0 && m.risk.WeeklyLossLimit == 0 && m.risk.MaxConsecutiveLosses == 0 {
+		return RiskHalt{}
+	}
+	trades, err := m.store.ListTrades()
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return RiskHalt{}
+	}
+	return lossHalt(m.risk, trades, now)
+}
+
+// checkMarket checks how far the market symbol fell from its high of the
+// last market_drop_minutes minutes.
+func (m *RiskManager) checkMarket(exchange Exchange, now time.Time) RiskHalt {
+	if m.risk.MarketDropPercent == 0 {
+		return RiskHalt{}
+	}
+	klines, err := exchange.GetKlines(context.Background(), m.risk.MarketSymbol, MARKET_DROP_INTERVAL, m.risk.MarketDropMinutes+1)
+	if err != nil {
+		fmt.Println("[ERROR]", m.risk.MarketSymbol, err)
+		return RiskHalt{}
+	}
+	candles, err := candlesFromKlines(m.risk.MarketSymbol, klines)
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return RiskHalt{}
+	}
+
+	drop := marketDrop(candles)
+	if drop < m.risk.MarketDropPercent {
+		return RiskHalt{}
+	}
+	return RiskHalt{
+		Rule:   RISK_MARKET_DROP,
+		Reason: fmt.Sprintf("%s fell %.2f%% in %d minutes, market_drop_percent is %v", m.risk.MarketSymbol, drop, m.risk.MarketDropMinutes, m.risk.MarketDropPercent),
+		Since:  now.Format("2006-01-02 15:04:05"),
+		Until:  now.Add(time.Duration(m.risk.MarketHaltMinutes) * time.Minute).Format("2006-01-02 15:04:05"),
+	}
+}
+
+// marketDrop is how far, in percent, the last close is below the highest
+// high of the candles.
+func marketDrop(candles []Candle) float64 {
+	if len(candles) == 0 {
+		return 0
+	}
+	high := candles[0].High
+	for _, candle := range candles {
+		if candle.High.GreaterThan(high) {
+			high = candle.High
+		}
+	}
+	if !high.IsPositive() {
+		return 0
+	}
+	return high.Sub(candles[len(candles)-1].Close).Div(high).InexactFloat64() * 100
+}
+
+// accountHalt checks max_open_positions and max_exposure. Their halts have
+// no Until: they lift once a position closes.
+func accountHalt(r RiskConfig, account SizingAccount, now time.Time) RiskHalt {
+	switch {
+	case r.MaxOpenPositions > 0 && account.Positions >= r.MaxOpenPositions:
+		return RiskHalt{
+			Rule:   RISK_MAX_OPEN_POSITIONS,
+			Reason: fmt.Sprintf("%d open positions, max_open_positions is %d", account.Positions, r.MaxOpenPositions),
+			Since:  now.Format("2006-01-02 15:04:05"),
+		}
+	case r.MaxExposure > 0 && account.Exposure >= r.MaxExposure:
+		return RiskHalt{
+			Rule:   RISK_MAX_EXPOSURE,
+			Reason: fmt.Sprintf("%.2f USDT in open trades, max_exposure is %v", account.Exposure, r.MaxExposure),
+			Since:  now.Format("2006-01-02 15:04:05"),
+		}
+	}
+	return RiskHalt{}
+}
+
+// closedPosition is a position whose legs all closed, with its realized
+// profit and when its last leg closed.
+type closedPosition struct {
+	pnl      float64
+	closedAt time.Time
+}
+
+// lossHalt checks the weekly and daily loss limits and the consecutive loss
+// breaker on the trades of every strategy. Days start at local midnight and
+// weeks on Monday. The breaker counts positions, skipping the ones that
+// closed without a profit or a loss; it lifts breaker_minutes after the last
+// loss, and trips again on the next loss before a win.
+func lossHalt(r RiskConfig, trades []TradingDetails, now time.Time) RiskHalt {
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	weekStart := dayStart.AddDate(0, 0, -((int(dayStart.Weekday()) + 6) % 7))
+
+	var daily, weekly float64
+	positions := make(map[string][]TradingDetails)
+	for _, trade := range trades {
+		key := trade.PositionID
+		if key == "" {
+			key = fmt.Sprint("trade ", trade.ID)
+		}
+		positions[key] = append(positions[key], trade)
+
+		if !isClosedLeg(trade) {
+			continue
+		}
+		closedAt := tradeClosedAt(trade)
+		if !closedAt.Before(weekStart) {
+			weekly += legPnL(trade)
+		}
+		if !closedAt.Before(dayStart) {
+			daily += legPnL(trade)
+		}
+	}
+
+	since := now.Format("2006-01-02 15:04:05")
+	if r.WeeklyLossLimit > 0 && -weekly >= r.WeeklyLossLimit {
+		return RiskHalt{
+			Rule:   RISK_WEEKLY_LOSS_LIMIT,
+			Reason: fmt.Sprintf("lost %.2f USDT this week, weekly_loss_limit is %v", -weekly, r.WeeklyLossLimit),
+			Since:  since,
+			Until:  weekStart.AddDate(0, 0, 7).Format("2006-01-02 15:04:05"),
+		}
+	}
+	if r.DailyLossLimit > 0 && -daily >= r.DailyLossLimit {
+		return RiskHalt{
+			Rule:   RISK_DAILY_LOSS_LIMIT,
+			Reason: fmt.Sprintf("lost %.2f USDT today, daily_loss_limit is %v", -daily, r.DailyLossLimit),
+			Since:  since,
+			Until:  dayStart.AddDate(0, 0, 1).Format("2006-01-02 15:04:05"),
+		}
+	}
+
+	if r.MaxConsecutiveLosses == 0 {
+		return RiskHalt{}
+	}
+	closed := []closedPosition{}
+	for _, legs := range positions {
+		pnl, isClosed := positionPnL(legs)
+		if !isClosed || pnl == 0 {
+			continue
+		}
+		position := closedPosition{pnl: pnl}
+		for _, leg := range legs {
+			if closedAt := tradeClosedAt(leg); closedAt.After(position.closedAt) {
+				position.closedAt = closedAt
+			}
+		}
+		closed = append(closed, position)
+	}
+	sort.Slice(closed, func(i, j int) bool { return closed[i].closedAt.Before(closed[j].closedAt) })
+
+	var losses int
+	for i := len(closed) - 1; i >= 0 && closed[i].pnl < 0; i-- {
+		losses++
+	}
+	if losses < r.MaxConsecutiveLosses {
+		return RiskHalt{}
+	}
+	until := closed[len(closed)-1].closedAt.Add(time.Duration(r.BreakerMinutes) * time.Minute)
+	if !now.Before(until) {
+		return RiskHalt{}
+	}
+	return RiskHalt{
+		Rule:   RISK_CONSECUTIVE_LOSSES,
+		Reason: fmt.Sprintf("%d positions in a row closed at a loss, max_consecutive_losses is %d", losses, r.MaxConsecutiveLosses),
+		Since:  since,
+		Until:  until.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// tradeClosedAt is when a closed trade closed. Trades closed before that was
+// recorded fall back to when they were bought.
+func tradeClosedAt(trade TradingDetails) time.Time {
+	if trade.ClosedAt != "" {
+		return parseStoreTime(trade.ClosedAt)
+	}
+	return parseStoreTime(trade.Timestamp)
+}
+
+// parseStoreTime reads a timestamp as the store writes it, in local time,
+// and is the zero time when it cannot.
+func parseStoreTime(value string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
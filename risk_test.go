@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// riskNow is Wednesday 10 January 2024 at noon: the day starts on the 10th
+// and the week on Monday the 8th.
+var riskNow = time.Date(2024, 1, 10, 12, 0, 0, 0, time.Local)
+
+// closedTrade is a filled trade of 1 AAA bought at 10 and sold at sellPrice,
+// closed at closedAt.
+func closedTrade(id int64, positionID string, sellPrice float64, closedAt string) TradingDetails {
+	return TradingDetails{
+		ID:         id,
+		Pair:       "AAAUSDT",
+		Timestamp:  "2024-01-01 00:00:00",
+		Quantity:   "1",
+		BuyPrice:   10,
+		SellPrice:  fmt.Sprint(sellPrice),
+		Status:     "FILLED",
+		PositionID: positionID,
+		ClosedAt:   closedAt,
+	}
+}
+
+func TestLossHaltLimits(t *testing.T) {
+	open, canceled := closedTrade(1, "", 0, ""), closedTrade(2, "", 0, "2024-01-10 10:00:00")
+	open.Status, canceled.Status = "NEW", "CANCELED"
+	// Trades closed before ClosedAt was recorded have none.
+	unrecorded := closedTrade(1, "", 4, "")
+	unrecorded.Timestamp = "2024-01-10 08:00:00"
+
+	tests := []struct {
+		name   string
+		risk   RiskConfig
+		trades []TradingDetails
+		now    time.Time
+		want   RiskHalt
+	}{
+		{
+			name:   "daily loss from midnight",
+			risk:   RiskConfig{DailyLossLimit: 5},
+			trades: []TradingDetails{closedTrade(1, "", 4, "2024-01-10 00:00:00")},
+			now:    riskNow,
+			want:   RiskHalt{Rule: RISK_DAILY_LOSS_LIMIT, Reason: "lost 6.00 USDT today, daily_loss_limit is 5", Since: "2024-01-10 12:00:00", Until: "2024-01-11 00:00:00"},
+		},
+		{
+			name:   "daily loss from yesterday",
+			risk:   RiskConfig{DailyLossLimit: 5},
+			trades: []TradingDetails{closedTrade(1, "", 4, "2024-01-09 23:59:59")},
+			now:    riskNow,
+		},
+		{
+			name:   "weekly loss from Monday",
+			risk:   RiskConfig{DailyLossLimit: 5, WeeklyLossLimit: 5},
+			trades: []TradingDetails{closedTrade(1, "", 4, "2024-01-08 00:00:00")},
+			now:    riskNow,
+			want:   RiskHalt{Rule: RISK_WEEKLY_LOSS_LIMIT, Reason: "lost 6.00 USDT this week, weekly_loss_limit is 5", Since: "2024-01-10 12:00:00", Until: "2024-01-15 00:00:00"},
+		},
+		{
+			name:   "weekly loss from last Sunday",
+			risk:   RiskConfig{WeeklyLossLimit: 5},
+			trades: []TradingDetails{closedTrade(1, "", 4, "2024-01-07 23:59:59")},
+			now:    riskNow,
+		},
+		{
+			name:   "the week of a Sunday started on Monday",
+			risk:   RiskConfig{WeeklyLossLimit: 5},
+			trades: []TradingDetails{closedTrade(1, "", 4, "2024-01-08 09:00:00")},
+			now:    time.Date(2024, 1, 14, 23, 0, 0, 0, time.Local),
+			want:   RiskHalt{Rule: RISK_WEEKLY_LOSS_LIMIT, Reason: "lost 6.00 USDT this week, weekly_loss_limit is 5", Since: "2024-01-14 23:00:00", Until: "2024-01-15 00:00:00"},
+		},
+		{
+			name:   "weekly checked before daily",
+			risk:   RiskConfig{DailyLossLimit: 5, WeeklyLossLimit: 5},
+			trades: []TradingDetails{closedTrade(1, "", 4, "2024-01-10 09:00:00")},
+			now:    riskNow,
+			want:   RiskHalt{Rule: RISK_WEEKLY_LOSS_LIMIT, Reason: "lost 6.00 USDT this week, weekly_loss_limit is 5", Since: "2024-01-10 12:00:00", Until: "2024-01-15 00:00:00"},
+		},
+		{
+			name: "wins count against losses",
+			risk: RiskConfig{DailyLossLimit: 5},
+			trades: []TradingDetails{
+				closedTrade(1, "", 4, "2024-01-10 09:00:00"),
+				closedTrade(2, "", 12, "2024-01-10 10:00:00"),
+			},
+			now: riskNow,
+		},
+		{
+			name:   "open and canceled trades lose nothing",
+			risk:   RiskConfig{DailyLossLimit: 5},
+			trades: []TradingDetails{open, canceled},
+			now:    riskNow,
+		},
+		{
+			name:   "trades closed before ClosedAt fall back to the buy",
+			risk:   RiskConfig{DailyLossLimit: 5},
+			trades: []TradingDetails{unrecorded},
+			now:    riskNow,
+			want:   RiskHalt{Rule: RISK_DAILY_LOSS_LIMIT, Reason: "lost 6.00 USDT today, daily_loss_limit is 5", Since: "2024-01-10 12:00:00", Until: "2024-01-11 00:00:00"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := lossHalt(test.risk, test.trades, test.now); got != test.want {
+				t.Errorf("lossHalt = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLossHaltBreaker(t *testing.T) {
+	risk := RiskConfig{MaxConsecutiveLosses: 3, BreakerMinutes: 120}
+	losses := []TradingDetails{
+		closedTrade(1, "", 9, "2024-01-10 10:00:00"),
+		closedTrade(2, "", 9, "2024-01-10 10:30:00"),
+		closedTrade(3, "", 9, "2024-01-10 11:00:00"),
+	}
+	open := closedTrade(4, "", 11, "")
+	open.Status = "NEW"
+	withTrades := func(trades ...TradingDetails) []TradingDetails {
+		return append(append([]TradingDetails(nil), losses...), trades...)
+	}
+	tripped := RiskHalt{
+		Rule:   RISK_CONSECUTIVE_LOSSES,
+		Reason: "3 positions in a row closed at a loss, max_consecutive_losses is 3",
+		Since:  "2024-01-10 12:00:00",
+		Until:  "2024-01-10 13:00:00",
+	}
+
+	tests := []struct {
+		name   string
+		trades []TradingDetails
+		now    time.Time
+		want   RiskHalt
+	}{
+		{"three losses", losses, riskNow, tripped},
+		{"just before the breaker lifts", losses, time.Date(2024, 1, 10, 12, 59, 59, 0, time.Local), RiskHalt{Rule: tripped.Rule, Reason: tripped.Reason, Since: "2024-01-10 12:59:59", Until: tripped.Until}},
+		{"breaker_minutes after the last loss", losses, time.Date(2024, 1, 10, 13, 0, 0, 0, time.Local), RiskHalt{}},
+		{"two losses", losses[1:], riskNow, RiskHalt{}},
+		{"a win after the losses", withTrades(closedTrade(4, "", 11, "2024-01-10 11:30:00")), riskNow, RiskHalt{}},
+		{"a win before the losses", withTrades(closedTrade(4, "", 11, "2024-01-10 09:00:00")), riskNow, tripped},
+		{"a break-even position is skipped", withTrades(closedTrade(4, "", 10, "2024-01-10 10:45:00")), riskNow, tripped},
+		{"an open position is skipped", withTrades(open), riskNow, tripped},
+		// The legs of a ladder make one position: +1 and -3 is one loss.
+		{"a ladder counts once", append(losses[1:], closedTrade(4, "ladder", 11, "2024-01-10 11:10:00"), closedTrade(5, "ladder", 7, "2024-01-10 11:20:00")), riskNow,
+			RiskHalt{Rule: tripped.Rule, Reason: tripped.Reason, Since: tripped.Since, Until: "2024-01-10 13:20:00"}},
+		{"a winning ladder breaks the run", append(losses[1:], closedTrade(4, "ladder", 13, "2024-01-10 11:10:00"), closedTrade(5, "ladder", 9, "2024-01-10 11:20:00")), riskNow, RiskHalt{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := lossHalt(risk, test.trades, test.now); got != test.want {
+				t.Errorf("lossHalt = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAccountHalt(t *testing.T) {
+	risk := RiskConfig{MaxOpenPositions: 2, MaxExposure: 50}
+
+	tests := []struct {
+		name    string
+		account SizingAccount
+		want    RiskHalt
+	}{
+		{"below both", SizingAccount{Positions: 1, Exposure: 49.99}, RiskHalt{}},
+		{"max_open_positions", SizingAccount{Positions: 2, Exposure: 60}, RiskHalt{Rule: RISK_MAX_OPEN_POSITIONS, Reason: "2 open positions, max_open_positions is 2", Since: "2024-01-10 12:00:00"}},
+		{"max_exposure", SizingAccount{Positions: 1, Exposure: 50}, RiskHalt{Rule: RISK_MAX_EXPOSURE, Reason: "50.00 USDT in open trades, max_exposure is 50", Since: "2024-01-10 12:00:00"}},
+	}
+	for _, test := range tests {
+		if got := accountHalt(risk, test.account, riskNow); got != test.want {
+			t.Errorf("%s: accountHalt = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+	if got := accountHalt(RiskConfig{}, SizingAccount{Positions: 100, Exposure: 1e6}, riskNow); got != (RiskHalt{}) {
+		t.Errorf("accountHalt without limits = %+v, want none", got)
+	}
+}
+
+func TestRiskHaltPersistsUntilItLifts(t *testing.T) {
+	useFlowConfig(t, EXIT_MODE_BRACKET)
+	config.Risk.MaxOpenPositions = 1
+	exchange, _ := flowMarket()
+	store := newMemoryStore()
+
+	// A saved halt in force holds without the limits being checked again.
+	until := time.Now().Add(time.Hour).Format("2006-01-02 15:04:05")
+	saved := RiskHalt{Rule: RISK_DAILY_LOSS_LIMIT, Reason: "lost 6.00 USDT today, daily_loss_limit is 5", Since: "2024-01-10 12:00:00", Until: until}
+	store.SaveRiskHalt(saved)
+
+	risk := newRiskManager(exchange, store)
+	if err := risk.Allow(SizingAccount{}); err == nil || err.Error() != saved.Reason {
+		t.Errorf("Allow = %v, want the saved halt", err)
+	}
+	if got, _ := store.LoadRiskHalt(); got != saved {
+		t.Errorf("stored halt = %+v, want it unchanged", got)
+	}
+
+	// Once it expired, the next run lifts it.
+	saved.Until = time.Now().Add(-time.Minute).Format("2006-01-02 15:04:05")
+	store.SaveRiskHalt(saved)
+	risk = newRiskManager(exchange, store)
+	if err := risk.Allow(SizingAccount{}); err != nil {
+		t.Errorf("Allow after the halt expired = %v", err)
+	}
+	if got, _ := store.LoadRiskHalt(); got != (RiskHalt{}) {
+		t.Errorf("stored halt = %+v, want it lifted", got)
+	}
+
+	// An account halt trips during a run, keeps its start on the next run
+	// and lifts once a position closed.
+	if err := risk.Allow(SizingAccount{Positions: 1}); err == nil {
+		t.Fatal("Allow at max_open_positions passed")
+	}
+	tripped, _ := store.LoadRiskHalt()
+	if tripped.Rule != RISK_MAX_OPEN_POSITIONS || tripped.Until != "" {
+		t.Fatalf("stored halt = %+v, want max_open_positions without an end", tripped)
+	}
+
+	store.AppendTrades([]TradingDetails{{Pair: flowSymbol, Quantity: "1", BuyPrice: 10, Timestamp: "2024-01-10 11:00:00"}})
+	risk = newRiskManager(exchange, store)
+	if err := risk.Allow(SizingAccount{Positions: 1}); err == nil {
+		t.Error("Allow with the position still open passed")
+	}
+	if got, _ := store.LoadRiskHalt(); got.Since != tripped.Since {
+		t.Errorf("halt since %s after the next run, want the first %s", got.Since, tripped.Since)
+	}
+
+	store.UpdateTradeStatus(store.trade(1), "FILLED")
+	risk = newRiskManager(exchange, store)
+	if err := risk.Allow(SizingAccount{}); err != nil {
+		t.Errorf("Allow after the position closed = %v", err)
+	}
+	if got, _ := store.LoadRiskHalt(); got != (RiskHalt{}) {
+		t.Errorf("stored halt = %+v, want it lifted", got)
+	}
+}
+
+func TestRiskRecord(t *testing.T) {
+	useFlowConfig(t, EXIT_MODE_BRACKET)
+	store := newMemoryStore()
+	m := &RiskManager{risk: RiskConfig{DailyLossLimit: 5}, store: store}
+
+	first := RiskHalt{Rule: RISK_DAILY_LOSS_LIMIT, Reason: "lost 6.00 USDT today", Since: "2024-01-10 12:00:00", Until: "2024-01-11 00:00:00"}
+	m.record(first)
+	if got, _ := store.LoadRiskHalt(); got != first {
+		t.Fatalf("stored halt = %+v, want %+v", got, first)
+	}
+
+	// The same rule tripping again keeps when it first did but saves the
+	// new reason.
+	again := RiskHalt{Rule: RISK_DAILY_LOSS_LIMIT, Reason: "lost 8.00 USDT today", Since: "2024-01-10 13:00:00", Until: "2024-01-11 00:00:00"}
+	m.record(again)
+	want := again
+	want.Since = first.Since
+	if got, _ := store.LoadRiskHalt(); got != want {
+		t.Errorf("stored halt = %+v, want %+v", got, want)
+	}
+
+	m.record(RiskHalt{})
+	if got, _ := store.LoadRiskHalt(); got != (RiskHalt{}) || m.halt != (RiskHalt{}) {
+		t.Errorf("stored halt = %+v and in force %+v, want both lifted", got, m.halt)
+	}
+}
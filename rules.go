@@ -0,0 +1,666 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/dzakyputra/binance/indicators"
+	"github.com/dzakyputra/binance/patterns"
+)
+
+// A rule is a true/false expression over the values screening computes for a
+// symbol, written in the config so conditions change without a rebuild:
+//
+//	close >= ma(20) * 1.02 and engulfing and uptrend
+//	close[1] < open[1] and volume > volume[1] * 2   # comments run to the end of the line
+//
+// Names:
+//
+//	open high low close volume   the candle series; name[n] is n candles back
+//	ma rsi                       the strategy's ma_period / rsi_period values
+//	ma(n) rsi(n)                 the same over n candles
+//	ema(n) wma(n) atr(n)         other moving averages and the average true range
+//	adx(n) plus_di(n) minus_di(n)
+//	bb_upper(n) bb_lower(n)      Bollinger bands, 2 standard deviations
+//	stoch_k(n) stoch_d(n)        stochastic %K over n candles smoothed by 3, %D
+//	macd macd_signal macd_histogram   MACD 12, 26, 9
+//	obv vwap                     over the screening window
+//	volume_diff                  percent change of the last 3 candles' volume
+//	engulfing uptrend break_resistance break_support   true or false
+//	hammer, doji, morning_star ...   confidence 0-1 of each candlestick
+//	                             pattern in patterns.All, 0 when absent
+//
+// Operators, loosest first: or (||), and (&&), not (!), comparisons
+// (== != < <= > >=), + -, * /, unary minus. Rules are parsed and type-checked
+// when the config is loaded; errors carry the line and column in the rule.
+
+// ruleError is a problem at a position of a rule's text, both 1-based.
+type ruleError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *ruleError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+type ruleType int
+
+const (
+	ruleNumber ruleType = iota
+	ruleBool
+)
+
+func (t ruleType) String() string {
+	if t == ruleBool {
+		return "true/false"
+	}
+	return "number"
+}
+
+// ruleEnv is what a rule is evaluated against: one symbol's screening window
+// and the parameters generated from it.
+type ruleEnv struct {
+	series     map[string][]float64
+	bars       []indicators.Bar
+	parameters Parameters
+}
+
+func newRuleEnv(bars []indicators.Bar, parameters Parameters) *ruleEnv {
+	series := map[string][]float64{
+		"open":   make([]float64, len(bars)),
+		"high":   make([]float64, len(bars)),
+		"low":    make([]float64, len(bars)),
+		"close":  make([]float64, len(bars)),
+		"volume": make([]float64, len(bars)),
+	}
+	for i, bar := range bars {
+		series["open"][i] = bar.Open
+		series["high"][i] = bar.High
+		series["low"][i] = bar.Low
+		series["close"][i] = bar.Close
+		series["volume"][i] = bar.Volume
+	}
+	return &ruleEnv{series: series, bars: bars, parameters: parameters}
+}
+
+// back returns the value n candles before the latest one, NaN when the window
+// is too short. Every comparison with NaN is false.
+func (env *ruleEnv) back(name string, n int) float64 {
+	values := env.series[name]
+	if n >= len(values) {
+		return math.NaN()
+	}
+	return values[len(values)-1-n]
+}
+
+// ruleNode is a type-checked expression. Exactly one of number and boolean is
+// set, matching typ.
+type ruleNode struct {
+	typ     ruleType
+	line    int
+	column  int
+	number  func(env *ruleEnv) float64
+	boolean func(env *ruleEnv) bool
+}
+
+// Rule is a compiled rule.
+type Rule struct {
+	source string
+	root   ruleNode
+}
+
+// Matches evaluates the rule for one symbol.
+func (r *Rule) Matches(env *ruleEnv) bool {
+	return r.root.boolean(env)
+}
+
+func (r *Rule) String() string {
+	return r.source
+}
+
+// compileRule parses and type-checks source. The whole rule must be
+// true/false.
+func compileRule(source string) (*Rule, error) {
+	tokens, err := lexRule(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &ruleParser{tokens: tokens}
+	if p.peek().kind == ruleTokenEOF {
+		return nil, p.errorAt(p.peek(), "rule is empty")
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); next.kind != ruleTokenEOF {
+		return nil, p.errorAt(next, fmt.Sprintf("unexpected %s", next))
+	}
+	if root.typ != ruleBool {
+		return nil, &ruleError{Line: root.line, Column: root.column, Message: "rule must be true/false, got a number"}
+	}
+	return &Rule{source: source, root: root}, nil
+}
+
+type ruleTokenKind int
+
+const (
+	ruleTokenEOF ruleTokenKind = iota
+	ruleTokenNumber
+	ruleTokenName
+	ruleTokenOperator
+)
+
+type ruleToken struct {
+	kind   ruleTokenKind
+	text   string
+	line   int
+	column int
+}
+
+func (t ruleToken) String() string {
+	if t.kind == ruleTokenEOF {
+		return "end of rule"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// ruleOperators are matched longest first.
+var ruleOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "(", ")", "[", "]"}
+
+func lexRule(source string) ([]ruleToken, error) {
+	var tokens []ruleToken
+	runes := []rune(source)
+	line, column := 1, 1
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == '\n':
+			i++
+			line, column = line+1, 1
+		case unicode.IsSpace(r):
+			i++
+			column++
+		case r == '#':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+				column++
+			}
+		case unicode.IsDigit(r) || r == '.':
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			text := string(runes[start:i])
+			if _, err := strconv.ParseFloat(text, 64); err != nil {
+				return nil, &ruleError{Line: line, Column: column, Message: fmt.Sprintf("%q is not a number", text)}
+			}
+			tokens = append(tokens, ruleToken{kind: ruleTokenNumber, text: text, line: line, column: column})
+			column += i - start
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			text := strings.ToLower(string(runes[start:i]))
+			tokens = append(tokens, ruleToken{kind: ruleTokenName, text: text, line: line, column: column})
+			column += i - start
+		default:
+			matched := ""
+			for _, operator := range ruleOperators {
+				if strings.HasPrefix(string(runes[i:]), operator) {
+					matched = operator
+					break
+				}
+			}
+			if matched == "" {
+				return nil, &ruleError{Line: line, Column: column, Message: fmt.Sprintf("unexpected character %q", r)}
+			}
+			tokens = append(tokens, ruleToken{kind: ruleTokenOperator, text: matched, line: line, column: column})
+			i += len(matched)
+			column += len(matched)
+		}
+	}
+
+	return append(tokens, ruleToken{kind: ruleTokenEOF, line: line, column: column}), nil
+}
+
+type ruleParser struct {
+	tokens []ruleToken
+	pos    int
+}
+
+func (p *ruleParser) peek() ruleToken {
+	return p.tokens[p.pos]
+}
+
+func (p *ruleParser) next() ruleToken {
+	token := p.tokens[p.pos]
+	if token.kind != ruleTokenEOF {
+		p.pos++
+	}
+	return token
+}
+
+// accept consumes the next token when it is one of texts.
+func (p *ruleParser) accept(texts ...string) (ruleToken, bool) {
+	token := p.peek()
+	if token.kind != ruleTokenOperator && token.kind != ruleTokenName {
+		return token, false
+	}
+	for _, text := range texts {
+		if token.text == text {
+			return p.next(), true
+		}
+	}
+	return token, false
+}
+
+func (p *ruleParser) expect(text string) error {
+	if _, ok := p.accept(text); !ok {
+		return p.errorAt(p.peek(), fmt.Sprintf("expected %q, got %s", text, p.peek()))
+	}
+	return nil
+}
+
+func (p *ruleParser) errorAt(token ruleToken, message string) error {
+	return &ruleError{Line: token.line, Column: token.column, Message: message}
+}
+
+func checkType(node ruleNode, want ruleType, operator string) error {
+	if node.typ != want {
+		return &ruleError{Line: node.line, Column: node.column, Message: fmt.Sprintf("%s needs a %s operand, got a %s", operator, want, node.typ)}
+	}
+	return nil
+}
+
+func (p *ruleParser) parseOr() (ruleNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return left, err
+	}
+	for {
+		operator, ok := p.accept("or", "||")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return right, err
+		}
+		if err := checkType(left, ruleBool, operator.text); err != nil {
+			return left, err
+		}
+		if err := checkType(right, ruleBool, operator.text); err != nil {
+			return right, err
+		}
+		a, b := left.boolean, right.boolean
+		left = ruleNode{typ: ruleBool, line: left.line, column: left.column, boolean: func(env *ruleEnv) bool { return a(env) || b(env) }}
+	}
+}
+
+func (p *ruleParser) parseAnd() (ruleNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return left, err
+	}
+	for {
+		operator, ok := p.accept("and", "&&")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return right, err
+		}
+		if err := checkType(left, ruleBool, operator.text); err != nil {
+			return left, err
+		}
+		if err := checkType(right, ruleBool, operator.text); err != nil {
+			return right, err
+		}
+		a, b := left.boolean, right.boolean
+		left = ruleNode{typ: ruleBool, line: left.line, column: left.column, boolean: func(env *ruleEnv) bool { return a(env) && b(env) }}
+	}
+}
+
+func (p *ruleParser) parseNot() (ruleNode, error) {
+	operator, ok := p.accept("not", "!")
+	if !ok {
+		return p.parseComparison()
+	}
+	operand, err := p.parseNot()
+	if err != nil {
+		return operand, err
+	}
+	if err := checkType(operand, ruleBool, operator.text); err != nil {
+		return operand, err
+	}
+	a := operand.boolean
+	return ruleNode{typ: ruleBool, line: operator.line, column: operator.column, boolean: func(env *ruleEnv) bool { return !a(env) }}, nil
+}
+
+func (p *ruleParser) parseComparison() (ruleNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return left, err
+	}
+	operator, ok := p.accept("==", "!=", "<", "<=", ">", ">=")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseAdditive()
+	if err != nil {
+		return right, err
+	}
+	if next, chained := p.accept("==", "!=", "<", "<=", ">", ">="); chained {
+		return left, p.errorAt(next, "comparisons cannot be chained, join them with and")
+	}
+
+	node := ruleNode{typ: ruleBool, line: left.line, column: left.column}
+	if operator.text == "==" || operator.text == "!=" {
+		if left.typ != right.typ {
+			return left, p.errorAt(operator, fmt.Sprintf("%s compares a %s with a %s", operator.text, left.typ, right.typ))
+		}
+		equal := operator.text == "=="
+		if left.typ == ruleBool {
+			a, b := left.boolean, right.boolean
+			node.boolean = func(env *ruleEnv) bool { return (a(env) == b(env)) == equal }
+		} else {
+			a, b := left.number, right.number
+			node.boolean = func(env *ruleEnv) bool {
+				x, y := a(env), b(env)
+				if math.IsNaN(x) || math.IsNaN(y) {
+					return false
+				}
+				return (x == y) == equal
+			}
+		}
+		return node, nil
+	}
+
+	if err := checkType(left, ruleNumber, operator.text); err != nil {
+		return left, err
+	}
+	if err := checkType(right, ruleNumber, operator.text); err != nil {
+		return right, err
+	}
+	a, b := left.number, right.number
+	switch operator.text {
+	case "<":
+		node.boolean = func(env *ruleEnv) bool { return a(env) < b(env) }
+	case "<=":
+		node.boolean = func(env *ruleEnv) bool { return a(env) <= b(env) }
+	case ">":
+		node.boolean = func(env *ruleEnv) bool { return a(env) > b(env) }
+	default:
+		node.boolean = func(env *ruleEnv) bool { return a(env) >= b(env) }
+	}
+	return node, nil
+}
+
+func (p *ruleParser) parseAdditive() (ruleNode, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return left, err
+	}
+	for {
+		operator, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return right, err
+		}
+		if left, err = arithmetic(operator, left, right); err != nil {
+			return left, err
+		}
+	}
+}
+
+func (p *ruleParser) parseMultiplicative() (ruleNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return left, err
+	}
+	for {
+		operator, ok := p.accept("*", "/")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return right, err
+		}
+		if left, err = arithmetic(operator, left, right); err != nil {
+			return left, err
+		}
+	}
+}
+
+func arithmetic(operator ruleToken, left, right ruleNode) (ruleNode, error) {
+	if err := checkType(left, ruleNumber, operator.text); err != nil {
+		return left, err
+	}
+	if err := checkType(right, ruleNumber, operator.text); err != nil {
+		return right, err
+	}
+	a, b := left.number, right.number
+	node := ruleNode{typ: ruleNumber, line: left.line, column: left.column}
+	switch operator.text {
+	case "+":
+		node.number = func(env *ruleEnv) float64 { return a(env) + b(env) }
+	case "-":
+		node.number = func(env *ruleEnv) float64 { return a(env) - b(env) }
+	case "*":
+		node.number = func(env *ruleEnv) float64 { return a(env) * b(env) }
+	default:
+		// Division by zero gives ±Inf or NaN, which no comparison matches
+		// by accident.
+		node.number = func(env *ruleEnv) float64 { return a(env) / b(env) }
+	}
+	return node, nil
+}
+
+func (p *ruleParser) parseUnary() (ruleNode, error) {
+	operator, ok := p.accept("-")
+	if !ok {
+		return p.parsePrimary()
+	}
+	operand, err := p.parseUnary()
+	if err != nil {
+		return operand, err
+	}
+	if err := checkType(operand, ruleNumber, "-"); err != nil {
+		return operand, err
+	}
+	a := operand.number
+	return ruleNode{typ: ruleNumber, line: operator.line, column: operator.column, number: func(env *ruleEnv) float64 { return -a(env) }}, nil
+}
+
+func (p *ruleParser) parsePrimary() (ruleNode, error) {
+	token := p.next()
+	switch token.kind {
+	case ruleTokenNumber:
+		value, _ := strconv.ParseFloat(token.text, 64)
+		return ruleNode{typ: ruleNumber, line: token.line, column: token.column, number: func(*ruleEnv) float64 { return value }}, nil
+	case ruleTokenName:
+		if token.text != "and" && token.text != "or" {
+			return p.parseName(token)
+		}
+	case ruleTokenOperator:
+		if token.text == "(" {
+			node, err := p.parseOr()
+			if err != nil {
+				return node, err
+			}
+			return node, p.expect(")")
+		}
+	}
+	return ruleNode{}, p.errorAt(token, fmt.Sprintf("expected a value, got %s", token))
+}
+
+// ruleBooleans are the true/false names, read from the parameters.
+var ruleBooleans = map[string]func(Parameters) bool{
+	"engulfing":        func(p Parameters) bool { return p.IsGulfingCandles },
+	"uptrend":          func(p Parameters) bool { return p.IsUpperTrend },
+	"break_resistance": func(p Parameters) bool { return p.IsBreakResistance },
+	"break_support":    func(p Parameters) bool { return p.IsBreakSupport },
+}
+
+// ruleNumbers are the numeric names without a lookback.
+var ruleNumbers = map[string]func(env *ruleEnv) float64{
+	"ma":          func(env *ruleEnv) float64 { return env.parameters.MovingAverage },
+	"rsi":         func(env *ruleEnv) float64 { return env.parameters.RelativeStrengthIndex },
+	"volume_diff": func(env *ruleEnv) float64 { return env.parameters.VolumeDiff },
+	"macd": func(env *ruleEnv) float64 {
+		return last(indicators.MACDSeries(env.series["close"], 12, 26, 9)).MACD
+	},
+	"macd_signal": func(env *ruleEnv) float64 {
+		return last(indicators.MACDSeries(env.series["close"], 12, 26, 9)).Signal
+	},
+	"macd_histogram": func(env *ruleEnv) float64 {
+		return last(indicators.MACDSeries(env.series["close"], 12, 26, 9)).Histogram
+	},
+	"obv":  func(env *ruleEnv) float64 { return last(indicators.OBVSeries(env.bars)) },
+	"vwap": func(env *ruleEnv) float64 { return last(indicators.VWAPSeries(env.bars)) },
+}
+
+// ruleFunctions are the numeric names taking a period, evaluated at the
+// latest candle.
+var ruleFunctions = map[string]func(env *ruleEnv, period int) float64{
+	"ma": func(env *ruleEnv, period int) float64 {
+		return calculateMovingAverage(env.series["close"], period)
+	},
+	"rsi": func(env *ruleEnv, period int) float64 {
+		return calculateRelativeStrengthIndex(env.series["close"], period)
+	},
+	"ema": func(env *ruleEnv, period int) float64 {
+		return last(indicators.EMASeries(env.series["close"], period))
+	},
+	"wma": func(env *ruleEnv, period int) float64 {
+		return last(indicators.WMASeries(env.series["close"], period))
+	},
+	"atr": func(env *ruleEnv, period int) float64 {
+		return last(indicators.ATRSeries(env.bars, period))
+	},
+	"adx": func(env *ruleEnv, period int) float64 {
+		return last(indicators.ADXSeries(env.bars, period)).ADX
+	},
+	"plus_di": func(env *ruleEnv, period int) float64 {
+		return last(indicators.ADXSeries(env.bars, period)).PlusDI
+	},
+	"minus_di": func(env *ruleEnv, period int) float64 {
+		return last(indicators.ADXSeries(env.bars, period)).MinusDI
+	},
+	"bb_upper": func(env *ruleEnv, period int) float64 {
+		return last(indicators.BollingerSeries(env.series["close"], period, 2)).Upper
+	},
+	"bb_lower": func(env *ruleEnv, period int) float64 {
+		return last(indicators.BollingerSeries(env.series["close"], period, 2)).Lower
+	},
+	"stoch_k": func(env *ruleEnv, period int) float64 {
+		return last(indicators.StochasticSeries(env.bars, period, 3, 3)).K
+	},
+	"stoch_d": func(env *ruleEnv, period int) float64 {
+		return last(indicators.StochasticSeries(env.bars, period, 3, 3)).D
+	},
+}
+
+// last returns the final element of a series, the zero value when it is
+// empty.
+func last[T any](series []T) T {
+	var zero T
+	if len(series) == 0 {
+		return zero
+	}
+	return series[len(series)-1]
+}
+
+func (p *ruleParser) parseName(name ruleToken) (ruleNode, error) {
+	node := ruleNode{line: name.line, column: name.column}
+
+	switch name.text {
+	case "true", "false":
+		value := name.text == "true"
+		node.typ = ruleBool
+		node.boolean = func(*ruleEnv) bool { return value }
+		return node, nil
+	case "open", "high", "low", "close", "volume":
+		series := name.text
+		offset := 0
+		if _, ok := p.accept("["); ok {
+			var err error
+			if offset, err = p.parseInteger(0, SCREENING_WINDOW-1); err != nil {
+				return node, err
+			}
+			if err := p.expect("]"); err != nil {
+				return node, err
+			}
+		}
+		node.typ = ruleNumber
+		node.number = func(env *ruleEnv) float64 { return env.back(series, offset) }
+		return node, nil
+	}
+
+	if _, ok := p.accept("("); ok {
+		function, exists := ruleFunctions[name.text]
+		if !exists {
+			return node, p.errorAt(name, fmt.Sprintf("%q is not a function", name.text))
+		}
+		period, err := p.parseInteger(1, SCREENING_WINDOW-2)
+		if err != nil {
+			return node, err
+		}
+		if err := p.expect(")"); err != nil {
+			return node, err
+		}
+		node.typ = ruleNumber
+		node.number = func(env *ruleEnv) float64 { return function(env, period) }
+		return node, nil
+	}
+	if _, exists := ruleFunctions[name.text]; exists && ruleNumbers[name.text] == nil {
+		return node, p.errorAt(name, fmt.Sprintf("%s needs a period, e.g. %s(14)", name.text, name.text))
+	}
+
+	if value, exists := ruleBooleans[name.text]; exists {
+		node.typ = ruleBool
+		node.boolean = func(env *ruleEnv) bool { return value(env.parameters) }
+		return node, nil
+	}
+	if value, exists := ruleNumbers[name.text]; exists {
+		node.typ = ruleNumber
+		node.number = value
+		return node, nil
+	}
+	for _, pattern := range patterns.All {
+		if pattern.Name == name.text {
+			node.typ = ruleNumber
+			node.number = func(env *ruleEnv) float64 { return patternConfidence(env.parameters.Patterns, pattern.Name) }
+			return node, nil
+		}
+	}
+	return node, p.errorAt(name, fmt.Sprintf("unknown name %q", name.text))
+}
+
+// parseInteger reads a whole number literal between min and max, as used by
+// lookbacks and periods.
+func (p *ruleParser) parseInteger(min, max int) (int, error) {
+	token := p.next()
+	value, err := strconv.Atoi(token.text)
+	if token.kind != ruleTokenNumber || err != nil {
+		return 0, p.errorAt(token, fmt.Sprintf("expected a whole number, got %s", token))
+	}
+	if value < min || value > max {
+		return 0, p.errorAt(token, fmt.Sprintf("%d is out of range, must be between %d and %d", value, min, max))
+	}
+	return value, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dzakyputra/binance/indicators"
+	"github.com/dzakyputra/binance/patterns"
+)
+
+// ruleTestEnv has three candles closing at 9, 10 and 11 with volumes 100,
+// 50 and 300, an uptrend and a hammer of confidence 0.8.
+func ruleTestEnv() *ruleEnv {
+	bars := []indicators.Bar{
+		{Open: 9.5, High: 9.6, Low: 8.8, Close: 9, Volume: 100},
+		{Open: 9, High: 10.2, Low: 8.9, Close: 10, Volume: 50},
+		{Open: 10, High: 11.5, Low: 9.9, Close: 11, Volume: 300},
+	}
+	parameters := Parameters{
+		IsUpperTrend:  true,
+		MovingAverage: 10,
+		Patterns:      []patterns.Match{{Name: "hammer", Confidence: 0.8}},
+	}
+	return newRuleEnv(bars, parameters)
+}
+
+func TestRuleMatches(t *testing.T) {
+	tests := []struct {
+		rule string
+		want bool
+	}{
+		{"true or false and false", true},
+		{"(true or false) and false", false},
+		{"not false and false", false},
+		{"not (false and false)", true},
+		{"! uptrend || engulfing", false},
+		{"not not uptrend", true},
+		{"1 + 2 * 3 == 7", true},
+		{"(1 + 2) * 3 == 9", true},
+		{"10 - 4 - 3 == 3", true},
+		{"12 / 3 / 2 == 2", true},
+		{"-close < -10", true},
+		{"close > close[1] and close[1] > close[2]", true},
+		{"close[2] == 9 and open[1] == 9 and high == 11.5 and low[2] == 8.8", true},
+		{"volume > volume[1] * 2", true},
+		{"close >= ma * 1.1", true},
+		{"uptrend == true", true},
+		{"engulfing != false", false},
+		{"hammer > 0.5 and doji == 0", true},
+		// Three candles back is past the window: NaN, which no comparison
+		// matches, so only its negation is true.
+		{"close[3] > 0", false},
+		{"close[3] <= 0", false},
+		{"close[3] == close[3]", false},
+		{"not close[3] > 0", true},
+		{"close / 0 > 0 or close > 0", true},
+		{"close > 10 # comments run to the end of the line", true},
+		{"UPTREND AND Close > 10", true},
+	}
+
+	env := ruleTestEnv()
+	for _, test := range tests {
+		t.Run(test.rule, func(t *testing.T) {
+			rule, err := compileRule(test.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rule.Matches(env); got != test.want {
+				t.Errorf("Matches = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCompileRuleErrors(t *testing.T) {
+	tests := []struct {
+		rule string
+		want string
+	}{
+		{"", "line 1, column 1: rule is empty"},
+		{"# only a comment", "line 1, column 17: rule is empty"},
+		{"close", "line 1, column 1: rule must be true/false, got a number"},
+		{"close + 1", "line 1, column 1: rule must be true/false, got a number"},
+		{"uptrend and 1", "line 1, column 13: and needs a true/false operand, got a number"},
+		{"close or uptrend", "line 1, column 1: or needs a true/false operand, got a number"},
+		{"not close", "line 1, column 5: not needs a true/false operand, got a number"},
+		{"uptrend + 1 > 0", "line 1, column 1: + needs a number operand, got a true/false"},
+		{"close > uptrend", "line 1, column 9: > needs a number operand, got a true/false"},
+		{"-uptrend", "line 1, column 2: - needs a number operand, got a true/false"},
+		{"close == uptrend", "line 1, column 7: == compares a number with a true/false"},
+		{"1 < close < 2", "line 1, column 11: comparisons cannot be chained, join them with and"},
+		{"closed > 1", `line 1, column 1: unknown name "closed"`},
+		{"uptrend and hamer > 0", `line 1, column 13: unknown name "hamer"`},
+		{"foo(3) > 1", `line 1, column 1: "foo" is not a function`},
+		{"close(3) > 1", `line 1, column 6: unexpected "("`},
+		{"ema > 1", "line 1, column 1: ema needs a period, e.g. ema(14)"},
+		{"ema(0) > 1", "line 1, column 5: 0 is out of range, must be between 1 and 298"},
+		{"ema(1.5) > 1", `line 1, column 5: expected a whole number, got "1.5"`},
+		{"close[300] > 1", "line 1, column 7: 300 is out of range, must be between 0 and 299"},
+		{"close[1 > 1", `line 1, column 9: expected "]", got ">"`},
+		{"(uptrend", `line 1, column 9: expected ")", got end of rule`},
+		{"close > ", "line 1, column 9: expected a value, got end of rule"},
+		{"close > 1.2.3", `line 1, column 9: "1.2.3" is not a number`},
+		{"close > 1 ; uptrend", `line 1, column 11: unexpected character ';'`},
+		{"uptrend uptrend", `line 1, column 9: unexpected "uptrend"`},
+		{"uptrend and\n  close > ma(20) and\n  volum > 0", `line 3, column 3: unknown name "volum"`},
+		{"uptrend  # rising\n\tand close >\n\t\tand", `line 3, column 3: expected a value, got "and"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.rule, func(t *testing.T) {
+			_, err := compileRule(test.rule)
+			if err == nil || err.Error() != test.want {
+				t.Errorf("error = %v, want %s", err, test.want)
+			}
+		})
+	}
+}
+
+func TestConfigRuleErrorLines(t *testing.T) {
+	content := `
+strategies:
+  - name: block
+    kind: rules
+    buy: |
+      uptrend and
+      close > ma(20) and
+      volum > 0
+  - name: plain
+    kind: rules
+    buy: uptrend
+    sell: close > > 1
+`
+	_, err := loadTestConfig(t, content, nil, false)
+	if err == nil {
+		t.Fatal("loadConfig accepted invalid rules")
+	}
+
+	for _, want := range []string{
+		`strategies[0].buy (starting on config line 6): line 3, column 1: unknown name "volum"`,
+		`strategies[1].sell (starting on config line 12): line 1, column 9: expected a value, got ">"`,
+	} {
+		if !strings.Contains(err.Error(), "\n  - "+want) {
+			t.Errorf("error does not list %q:\n%v", want, err)
+		}
+	}
+}
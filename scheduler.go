@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+)
+
+// schedulerJob is a job run by the scheduler and by its endpoint. running
+// keeps a second run from starting while one is going, whoever started it.
+type schedulerJob struct {
+	name    string
+	run     func(exchange Exchange, store Store)
+	running sync.Mutex
+}
+
+var (
+	screeningJob   = &schedulerJob{name: JOB_SCREENING, run: runScreening}
+	orderStatusJob = &schedulerJob{name: JOB_ORDER_STATUS, run: runOrderStatus}
+	stopLossJob    = &schedulerJob{name: JOB_STOP_LOSS, run: runStopLoss}
+)
+
+func (j *schedulerJob) settings() JobConfig {
+	switch j.name {
+	case JOB_SCREENING:
+		return config.Scheduler.Screening
+	case JOB_ORDER_STATUS:
+		return config.Scheduler.OrderStatus
+	default:
+		return config.Scheduler.StopLoss
+	}
+}
+
+// tryRun runs the job unless a run of it is going, and reports whether it
+// ran. The run's exchange requests and store reads stop at the job's
+// timeout, see jobExchange and Store.WithContext.
+func (j *schedulerJob) tryRun(trigger string) bool {
+	if !j.running.TryLock() {
+		fmt.Println("[SCHEDULER]", j.name, "is still running, the", trigger, "run is skipped")
+		return false
+	}
+	defer j.running.Unlock()
+	defer recoverPanic(j.name)
+
+	timeout := time.Duration(j.settings().TimeoutSeconds) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Initialization
+	var wgInit sync.WaitGroup
+	var exchange Exchange
+	var store Store
+
+	wgInit.Add(1)
+	go func() {
+		defer wgInit.Done()
+		defer recoverPanic(j.name)
+
+		exchange = initExchange()
+	}()
+
+	wgInit.Add(1)
+	go func() {
+		defer wgInit.Done()
+		defer recoverPanic(j.name)
+
+		store = initStore()
+	}()
+	wgInit.Wait()
+
+	start := time.Now()
+	fmt.Println("[SCHEDULER]", j.name, "started by", trigger)
+	j.run(&jobExchange{Exchange: exchange, ctx: ctx}, store.WithContext(ctx))
+
+	if ctx.Err() == context.DeadlineExceeded {
+		message := fmt.Sprintf("%s timed out after %s and was cut short", j.name, timeout)
+		fmt.Println("[SCHEDULER]", message)
+		sendTelegramNotice("SCHEDULER", message)
+	}
+	fmt.Println("[SCHEDULER]", j.name, "finished in", time.Since(start).Round(time.Millisecond))
+	return true
+}
+
+// recoverPanic keeps a panic in a job from taking the server down with it.
+// A recover only catches the panics of its own goroutine, so it is deferred
+// in the job and in every goroutine the job starts.
+func recoverPanic(where string) {
+	if r := recover(); r != nil {
+		fmt.Println("[PANIC]", where+":", r)
+	}
+}
+
+// startScheduler runs every job that has a schedule in its own goroutine
+// until stop is closed.
+func startScheduler(stop <-chan struct{}) {
+	for _, job := range []*schedulerJob{screeningJob, orderStatusJob, stopLossJob} {
+		settings := job.settings()
+		if settings.Schedule == "" {
+			continue
+		}
+		schedule, err := parseCron(settings.Schedule)
+		if err != nil {
+			fmt.Println("[ERROR]", err)
+			continue
+		}
+		fmt.Println("[SCHEDULER]", job.name, "runs at", settings.Schedule)
+		go job.loop(schedule, settings, stop)
+	}
+}
+
+// loop waits for each scheduled time plus the delay and jitter and runs the
+// job. A run only ever starts once the previous one returned, so every
+// scheduled time that passed in the meantime is due at once, see catchUp.
+func (j *schedulerJob) loop(schedule cronSchedule, settings JobConfig, stop <-chan struct{}) {
+	delay := time.Duration(settings.DelaySeconds) * time.Second
+	jitter := time.Duration(settings.JitterSeconds) * time.Second
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	next := firstRun(schedule, delay, time.Now())
+	for !next.IsZero() {
+		offset := delay
+		if jitter > 0 {
+			offset += time.Duration(rng.Int63n(int64(jitter) + 1))
+		}
+		timer := time.NewTimer(time.Until(next.Add(offset)))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		latest, missed, late, run := catchUp(schedule, settings, next, time.Now())
+		switch {
+		case missed > 0 && settings.Missed == SCHEDULER_MISSED_RUN_ONCE:
+			fmt.Println("[SCHEDULER]", j.name, "missed", missed, "runs, running once for them")
+		case late:
+			fmt.Println("[SCHEDULER]", j.name, "missed", missed, "runs, skipping to the next")
+		case missed > 0:
+			fmt.Println("[SCHEDULER]", j.name, "missed", missed, "runs")
+		}
+		if run {
+			j.tryRun("schedule")
+		}
+
+		next = schedule.Next(latest)
+	}
+	fmt.Println("[SCHEDULER]", j.name, "has no more scheduled runs")
+}
+
+// firstRun is the first scheduled time the loop waits for when it starts at
+// now. The current minute still counts when its delay has not passed.
+func firstRun(schedule cronSchedule, delay time.Duration, now time.Time) time.Time {
+	next := schedule.Next(now.Add(-delay - time.Minute))
+	if !next.IsZero() && next.Add(delay).Before(now) {
+		next = schedule.Next(next)
+	}
+	return next
+}
+
+// catchUp looks at the scheduled times from next up to now. The latest of
+// them runs when it is still on time, within the jitter and
+// SCHEDULER_GRACE_SECONDS, and the others are missed. A latest one that is
+// late too is missed, and run anyway with "run_once".
+func catchUp(schedule cronSchedule, settings JobConfig, next, now time.Time) (latest time.Time, missed int, late, run bool) {
+	delay := time.Duration(settings.DelaySeconds) * time.Second
+	grace := time.Duration(settings.JitterSeconds)*time.Second + SCHEDULER_GRACE_SECONDS*time.Second
+
+	latest = next
+	for t := schedule.Next(latest); !t.IsZero() && !t.Add(delay).After(now); t = schedule.Next(t) {
+		latest = t
+		missed++
+	}
+	late = now.Sub(latest.Add(delay)) > grace
+	if late {
+		missed++
+	}
+	return latest, missed, late, !late || settings.Missed == SCHEDULER_MISSED_RUN_ONCE
+}
+
+// jobExchange makes the requests of a job under the job's context, so they
+// fail once it timed out. Sells, OCO exits and cancels keep the caller's
+// context: a job past its timeout can still place the exit of a buy that
+// filled or finish a stop loss it started.
+type jobExchange struct {
+	Exchange
+	ctx context.Context
+}
+
+func (e *jobExchange) GetKlines(ctx context.Context, symbol string, interval string, limit int) ([]*binance.Kline, error) {
+	return e.Exchange.GetKlines(e.ctx, symbol, interval, limit)
+}
+
+func (e *jobExchange) GetKlinesFrom(ctx context.Context, symbol string, interval string, startTime int64, limit int) ([]*binance.Kline, error) {
+	return e.Exchange.GetKlinesFrom(e.ctx, symbol, interval, startTime, limit)
+}
+
+func (e *jobExchange) GetExchangeInfo(ctx context.Context) (*binance.ExchangeInfo, error) {
+	return e.Exchange.GetExchangeInfo(e.ctx)
+}
+
+func (e *jobExchange) GetUserAssets(ctx context.Context) ([]binance.UserAssetRecord, error) {
+	return e.Exchange.GetUserAssets(e.ctx)
+}
+
+func (e *jobExchange) GetOrder(ctx context.Context, symbol string, clientOrderID string) (*binance.Order, error) {
+	return e.Exchange.GetOrder(e.ctx, symbol, clientOrderID)
+}
+
+func (e *jobExchange) CreateOrder(ctx context.Context, order OrderRequest) (*binance.CreateOrderResponse, error) {
+	if order.Side == binance.SideTypeBuy {
+		ctx = e.ctx
+	}
+	return e.Exchange.CreateOrder(ctx, order)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFirstRun(t *testing.T) {
+	schedule, err := parseCron("*/15 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(minute, second int) time.Time {
+		return time.Date(2024, 1, 1, 10, minute, second, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{"before the delay passed", at(15, 3), at(15, 0)},
+		{"after the delay passed", at(15, 6), at(30, 0)},
+		{"between two times", at(16, 0), at(30, 0)},
+		{"just before a time", at(14, 59), at(15, 0)},
+	}
+	for _, test := range tests {
+		if got := firstRun(schedule, 5*time.Second, test.now); !got.Equal(test.want) {
+			t.Errorf("%s: firstRun = %s, want %s", test.name, got.Format("15:04:05"), test.want.Format("15:04:05"))
+		}
+	}
+}
+
+func TestCatchUp(t *testing.T) {
+	schedule, err := parseCron("*/15 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(hour, minute, second int) time.Time {
+		return time.Date(2024, 1, 1, hour, minute, second, 0, time.UTC)
+	}
+
+	// A delay of 5 seconds and a jitter of 10 give a grace of 40 seconds.
+	tests := []struct {
+		name   string
+		missed string
+		next   time.Time
+		now    time.Time
+
+		latest     time.Time
+		wantMissed int
+		late, run  bool
+	}{
+		{"on time", SCHEDULER_MISSED_SKIP, at(10, 15, 0), at(10, 15, 12), at(10, 15, 0), 0, false, true},
+		{"within the grace", SCHEDULER_MISSED_SKIP, at(10, 15, 0), at(10, 15, 45), at(10, 15, 0), 0, false, true},
+		{"past the grace, skip", SCHEDULER_MISSED_SKIP, at(10, 15, 0), at(10, 15, 46), at(10, 15, 0), 1, true, false},
+		{"past the grace, run once", SCHEDULER_MISSED_RUN_ONCE, at(10, 15, 0), at(10, 15, 46), at(10, 15, 0), 1, true, true},
+		// The previous run returned at 10:45:20: the 10:30 run was missed,
+		// the 10:45 one is still on time.
+		{"long run, latest on time", SCHEDULER_MISSED_SKIP, at(10, 30, 0), at(10, 45, 20), at(10, 45, 0), 1, false, true},
+		// It returned at 10:52: 10:30 and 10:45 were both missed.
+		{"long run, skip", SCHEDULER_MISSED_SKIP, at(10, 30, 0), at(10, 52, 0), at(10, 45, 0), 2, true, false},
+		{"long run, run once", SCHEDULER_MISSED_RUN_ONCE, at(10, 30, 0), at(10, 52, 0), at(10, 45, 0), 2, true, true},
+		{"across midnight", SCHEDULER_MISSED_SKIP, at(23, 45, 0), time.Date(2024, 1, 2, 0, 30, 10, 0, time.UTC), time.Date(2024, 1, 2, 0, 30, 0, 0, time.UTC), 3, false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			settings := JobConfig{DelaySeconds: 5, JitterSeconds: 10, Missed: test.missed}
+			latest, missed, late, run := catchUp(schedule, settings, test.next, test.now)
+			if !latest.Equal(test.latest) || missed != test.wantMissed || late != test.late || run != test.run {
+				t.Errorf("catchUp = %s, missed %d, late %v, run %v; want %s, missed %d, late %v, run %v",
+					latest.Format("15:04:05"), missed, late, run, test.latest.Format("15:04:05"), test.wantMissed, test.late, test.run)
+			}
+		})
+	}
+}
+
+func TestTryRunRefusesToOverlap(t *testing.T) {
+	useFlowConfig(t, EXIT_MODE_BRACKET)
+	config.Storage = StorageConfig{Driver: STORAGE_SQLITE, SQLitePath: filepath.Join(t.TempDir(), "bot.db")}
+
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	job := &schedulerJob{name: JOB_SCREENING, run: func(exchange Exchange, store Store) {
+		started <- struct{}{}
+		<-release
+	}}
+
+	// Flatten holds the lock to keep the jobs from starting.
+	job.running.Lock()
+	if job.tryRun("locked") {
+		t.Error("a run started while the job was locked")
+	}
+	job.running.Unlock()
+
+	first := make(chan bool)
+	go func() { first <- job.tryRun("first") }()
+	<-started
+
+	if job.tryRun("second") {
+		t.Error("a second run started while the first was going")
+	}
+	close(release)
+	if !<-first {
+		t.Error("the first run did not report that it ran")
+	}
+	if !job.tryRun("third") {
+		t.Error("a run after the first one returned did not start")
+	}
+	if len(started) != 1 {
+		t.Errorf("the job ran %d more times, want the third run only", len(started))
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/adshao/go-binance/v2"
+)
+
+// SizingAccount is what the sizer knows of the account while a run buys.
+// Free is the free quote balance the run started with and Spent what its
+// buys took since; Exposure is the quote in open trades at cost, in total
+// and per pair, and Positions how many positions they make. History holds
+// the returns of the strategy's closed trades, oldest first, for the Kelly
+// mode.
+type SizingAccount struct {
+	Free           float64
+	Spent          float64
+	Exposure       float64
+	SymbolExposure map[string]float64
+	Positions      int
+	History        []float64
+}
+
+// newSizingAccount starts an account from the open trades, valued at cost.
+// The legs of a ladder count as one position.
+func newSizingAccount(openTrades []TradingDetails) SizingAccount {
+	account := SizingAccount{SymbolExposure: make(map[string]float64)}
+	account.Positions = len(positionEntries(openTrades))
+	for _, trade := range openTrades {
+		quantity, err := strconv.ParseFloat(trade.Quantity, 64)
+		if err != nil {
+			continue
+		}
+		account.Exposure += quantity * trade.BuyPrice
+		account.SymbolExposure[trade.Pair] += quantity * trade.BuyPrice
+	}
+	return account
+}
+
+// Equity is the free balance plus the open trades at cost.
+func (a SizingAccount) Equity() float64 {
+	return a.Free - a.Spent + a.Exposure
+}
+
+// Add records a buy of quote in symbol.
+func (a *SizingAccount) Add(symbol string, quote float64) {
+	if a.SymbolExposure == nil {
+		a.SymbolExposure = make(map[string]float64)
+	}
+	a.Spent += quote
+	a.Exposure += quote
+	a.SymbolExposure[symbol] += quote
+	a.Positions++
+}
+
+// SizingEntry is the buy being sized. Slots is how many pairs the run buys
+// at most and ATR the symbol's ATR of the sizing period, 0 when unknown.
+type SizingEntry struct {
+	Symbol string
+	Price  float64
+	ATR    float64
+	Slots  int
+}
+
+// Sizer decides how much quote a buy spends, before the caps every mode
+// shares.
+type Sizer interface {
+	Quote(account SizingAccount, entry SizingEntry) (float64, error)
+}
+
+// sizerFunc lets a plain function be a Sizer.
+type sizerFunc func(account SizingAccount, entry SizingEntry) (float64, error)
+
+func (f sizerFunc) Quote(account SizingAccount, entry SizingEntry) (float64, error) {
+	return f(account, entry)
+}
+
+type sizerFactory func(trading TradingConfig) Sizer
+
+// sizingModes are the sizers a SizingConfig can name as its mode.
+var sizingModes = map[string]sizerFactory{
+	SIZING_DIVIDER:        newDividerSizer,
+	SIZING_FIXED:          newFixedSizer,
+	SIZING_EQUITY_PERCENT: newEquityPercentSizer,
+	SIZING_RISK:           newRiskSizer,
+	SIZING_ATR:            newATRSizer,
+	SIZING_KELLY:          newKellySizer,
+}
+
+// sizingModeNames lists the modes for error messages, sorted.
+func sizingModeNames() []string {
+	names := make([]string, 0, len(sizingModes))
+	for name := range sizingModes {
+		names = append(names, strconv.Quote(name))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newSizer builds the sizer of the trading settings' sizing mode.
+func newSizer(trading TradingConfig) (Sizer, error) {
+	factory, exists := sizingModes[trading.Sizing.Mode]
+	if !exists {
+		return nil, fmt.Errorf("unknown sizing mode %q", trading.Sizing.Mode)
+	}
+	return factory(trading), nil
+}
+
+// newDividerSizer splits the free balance above the minimum over the
+// run's slots and buys max_quote_per_trade, but only when the split is
+// above it.
+func newDividerSizer(trading TradingConfig) Sizer {
+	return sizerFunc(func(account SizingAccount, entry SizingEntry) (float64, error) {
+		if entry.Slots <= 0 {
+			return 0, errors.New("no slots to divide the balance over")
+		}
+		split := (account.Free - trading.MinimumBalance) / float64(entry.Slots)
+		if split <= trading.MaxQuotePerTrade {
+			return 0, fmt.Errorf("balance per trade %.2f is not above max_quote_per_trade %v", split, trading.MaxQuotePerTrade)
+		}
+		return trading.MaxQuotePerTrade, nil
+	})
+}
+
+func newFixedSizer(trading TradingConfig) Sizer {
+	return sizerFunc(func(account SizingAccount, entry SizingEntry) (float64, error) {
+		return trading.Sizing.FixedQuote, nil
+	})
+}
+
+func newEquityPercentSizer(trading TradingConfig) Sizer {
+	return sizerFunc(func(account SizingAccount, entry SizingEntry) (float64, error) {
+		return account.Equity() * trading.Sizing.EquityPercent / 100, nil
+	})
+}
+
+// newRiskSizer buys what loses risk_percent of the equity when the stop
+// loss hits.
+func newRiskSizer(trading TradingConfig) Sizer {
+	return sizerFunc(func(account SizingAccount, entry SizingEntry) (float64, error) {
+		return account.Equity() * trading.Sizing.RiskPercent / trading.StopLossPercent, nil
+	})
+}
+
+// newATRSizer buys what loses risk_percent of the equity when the price
+// falls atr_multiple ATRs, so volatile pairs get smaller buys.
+func newATRSizer(trading TradingConfig) Sizer {
+	return sizerFunc(func(account SizingAccount, entry SizingEntry) (float64, error) {
+		if entry.ATR <= 0 || entry.Price <= 0 {
+			return 0, fmt.Errorf("no ATR(%d) for %s", trading.Sizing.ATRPeriod, entry.Symbol)
+		}
+		distance := trading.Sizing.ATRMultiple * entry.ATR / entry.Price
+		return account.Equity() * trading.Sizing.RiskPercent / 100 / distance, nil
+	})
+}
+
+// newKellySizer buys kelly_fraction of the Kelly fraction of the equity,
+// W - (1-W)/R for the win rate W and the ratio R of the average win to the
+// average loss of the closed trades. Until kelly_min_trades trades closed
+// it sizes like equity_percent.
+func newKellySizer(trading TradingConfig) Sizer {
+	fallback := newEquityPercentSizer(trading)
+	return sizerFunc(func(account SizingAccount, entry SizingEntry) (float64, error) {
+		if len(account.History) < trading.Sizing.KellyMinTrades {
+			return fallback.Quote(account, entry)
+		}
+		kelly := kellyFraction(account.History)
+		if kelly <= 0 {
+			return 0, fmt.Errorf("no edge over %d closed trades, Kelly fraction %.4f", len(account.History), kelly)
+		}
+		return account.Equity() * trading.Sizing.KellyFraction * kelly, nil
+	})
+}
+
+// kellyFraction is the Kelly fraction of a history of trade returns,
+// between 1 for no losses and below 0 for a losing edge.
+func kellyFraction(returns []float64) float64 {
+	var wins, losses int
+	var won, lost float64
+	for _, r := range returns {
+		if r > 0 {
+			wins++
+			won += r
+		} else if r < 0 {
+			losses++
+			lost -= r
+		}
+	}
+	if wins == 0 {
+		return -1
+	}
+	if losses == 0 {
+		return 1
+	}
+	winRate := float64(wins) / float64(wins+losses)
+	payoff := (won / float64(wins)) / (lost / float64(losses))
+	return math.Min(1, winRate-(1-winRate)/payoff)
+}
+
+// sizePosition sizes a buy with the sizer and caps it by
+// max_quote_per_trade, the free balance above minimum_balance, the
+// exposure left under max_exposure_percent and the pair's cap. It fails
+// when nothing is left to buy.
+func sizePosition(sizer Sizer, trading TradingConfig, account SizingAccount, entry SizingEntry) (float64, error) {
+	quote, err := sizer.Quote(account, entry)
+	if err != nil {
+		return 0, err
+	}
+
+	sizing := trading.Sizing
+	equity := account.Equity()
+	limit := func(cap float64, name string) error {
+		if quote > cap {
+			quote = cap
+		}
+		if quote <= 0 {
+			return fmt.Errorf("%s leaves nothing to buy", name)
+		}
+		return nil
+	}
+
+	if err := limit(trading.MaxQuotePerTrade, "max_quote_per_trade"); err != nil {
+		return 0, err
+	}
+	if err := limit(account.Free-account.Spent-trading.MinimumBalance, "minimum_balance"); err != nil {
+		return 0, err
+	}
+	if sizing.MaxExposurePercent > 0 {
+		if err := limit(equity*sizing.MaxExposurePercent/100-account.Exposure, "max_exposure_percent"); err != nil {
+			return 0, err
+		}
+	}
+	symbolCap := math.Inf(1)
+	if sizing.MaxSymbolPercent > 0 {
+		symbolCap = equity * sizing.MaxSymbolPercent / 100
+	}
+	if cap, exists := sizing.SymbolCaps[entry.Symbol]; exists && cap < symbolCap {
+		symbolCap = cap
+	}
+	if !math.IsInf(symbolCap, 1) {
+		if err := limit(symbolCap-account.SymbolExposure[entry.Symbol], entry.Symbol+" cap"); err != nil {
+			return 0, err
+		}
+	}
+	return quote, nil
+}
+
+// latestATR is the symbol's ATR over its closed candles, 0 when they cannot
+// be fetched.
+func latestATR(exchange Exchange, symbol string, period int) float64 {
+	klines, err := getKlines(exchange, symbol, 3*period+1)
+	if err != nil || len(klines) < 2 {
+		return 0
+	}
+	candles, err := candlesFromKlines(symbol, klines)
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return 0
+	}
+	return candlesATR(candles[:len(candles)-1], period)
+}
+
+// tradeReturns are the returns of the strategy's filled trades, oldest
+// first. Every leg of a ladder counts as a trade.
+func tradeReturns(trades []TradingDetails, strategy string) []float64 {
+	returns := []float64{}
+	for _, trade := range trades {
+		if tradeStrategy(trade) != strategy || trade.Status != string(binance.OrderStatusTypeFilled) || trade.BuyPrice <= 0 {
+			continue
+		}
+		quantity, err := strconv.ParseFloat(trade.Quantity, 64)
+		if err != nil || quantity <= 0 {
+			continue
+		}
+		returns = append(returns, legPnL(trade)/(quantity*trade.BuyPrice))
+	}
+	return returns
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestKellyFraction(t *testing.T) {
+	tests := []struct {
+		name    string
+		returns []float64
+		want    float64
+	}{
+		{"no trades", nil, -1},
+		{"no wins", []float64{-0.1, -0.05}, -1},
+		{"only break-even", []float64{0, 0}, -1},
+		{"no losses", []float64{0.1, 0.2}, 1},
+		{"half wins paying twice the losses", []float64{0.1, -0.05}, 0.25},
+		{"break-even trades are left out", []float64{0.1, 0, -0.05, 0}, 0.25},
+		{"three wins to a loss of the same size", []float64{0.02, 0.02, -0.02, 0.02}, 0.5},
+		{"a losing edge", []float64{0.01, -0.02, -0.02}, -1},
+		{"a small edge", []float64{0.03, -0.02, 0.01, -0.01}, 0.5 - 0.5/(0.02/0.015)},
+	}
+	for _, test := range tests {
+		if got := kellyFraction(test.returns); math.Abs(got-test.want) > 1e-12 {
+			t.Errorf("%s: kellyFraction = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// sizingAccount has 1000 USDT free, 100 of them spent by the run and 300 in
+// open trades: an equity of 1200.
+func sizingAccount() SizingAccount {
+	return SizingAccount{Free: 1000, Spent: 100, Exposure: 300, SymbolExposure: map[string]float64{"AAAUSDT": 300}, Positions: 2}
+}
+
+func TestSizerModes(t *testing.T) {
+	tests := []struct {
+		name    string
+		trading func(trading *TradingConfig)
+		account func(account *SizingAccount)
+		entry   SizingEntry
+		want    float64
+		err     string
+	}{
+		{
+			name: "divider",
+			trading: func(trading *TradingConfig) {
+				trading.Sizing.Mode, trading.MaxQuotePerTrade, trading.MinimumBalance = SIZING_DIVIDER, 50, 100
+			},
+			entry: SizingEntry{Slots: 4},
+			want:  50,
+		},
+		{
+			name: "divider with the split at max_quote_per_trade",
+			trading: func(trading *TradingConfig) {
+				trading.Sizing.Mode, trading.MaxQuotePerTrade, trading.MinimumBalance = SIZING_DIVIDER, 225, 100
+			},
+			entry: SizingEntry{Slots: 4},
+			err:   "balance per trade 225.00 is not above max_quote_per_trade 225",
+		},
+		{
+			name:    "divider without slots",
+			trading: func(trading *TradingConfig) { trading.Sizing.Mode = SIZING_DIVIDER },
+			err:     "no slots to divide the balance over",
+		},
+		{
+			name:    "fixed",
+			trading: func(trading *TradingConfig) { trading.Sizing.Mode, trading.Sizing.FixedQuote = SIZING_FIXED, 25 },
+			want:    25,
+		},
+		{
+			name: "equity_percent",
+			trading: func(trading *TradingConfig) {
+				trading.Sizing.Mode, trading.Sizing.EquityPercent = SIZING_EQUITY_PERCENT, 10
+			},
+			want: 120,
+		},
+		{
+			// A 2% stop loss on 600 loses 12, 1% of the equity.
+			name: "risk",
+			trading: func(trading *TradingConfig) {
+				trading.Sizing.Mode, trading.Sizing.RiskPercent, trading.StopLossPercent = SIZING_RISK, 1, 2
+			},
+			want: 600,
+		},
+		{
+			// Two ATRs of 0.5 are 10% of the price: 120 loses 12 there.
+			name: "atr",
+			trading: func(trading *TradingConfig) {
+				trading.Sizing.Mode, trading.Sizing.RiskPercent, trading.Sizing.ATRMultiple = SIZING_ATR, 1, 2
+			},
+			entry: SizingEntry{Symbol: "AAAUSDT", Price: 10, ATR: 0.5},
+			want:  120,
+		},
+		{
+			name: "atr without an ATR",
+			trading: func(trading *TradingConfig) {
+				trading.Sizing.Mode, trading.Sizing.RiskPercent, trading.Sizing.ATRMultiple, trading.Sizing.ATRPeriod = SIZING_ATR, 1, 2, 14
+			},
+			entry: SizingEntry{Symbol: "AAAUSDT", Price: 10},
+			err:   "no ATR(14) for AAAUSDT",
+		},
+		{
+			name: "kelly",
+			trading: func(trading *TradingConfig) {
+				trading.Sizing.Mode, trading.Sizing.KellyFraction, trading.Sizing.KellyMinTrades = SIZING_KELLY, 0.5, 2
+			},
+			account: func(account *SizingAccount) { account.History = []float64{0.1, -0.05} },
+			want:    150,
+		},
+		{
+			name: "kelly before kelly_min_trades",
+			trading: func(trading *TradingConfig) {
+				trading.Sizing.Mode, trading.Sizing.KellyMinTrades, trading.Sizing.EquityPercent = SIZING_KELLY, 3, 10
+			},
+			account: func(account *SizingAccount) { account.History = []float64{0.1, -0.05} },
+			want:    120,
+		},
+		{
+			name: "kelly without an edge",
+			trading: func(trading *TradingConfig) {
+				trading.Sizing.Mode, trading.Sizing.KellyFraction, trading.Sizing.KellyMinTrades = SIZING_KELLY, 0.5, 2
+			},
+			account: func(account *SizingAccount) { account.History = []float64{-0.1, 0.01} },
+			err:     "no edge over 2 closed trades",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			trading := TradingConfig{}
+			test.trading(&trading)
+			account := sizingAccount()
+			if test.account != nil {
+				test.account(&account)
+			}
+
+			sizer, err := newSizer(trading)
+			if err != nil {
+				t.Fatal(err)
+			}
+			quote, err := sizer.Quote(account, test.entry)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error = %v, want %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(quote-test.want) > 1e-9 {
+				t.Errorf("quote = %v, want %v", quote, test.want)
+			}
+		})
+	}
+
+	if _, err := newSizer(TradingConfig{Sizing: SizingConfig{Mode: "martingale"}}); err == nil {
+		t.Error("newSizer accepted an unknown mode")
+	}
+}
+
+func TestSizePositionCaps(t *testing.T) {
+	tests := []struct {
+		name    string
+		trading func(trading *TradingConfig)
+		account func(account *SizingAccount)
+		want    float64
+		err     string
+	}{
+		{
+			name: "uncapped",
+			want: 100,
+		},
+		{
+			name:    "max_quote_per_trade",
+			trading: func(trading *TradingConfig) { trading.MaxQuotePerTrade = 40 },
+			want:    40,
+		},
+		{
+			name:    "max_quote_per_trade of 0",
+			trading: func(trading *TradingConfig) { trading.MaxQuotePerTrade = 0 },
+			err:     "max_quote_per_trade leaves nothing to buy",
+		},
+		{
+			name:    "minimum_balance",
+			trading: func(trading *TradingConfig) { trading.MinimumBalance = 50 },
+			account: func(account *SizingAccount) { account.Spent = 900 },
+			want:    50,
+		},
+		{
+			name:    "minimum_balance reached",
+			trading: func(trading *TradingConfig) { trading.MinimumBalance = 50 },
+			account: func(account *SizingAccount) { account.Spent = 950 },
+			err:     "minimum_balance leaves nothing to buy",
+		},
+		{
+			// 38% of an equity of 1500 is 570, 70 above the exposure.
+			name:    "max_exposure_percent",
+			trading: func(trading *TradingConfig) { trading.Sizing.MaxExposurePercent = 38 },
+			account: func(account *SizingAccount) { account.Exposure = 500 },
+			want:    70,
+		},
+		{
+			name:    "max_exposure_percent reached",
+			trading: func(trading *TradingConfig) { trading.Sizing.MaxExposurePercent = 30 },
+			account: func(account *SizingAccount) { account.Exposure = 500 },
+			err:     "max_exposure_percent leaves nothing to buy",
+		},
+		{
+			name:    "max_symbol_percent",
+			trading: func(trading *TradingConfig) { trading.Sizing.MaxSymbolPercent = 5 },
+			account: func(account *SizingAccount) { account.SymbolExposure["AAAUSDT"] = 20 },
+			want:    30,
+		},
+		{
+			name:    "symbol_caps",
+			trading: func(trading *TradingConfig) { trading.Sizing.SymbolCaps = map[string]float64{"AAAUSDT": 60} },
+			account: func(account *SizingAccount) { account.SymbolExposure["AAAUSDT"] = 20 },
+			want:    40,
+		},
+		{
+			name: "the lower of max_symbol_percent and symbol_caps",
+			trading: func(trading *TradingConfig) {
+				trading.Sizing.MaxSymbolPercent, trading.Sizing.SymbolCaps = 5, map[string]float64{"AAAUSDT": 45}
+			},
+			account: func(account *SizingAccount) { account.SymbolExposure["AAAUSDT"] = 20 },
+			want:    25,
+		},
+		{
+			name:    "symbol_caps of another pair",
+			trading: func(trading *TradingConfig) { trading.Sizing.SymbolCaps = map[string]float64{"BBBUSDT": 10} },
+			want:    100,
+		},
+		{
+			name:    "pair at its cap",
+			trading: func(trading *TradingConfig) { trading.Sizing.SymbolCaps = map[string]float64{"AAAUSDT": 20} },
+			account: func(account *SizingAccount) { account.SymbolExposure["AAAUSDT"] = 20 },
+			err:     "AAAUSDT cap leaves nothing to buy",
+		},
+		{
+			name: "every cap, the tightest wins",
+			trading: func(trading *TradingConfig) {
+				trading.MaxQuotePerTrade, trading.MinimumBalance = 90, 920
+				trading.Sizing.MaxExposurePercent, trading.Sizing.SymbolCaps = 50, map[string]float64{"AAAUSDT": 75}
+			},
+			want: 75,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			trading := TradingConfig{MaxQuotePerTrade: 1000, Sizing: SizingConfig{FixedQuote: 100}}
+			if test.trading != nil {
+				test.trading(&trading)
+			}
+			account := SizingAccount{Free: 1000, SymbolExposure: map[string]float64{}}
+			if test.account != nil {
+				test.account(&account)
+			}
+
+			quote, err := sizePosition(newFixedSizer(trading), trading, account, SizingEntry{Symbol: "AAAUSDT", Price: 10, Slots: 1})
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("error = %v, want %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(quote-test.want) > 1e-9 {
+				t.Errorf("quote = %v, want %v", quote, test.want)
+			}
+		})
+	}
+}
+
+func TestSizePositionPassesSizerErrors(t *testing.T) {
+	trading := TradingConfig{MaxQuotePerTrade: 100, Sizing: SizingConfig{Mode: SIZING_DIVIDER}}
+	_, err := sizePosition(newDividerSizer(trading), trading, SizingAccount{Free: 1000}, SizingEntry{Symbol: "AAAUSDT"})
+	if err == nil || err.Error() != "no slots to divide the balance over" {
+		t.Errorf("error = %v, want the sizer's", err)
+	}
+}
+
+func TestNewSizingAccount(t *testing.T) {
+	account := newSizingAccount([]TradingDetails{
+		{Pair: "AAAUSDT", Quantity: "2", BuyPrice: 10, PositionID: "ladder"},
+		{Pair: "AAAUSDT", Quantity: "1", BuyPrice: 10, PositionID: "ladder"},
+		{Pair: "BBBUSDT", Quantity: "0.5", BuyPrice: 40},
+		{Pair: "CCCUSDT", Quantity: "?", BuyPrice: 40},
+	})
+	if account.Exposure != 50 || account.SymbolExposure["AAAUSDT"] != 30 || account.SymbolExposure["BBBUSDT"] != 20 {
+		t.Errorf("exposure = %v %v, want 50 of which AAA 30 and BBB 20", account.Exposure, account.SymbolExposure)
+	}
+	if account.Positions != 3 {
+		t.Errorf("positions = %d, want the ladder once", account.Positions)
+	}
+
+	account.Free = 100
+	account.Add("BBBUSDT", 10)
+	if account.Spent != 10 || account.Exposure != 60 || account.SymbolExposure["BBBUSDT"] != 30 || account.Positions != 4 || account.Equity() != 150 {
+		t.Errorf("account after a buy = %+v", account)
+	}
+}
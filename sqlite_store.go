@@ -0,0 +1,446 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteMigrations are applied in order at startup; the index + 1 is the
+// schema version. Only ever append to this list.
+var sqliteMigrations = []string{
+	`CREATE TABLE trades (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp   TEXT NOT NULL,
+		pair        TEXT NOT NULL,
+		quantity    TEXT NOT NULL,
+		buy_price   REAL NOT NULL,
+		sell_price  TEXT NOT NULL,
+		order_id    TEXT NOT NULL,
+		status      TEXT NOT NULL
+	);
+	CREATE INDEX trades_status ON trades (status);
+
+	CREATE TABLE order_status_history (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		trade_id    INTEGER NOT NULL REFERENCES trades (id),
+		status      TEXT NOT NULL,
+		sell_price  TEXT NOT NULL,
+		recorded_at TEXT NOT NULL
+	);
+	CREATE INDEX order_status_history_trade ON order_status_history (trade_id);
+
+	CREATE TABLE cooldowns (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp   TEXT NOT NULL,
+		pair        TEXT NOT NULL,
+		buy_price   REAL NOT NULL,
+		sell_price  TEXT NOT NULL
+	);
+
+	CREATE TABLE alert_snapshots (
+		id             INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at     TEXT NOT NULL,
+		pairs          TEXT NOT NULL,
+		current_total  TEXT NOT NULL,
+		previous_total TEXT NOT NULL
+	);`,
+	`ALTER TABLE trades ADD COLUMN paper INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE cooldowns ADD COLUMN paper INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE trades ADD COLUMN strategy TEXT NOT NULL DEFAULT 'default';
+	ALTER TABLE cooldowns ADD COLUMN strategy TEXT NOT NULL DEFAULT 'default';
+	ALTER TABLE alert_snapshots ADD COLUMN strategy TEXT NOT NULL DEFAULT 'default';`,
+	`ALTER TABLE trades ADD COLUMN order_list_id INTEGER NOT NULL DEFAULT -1;
+	ALTER TABLE trades ADD COLUMN stop_order_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE trades ADD COLUMN stop_price TEXT NOT NULL DEFAULT '';
+	ALTER TABLE trades ADD COLUMN exit_leg TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE trades ADD COLUMN high_price TEXT NOT NULL DEFAULT '';
+	ALTER TABLE trades ADD COLUMN trail_stop TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE trades ADD COLUMN position_id TEXT NOT NULL DEFAULT '';
+	CREATE INDEX trades_position ON trades (position_id);`,
+	`ALTER TABLE trades ADD COLUMN closed_at TEXT NOT NULL DEFAULT '';
+
+	CREATE TABLE risk_halts (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at TEXT NOT NULL,
+		rule       TEXT NOT NULL,
+		reason     TEXT NOT NULL,
+		since      TEXT NOT NULL,
+		until      TEXT NOT NULL,
+		paper      INTEGER NOT NULL DEFAULT 0
+	);`,
+	`CREATE TABLE trading_switch (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at TEXT NOT NULL,
+		enabled    INTEGER NOT NULL,
+		reason     TEXT NOT NULL,
+		paper      INTEGER NOT NULL DEFAULT 0
+	);`,
+}
+
+// sqliteStore is the Store backed by an embedded SQLite database. It holds
+// what the all_trading, trading_details and data tabs hold in Sheets, plus the
+// history of every status change. Open trades and cooldowns are those of the
+// running mode, live or paper.
+type sqliteStore struct {
+	db *sql.DB
+	// ctx bounds the reads, see Store.WithContext.
+	ctx context.Context
+}
+
+func openSQLiteStore(path string) (*sqliteStore, error) {
+	db, err := openSQLite(path, sqliteMigrations)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteStore{db: db, ctx: context.Background()}, nil
+}
+
+func openSQLite(path string, migrations []string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, err
+	}
+	// Several goroutines write at once; one connection keeps SQLite from
+	// answering them with SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+
+	if err := migrateSQLite(db, migrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// migrateSQLite applies the migrations db has not seen yet, each in its own
+// transaction, recording them in schema_migrations.
+func migrateSQLite(db *sql.DB, migrations []string) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+
+	var version int
+	err = db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %v", i+1, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`, i+1, time.Now().Format("2006-01-02 15:04:05")); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %v", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d: %v", i+1, err)
+		}
+		fmt.Println("[SQLite] Applied migration", i+1)
+	}
+
+	return nil
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *sqliteStore) WithContext(ctx context.Context) Store {
+	return &sqliteStore{db: s.db, ctx: ctx}
+}
+
+func (s *sqliteStore) LoadAlertState(strategy string) (TradingIndormationData, error) {
+	var pairs string
+	state := TradingIndormationData{}
+	err := s.db.QueryRowContext(s.ctx, `SELECT pairs, current_total, previous_total FROM alert_snapshots WHERE strategy = ? ORDER BY id DESC LIMIT 1`, strategy).
+		Scan(&pairs, &state.CurrentTotalAlertCoin, &state.PreviousTotalAlertCoin)
+	if err == sql.ErrNoRows {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+
+	if pairs != "" {
+		state.LastAlertCoin = strings.Split(pairs, ",")
+	}
+	return state, nil
+}
+
+func (s *sqliteStore) SaveAlertState(strategy string, state TradingIndormationData) error {
+	ctx, cancel := storeWriteContext()
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `INSERT INTO alert_snapshots (created_at, pairs, current_total, previous_total, strategy) VALUES (?, ?, ?, ?, ?)`,
+		time.Now().Format("2006-01-02 15:04:05"),
+		strings.Join(state.LastAlertCoin, ","),
+		state.CurrentTotalAlertCoin,
+		state.PreviousTotalAlertCoin,
+		strategy,
+	)
+	return err
+}
+
+func (s *sqliteStore) ListOpenTrades() ([]TradingDetails, error) {
+	return s.queryTrades(`WHERE status IN ('NEW', 'PARTIALLY_FILLED') AND paper = ? ORDER BY id`, config.Paper.Enabled)
+}
+
+func (s *sqliteStore) ListTrades() ([]TradingDetails, error) {
+	return s.queryTrades(`WHERE paper = ? ORDER BY id`, config.Paper.Enabled)
+}
+
+func (s *sqliteStore) ListPositionTrades(positionID string) ([]TradingDetails, error) {
+	return s.queryTrades(`WHERE position_id = ? ORDER BY id`, positionID)
+}
+
+func (s *sqliteStore) queryTrades(clause string, args ...interface{}) ([]TradingDetails, error) {
+	rows, err := s.db.QueryContext(s.ctx, `SELECT id, timestamp, pair, quantity, buy_price, sell_price, order_id, status, paper, strategy, order_list_id, stop_order_id, stop_price, exit_leg, high_price, trail_stop, position_id, closed_at FROM trades `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []TradingDetails{}
+	for rows.Next() {
+		var trade TradingDetails
+		err := rows.Scan(&trade.ID, &trade.Timestamp, &trade.Pair, &trade.Quantity, &trade.BuyPrice, &trade.SellPrice, &trade.OrderID, &trade.Status, &trade.Paper, &trade.Strategy, &trade.OrderListID, &trade.StopOrderID, &trade.StopPrice, &trade.Exit, &trade.HighPrice, &trade.TrailStop, &trade.PositionID, &trade.ClosedAt)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, trade)
+	}
+	return result, rows.Err()
+}
+
+func (s *sqliteStore) AppendTrades(trades []TradingDetails) error {
+	ctx, cancel := storeWriteContext()
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, trade := range trades {
+		if trade.Status == "" {
+			trade.Status = "NEW"
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO trades (timestamp, pair, quantity, buy_price, sell_price, order_id, status, paper, strategy, order_list_id, stop_order_id, stop_price, exit_leg, high_price, trail_stop, position_id, closed_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			trade.Timestamp, trade.Pair, trade.Quantity, trade.BuyPrice, trade.SellPrice, trade.OrderID, trade.Status, trade.Paper, tradeStrategy(trade), tradeOrderListID(trade), trade.StopOrderID, trade.StopPrice, trade.Exit, trade.HighPrice, trade.TrailStop, trade.PositionID, trade.ClosedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UpdateTradeStatus also stamps closed_at the first time the status closes
+// the trade.
+func (s *sqliteStore) UpdateTradeStatus(trade TradingDetails, status string) error {
+	if isClosedStatus(status) && trade.ClosedAt == "" {
+		return s.updateTrade(trade.ID, `UPDATE trades SET status = ?, closed_at = ? WHERE id = ?`, status, time.Now().Format("2006-01-02 15:04:05"))
+	}
+	return s.updateTrade(trade.ID, `UPDATE trades SET status = ? WHERE id = ?`, status)
+}
+
+func (s *sqliteStore) UpdateTradeSellPrice(trade TradingDetails, sellPrice string) error {
+	return s.updateTrade(trade.ID, `UPDATE trades SET sell_price = ? WHERE id = ?`, sellPrice)
+}
+
+func (s *sqliteStore) UpdateTradeExit(trade TradingDetails, exit string) error {
+	return s.updateTrade(trade.ID, `UPDATE trades SET exit_leg = ? WHERE id = ?`, exit)
+}
+
+func (s *sqliteStore) UpdateTradeTrail(trade TradingDetails, highPrice string, trailStop string) error {
+	return s.updateTrade(trade.ID, `UPDATE trades SET high_price = ?, trail_stop = ? WHERE id = ?`, highPrice, trailStop)
+}
+
+// updateTrade applies a change to the trade's columns, binding values and
+// then id, and records the resulting status and sell price in
+// order_status_history.
+func (s *sqliteStore) updateTrade(id int64, query string, values ...interface{}) error {
+	ctx, cancel := storeWriteContext()
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, append(values, id)...)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("trade %d not found", id)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO order_status_history (trade_id, status, sell_price, recorded_at)
+		SELECT id, status, sell_price, ? FROM trades WHERE id = ?`, time.Now().Format("2006-01-02 15:04:05"), id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqliteStore) LoadRiskHalt() (RiskHalt, error) {
+	halt := RiskHalt{}
+	err := s.db.QueryRowContext(s.ctx, `SELECT rule, reason, since, until FROM risk_halts WHERE paper = ? ORDER BY id DESC LIMIT 1`, config.Paper.Enabled).
+		Scan(&halt.Rule, &halt.Reason, &halt.Since, &halt.Until)
+	if err == sql.ErrNoRows {
+		return halt, nil
+	}
+	return halt, err
+}
+
+// SaveRiskHalt appends the halt, so risk_halts keeps every one tripped and
+// lifted.
+func (s *sqliteStore) SaveRiskHalt(halt RiskHalt) error {
+	ctx, cancel := storeWriteContext()
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `INSERT INTO risk_halts (created_at, rule, reason, since, until, paper) VALUES (?, ?, ?, ?, ?, ?)`,
+		time.Now().Format("2006-01-02 15:04:05"), halt.Rule, halt.Reason, halt.Since, halt.Until, config.Paper.Enabled)
+	return err
+}
+
+func (s *sqliteStore) LoadTradingSwitch() (TradingSwitch, error) {
+	trading := TradingSwitch{Enabled: true}
+	err := s.db.QueryRowContext(s.ctx, `SELECT enabled, reason, created_at FROM trading_switch WHERE paper = ? ORDER BY id DESC LIMIT 1`, config.Paper.Enabled).
+		Scan(&trading.Enabled, &trading.Reason, &trading.Since)
+	if err == sql.ErrNoRows {
+		return TradingSwitch{Enabled: true}, nil
+	}
+	return trading, err
+}
+
+// SaveTradingSwitch appends the switch, so trading_switch keeps every pause
+// and resume. Since is when it was saved.
+func (s *sqliteStore) SaveTradingSwitch(trading TradingSwitch) error {
+	ctx, cancel := storeWriteContext()
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `INSERT INTO trading_switch (created_at, enabled, reason, paper) VALUES (?, ?, ?, ?)`,
+		time.Now().Format("2006-01-02 15:04:05"), trading.Enabled, trading.Reason, config.Paper.Enabled)
+	return err
+}
+
+func (s *sqliteStore) LoadCooldowns(strategy string) (map[string]int, error) {
+	blacklistAssets := make(map[string]int)
+
+	cooldowns, err := s.listCooldowns(s.ctx)
+	if err != nil {
+		return blacklistAssets, err
+	}
+
+	for _, cooldown := range cooldowns {
+		if isInCooldown(cooldown.Timestamp) && cooldown.Paper == config.Paper.Enabled && cooldown.Strategy == strategy {
+			blacklistAssets[cooldown.Pair] += 1
+		}
+	}
+	return blacklistAssets, nil
+}
+
+func (s *sqliteStore) RecordCooldown(trades []TradingDetails) error {
+	ctx, cancel := storeWriteContext()
+	defer cancel()
+
+	cooldowns, err := s.listCooldowns(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, cooldown := range cooldowns {
+		if isInCooldown(cooldown.Timestamp) {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM cooldowns WHERE id = ?`, cooldown.ID); err != nil {
+			return err
+		}
+	}
+
+	for _, trade := range trades {
+		_, err := tx.ExecContext(ctx, `INSERT INTO cooldowns (timestamp, pair, buy_price, sell_price, paper, strategy) VALUES (?, ?, ?, ?, ?, ?)`,
+			trade.Timestamp, trade.Pair, trade.BuyPrice, trade.SellPrice, trade.Paper, tradeStrategy(trade))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqliteStore) listCooldowns(ctx context.Context) ([]TradingDetails, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, timestamp, pair, buy_price, sell_price, paper, strategy FROM cooldowns ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []TradingDetails{}
+	for rows.Next() {
+		var cooldown TradingDetails
+		if err := rows.Scan(&cooldown.ID, &cooldown.Timestamp, &cooldown.Pair, &cooldown.BuyPrice, &cooldown.SellPrice, &cooldown.Paper, &cooldown.Strategy); err != nil {
+			return nil, err
+		}
+		result = append(result, cooldown)
+	}
+	return result, rows.Err()
+}
+
+// importTrade inserts a trade unless one with the same timestamp, pair,
+// order ID, quantity, sell price and position exists, and reports whether
+// it inserted. The legs of a ladder share the timestamp and pair, and the
+// legs whose sell failed all have the order ID "error", so the order ID
+// alone does not tell them apart.
+func (s *sqliteStore) importTrade(trade TradingDetails) (bool, error) {
+	result, err := s.db.Exec(`INSERT INTO trades (timestamp, pair, quantity, buy_price, sell_price, order_id, status, paper, strategy, order_list_id, stop_order_id, stop_price, exit_leg, high_price, trail_stop, position_id, closed_at)
+		SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM trades WHERE timestamp = ? AND pair = ? AND order_id = ? AND quantity = ? AND sell_price = ? AND position_id = ?)`,
+		trade.Timestamp, trade.Pair, trade.Quantity, trade.BuyPrice, trade.SellPrice, trade.OrderID, trade.Status, trade.Paper, tradeStrategy(trade), tradeOrderListID(trade), trade.StopOrderID, trade.StopPrice, trade.Exit, trade.HighPrice, trade.TrailStop, trade.PositionID, trade.ClosedAt,
+		trade.Timestamp, trade.Pair, trade.OrderID, trade.Quantity, trade.SellPrice, trade.PositionID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// importCooldown inserts a cooldown entry unless one with the same timestamp
+// and pair exists, and reports whether it inserted.
+func (s *sqliteStore) importCooldown(cooldown TradingDetails) (bool, error) {
+	result, err := s.db.Exec(`INSERT INTO cooldowns (timestamp, pair, buy_price, sell_price, paper, strategy)
+		SELECT ?, ?, ?, ?, ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM cooldowns WHERE timestamp = ? AND pair = ?)`,
+		cooldown.Timestamp, cooldown.Pair, cooldown.BuyPrice, cooldown.SellPrice, cooldown.Paper, tradeStrategy(cooldown),
+		cooldown.Timestamp, cooldown.Pair)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
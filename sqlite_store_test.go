@@ -0,0 +1,42 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestImportTradeKeepsLadderLegs(t *testing.T) {
+	store, err := openSQLiteStore(filepath.Join(t.TempDir(), "bot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	// Two legs whose sells failed, a filled leg, and a trade of another
+	// position bought in the same second.
+	leg := TradingDetails{Timestamp: "2024-01-10 12:00:00", Pair: "AAAUSDT", Quantity: "1", BuyPrice: 10, SellPrice: "10.5", OrderID: "error", Status: "ERROR", Strategy: "default", OrderListID: -1}
+	trades := []TradingDetails{leg, leg, leg, leg}
+	trades[1].Quantity, trades[1].SellPrice = "2", "11"
+	trades[2].OrderID, trades[2].SellPrice, trades[2].Status = "sell3", "12", "FILLED"
+	trades[3].PositionID = "buy2"
+
+	for round, want := range []bool{true, false} {
+		for i, trade := range trades {
+			inserted, err := store.importTrade(trade)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if inserted != want {
+				t.Errorf("import %d of trade %d inserted = %v, want %v", round+1, i, inserted, want)
+			}
+		}
+	}
+
+	stored, err := store.ListTrades()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != len(trades) {
+		t.Errorf("stored %d trades, want %d", len(stored), len(trades))
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Store holds the bot's state between runs: the previous screening result,
+// the trades placed and the per-pair cooldown entries. Alert state and
+// cooldowns are kept per strategy.
+type Store interface {
+	LoadAlertState(strategy string) (TradingIndormationData, error)
+	SaveAlertState(strategy string, state TradingIndormationData) error
+
+	// ListOpenTrades returns the trades whose sell order is NEW or
+	// PARTIALLY_FILLED, including the ones whose sell order failed.
+	ListOpenTrades() ([]TradingDetails, error)
+	// ListPositionTrades returns every trade of a position, open or closed.
+	ListPositionTrades(positionID string) ([]TradingDetails, error)
+	// ListTrades returns every trade of the running mode, live or paper,
+	// open or closed, oldest first.
+	ListTrades() ([]TradingDetails, error)
+	AppendTrades(trades []TradingDetails) error
+	UpdateTradeStatus(trade TradingDetails, status string) error
+	UpdateTradeSellPrice(trade TradingDetails, sellPrice string) error
+	// UpdateTradeExit records which leg of an OCO exit closed the trade.
+	UpdateTradeExit(trade TradingDetails, exit string) error
+	// UpdateTradeTrail saves a trailing stop trade's highest price and stop.
+	UpdateTradeTrail(trade TradingDetails, highPrice string, trailStop string) error
+
+	// LoadRiskHalt returns the last risk halt saved in the running mode,
+	// live or paper, a zero one when none was.
+	LoadRiskHalt() (RiskHalt, error)
+	// SaveRiskHalt records the risk halt in force; a zero one lifts it.
+	SaveRiskHalt(halt RiskHalt) error
+
+	// LoadTradingSwitch returns the kill switch of the running mode, live or
+	// paper, enabled when it was never saved.
+	LoadTradingSwitch() (TradingSwitch, error)
+	SaveTradingSwitch(s TradingSwitch) error
+
+	// LoadCooldowns counts the strategy's trades per pair inside the
+	// cooldown window.
+	LoadCooldowns(strategy string) (map[string]int, error)
+	// RecordCooldown adds trades to the cooldown window of their strategy
+	// and drops the entries that fell out of it.
+	RecordCooldown(trades []TradingDetails) error
+
+	// WithContext returns the store reading under ctx, so a job's reads stop
+	// at its timeout. Writes record what already happened on the exchange
+	// and are not cut short with the job; see storeWriteContext.
+	WithContext(ctx context.Context) Store
+}
+
+// storeWriteContext bounds a store write by STORE_WRITE_TIMEOUT seconds of
+// its own, whatever the context the store reads under.
+func storeWriteContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), STORE_WRITE_TIMEOUT*time.Second)
+}
+
+var (
+	sqliteStoreOnce   sync.Once
+	sharedSQLiteStore *sqliteStore
+)
+
+// initStore returns the configured Store. The SQLite database is opened and
+// migrated once per process and shared by every request.
+func initStore() Store {
+	switch config.Storage.Driver {
+	case STORAGE_SQLITE:
+		sqliteStoreOnce.Do(func() {
+			store, err := openSQLiteStore(config.Storage.SQLitePath)
+			if err != nil {
+				log.Fatalf("Unable to open SQLite database: %v", err)
+			}
+			sharedSQLiteStore = store
+		})
+		return sharedSQLiteStore
+	default:
+		return newSheetsStore(initGoogleSheetClient())
+	}
+}
+
+// isInCooldown reports whether a trade placed at timestamp still counts
+// toward its pair's trade limit.
+func isInCooldown(timestamp string) bool {
+	tradingTime, err := time.Parse("2006-01-02 15:04:05", timestamp)
+	if err != nil {
+		return false
+	}
+	return time.Now().Sub(tradingTime).Minutes() < float64(config.Trading.CooldownMinutes)
+}
+
+// tradeStrategy is the strategy a trade is stored under. Trades recorded
+// before strategies existed belong to the default one.
+func tradeStrategy(trade TradingDetails) string {
+	if trade.Strategy == "" {
+		return DEFAULT_STRATEGY_NAME
+	}
+	return trade.Strategy
+}
+
+// tradeOrderListID is the stored OCO list ID of a trade: -1 when its exit
+// is not an OCO list, whatever the zero value of the field says.
+func tradeOrderListID(trade TradingDetails) int64 {
+	if trade.StopOrderID == "" {
+		return -1
+	}
+	return trade.OrderListID
+}
+
+// newAlertState builds the state to save after a screening run from the pairs
+// that alerted and the state loaded before it.
+func newAlertState(parameters map[string]Parameters, previous TradingIndormationData) TradingIndormationData {
+	pairs := []string{}
+	for pair := range parameters {
+		pairs = append(pairs, pair)
+	}
+
+	return TradingIndormationData{
+		LastAlertCoin:          pairs,
+		CurrentTotalAlertCoin:  strconv.Itoa(len(pairs)),
+		PreviousTotalAlertCoin: previous.CurrentTotalAlertCoin,
+	}
+}
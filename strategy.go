@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/adshao/go-binance/v2"
+)
+
+// Signal is a strategy's verdict on a symbol at its latest candle. BUY
+// signals are the uptrend alerts the bot trades; SELL signals are downtrend
+// alerts that are only reported.
+type Signal struct {
+	Strategy string
+	Symbol   string
+	Side     binance.SideType
+	// Strength is between 0 and 1, how many of the strategy's conditions
+	// agreed.
+	Strength float64
+	Reason   string
+
+	// Parameters are the indicators the signal was computed from. Trading
+	// reads CurrentPrice and the symbol's Rules from them.
+	Parameters Parameters
+}
+
+// Strategy turns the latest screening window of a symbol into signals.
+// Evaluate gets SCREENING_WINDOW candles, oldest first, and must not keep
+// them: screening calls it from several goroutines at once.
+type Strategy interface {
+	Name() string
+	Settings() StrategyConfig
+	Evaluate(klines []*binance.Kline, symbol binance.Symbol) []Signal
+}
+
+type strategyFactory func(settings StrategyConfig) (Strategy, error)
+
+// strategyKinds are the strategies a StrategyConfig can name as its kind.
+var strategyKinds = map[string]strategyFactory{
+	STRATEGY_ENGULFING_BREAKOUT: func(settings StrategyConfig) (Strategy, error) {
+		return newEngulfingBreakoutStrategy(settings), nil
+	},
+	STRATEGY_RULES: func(settings StrategyConfig) (Strategy, error) {
+		return newRulesStrategy(settings)
+	},
+}
+
+// newStrategy builds a configured strategy through its kind's factory.
+func newStrategy(settings StrategyConfig) (Strategy, error) {
+	factory, exists := strategyKinds[settings.Kind]
+	if !exists {
+		return nil, fmt.Errorf("strategy %q: unknown kind %q", settings.Name, settings.Kind)
+	}
+	return factory(settings)
+}
+
+// loadStrategies builds every configured strategy, in config order.
+func loadStrategies() ([]Strategy, error) {
+	var strategies []Strategy
+	for _, settings := range config.strategies() {
+		strategy, err := newStrategy(settings)
+		if err != nil {
+			return nil, err
+		}
+		strategies = append(strategies, strategy)
+	}
+	return strategies, nil
+}
+
+// strategyTrading returns the trading settings of the named strategy, or the
+// top-level ones for trades of a strategy no longer configured.
+func strategyTrading(name string) TradingConfig {
+	for _, settings := range config.strategies() {
+		if settings.Name == name {
+			return settings.Trading
+		}
+	}
+	return config.Trading
+}
+
+// engulfingBreakoutStrategy is the bot's original rule set. It buys when the
+// price is above the moving average by UpperMAFactor and either a bullish
+// engulfing candle forms in an uptrend or the price breaks the window's
+// high.
+type engulfingBreakoutStrategy struct {
+	settings StrategyConfig
+}
+
+func newEngulfingBreakoutStrategy(settings StrategyConfig) *engulfingBreakoutStrategy {
+	return &engulfingBreakoutStrategy{settings: settings}
+}
+
+func (s *engulfingBreakoutStrategy) Name() string {
+	return s.settings.Name
+}
+
+func (s *engulfingBreakoutStrategy) Settings() StrategyConfig {
+	return s.settings
+}
+
+func (s *engulfingBreakoutStrategy) Evaluate(klines []*binance.Kline, symbol binance.Symbol) []Signal {
+	rules := s.settings.Screening
+	parameter, isValid := generateParameters(klines, symbol, rules)
+	if !isValid {
+		return nil
+	}
+
+	var signals []Signal
+
+	aboveAverage := parameter.CurrentPrice >= parameter.MovingAverage*rules.UpperMAFactor
+	var reasons []string
+	if aboveAverage && parameter.IsGulfingCandles && parameter.IsUpperTrend {
+		reasons = append(reasons, "engulfing")
+	}
+	if aboveAverage && parameter.IsBreakResistance {
+		reasons = append(reasons, "breakout")
+	}
+	if len(reasons) > 0 {
+		signals = append(signals, Signal{
+			Strategy:   s.Name(),
+			Symbol:     symbol.Symbol,
+			Side:       binance.SideTypeBuy,
+			Strength:   float64(len(reasons)) / 2,
+			Reason:     strings.Join(reasons, "+"),
+			Parameters: parameter,
+		})
+	}
+
+	reasons = nil
+	if parameter.CurrentPrice <= parameter.MovingAverage*rules.LowerMAFactor && !parameter.IsUpperTrend {
+		reasons = append(reasons, "below_average")
+	}
+	if parameter.IsBreakSupport {
+		reasons = append(reasons, "breakdown")
+	}
+	if len(reasons) > 0 {
+		signals = append(signals, Signal{
+			Strategy:   s.Name(),
+			Symbol:     symbol.Symbol,
+			Side:       binance.SideTypeSell,
+			Strength:   float64(len(reasons)) / 2,
+			Reason:     strings.Join(reasons, "+"),
+			Parameters: parameter,
+		})
+	}
+
+	return signals
+}
+
+// rulesStrategy signals when the rules written in its config match: a BUY
+// when the buy rule does and a SELL when the optional sell rule does.
+type rulesStrategy struct {
+	settings StrategyConfig
+	buy      *Rule
+	sell     *Rule
+}
+
+func newRulesStrategy(settings StrategyConfig) (*rulesStrategy, error) {
+	s := &rulesStrategy{settings: settings}
+
+	var err error
+	if s.buy, err = compileRule(settings.Buy); err != nil {
+		return nil, fmt.Errorf("strategy %q: buy: %v", settings.Name, err)
+	}
+	if settings.Sell != "" {
+		if s.sell, err = compileRule(settings.Sell); err != nil {
+			return nil, fmt.Errorf("strategy %q: sell: %v", settings.Name, err)
+		}
+	}
+	return s, nil
+}
+
+func (s *rulesStrategy) Name() string {
+	return s.settings.Name
+}
+
+func (s *rulesStrategy) Settings() StrategyConfig {
+	return s.settings
+}
+
+func (s *rulesStrategy) Evaluate(klines []*binance.Kline, symbol binance.Symbol) []Signal {
+	parameter, isValid := generateParameters(klines, symbol, s.settings.Screening)
+	if !isValid {
+		return nil
+	}
+	candles, err := candlesFromKlines(symbol.Symbol, klines)
+	if err != nil {
+		return nil
+	}
+
+	env := newRuleEnv(candleBars(candles), parameter)
+	var signals []Signal
+	if s.buy.Matches(env) {
+		signals = append(signals, Signal{
+			Strategy:   s.Name(),
+			Symbol:     symbol.Symbol,
+			Side:       binance.SideTypeBuy,
+			Strength:   1,
+			Reason:     "buy_rule",
+			Parameters: parameter,
+		})
+	}
+	if s.sell != nil && s.sell.Matches(env) {
+		signals = append(signals, Signal{
+			Strategy:   s.Name(),
+			Symbol:     symbol.Symbol,
+			Side:       binance.SideTypeSell,
+			Strength:   1,
+			Reason:     "sell_rule",
+			Parameters: parameter,
+		})
+	}
+	return signals
+}
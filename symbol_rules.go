@@ -0,0 +1,399 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/shopspring/decimal"
+)
+
+// SymbolRules are the exchange filters every order of a symbol has to pass,
+// read once from exchange info. Orders are adjusted to them before they are
+// sent so Binance never answers with a filter failure. Zero bounds are not
+// enforced, as on Binance.
+type SymbolRules struct {
+	Symbol     string
+	BaseAsset  string
+	QuoteAsset string
+
+	// PRICE_FILTER
+	TickSize decimal.Decimal
+	MinPrice decimal.Decimal
+	MaxPrice decimal.Decimal
+
+	// LOT_SIZE
+	StepSize decimal.Decimal
+	MinQty   decimal.Decimal
+	MaxQty   decimal.Decimal
+
+	// NOTIONAL, or the older MIN_NOTIONAL. The market flags say whether the
+	// bounds also apply to market orders, priced at the average price.
+	MinNotional       decimal.Decimal
+	MaxNotional       decimal.Decimal
+	MinNotionalMarket bool
+	MaxNotionalMarket bool
+
+	// PERCENT_PRICE_BY_SIDE, or PERCENT_PRICE for both sides: a limit price
+	// must stay within these multiples of the average price.
+	BidMultiplierUp   decimal.Decimal
+	BidMultiplierDown decimal.Decimal
+	AskMultiplierUp   decimal.Decimal
+	AskMultiplierDown decimal.Decimal
+
+	// MAX_NUM_ORDERS, 0 when the symbol has no limit.
+	MaxNumOrders int
+}
+
+// newSymbolRules reads the rules of a symbol from its exchange info filters.
+// PRICE_FILTER and LOT_SIZE are required with a tick and step size above
+// zero, since no price or quantity could be rounded otherwise; the other
+// filters are optional.
+func newSymbolRules(symbol binance.Symbol) (SymbolRules, error) {
+	rules := SymbolRules{
+		Symbol:     symbol.Symbol,
+		BaseAsset:  symbol.BaseAsset,
+		QuoteAsset: symbol.QuoteAsset,
+	}
+
+	filters := make(map[string]map[string]interface{})
+	for _, filter := range symbol.Filters {
+		if filterType, ok := filter["filterType"].(string); ok {
+			filters[filterType] = filter
+		}
+	}
+
+	var problems []error
+	number := func(filterType, key string, target *decimal.Decimal) {
+		value, exists := filters[filterType][key]
+		if !exists {
+			return
+		}
+		var err error
+		switch value := value.(type) {
+		case string:
+			*target, err = decimal.NewFromString(value)
+		case float64:
+			*target = decimal.NewFromFloat(value)
+		default:
+			err = fmt.Errorf("unexpected type %T", value)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s.%s %v is not a number", filterType, key, value))
+		}
+	}
+	flag := func(filterType, key string, target *bool) {
+		if value, ok := filters[filterType][key].(bool); ok {
+			*target = value
+		}
+	}
+
+	for _, required := range []string{"PRICE_FILTER", "LOT_SIZE"} {
+		if _, exists := filters[required]; !exists {
+			return rules, fmt.Errorf("%s has no %s filter", symbol.Symbol, required)
+		}
+	}
+
+	number("PRICE_FILTER", "tickSize", &rules.TickSize)
+	number("PRICE_FILTER", "minPrice", &rules.MinPrice)
+	number("PRICE_FILTER", "maxPrice", &rules.MaxPrice)
+	number("LOT_SIZE", "stepSize", &rules.StepSize)
+	number("LOT_SIZE", "minQty", &rules.MinQty)
+	number("LOT_SIZE", "maxQty", &rules.MaxQty)
+
+	if _, exists := filters["NOTIONAL"]; exists {
+		number("NOTIONAL", "minNotional", &rules.MinNotional)
+		number("NOTIONAL", "maxNotional", &rules.MaxNotional)
+		flag("NOTIONAL", "applyMinToMarket", &rules.MinNotionalMarket)
+		flag("NOTIONAL", "applyMaxToMarket", &rules.MaxNotionalMarket)
+	} else if _, exists := filters["MIN_NOTIONAL"]; exists {
+		number("MIN_NOTIONAL", "minNotional", &rules.MinNotional)
+		flag("MIN_NOTIONAL", "applyToMarket", &rules.MinNotionalMarket)
+	}
+
+	if _, exists := filters["PERCENT_PRICE_BY_SIDE"]; exists {
+		number("PERCENT_PRICE_BY_SIDE", "bidMultiplierUp", &rules.BidMultiplierUp)
+		number("PERCENT_PRICE_BY_SIDE", "bidMultiplierDown", &rules.BidMultiplierDown)
+		number("PERCENT_PRICE_BY_SIDE", "askMultiplierUp", &rules.AskMultiplierUp)
+		number("PERCENT_PRICE_BY_SIDE", "askMultiplierDown", &rules.AskMultiplierDown)
+	} else if _, exists := filters["PERCENT_PRICE"]; exists {
+		number("PERCENT_PRICE", "multiplierUp", &rules.BidMultiplierUp)
+		number("PERCENT_PRICE", "multiplierDown", &rules.BidMultiplierDown)
+		rules.AskMultiplierUp, rules.AskMultiplierDown = rules.BidMultiplierUp, rules.BidMultiplierDown
+	}
+
+	var maxNumOrders decimal.Decimal
+	number("MAX_NUM_ORDERS", "maxNumOrders", &maxNumOrders)
+	rules.MaxNumOrders = int(maxNumOrders.IntPart())
+
+	if len(problems) > 0 {
+		return rules, fmt.Errorf("%s: %v", symbol.Symbol, problems[0])
+	}
+	if !rules.TickSize.IsPositive() {
+		return rules, fmt.Errorf("%s PRICE_FILTER.tickSize must be > 0, got %s", symbol.Symbol, rules.TickSize)
+	}
+	if !rules.StepSize.IsPositive() {
+		return rules, fmt.Errorf("%s LOT_SIZE.stepSize must be > 0, got %s", symbol.Symbol, rules.StepSize)
+	}
+	return rules, nil
+}
+
+// Tradeable reports why the bot cannot trade the symbol with at most
+// maxQuote per buy, or nil when it can.
+func (r SymbolRules) Tradeable(symbol binance.Symbol, maxQuote float64) error {
+	if symbol.Status != "TRADING" {
+		return fmt.Errorf("status is %s", symbol.Status)
+	}
+	if !symbol.IsSpotTradingAllowed {
+		return fmt.Errorf("spot trading is not allowed")
+	}
+	// Entries are market buys, exits an OCO of a limit maker and a stop-loss
+	// limit order, with a market sell as the manual fallback.
+	for _, orderType := range []binance.OrderType{binance.OrderTypeMarket, binance.OrderTypeLimitMaker, binance.OrderTypeStopLossLimit} {
+		if !hasOrderType(symbol, orderType) {
+			return fmt.Errorf("%s orders are not allowed", orderType)
+		}
+	}
+	if len(symbol.OrderTypes) > 0 && !symbol.OcoAllowed {
+		return fmt.Errorf("OCO orders are not allowed")
+	}
+	if quote := decimal.NewFromFloat(maxQuote); r.MinNotional.IsPositive() && quote.LessThan(r.MinNotional) {
+		return fmt.Errorf("minimum notional %s is above max_quote_per_trade %s", r.MinNotional, quote)
+	}
+	if r.MaxNumOrders > 0 && r.MaxNumOrders < 2 {
+		// The buy fills at once but both legs of the exit stay open.
+		return fmt.Errorf("MAX_NUM_ORDERS is %d", r.MaxNumOrders)
+	}
+	return nil
+}
+
+func hasOrderType(symbol binance.Symbol, orderType binance.OrderType) bool {
+	// Exchange info without order types comes from the fake exchange and old
+	// test data; it allows everything, OCO included.
+	if len(symbol.OrderTypes) == 0 {
+		return true
+	}
+	for _, allowed := range symbol.OrderTypes {
+		if allowed == string(orderType) {
+			return true
+		}
+	}
+	return false
+}
+
+// RoundPrice rounds price to the nearest multiple of the tick size.
+func (r SymbolRules) RoundPrice(price decimal.Decimal) decimal.Decimal {
+	return price.Div(r.TickSize).Round(0).Mul(r.TickSize)
+}
+
+// FloorPrice rounds price down to a multiple of the tick size.
+func (r SymbolRules) FloorPrice(price decimal.Decimal) decimal.Decimal {
+	return price.Div(r.TickSize).Floor().Mul(r.TickSize)
+}
+
+// CeilPrice rounds price up to a multiple of the tick size.
+func (r SymbolRules) CeilPrice(price decimal.Decimal) decimal.Decimal {
+	return price.Div(r.TickSize).Ceil().Mul(r.TickSize)
+}
+
+// FloorQuantity rounds quantity down to a multiple of the step size, so an
+// order never asks for more than is held.
+func (r SymbolRules) FloorQuantity(quantity decimal.Decimal) decimal.Decimal {
+	return quantity.Div(r.StepSize).Floor().Mul(r.StepSize)
+}
+
+// FormatPrice writes price with as many decimals as the tick size has.
+func (r SymbolRules) FormatPrice(price decimal.Decimal) string {
+	return price.StringFixed(decimalPlaces(r.TickSize))
+}
+
+// FormatQuantity writes quantity with as many decimals as the step size has.
+func (r SymbolRules) FormatQuantity(quantity decimal.Decimal) string {
+	return quantity.StringFixed(decimalPlaces(r.StepSize))
+}
+
+// decimalPlaces counts the decimals of a step like 0.00100000, which is 3.
+func decimalPlaces(step decimal.Decimal) int32 {
+	var places int32
+	for shifted := step; !shifted.Equal(shifted.Truncate(0)); places++ {
+		shifted = shifted.Shift(1)
+	}
+	return places
+}
+
+// PriceBand returns the lowest and highest limit price PERCENT_PRICE and
+// PRICE_FILTER allow for side around the average price, rounded inwards to
+// the tick. A zero bound is open.
+func (r SymbolRules) PriceBand(side binance.SideType, averagePrice decimal.Decimal) (low, high decimal.Decimal) {
+	up, down := r.BidMultiplierUp, r.BidMultiplierDown
+	if side == binance.SideTypeSell {
+		up, down = r.AskMultiplierUp, r.AskMultiplierDown
+	}
+
+	low, high = r.MinPrice, r.MaxPrice
+	if down.IsPositive() {
+		low = decimal.Max(low, r.CeilPrice(averagePrice.Mul(down)))
+	}
+	if up.IsPositive() {
+		bound := r.FloorPrice(averagePrice.Mul(up))
+		if high.IsZero() || bound.LessThan(high) {
+			high = bound
+		}
+	}
+	return low, high
+}
+
+// AdjustLimitOrder fits a limit order to the filters: the price is rounded
+// to the tick and pulled into the percent price band around averagePrice,
+// the quantity is rounded down to the step and capped at maxQty. It fails
+// when the order cannot be placed at all, below minQty or the notional
+// bounds.
+func (r SymbolRules) AdjustLimitOrder(side binance.SideType, price, quantity, averagePrice decimal.Decimal) (decimal.Decimal, decimal.Decimal, error) {
+	price = r.RoundPrice(price)
+	low, high := r.PriceBand(side, averagePrice)
+	if price.LessThan(low) {
+		price = low
+	}
+	if high.IsPositive() && price.GreaterThan(high) {
+		price = high
+	}
+	if !price.IsPositive() {
+		return price, quantity, fmt.Errorf("%s: price %s is not positive", r.Symbol, price)
+	}
+
+	quantity, err := r.adjustQuantity(quantity)
+	if err != nil {
+		return price, quantity, err
+	}
+	return price, quantity, r.checkNotional(price.Mul(quantity), true)
+}
+
+// AdjustOCOSell fits an OCO sell to the filters: a take-profit limit at
+// price and a stop-loss leg triggered at stopPrice with its limit at
+// stopLimitPrice. Both legs share the quantity, so it has to pass the
+// notional filters at the lower stop limit too. The prices must stay in
+// order, price above stopPrice and stopPrice at or above stopLimitPrice,
+// after rounding to the tick.
+func (r SymbolRules) AdjustOCOSell(price, stopPrice, stopLimitPrice, quantity, averagePrice decimal.Decimal) (OCORequest, error) {
+	price, quantity, err := r.AdjustLimitOrder(binance.SideTypeSell, price, quantity, averagePrice)
+	if err != nil {
+		return OCORequest{}, err
+	}
+	stopLimitPrice, quantity, err = r.AdjustLimitOrder(binance.SideTypeSell, stopLimitPrice, quantity, averagePrice)
+	if err != nil {
+		return OCORequest{}, err
+	}
+	stopPrice = r.RoundPrice(stopPrice)
+	if stopPrice.LessThan(stopLimitPrice) {
+		stopPrice = stopLimitPrice
+	}
+	if !price.GreaterThan(stopPrice) {
+		return OCORequest{}, fmt.Errorf("%s: take profit %s is not above the stop %s after rounding", r.Symbol, r.FormatPrice(price), r.FormatPrice(stopPrice))
+	}
+
+	return OCORequest{
+		Symbol:               r.Symbol,
+		Side:                 binance.SideTypeSell,
+		Quantity:             r.FormatQuantity(quantity),
+		Price:                r.FormatPrice(price),
+		StopPrice:            r.FormatPrice(stopPrice),
+		StopLimitPrice:       r.FormatPrice(stopLimitPrice),
+		StopLimitTimeInForce: binance.TimeInForceTypeGTC,
+	}, nil
+}
+
+// AdjustMarketQuantity fits the quantity of a market order, valued at
+// averagePrice for the notional filters that apply to market orders.
+func (r SymbolRules) AdjustMarketQuantity(quantity, averagePrice decimal.Decimal) (decimal.Decimal, error) {
+	quantity, err := r.adjustQuantity(quantity)
+	if err != nil {
+		return quantity, err
+	}
+	return quantity, r.checkNotional(averagePrice.Mul(quantity), false)
+}
+
+// SplitQuantity splits quantity into parts of the given percentages, each
+// rounded down to the step size, with what the rounding leaves over going to
+// the last part. A part below minQty or the minimum notional at price is
+// folded into the next part, and the last one into the closest part before
+// it, so some parts may be zero. It fails when the whole quantity is too
+// small for one part.
+func (r SymbolRules) SplitQuantity(quantity decimal.Decimal, percents []float64, price decimal.Decimal) ([]decimal.Decimal, error) {
+	quantity = r.FloorQuantity(quantity)
+	parts := make([]decimal.Decimal, len(percents))
+	rest := quantity
+	for i, percent := range percents {
+		if i == len(percents)-1 {
+			parts[i] = rest
+			break
+		}
+		parts[i] = r.FloorQuantity(quantity.Mul(decimal.NewFromFloat(percent)).Div(decimal.NewFromInt(100)))
+		rest = rest.Sub(parts[i])
+	}
+
+	sellable := func(part decimal.Decimal) bool {
+		if !part.IsPositive() || part.LessThan(r.MinQty) {
+			return false
+		}
+		return !r.MinNotional.IsPositive() || !price.Mul(part).LessThan(r.MinNotional)
+	}
+	for i := 0; i < len(parts)-1; i++ {
+		if !sellable(parts[i]) {
+			parts[i+1] = parts[i+1].Add(parts[i])
+			parts[i] = decimal.Zero
+		}
+	}
+	last := len(parts) - 1
+	if last >= 0 && !sellable(parts[last]) {
+		folded := false
+		for i := last - 1; i >= 0 && !folded; i-- {
+			if parts[i].IsPositive() {
+				parts[i] = parts[i].Add(parts[last])
+				parts[last] = decimal.Zero
+				folded = true
+			}
+		}
+		if !folded {
+			return nil, fmt.Errorf("%s: quantity %s is too small to split", r.Symbol, r.FormatQuantity(quantity))
+		}
+	}
+	return parts, nil
+}
+
+// CheckQuoteOrder checks a market buy of quote worth at averagePrice.
+func (r SymbolRules) CheckQuoteOrder(quote, averagePrice decimal.Decimal) error {
+	if averagePrice.IsPositive() {
+		if quantity := r.FloorQuantity(quote.Div(averagePrice)); quantity.LessThan(r.MinQty) || quantity.IsZero() {
+			return fmt.Errorf("%s: %s %s buys %s, below LOT_SIZE minQty %s", r.Symbol, quote, r.QuoteAsset, quantity, r.MinQty)
+		}
+	}
+	return r.checkNotional(quote, false)
+}
+
+// CheckOpenOrders fails when adding orders would pass MAX_NUM_ORDERS.
+func (r SymbolRules) CheckOpenOrders(open, adding int) error {
+	if r.MaxNumOrders > 0 && open+adding > r.MaxNumOrders {
+		return fmt.Errorf("%s: %d open orders reach MAX_NUM_ORDERS %d", r.Symbol, open, r.MaxNumOrders)
+	}
+	return nil
+}
+
+func (r SymbolRules) adjustQuantity(quantity decimal.Decimal) (decimal.Decimal, error) {
+	quantity = r.FloorQuantity(quantity)
+	if r.MaxQty.IsPositive() && quantity.GreaterThan(r.MaxQty) {
+		quantity = r.FloorQuantity(r.MaxQty)
+	}
+	if quantity.LessThan(r.MinQty) || !quantity.IsPositive() {
+		return quantity, fmt.Errorf("%s: quantity %s is below LOT_SIZE minQty %s", r.Symbol, r.FormatQuantity(quantity), r.MinQty)
+	}
+	return quantity, nil
+}
+
+func (r SymbolRules) checkNotional(notional decimal.Decimal, limit bool) error {
+	if r.MinNotional.IsPositive() && (limit || r.MinNotionalMarket) && notional.LessThan(r.MinNotional) {
+		return fmt.Errorf("%s: notional %s is below the minimum %s", r.Symbol, notional.StringFixed(8), r.MinNotional)
+	}
+	if r.MaxNotional.IsPositive() && (limit || r.MaxNotionalMarket) && notional.GreaterThan(r.MaxNotional) {
+		return fmt.Errorf("%s: notional %s is above the maximum %s", r.Symbol, notional.StringFixed(8), r.MaxNotional)
+	}
+	return nil
+}
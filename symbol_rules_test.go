@@ -0,0 +1,384 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/shopspring/decimal"
+)
+
+func dec(value string) decimal.Decimal {
+	return decimal.RequireFromString(value)
+}
+
+func testSymbol(filters ...map[string]interface{}) binance.Symbol {
+	return binance.Symbol{Symbol: "AAAUSDT", BaseAsset: "AAA", QuoteAsset: "USDT", Filters: filters}
+}
+
+var (
+	testPriceFilter = map[string]interface{}{"filterType": "PRICE_FILTER", "tickSize": "0.01000000", "minPrice": "0.01000000", "maxPrice": "1000.00000000"}
+	testLotSize     = map[string]interface{}{"filterType": "LOT_SIZE", "stepSize": "0.00100000", "minQty": "0.01000000", "maxQty": "100.00000000"}
+)
+
+func TestNewSymbolRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters []map[string]interface{}
+		check   func(t *testing.T, rules SymbolRules)
+		err     string
+	}{
+		{
+			name:    "price and lot size",
+			filters: []map[string]interface{}{testPriceFilter, testLotSize},
+			check: func(t *testing.T, rules SymbolRules) {
+				if !rules.TickSize.Equal(dec("0.01")) || !rules.MinPrice.Equal(dec("0.01")) || !rules.MaxPrice.Equal(dec("1000")) {
+					t.Errorf("price filter = %s %s %s", rules.TickSize, rules.MinPrice, rules.MaxPrice)
+				}
+				if !rules.StepSize.Equal(dec("0.001")) || !rules.MinQty.Equal(dec("0.01")) || !rules.MaxQty.Equal(dec("100")) {
+					t.Errorf("lot size = %s %s %s", rules.StepSize, rules.MinQty, rules.MaxQty)
+				}
+				if !rules.MinNotional.IsZero() || rules.MaxNumOrders != 0 || !rules.BidMultiplierUp.IsZero() {
+					t.Errorf("absent filters = %+v, want them open", rules)
+				}
+			},
+		},
+		{
+			name: "NOTIONAL",
+			filters: []map[string]interface{}{testPriceFilter, testLotSize,
+				{"filterType": "NOTIONAL", "minNotional": "5.00000000", "applyMinToMarket": true, "maxNotional": "9000.00000000", "applyMaxToMarket": false},
+			},
+			check: func(t *testing.T, rules SymbolRules) {
+				if !rules.MinNotional.Equal(dec("5")) || !rules.MaxNotional.Equal(dec("9000")) || !rules.MinNotionalMarket || rules.MaxNotionalMarket {
+					t.Errorf("notional = %s %v %s %v", rules.MinNotional, rules.MinNotionalMarket, rules.MaxNotional, rules.MaxNotionalMarket)
+				}
+			},
+		},
+		{
+			name: "MIN_NOTIONAL",
+			filters: []map[string]interface{}{testPriceFilter, testLotSize,
+				{"filterType": "MIN_NOTIONAL", "minNotional": "10.00000000", "applyToMarket": true, "avgPriceMins": 5.0},
+			},
+			check: func(t *testing.T, rules SymbolRules) {
+				if !rules.MinNotional.Equal(dec("10")) || !rules.MinNotionalMarket || !rules.MaxNotional.IsZero() {
+					t.Errorf("notional = %s %v %s", rules.MinNotional, rules.MinNotionalMarket, rules.MaxNotional)
+				}
+			},
+		},
+		{
+			name: "NOTIONAL over MIN_NOTIONAL",
+			filters: []map[string]interface{}{testPriceFilter, testLotSize,
+				{"filterType": "MIN_NOTIONAL", "minNotional": "10.00000000", "applyToMarket": true},
+				{"filterType": "NOTIONAL", "minNotional": "5.00000000", "applyMinToMarket": false},
+			},
+			check: func(t *testing.T, rules SymbolRules) {
+				if !rules.MinNotional.Equal(dec("5")) || rules.MinNotionalMarket {
+					t.Errorf("notional = %s %v, want NOTIONAL's 5 off for market orders", rules.MinNotional, rules.MinNotionalMarket)
+				}
+			},
+		},
+		{
+			name: "PERCENT_PRICE",
+			filters: []map[string]interface{}{testPriceFilter, testLotSize,
+				{"filterType": "PERCENT_PRICE", "multiplierUp": "5", "multiplierDown": "0.2", "avgPriceMins": 5.0},
+			},
+			check: func(t *testing.T, rules SymbolRules) {
+				if !rules.BidMultiplierUp.Equal(dec("5")) || !rules.BidMultiplierDown.Equal(dec("0.2")) ||
+					!rules.AskMultiplierUp.Equal(dec("5")) || !rules.AskMultiplierDown.Equal(dec("0.2")) {
+					t.Errorf("multipliers = %+v, want 5 and 0.2 on both sides", rules)
+				}
+			},
+		},
+		{
+			name: "PERCENT_PRICE_BY_SIDE over PERCENT_PRICE",
+			filters: []map[string]interface{}{testPriceFilter, testLotSize,
+				{"filterType": "PERCENT_PRICE", "multiplierUp": "5", "multiplierDown": "0.2"},
+				{"filterType": "PERCENT_PRICE_BY_SIDE", "bidMultiplierUp": "1.2", "bidMultiplierDown": "0.8", "askMultiplierUp": "1.5", "askMultiplierDown": "0.5"},
+			},
+			check: func(t *testing.T, rules SymbolRules) {
+				if !rules.BidMultiplierUp.Equal(dec("1.2")) || !rules.BidMultiplierDown.Equal(dec("0.8")) ||
+					!rules.AskMultiplierUp.Equal(dec("1.5")) || !rules.AskMultiplierDown.Equal(dec("0.5")) {
+					t.Errorf("multipliers = %+v, want the by-side ones", rules)
+				}
+			},
+		},
+		{
+			name:    "MAX_NUM_ORDERS as a JSON number",
+			filters: []map[string]interface{}{testPriceFilter, testLotSize, {"filterType": "MAX_NUM_ORDERS", "maxNumOrders": 200.0}},
+			check: func(t *testing.T, rules SymbolRules) {
+				if rules.MaxNumOrders != 200 {
+					t.Errorf("MaxNumOrders = %d, want 200", rules.MaxNumOrders)
+				}
+			},
+		},
+		{
+			name:    "no PRICE_FILTER",
+			filters: []map[string]interface{}{testLotSize},
+			err:     "AAAUSDT has no PRICE_FILTER filter",
+		},
+		{
+			name:    "no LOT_SIZE",
+			filters: []map[string]interface{}{testPriceFilter},
+			err:     "AAAUSDT has no LOT_SIZE filter",
+		},
+		{
+			name:    "tick size not a number",
+			filters: []map[string]interface{}{{"filterType": "PRICE_FILTER", "tickSize": "tick"}, testLotSize},
+			err:     "AAAUSDT: PRICE_FILTER.tickSize tick is not a number",
+		},
+		{
+			name:    "zero tick size",
+			filters: []map[string]interface{}{{"filterType": "PRICE_FILTER", "tickSize": "0.00000000"}, testLotSize},
+			err:     "AAAUSDT PRICE_FILTER.tickSize must be > 0, got 0",
+		},
+		{
+			name:    "zero step size",
+			filters: []map[string]interface{}{testPriceFilter, {"filterType": "LOT_SIZE", "stepSize": "0"}},
+			err:     "AAAUSDT LOT_SIZE.stepSize must be > 0, got 0",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules, err := newSymbolRules(testSymbol(test.filters...))
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("error = %v, want %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.check(t, rules)
+		})
+	}
+}
+
+func TestRoundingToTheTick(t *testing.T) {
+	rules := SymbolRules{TickSize: dec("0.005"), StepSize: dec("0.001")}
+
+	tests := []struct {
+		price              string
+		round, floor, ceil string
+	}{
+		{"1.2376", "1.240", "1.235", "1.240"},
+		{"1.2374", "1.235", "1.235", "1.240"},
+		{"1.2350", "1.235", "1.235", "1.235"},
+		{"1.2375", "1.240", "1.235", "1.240"},
+		{"0.0012", "0.000", "0.000", "0.005"},
+	}
+	for _, test := range tests {
+		price := dec(test.price)
+		if got := rules.FormatPrice(rules.RoundPrice(price)); got != test.round {
+			t.Errorf("RoundPrice(%s) = %s, want %s", test.price, got, test.round)
+		}
+		if got := rules.FormatPrice(rules.FloorPrice(price)); got != test.floor {
+			t.Errorf("FloorPrice(%s) = %s, want %s", test.price, got, test.floor)
+		}
+		if got := rules.FormatPrice(rules.CeilPrice(price)); got != test.ceil {
+			t.Errorf("CeilPrice(%s) = %s, want %s", test.price, got, test.ceil)
+		}
+	}
+
+	if got := rules.FormatQuantity(rules.FloorQuantity(dec("0.9999"))); got != "0.999" {
+		t.Errorf("FloorQuantity(0.9999) = %s, want 0.999", got)
+	}
+}
+
+func TestDecimalPlaces(t *testing.T) {
+	tests := []struct {
+		step string
+		want int32
+	}{
+		{"1", 0},
+		{"10.00000000", 0},
+		{"0.01", 2},
+		{"0.005", 3},
+		{"0.00100000", 3},
+		{"0.00000001", 8},
+	}
+	for _, test := range tests {
+		if got := decimalPlaces(dec(test.step)); got != test.want {
+			t.Errorf("decimalPlaces(%s) = %d, want %d", test.step, got, test.want)
+		}
+	}
+}
+
+// testRules has a tick of 0.01, a step of 0.001 from 0.01 to 100, notional
+// bounds of 5 to 1000 and a band of 0.8-1.2 for buys and 0.5-1.5 for sells.
+func testRules() SymbolRules {
+	return SymbolRules{
+		Symbol:            "AAAUSDT",
+		TickSize:          dec("0.01"),
+		MinPrice:          dec("0.01"),
+		MaxPrice:          dec("1000"),
+		StepSize:          dec("0.001"),
+		MinQty:            dec("0.01"),
+		MaxQty:            dec("100"),
+		MinNotional:       dec("5"),
+		MaxNotional:       dec("1000"),
+		BidMultiplierUp:   dec("1.2"),
+		BidMultiplierDown: dec("0.8"),
+		AskMultiplierUp:   dec("1.5"),
+		AskMultiplierDown: dec("0.5"),
+	}
+}
+
+func TestAdjustLimitOrder(t *testing.T) {
+	tests := []struct {
+		name                    string
+		side                    binance.SideType
+		price, quantity         string
+		wantPrice, wantQuantity string
+		err                     string
+	}{
+		{"rounded to tick and step", binance.SideTypeBuy, "10.004", "1.2345", "10", "1.234", ""},
+		{"buy above the bid band", binance.SideTypeBuy, "13", "1", "12", "1", ""},
+		{"buy below the bid band", binance.SideTypeBuy, "7", "1", "8", "1", ""},
+		{"sell within the ask band", binance.SideTypeSell, "14", "1", "14", "1", ""},
+		{"sell above the ask band", binance.SideTypeSell, "16", "1", "15", "1", ""},
+		{"sell below the ask band", binance.SideTypeSell, "4", "2", "5", "2", ""},
+		{"capped at maxQty", binance.SideTypeSell, "9", "150", "9", "100", ""},
+		{"below minQty", binance.SideTypeBuy, "10", "0.009", "", "", "quantity 0.009 is below LOT_SIZE minQty 0.01"},
+		{"below the minimum notional", binance.SideTypeBuy, "10", "0.4", "", "", "notional 4.00000000 is below the minimum 5"},
+		{"above the maximum notional", binance.SideTypeBuy, "12", "100", "", "", "notional 1200.00000000 is above the maximum 1000"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			price, quantity, err := testRules().AdjustLimitOrder(test.side, dec(test.price), dec(test.quantity), dec("10"))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error = %v, want %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !price.Equal(dec(test.wantPrice)) || !quantity.Equal(dec(test.wantQuantity)) {
+				t.Errorf("adjusted to %s at %s, want %s at %s", quantity, price, test.wantQuantity, test.wantPrice)
+			}
+		})
+	}
+}
+
+func TestAdjustMarketQuantity(t *testing.T) {
+	rules := testRules()
+	rules.MaxNotional = decimal.Zero
+
+	if quantity, err := rules.AdjustMarketQuantity(dec("0.4005"), dec("10")); err != nil || !quantity.Equal(dec("0.4")) {
+		t.Errorf("market quantity without applyMinToMarket = %s, %v, want 0.4", quantity, err)
+	}
+	rules.MinNotionalMarket = true
+	if _, err := rules.AdjustMarketQuantity(dec("0.4005"), dec("10")); err == nil {
+		t.Error("market quantity below the minimum notional with applyMinToMarket passed")
+	}
+	if quantity, err := rules.AdjustMarketQuantity(dec("250"), dec("10")); err != nil || !quantity.Equal(dec("100")) {
+		t.Errorf("market quantity above maxQty = %s, %v, want 100", quantity, err)
+	}
+}
+
+func TestAdjustOCOSell(t *testing.T) {
+	rules := testRules()
+	rules.TickSize = dec("0.005")
+
+	tests := []struct {
+		name                             string
+		price, stopPrice, stopLimitPrice string
+		quantity                         string
+		want                             OCORequest
+		err                              string
+	}{
+		{
+			name:  "rounded to tick 0.005",
+			price: "10.2037", stopPrice: "9.8012", stopLimitPrice: "9.7512", quantity: "0.9999",
+			want: OCORequest{Price: "10.205", StopPrice: "9.800", StopLimitPrice: "9.750", Quantity: "0.999"},
+		},
+		{
+			name:  "stop raised to the stop limit",
+			price: "10.2", stopPrice: "9.7474", stopLimitPrice: "9.7476", quantity: "1",
+			want: OCORequest{Price: "10.200", StopPrice: "9.750", StopLimitPrice: "9.750", Quantity: "1.000"},
+		},
+		{
+			name:  "take profit clamped into the ask band",
+			price: "20", stopPrice: "9.5", stopLimitPrice: "9.4", quantity: "1",
+			want: OCORequest{Price: "15.000", StopPrice: "9.500", StopLimitPrice: "9.400", Quantity: "1.000"},
+		},
+		{
+			name:  "take profit not above the stop after rounding",
+			price: "9.801", stopPrice: "9.8", stopLimitPrice: "9.79", quantity: "1",
+			err: "take profit 9.800 is not above the stop 9.800 after rounding",
+		},
+		{
+			name:  "notional too small at the stop limit",
+			price: "10.2", stopPrice: "9.6", stopLimitPrice: "9.5", quantity: "0.52",
+			err: "notional 4.94000000 is below the minimum 5",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			oco, err := rules.AdjustOCOSell(dec(test.price), dec(test.stopPrice), dec(test.stopLimitPrice), dec(test.quantity), dec("10"))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error = %v, want %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if oco.Price != test.want.Price || oco.StopPrice != test.want.StopPrice || oco.StopLimitPrice != test.want.StopLimitPrice || oco.Quantity != test.want.Quantity {
+				t.Errorf("OCO = %+v, want %+v", oco, test.want)
+			}
+			if oco.Symbol != "AAAUSDT" || oco.Side != binance.SideTypeSell || oco.StopLimitTimeInForce != binance.TimeInForceTypeGTC {
+				t.Errorf("OCO = %+v, want a GTC sell of AAAUSDT", oco)
+			}
+		})
+	}
+}
+
+func TestSplitQuantity(t *testing.T) {
+	tests := []struct {
+		name     string
+		quantity string
+		percents []float64
+		price    string
+		want     []string
+		err      string
+	}{
+		{"every part sellable", "3", []float64{40, 40, 20}, "10", []string{"1.2", "1.2", "0.6"}, ""},
+		{"rounding left over goes last", "1.0001", []float64{33.3, 33.3, 33.4}, "100", []string{"0.333", "0.333", "0.334"}, ""},
+		{"one part", "0.9999", []float64{100}, "10", []string{"0.999"}, ""},
+		{"small part folds into the next", "2", []float64{30, 10, 60}, "10", []string{"0.6", "0", "1.4"}, ""},
+		{"small last part folds into the closest before it", "2", []float64{60, 35, 5}, "10", []string{"1.2", "0.8", "0"}, ""},
+		{"small parts fold through to the middle", "1", []float64{40, 40, 20}, "10", []string{"0", "1", "0"}, ""},
+		{"below minQty folds", "0.5", []float64{1, 99}, "100", []string{"0", "0.5"}, ""},
+		{"too small for one part", "0.3", []float64{50, 50}, "10", nil, "quantity 0.300 is too small to split"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parts, err := testRules().SplitQuantity(dec(test.quantity), test.percents, dec(test.price))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error = %v, want %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(parts) != len(test.want) {
+				t.Fatalf("parts = %v, want %v", parts, test.want)
+			}
+			for i := range parts {
+				if !parts[i].Equal(dec(test.want[i])) {
+					t.Fatalf("parts = %v, want %v", parts, test.want)
+				}
+			}
+		})
+	}
+}
@@ -7,9 +7,10 @@ import (
 )
 
 func sendTelegramMessage(title string, upperParameters, lowerParameters map[string]Parameters) {
-	bot, err := tgbotapi.NewBotAPI(BOT_TOKEN)
+	bot, err := tgbotapi.NewBotAPI(config.Telegram.BotToken)
 	if err != nil {
 		fmt.Println(err)
+		return
 	}
 
 	lengthUptrend := len(upperParameters)
@@ -17,21 +18,46 @@ func sendTelegramMessage(title string, upperParameters, lowerParameters map[stri
 
 	message := fmt.Sprintf("["+title+"]"+"\n\n ✅ Got %v coins alert uptrend!", lengthUptrend)
 	if lengthUptrend > 0 {
-		for coin, _ := range upperParameters {
-			message += "\n" + coin
+		for coin, parameter := range upperParameters {
+			message += "\n" + coin + describePatterns(parameter)
 		}
 	}
 
 	message = fmt.Sprintf(message+"\n\n ⛔ Got %v coins alert downtrend!", lengthDowntrend)
 	if lengthDowntrend > 0 {
-		for coin, _ := range lowerParameters {
-			message += "\n" + coin
+		for coin, parameter := range lowerParameters {
+			message += "\n" + coin + describePatterns(parameter)
 		}
 	}
 
-	msg := tgbotapi.NewMessage(RECEIVER_USER_ID, message)
+	msg := tgbotapi.NewMessage(config.Telegram.ReceiverUserID, message)
 	_, err = bot.Send(msg)
 	if err != nil {
 		fmt.Println(err)
 	}
 }
+
+// sendTelegramNotice sends a one-off message under a title, like the
+// "[RISK]" notices of the risk manager.
+func sendTelegramNotice(title, message string) {
+	bot, err := tgbotapi.NewBotAPI(config.Telegram.BotToken)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	msg := tgbotapi.NewMessage(config.Telegram.ReceiverUserID, "["+title+"]\n\n "+message)
+	_, err = bot.Send(msg)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+// describePatterns is the " (hammer 0.80)" suffix of an alerted coin, empty
+// when no candlestick pattern formed.
+func describePatterns(parameter Parameters) string {
+	if len(parameter.Patterns) == 0 {
+		return ""
+	}
+	return " (" + formatPatterns(parameter.Patterns) + ")"
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/shopspring/decimal"
+)
+
+// initialTrailingStop is where a trailing stop starts: the strategy's
+// ordinary stop loss below the entry.
+func initialTrailingStop(trading TradingConfig, entryPrice float64) float64 {
+	return entryPrice * (1 - trading.StopLossPercent/100)
+}
+
+// startTrailingStop opens a trailing stop trade for quantity of what the buy
+// order got. Nothing rests on the exchange: the price monitor sells at
+// market once the price falls through the stop, so the buy's own client
+// order ID is kept as the trade's order ID. A quantity a market sell
+// cannot take, below LOT_SIZE or the minimum notional, still stays under the
+// trailing stop, and is sent to Telegram as it may have to be sold by hand.
+func startTrailingStop(symbolRules SymbolRules, trading TradingConfig, buyOrder Order, quantity decimal.Decimal) TradingDetails {
+	averageBuyPrice := buyOrder.AveragePrice()
+	quantity, err := symbolRules.AdjustMarketQuantity(quantity, averageBuyPrice)
+	stop := symbolRules.FloorPrice(decimal.NewFromFloat(initialTrailingStop(trading, averageBuyPrice.InexactFloat64())))
+
+	trade := TradingDetails{
+		OrderID:     buyOrder.ClientOrderID,
+		Quantity:    symbolRules.FormatQuantity(quantity),
+		SellPrice:   symbolRules.FormatPrice(stop),
+		OrderListID: -1,
+		HighPrice:   symbolRules.FormatPrice(averageBuyPrice),
+		TrailStop:   symbolRules.FormatPrice(stop),
+	}
+	if err != nil {
+		message := fmt.Sprintf("%s: bought %s but a market sell cannot take it: %v\nThe trailing stop keeps watching it, sell it by hand if it cannot", symbolRules.Symbol, trade.Quantity, err)
+		fmt.Println("[ERROR]", message)
+		sendTelegramNotice("TRAILING STOP", message)
+	}
+
+	fmt.Println("[TRAILING STOP] ", symbolRules.Symbol, " STOP: ", trade.TrailStop, trade.Quantity)
+	return trade
+}
+
+// raiseTrailingStop moves stop up behind high, the highest price since
+// entry: trailing_atr_multiple ATRs below it when set, trailing_percent
+// below otherwise. The stop never moves down, and an ATR of 0 (not enough
+// candles yet) leaves it where it is.
+func raiseTrailingStop(trading TradingConfig, high, stop, atr float64) float64 {
+	var level float64
+	if trading.TrailingATRMultiple > 0 {
+		if atr <= 0 {
+			return stop
+		}
+		level = high - trading.TrailingATRMultiple*atr
+	} else {
+		level = high * (1 - trading.TrailingPercent/100)
+	}
+	return math.Max(stop, level)
+}
+
+// monitorKlines is how many candles the price monitor needs for a trade:
+// the latest one for the price, plus enough closed ones to warm up the ATR
+// when it trails by one.
+func monitorKlines(trade TradingDetails) int {
+	trading := strategyTrading(trade.Strategy)
+	if trade.TrailStop == "" || trading.TrailingATRMultiple <= 0 {
+		return 1
+	}
+	return 3*trading.TrailingATRPeriod + 1
+}
+
+// monitorQuote is what the price monitor knows of a symbol: the latest
+// price, the high of the latest candle and the closed candles before it.
+type monitorQuote struct {
+	Price  float64
+	High   float64
+	Closed []Candle
+}
+
+// ATR is the ATR of the closed candles, 0 when there are not enough.
+func (q monitorQuote) ATR(period int) float64 {
+	return candlesATR(q.Closed, period)
+}
+
+// checkTrailingStop sells a trailing stop trade at market when the price is
+// below its stop, and otherwise raises the stop behind the highest price
+// and saves both when they moved. Stops are rounded to the tick when the
+// symbol's rules are known.
+func checkTrailingStop(exchange Exchange, store Store, trade TradingDetails, quote monitorQuote, rules SymbolRules, hasRules bool) {
+	trading := strategyTrading(trade.Strategy)
+
+	stop, err := strconv.ParseFloat(trade.TrailStop, 64)
+	if err != nil {
+		fmt.Println("[ERROR]", trade.Pair, "trailing stop", trade.TrailStop, "is not a number")
+		return
+	}
+	high, err := strconv.ParseFloat(trade.HighPrice, 64)
+	if err != nil {
+		high = trade.BuyPrice
+	}
+
+	if quote.Price < stop {
+		fmt.Println("[TRAILING STOP]", trade.Pair, trade.BuyPrice, high, stop, quote.Price)
+		sellTrailingStop(exchange, store, trade, quote.Price, rules, hasRules)
+		return
+	}
+
+	newHigh := math.Max(high, quote.High)
+	newStop := raiseTrailingStop(trading, newHigh, stop, quote.ATR(trading.TrailingATRPeriod))
+	if newHigh == high && newStop == stop {
+		return
+	}
+
+	highPrice := strconv.FormatFloat(newHigh, 'f', -1, 64)
+	trailStop := strconv.FormatFloat(newStop, 'f', -1, 64)
+	if hasRules {
+		highPrice = rules.FormatPrice(decimal.NewFromFloat(newHigh))
+		trailStop = rules.FormatPrice(rules.FloorPrice(decimal.NewFromFloat(newStop)))
+		if trailStop == trade.TrailStop && highPrice == trade.HighPrice {
+			return
+		}
+	}
+	if err := store.UpdateTradeTrail(trade, highPrice, trailStop); err != nil {
+		fmt.Println("[ERROR]", err)
+		return
+	}
+	if trailStop != trade.TrailStop {
+		fmt.Println("[TRAIL]", trade.Pair, "high", highPrice, "stop", trade.TrailStop, "->", trailStop)
+	}
+}
+
+// sellTrailingStop closes a trailing stop trade. There is no exit order to
+// poll, so the trade is marked FILLED here with the price the sell got.
+func sellTrailingStop(exchange Exchange, store Store, trade TradingDetails, price float64, rules SymbolRules, hasRules bool) {
+	quantity, err := decimal.NewFromString(trade.Quantity)
+	if err != nil {
+		fmt.Println("[ERROR]", trade.Pair, "quantity", trade.Quantity, "is not a number")
+		return
+	}
+	sellQuantity := trade.Quantity
+	if hasRules {
+		quantity, err = rules.AdjustMarketQuantity(quantity, decimal.NewFromFloat(price))
+		if err != nil {
+			fmt.Println("[ERROR] cannot trailing stop", err)
+			return
+		}
+		sellQuantity = rules.FormatQuantity(quantity)
+	}
+
+	sellMarketResponse, err := exchange.CreateOrder(context.Background(), OrderRequest{
+		Symbol:   trade.Pair,
+		Side:     binance.SideTypeSell,
+		Type:     binance.OrderTypeMarket,
+		Quantity: sellQuantity,
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	sellOrder, err := orderFromResponse(sellMarketResponse)
+	if err != nil {
+		fmt.Println("[ERROR]", err)
+		return
+	}
+
+	store.UpdateTradeSellPrice(trade, sellOrder.AveragePrice().String())
+	store.UpdateTradeExit(trade, EXIT_TRAILING_STOP)
+	store.UpdateTradeStatus(trade, string(binance.OrderStatusTypeFilled))
+	reportClosedPosition(store, trade.PositionID)
+}
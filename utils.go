@@ -1,8 +1,12 @@
 package main
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/MicahParks/go-rsi/v2"
-	"github.com/adshao/go-binance/v2"
+	"github.com/dzakyputra/binance/indicators"
+	"github.com/dzakyputra/binance/patterns"
 )
 
 // Parameters
@@ -32,18 +36,34 @@ func calculateVolumdeDiff(volumes []float64) float64 {
 	return ((after - before) / before) * 100
 }
 
-func isGulfingCandles(klines []*binance.Kline) bool {
-	currentPrice, previous1Price, previous2Price := klines[len(klines)-1], klines[len(klines)-2], klines[len(klines)-3]
-	if previous2Price.Close > previous2Price.Open {
+// isGulfingCandles reports a bullish engulfing on the two candles before the
+// latest one, confirmed by the latest closing above it.
+func isGulfingCandles(bars []indicators.Bar) bool {
+	if len(bars) < 3 {
 		return false
 	}
-	if previous1Price.Close < previous1Price.Open {
-		return false
+	current, previous := bars[len(bars)-1], bars[len(bars)-2]
+	return patterns.BullishEngulfing(bars[:len(bars)-1]) > 0 && current.Close > previous.Close
+}
+
+// patternConfidence is the confidence of the named pattern among matches, 0
+// when it was not found.
+func patternConfidence(matches []patterns.Match, name string) float64 {
+	for _, match := range matches {
+		if match.Name == name {
+			return match.Confidence
+		}
 	}
-	if (previous1Price.Open < previous2Price.Close) && (previous1Price.Close > previous2Price.Open) && (currentPrice.Close > previous1Price.Close) {
-		return true
+	return 0
+}
+
+// formatPatterns lists matches as "name 0.80, name 0.65".
+func formatPatterns(matches []patterns.Match) string {
+	var parts []string
+	for _, match := range matches {
+		parts = append(parts, fmt.Sprintf("%s %.2f", match.Name, match.Confidence))
 	}
-	return false
+	return strings.Join(parts, ", ")
 }
 
 // Others
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// rsiCloses is the worked example on StockCharts' RSI page; wantRSI is
+// Wilder's RSI(14) of those closes from the fifteenth on, evaluated exactly
+// and rounded to four decimals.
+var (
+	rsiCloses = []float64{
+		44.34, 44.09, 44.15, 43.61, 44.33, 44.83, 45.10, 45.42, 45.84, 46.08,
+		45.89, 46.03, 45.61, 46.28, 46.28, 46.00, 46.03, 46.41, 46.22, 45.64,
+		46.21, 46.25, 45.71, 46.45, 45.78, 45.35, 44.03, 44.18, 44.22, 44.57,
+		43.42, 42.66, 43.13,
+	}
+	wantRSI = []float64{
+		70.4641, 66.2496, 66.4809, 69.3469, 66.2947, 57.9150, 62.8807,
+		63.2088, 56.0116, 62.3399, 54.6710, 50.3868, 40.0194, 41.4926,
+		41.9024, 45.4995, 37.3228, 33.0905, 37.7888,
+	}
+)
+
+// calculateRelativeStrengthIndex seeds go-rsi with period closes, which is
+// period - 1 changes, and drops the last candle because it is still open, so
+// Wilder's RSI(14) at a close is period 15 over the closes up to it plus one
+// more.
+func TestCalculateRelativeStrengthIndex(t *testing.T) {
+	const openCandle = 1000
+	for i, want := range wantRSI {
+		last := 14 + i
+		prices := append(append([]float64{}, rsiCloses[:last+1]...), openCandle)
+		got := calculateRelativeStrengthIndex(prices, 15)
+		if math.Abs(got-want) > 1e-4 {
+			t.Errorf("RSI at close %d = %.4f, want %.4f", last, got, want)
+		}
+	}
+}